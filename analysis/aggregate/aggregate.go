@@ -97,6 +97,23 @@ func (s *Sum) Reset() {
 	s.sum = 0
 }
 
+// Count returns the number of data points aggregated.
+type Count struct {
+	count int64
+}
+
+func (c *Count) Add(n int64) {
+	c.count++
+}
+
+func (c *Count) Result() int64 {
+	return c.count
+}
+
+func (c *Count) Reset() {
+	c.count = 0
+}
+
 // Mean returns the arithmetic mean of the aggregated data.
 type Mean struct {
 	sum   int64
@@ -157,7 +174,7 @@ func (p *Percentile) Reset() {
 // IsValidAgg returns true if desc is a valid descriptor for an aggregator type.
 func IsValidAgg(desc string) bool {
 	switch desc {
-	case "max", "min", "mean", "avg", "sum":
+	case "max", "min", "mean", "avg", "sum", "count", "distinct", "top":
 		return true
 
 	default:
@@ -200,6 +217,15 @@ func NewFactoryFromDescriptor(desc string) (AggregatorFactory, error) {
 	case "sum":
 		return func() Aggregator { return &Sum{} }, nil
 
+	case "count":
+		return func() Aggregator { return &Count{} }, nil
+
+	case "distinct":
+		return func() Aggregator { return &Distinct{} }, nil
+
+	case "top":
+		return func() Aggregator { return &Top{} }, nil
+
 	default:
 		if len(desc) >= 3 && desc[0] == 'p' {
 			return percentileFactoryFromDescriptor(desc)
@@ -0,0 +1,96 @@
+package aggregate
+
+import (
+	"math"
+)
+
+const (
+	// distinctExactLimit is the number of distinct values Distinct counts
+	// exactly before switching to an estimate.
+	distinctExactLimit = 64
+	// distinctPrecision is the number of hash bits used to select a
+	// HyperLogLog register, giving 1024 registers and a standard error of
+	// about 3%.
+	distinctPrecision = 10
+	distinctRegisters = 1 << distinctPrecision
+)
+
+// Distinct returns the number of distinct values in the aggregated data.
+// Small counts are exact.  Beyond distinctExactLimit values the count is a
+// HyperLogLog estimate, keeping memory per key bounded.
+type Distinct struct {
+	exact     []uint64
+	registers []uint8
+}
+
+func (d *Distinct) Add(n int64) {
+	h := mix64(uint64(n))
+	if d.registers != nil {
+		d.addHashed(h)
+		return
+	}
+	for _, v := range d.exact {
+		if v == h {
+			return
+		}
+	}
+	if len(d.exact) < distinctExactLimit {
+		d.exact = append(d.exact, h)
+		return
+	}
+	d.registers = make([]uint8, distinctRegisters)
+	for _, v := range d.exact {
+		d.addHashed(v)
+	}
+	d.exact = d.exact[:0]
+	d.addHashed(h)
+}
+
+func (d *Distinct) addHashed(h uint64) {
+	idx := h >> (64 - distinctPrecision)
+	// position of the first set bit in the remaining bits, counting from 1
+	rank := uint8(1)
+	for rest := h << distinctPrecision; rest&(1<<63) == 0 && rank <= 64-distinctPrecision; rest <<= 1 {
+		rank++
+	}
+	if rank > d.registers[idx] {
+		d.registers[idx] = rank
+	}
+}
+
+func (d *Distinct) Result() int64 {
+	if d.registers == nil {
+		return int64(len(d.exact))
+	}
+	m := float64(distinctRegisters)
+	var sum float64
+	var zeros int
+	for _, r := range d.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(estimate + 0.5)
+}
+
+func (d *Distinct) Reset() {
+	d.exact = d.exact[:0]
+	d.registers = nil
+}
+
+// mix64 scrambles the bits of x so that similar inputs, such as consecutive
+// integers, fall in unrelated registers.  It is the finalizer of SplitMix64.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -23,6 +23,24 @@ func fieldIDFromDescriptor(desc string) (model.EventFieldMask, error) {
 		return model.FieldKey, nil
 	case "size":
 		return model.FieldSize, nil
+	case "hit":
+		return model.FieldHit, nil
+	case "miss":
+		return model.FieldMiss, nil
+	case "reqsize":
+		return model.FieldRequestSize, nil
+	case "client":
+		return model.FieldClient, nil
+	case "multi":
+		return model.FieldMultiGet, nil
+	case "expmiss":
+		return model.FieldExpiryMiss, nil
+	case "coldmiss":
+		return model.FieldColdMiss, nil
+	case "server":
+		return model.FieldServer, nil
+	case "conn":
+		return model.FieldConn, nil
 	default:
 		return 0, BadDescriptorError(desc)
 	}
@@ -53,8 +71,16 @@ func fieldAsString(e model.Event, id model.EventFieldMask) string {
 	switch id {
 	case model.FieldKey:
 		return e.Key
+	case model.FieldClient:
+		return e.Client
+	case model.FieldServer:
+		return e.Server
+	case model.FieldConn:
+		return e.Conn
 	case model.FieldSize:
 		return strconv.Itoa(e.Size)
+	case model.FieldHit, model.FieldMiss, model.FieldRequestSize, model.FieldMultiGet, model.FieldExpiryMiss, model.FieldColdMiss:
+		return strconv.FormatInt(fieldAsInt64(e, id), 10)
 	default:
 		panic("bad fieldId")
 	}
@@ -64,7 +90,45 @@ func fieldAsInt64(e model.Event, id model.EventFieldMask) int64 {
 	switch id {
 	case model.FieldSize:
 		return int64(e.Size)
+	case model.FieldHit:
+		return boolAsInt64(e.Type == model.EventGetHit)
+	case model.FieldMiss:
+		return boolAsInt64(e.Type == model.EventGetMiss)
+	case model.FieldRequestSize:
+		return int64(e.RequestSize)
+	case model.FieldMultiGet:
+		return boolAsInt64(e.BatchSize > 1)
+	case model.FieldExpiryMiss:
+		return boolAsInt64(e.Type == model.EventGetMiss && e.Expired)
+	case model.FieldColdMiss:
+		return boolAsInt64(e.Type == model.EventGetMiss && !e.Expired)
+	case model.FieldKey:
+		return hashString(e.Key)
+	case model.FieldClient:
+		return hashString(e.Client)
+	case model.FieldServer:
+		return hashString(e.Server)
+	case model.FieldConn:
+		return hashString(e.Conn)
 	default:
 		panic("bad fieldId")
 	}
 }
+
+// hashString returns the FNV-1a hash of s, so that string fields can be
+// counted by Distinct and Top.
+func hashString(s string) int64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return int64(h)
+}
+
+func boolAsInt64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -62,8 +62,9 @@ func NewKeyAggregatorFactory(desc string) (KeyAggregatorFactory, error) {
 			kaf.KeyFields = append(kaf.KeyFields, field)
 			kaf.keyFieldMask |= fieldID
 		} else {
-			// can aggregate integer fields only
-			if fieldID&model.IntFields == 0 {
+			// can aggregate integer fields only, though any field can be
+			// counted by its distinct values or its most frequent
+			if fieldID&model.IntFields == 0 && aggDesc != "distinct" && aggDesc != "top" {
 				return KeyAggregatorFactory{}, BadDescriptorError(field)
 			}
 			aggFactory, err := NewFactoryFromDescriptor(aggDesc)
@@ -76,6 +76,107 @@ func TestPercentile(t *testing.T) {
 	}
 }
 
+func TestCount(t *testing.T) {
+	kaf, err := NewKeyAggregatorFactory("key,count(size)")
+	if err != nil {
+		t.Error(err)
+	}
+
+	ka := kaf.New()
+	for _, e := range eventsWithSizes(0, 10, 20) {
+		ka.Add(e)
+	}
+
+	res := ka.Result()
+	if len(res) != 1 || res[0] != 3 {
+		t.Error("count:", res)
+	}
+}
+
+func TestDistinctClients(t *testing.T) {
+	kaf, err := NewKeyAggregatorFactory("key,distinct(client)")
+	if err != nil {
+		t.Error(err)
+	}
+
+	ka := kaf.New()
+	for _, c := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.3"} {
+		ka.Add(model.Event{Type: model.EventGetHit, Key: "key1", Client: c})
+	}
+
+	res := ka.Result()
+	if len(res) != 1 || res[0] != 3 {
+		t.Error("distinct:", res)
+	}
+}
+
+func TestDistinctOnlyAggregatesStrings(t *testing.T) {
+	if _, err := NewKeyAggregatorFactory("key,sum(client)"); err == nil {
+		t.Error("expected error summing client")
+	}
+}
+
+func TestDistinctEstimate(t *testing.T) {
+	for _, n := range []int64{distinctExactLimit + 1, 1000, 100000} {
+		var d Distinct
+		for i := int64(0); i < n; i++ {
+			d.Add(i)
+			d.Add(i)
+		}
+		res := d.Result()
+		if res < n*95/100 || res > n*105/100 {
+			t.Errorf("distinct of %d values estimated as %d", n, res)
+		}
+		d.Reset()
+		if res := d.Result(); res != 0 {
+			t.Error("after reset:", res)
+		}
+	}
+}
+
+func TestTopConns(t *testing.T) {
+	kaf, err := NewKeyAggregatorFactory("key,top(client),top(conn)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ka := kaf.New()
+	for i := 0; i < 10; i++ {
+		conn := "10.0.0.1:40000"
+		if i%5 == 0 {
+			conn = "10.0.0.1:40001"
+		}
+		ka.Add(model.Event{Type: model.EventGetHit, Key: "key1", Client: "10.0.0.1", Conn: conn})
+	}
+	if res := ka.Result(); len(res) != 2 || res[0] != 100 || res[1] != 80 {
+		t.Error("top:", res)
+	}
+}
+
+func TestTopEstimate(t *testing.T) {
+	var tp Top
+	// one caller among a thousand others, each seen once
+	for i := int64(0); i < 1000; i++ {
+		tp.Add(-1)
+		tp.Add(-1)
+		tp.Add(-1)
+		tp.Add(i)
+	}
+	if res := tp.Result(); res < 75-100/topCounters || res > 75 {
+		t.Error("dominant value:", res)
+	}
+	tp.Reset()
+	for i := int64(0); i < 1000; i++ {
+		tp.Add(i % 100)
+	}
+	if res := tp.Result(); res > 1 {
+		t.Error("even spread:", res)
+	}
+	tp.Reset()
+	if res := tp.Result(); res != 0 {
+		t.Error("after reset:", res)
+	}
+}
+
 func eventsWithSizes(sizes ...int) []model.Event {
 	res := make([]model.Event, len(sizes))
 	for i, s := range sizes {
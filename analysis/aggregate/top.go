@@ -0,0 +1,66 @@
+package aggregate
+
+// topCounters is the number of values Top counts at once.  A value making up
+// more than 1/topCounters of the data is always among them.
+const topCounters = 8
+
+// topCounter is the count of one value, which may have replaced others
+// counted before it, as many as err.
+type topCounter struct {
+	value      int64
+	count, err int64
+}
+
+// Top returns the percentage of the aggregated data made up by its most
+// frequent value, such as the share of the requests for a key made by its
+// busiest client.  Values are counted by the Space-Saving algorithm in
+// topCounters counters, so the share is exact for up to topCounters distinct
+// values and otherwise a lower bound, low by at most 100/topCounters.  A
+// value dominating the data is never missed, and traffic spread evenly is
+// never shown as dominated.
+type Top struct {
+	counters []topCounter
+	total    int64
+}
+
+func (t *Top) Add(n int64) {
+	t.total++
+	least := -1
+	for i := range t.counters {
+		c := &t.counters[i]
+		if c.value == n {
+			c.count++
+			return
+		}
+		if least < 0 || c.count < t.counters[least].count {
+			least = i
+		}
+	}
+	if len(t.counters) < topCounters {
+		t.counters = append(t.counters, topCounter{value: n, count: 1})
+		return
+	}
+	// the least counted value gives way, its count becoming the error of
+	// the new one
+	c := &t.counters[least]
+	c.value, c.err = n, c.count
+	c.count++
+}
+
+func (t *Top) Result() int64 {
+	if t.total == 0 {
+		return 0
+	}
+	var top int64
+	for _, c := range t.counters {
+		if guaranteed := c.count - c.err; guaranteed > top {
+			top = guaranteed
+		}
+	}
+	return top * 100 / t.total
+}
+
+func (t *Top) Reset() {
+	t.counters = t.counters[:0]
+	t.total = 0
+}
@@ -0,0 +1,66 @@
+package analysis
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// batchTracker counts retrievals of keys requested alone and alongside other
+// keys, over the same window as each report.  batchTracker is threadsafe.
+type batchTracker struct {
+	sync.Mutex
+	// sinceSingle and sinceMulti are the counts at the start of the current
+	// window.
+	sinceSingle, sinceMulti int64
+}
+
+// countBatches adds the retrievals in evts to the totals in s.  Events from
+// requests of unknown size are not counted.
+func countBatches(s *Stats, evts []model.Event) {
+	var single, multi int64
+	for _, e := range evts {
+		switch {
+		case e.BatchSize == 1:
+			single++
+		case e.BatchSize > 1:
+			multi++
+		}
+	}
+	if single > 0 {
+		atomic.AddInt64(&s.KeysSingleGet, single)
+	}
+	if multi > 0 {
+		atomic.AddInt64(&s.KeysMultiGet, multi)
+	}
+}
+
+// window returns the retrievals counted since the start of the current window.
+// If shouldReset is true, a new window begins.
+func (bt *batchTracker) window(s *Stats, shouldReset bool) (single, multi int64) {
+	bt.Lock()
+	defer bt.Unlock()
+	nowSingle := atomic.LoadInt64(&s.KeysSingleGet)
+	nowMulti := atomic.LoadInt64(&s.KeysMultiGet)
+	single, multi = nowSingle-bt.sinceSingle, nowMulti-bt.sinceMulti
+	if shouldReset {
+		bt.sinceSingle, bt.sinceMulti = nowSingle, nowMulti
+	}
+	return single, multi
+}
+
+// MultiGetFraction returns the fraction of keys retrieved as part of a
+// multi-key request over the period covered by r, or 0 if no retrievals were
+// counted.
+func (r Report) MultiGetFraction() float64 {
+	return fraction(r.KeysMultiGet, r.KeysSingleGet+r.KeysMultiGet)
+}
+
+// percentOf returns n as a rounded percentage of d, or 0 if d is 0.
+func percentOf(n, d int64) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return (200*n + d) / (2 * d)
+}
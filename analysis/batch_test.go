@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func batchEvents(sizes ...int) []model.Event {
+	evts := make([]model.Event, len(sizes))
+	for i, n := range sizes {
+		evts[i] = model.Event{Type: model.EventGetHit, Key: "k", BatchSize: n}
+	}
+	return evts
+}
+
+func TestBatchWindows(t *testing.T) {
+	var s Stats
+	var bt batchTracker
+
+	countBatches(&s, batchEvents(1, 3, 3, 3, 0))
+	if single, multi := bt.window(&s, true); single != 1 || multi != 3 {
+		t.Error("first window:", single, multi)
+	}
+	countBatches(&s, batchEvents(1, 1))
+	if single, multi := bt.window(&s, false); single != 2 || multi != 0 {
+		t.Error("second window:", single, multi)
+	}
+	countBatches(&s, batchEvents(2, 2))
+	if single, multi := bt.window(&s, true); single != 2 || multi != 2 {
+		t.Error("second window:", single, multi)
+	}
+	if single, multi := bt.window(&s, true); single != 0 || multi != 0 {
+		t.Error("empty window:", single, multi)
+	}
+	if s.KeysSingleGet != 3 || s.KeysMultiGet != 5 {
+		t.Error("totals:", s.KeysSingleGet, s.KeysMultiGet)
+	}
+}
+
+func TestMultiGetFraction(t *testing.T) {
+	if f := (Report{}).MultiGetFraction(); f != 0 {
+		t.Error("empty report:", f)
+	}
+	if f := (Report{KeysSingleGet: 1, KeysMultiGet: 3}).MultiGetFraction(); !closeTo(f, 0.75) {
+		t.Error(f)
+	}
+}
+
+func TestMultiGetColumn(t *testing.T) {
+	p, err := New(1, "key,multi%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// hidden sum(multi), count(size)
+	if res := p.withDerived([]int64{2, 3}, OpCounts{}); len(res) != 1 || res[0] != 67 {
+		t.Error(res)
+	}
+	if res := p.withDerived([]int64{0, 0}, OpCounts{}); res[0] != 0 {
+		t.Error(res)
+	}
+}
+
+func TestHandleEventsCountsBatches(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.SetFilterPattern("^none$"); err != nil {
+		t.Fatal(err)
+	}
+	p.HandleEvents(batchEvents(1, 2, 2))
+
+	rep := p.Report(true)
+	if rep.KeysSingleGet != 1 || rep.KeysMultiGet != 2 {
+		t.Error("filtered events not counted:", rep.KeysSingleGet, rep.KeysMultiGet)
+	}
+	if rep = p.Report(true); rep.KeysSingleGet != 0 || rep.KeysMultiGet != 0 {
+		t.Error("counts carried over:", rep.KeysSingleGet, rep.KeysMultiGet)
+	}
+}
@@ -0,0 +1,63 @@
+package analysis
+
+import "hash/fnv"
+
+// bloomBitsPerKey and bloomHashes size a bloomFilter for a false positive
+// rate of about 1% at its expected number of keys.
+const (
+	bloomBitsPerKey = 10
+	bloomHashes     = 7
+)
+
+// bloomFilter is a set of keys that may report a key absent from it as
+// present, but never the reverse, in a fraction of the memory of the keys.
+type bloomFilter struct {
+	bits []uint64
+}
+
+// newBloomFilter returns an empty bloomFilter sized for n keys.
+func newBloomFilter(n int) *bloomFilter {
+	words := (n*bloomBitsPerKey + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	return &bloomFilter{bits: make([]uint64, words)}
+}
+
+// positions calls f with each bit position of key, derived from two halves of
+// its hash as described by Kirsch and Mitzenmacher.
+func (bf *bloomFilter) positions(key string, f func(word int, mask uint64)) {
+	h := fnv.New64a()
+	// writing to a Hash can never fail
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)
+	m := uint64(len(bf.bits)) * 64
+	for i := uint32(0); i < bloomHashes; i++ {
+		bit := uint64(h1+i*h2) % m
+		f(int(bit/64), 1<<(bit%64))
+	}
+}
+
+// add adds key to the set, returning false if it was already present.
+func (bf *bloomFilter) add(key string) bool {
+	added := false
+	bf.positions(key, func(word int, mask uint64) {
+		if bf.bits[word]&mask == 0 {
+			bf.bits[word] |= mask
+			added = true
+		}
+	})
+	return added
+}
+
+// contains returns true if key is probably in the set.
+func (bf *bloomFilter) contains(key string) bool {
+	found := true
+	bf.positions(key, func(word int, mask uint64) {
+		if bf.bits[word]&mask == 0 {
+			found = false
+		}
+	})
+	return found
+}
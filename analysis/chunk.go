@@ -0,0 +1,222 @@
+package analysis
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// DefaultChunkWindow is how long after a chunk of a value is retrieved on a
+// connection another chunk of the same value counts as part of the same
+// fetch.
+const DefaultChunkWindow = 100 * time.Millisecond
+
+var errChunkGroup = errors.New("chunk pattern must capture the key of the value, such as ^(.*)/[0-9]+$")
+
+// ChunkFanout describes the chunks in which a value split across several keys
+// has been retrieved.
+type ChunkFanout struct {
+	// Keys are up to 8 of the chunk keys most recently seen, oldest first.
+	Keys []string
+	// Fetches is the number of retrievals of the value, counting the
+	// chunks retrieved together on a connection once, and Chunks the
+	// number of chunks they retrieved.
+	Fetches int64
+	Chunks  int64
+}
+
+// chunkFetch identifies the retrieval of a value on a connection.
+type chunkFetch struct {
+	conn, parent string
+}
+
+// pendingFetch is the retrieval of a value whose chunks may still be arriving.
+type pendingFetch struct {
+	evt    model.Event
+	last   time.Time
+	chunks int64
+}
+
+// add includes the retrieval of another chunk in pf.  The value is a miss if
+// any chunk of it missed.
+func (pf *pendingFetch) add(e model.Event, at time.Time) {
+	pf.evt.Size += e.Size
+	pf.evt.RequestSize += e.RequestSize
+	if e.Type == model.EventGetMiss {
+		pf.evt.Type = model.EventGetMiss
+	}
+	pf.evt.Expired = pf.evt.Expired || e.Expired
+	if e.Timestamp.After(pf.evt.Timestamp) {
+		pf.evt.Timestamp = e.Timestamp
+	}
+	if e.Latency > pf.evt.Latency {
+		pf.evt.Latency = e.Latency
+	}
+	pf.last = at
+	pf.chunks++
+}
+
+// chunkStage replaces the keys of chunks of values split across several keys
+// with the key of the value, and combines the retrievals of chunks of a value
+// on a connection, each within the window of the last, into a single
+// retrieval of their total size.  Combined retrievals are held back until the
+// window has passed.  chunkStage is threadsafe.
+type chunkStage struct {
+	re     *regexp.Regexp
+	window time.Duration
+
+	sync.Mutex
+	pending map[chunkFetch]*pendingFetch
+	fanouts map[string]*ChunkFanout
+}
+
+func (cs *chunkStage) set(pattern string, window time.Duration) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	if re.NumSubexp() < 1 {
+		return errChunkGroup
+	}
+	cs.re, cs.window = re, window
+	cs.pending = make(map[chunkFetch]*pendingFetch)
+	cs.fanouts = make(map[string]*ChunkFanout)
+	return nil
+}
+
+// fold returns evts with chunks replaced by the values they are part of,
+// followed by the retrievals whose window has passed as of the latest event in
+// evts.  Events without a capture time are taken to have been captured at now.
+func (cs *chunkStage) fold(evts []model.Event, now time.Time) []model.Event {
+	if cs.re == nil || len(evts) == 0 {
+		return evts
+	}
+	cs.Lock()
+	defer cs.Unlock()
+	out := make([]model.Event, 0, len(evts))
+	var latest time.Time
+	for _, e := range evts {
+		m := cs.re.FindStringSubmatch(e.Key)
+		if m == nil || e.Type == model.EventTraffic || e.Type == model.EventUnattributed {
+			out = append(out, e)
+			continue
+		}
+		chunk := e.Key
+		e.Key = m[1]
+		cs.addKey(e.Key, chunk)
+		if e.Type != model.EventGetHit && e.Type != model.EventGetMiss {
+			// stores and deletions count once per chunk
+			out = append(out, e)
+			continue
+		}
+		at := e.Timestamp
+		if at.IsZero() {
+			at = now
+		}
+		if at.After(latest) {
+			latest = at
+		}
+		f := chunkFetch{e.Conn, e.Key}
+		pf, ok := cs.pending[f]
+		if ok && at.Sub(pf.last) <= cs.window {
+			pf.add(e, at)
+			continue
+		}
+		if ok {
+			out = append(out, cs.finish(f, pf))
+		}
+		cs.pending[f] = &pendingFetch{evt: e, last: at, chunks: 1}
+	}
+	for f, pf := range cs.pending {
+		if latest.Sub(pf.last) > cs.window {
+			out = append(out, cs.finish(f, pf))
+		}
+	}
+	return out
+}
+
+// flush returns the retrievals whose window has passed as of now, by capture
+// time, or every retrieval held back if all is true, so that they are counted
+// in the report being built.
+func (cs *chunkStage) flush(now time.Time, all bool) []model.Event {
+	if cs.re == nil {
+		return nil
+	}
+	cs.Lock()
+	defer cs.Unlock()
+	var out []model.Event
+	for f, pf := range cs.pending {
+		if all || now.Sub(pf.last) > cs.window {
+			out = append(out, cs.finish(f, pf))
+		}
+	}
+	return out
+}
+
+func (cs *chunkStage) finish(f chunkFetch, pf *pendingFetch) model.Event {
+	delete(cs.pending, f)
+	if cf, ok := cs.fanouts[f.parent]; ok {
+		cf.Fetches++
+		cf.Chunks += pf.chunks
+	}
+	return pf.evt
+}
+
+// addKey remembers chunk among the most recent chunks of parent, within the
+// same limits as the members of groups.
+func (cs *chunkStage) addKey(parent, chunk string) {
+	cf, ok := cs.fanouts[parent]
+	if !ok {
+		if len(cs.fanouts) >= maxGroupsTracked {
+			return
+		}
+		cf = &ChunkFanout{}
+		cs.fanouts[parent] = cf
+	}
+	for _, k := range cf.Keys {
+		if k == chunk {
+			return
+		}
+	}
+	if len(cf.Keys) < maxGroupMembers {
+		cf.Keys = append(cf.Keys, chunk)
+	} else {
+		cf.Keys = append(cf.Keys[1:], chunk)
+	}
+}
+
+func (cs *chunkStage) fanout(parent string) (ChunkFanout, bool) {
+	if cs.re == nil {
+		return ChunkFanout{}, false
+	}
+	cs.Lock()
+	defer cs.Unlock()
+	cf, ok := cs.fanouts[parent]
+	if !ok {
+		return ChunkFanout{}, false
+	}
+	fanout := *cf
+	fanout.Keys = append([]string(nil), cf.Keys...)
+	return fanout, true
+}
+
+// SetChunkPattern folds the keys of chunks of values split across several
+// keys, which match pattern, into the key of their value, which is the first
+// group captured by pattern, such as ^(.*)/[0-9]+$ for chunks user:1/0,
+// user:1/1 and so on of user:1.  The retrievals of chunks of a value on a
+// connection, each within window of the last, count as a single retrieval of
+// their total size.  Stores and deletions of chunks each count once.  The
+// chunks seen for each value are available from Chunks.  SetChunkPattern is
+// not threadsafe and should be called before the Pool is in use.
+func (p *Pool) SetChunkPattern(pattern string, window time.Duration) error {
+	return p.chunks.set(pattern, window)
+}
+
+// Chunks returns the chunks in which the value of key has been retrieved since
+// the Pool started, and whether any chunk of it has been seen.
+func (p *Pool) Chunks(key string) (ChunkFanout, bool) {
+	return p.chunks.fanout(key)
+}
@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func chunkGet(conn, key string, size int, at time.Time) model.Event {
+	return model.Event{Type: model.EventGetHit, Conn: conn, Key: key, Size: size, Timestamp: at}
+}
+
+func TestChunkFold(t *testing.T) {
+	var cs chunkStage
+	if err := cs.set("^([a-z]+)$", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.set("^[a-z]+/[0-9]+$", time.Second); err != errChunkGroup {
+		t.Error("pattern without group accepted:", err)
+	}
+	if err := cs.set(`^(.*)/[0-9]+$`, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	ms := func(n int) time.Time { return start.Add(time.Duration(n) * time.Millisecond) }
+
+	miss := chunkGet("c1", "big/2", 0, ms(20))
+	miss.Type = model.EventGetMiss
+	out := cs.fold([]model.Event{
+		chunkGet("c1", "big/0", 100, ms(0)),
+		chunkGet("c1", "big/1", 100, ms(10)),
+		// another connection fetches separately
+		chunkGet("c2", "big/0", 100, ms(15)),
+		miss,
+		chunkGet("c1", "small", 5, ms(20)),
+		{Type: model.EventSet, Conn: "c1", Key: "big/3", Size: 50, Timestamp: ms(25)},
+	}, start)
+	if len(out) != 2 || out[0].Key != "small" || out[1].Key != "big" || out[1].Type != model.EventSet {
+		t.Fatal("retrievals not held back:", out)
+	}
+
+	// each chunk extends the window, and the fetch ends once it passes
+	out = cs.fold([]model.Event{chunkGet("c1", "big/0", 100, ms(300))}, start)
+	if len(out) != 2 {
+		t.Fatal("fetches not ended by window:", out)
+	}
+	byConn := map[string]model.Event{out[0].Conn: out[0], out[1].Conn: out[1]}
+	if e := byConn["c1"]; e.Key != "big" || e.Size != 200 || e.Type != model.EventGetMiss || !e.Timestamp.Equal(ms(20)) {
+		t.Error("chunks not combined:", e)
+	}
+	if e := byConn["c2"]; e.Size != 100 || e.Type != model.EventGetHit {
+		t.Error("connections combined:", e)
+	}
+
+	if out := cs.flush(ms(350), false); len(out) != 0 {
+		t.Error("flushed within window:", out)
+	}
+	if out := cs.flush(ms(350), true); len(out) != 1 || out[0].Size != 100 {
+		t.Error("not flushed:", out)
+	}
+
+	cf, ok := cs.fanout("big")
+	want := ChunkFanout{Keys: []string{"big/0", "big/1", "big/2", "big/3"}, Fetches: 3, Chunks: 5}
+	if !ok || !reflect.DeepEqual(cf, want) {
+		t.Errorf("got %+v, want %+v", cf, want)
+	}
+	if _, ok := cs.fanout("small"); ok {
+		t.Error("fanout of unchunked key")
+	}
+}
+
+// TestChunkReport checks that the chunks of a value are reported as a single
+// retrieval of the value, including those still within their window when the
+// report is built.
+func TestChunkReport(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.SetChunkPattern(`^(.*)/[0-9]+$`, DefaultChunkWindow); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	p.HandleEvents([]model.Event{
+		chunkGet("c1", "user:1/0", 1000, now),
+		chunkGet("c1", "user:1/1", 1000, now),
+		chunkGet("c1", "user:1/2", 500, now),
+	})
+	rep := p.Report(true)
+	if len(rep.Rows) != 1 {
+		t.Fatal(rep.Rows)
+	}
+	row := rep.Rows[0]
+	if row.Key[0] != "user:1" || row.Values[0] != 2500 || row.Ops.Gets != 1 {
+		t.Errorf("got %v %v %+v", row.Key, row.Values, row.Ops)
+	}
+	if cf, ok := p.Chunks("user:1"); !ok || cf.Fetches != 1 || cf.Chunks != 3 {
+		t.Error(cf, ok)
+	}
+}
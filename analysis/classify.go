@@ -0,0 +1,292 @@
+package analysis
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// Classifier assigns keys to groups, so that activity is reported per group
+// rather than per key.
+//
+// Classify is called for every event on the analysis hot path, from several
+// goroutines at once.  It must be threadsafe, must not block (no network or
+// disk access, no waiting on locks held for long), and must not retain key,
+// whose contents are only valid for the duration of the call.  If ok is false
+// the key is not part of any group and is reported on its own.
+type Classifier interface {
+	Classify(key []byte) (group string, ok bool)
+}
+
+// ClassifierFactory creates a Classifier configured by arg, which is the empty
+// string if no argument was given.
+type ClassifierFactory func(arg string) (Classifier, error)
+
+var (
+	classifiersMu sync.Mutex
+	classifiers   = map[string]ClassifierFactory{
+		"field": newFieldClassifier,
+	}
+)
+
+var errUnknownClassifier = errors.New("unknown classifier")
+
+// RegisterClassifier makes a Classifier available to NewClassifier under name.
+// Programs embedding memsniff call RegisterClassifier, typically from an init
+// function, to add their own classifiers.  A later registration under the
+// same name replaces an earlier one.
+func RegisterClassifier(name string, factory ClassifierFactory) {
+	classifiersMu.Lock()
+	defer classifiersMu.Unlock()
+	classifiers[name] = factory
+}
+
+// NewClassifier creates a registered Classifier from spec, which is a name
+// given to RegisterClassifier, optionally followed by a colon and an
+// argument for its factory.
+func NewClassifier(spec string) (Classifier, error) {
+	name, arg := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		name, arg = spec[:i], spec[i+1:]
+	}
+	classifiersMu.Lock()
+	factory, ok := classifiers[name]
+	classifiersMu.Unlock()
+	if !ok {
+		return nil, errUnknownClassifier
+	}
+	return factory(arg)
+}
+
+// FieldClassifier groups keys made of colon-separated fields, such as
+// "shard:17:user:1234", by their first Fields fields ("shard:17" for
+// Fields=2).  Keys with fewer fields are not grouped.
+type FieldClassifier struct {
+	Fields int
+}
+
+var (
+	errBadFieldCount = errors.New("field classifier requires a positive number of fields")
+	errBadFieldSpec  = errors.New("field classifier options must be auto, auto=DELIMITERS, or PREFIX=DELIMITER")
+)
+
+// newFieldClassifier creates a FieldClassifier from a number of fields, or an
+// AutoFieldClassifier if options follow it, separated by commas.  The option
+// "auto" detects the delimiter of each key among DefaultDelimiters, and
+// "auto=CHARS" among CHARS.  An option PREFIX=D forces the delimiter D for
+// keys whose first field is PREFIX.
+func newFieldClassifier(arg string) (Classifier, error) {
+	opts := strings.Split(arg, ",")
+	n, err := strconv.Atoi(opts[0])
+	if err != nil || n < 1 {
+		return nil, errBadFieldCount
+	}
+	if len(opts) == 1 {
+		return FieldClassifier{Fields: n}, nil
+	}
+	ac := &AutoFieldClassifier{Fields: n, Delimiters: ":"}
+	for _, opt := range opts[1:] {
+		switch {
+		case opt == "auto":
+			ac.Delimiters = DefaultDelimiters
+		case strings.HasPrefix(opt, "auto="):
+			ac.Delimiters = opt[len("auto="):]
+			if ac.Delimiters == "" {
+				return nil, errBadFieldSpec
+			}
+		case len(opt) >= 3 && opt[len(opt)-2] == '=':
+			ac.Forced = append(ac.Forced, ForcedDelimiter{opt[:len(opt)-2], opt[len(opt)-1]})
+		default:
+			return nil, errBadFieldSpec
+		}
+	}
+	sort.SliceStable(ac.Forced, func(i, j int) bool {
+		return len(ac.Forced[i].Prefix) > len(ac.Forced[j].Prefix)
+	})
+	return ac, nil
+}
+
+// Classify implements Classifier.
+func (fc FieldClassifier) Classify(key []byte) (string, bool) {
+	return firstFields(key, fc.Fields, ':')
+}
+
+// firstFields returns the first n fields of key separated by delim, and false
+// if key has fewer.
+func firstFields(key []byte, n int, delim byte) (string, bool) {
+	var end int
+	for i := 0; i < n; i++ {
+		j := bytes.IndexByte(key[end:], delim)
+		if j < 0 {
+			return "", false
+		}
+		end += j + 1
+	}
+	return string(key[:end-1]), true
+}
+
+// DefaultDelimiters are the delimiters detected by the "auto" option of the
+// field classifier.
+const DefaultDelimiters = ":|."
+
+// AutoFieldClassifier is like FieldClassifier, for keys whose fields may be
+// separated by any of several delimiters, as when teams sharing a cache follow
+// different conventions.  The delimiter of each key is the candidate that
+// occurs most often in it, or the one occurring first among those occurring
+// equally often, unless the key starts with a prefix in Forced.  Keys with
+// none of the candidates, or with fewer fields than Fields, are not grouped.
+type AutoFieldClassifier struct {
+	Fields int
+	// Delimiters are the candidate delimiters.
+	Delimiters string
+	// Forced assigns delimiters to keys by their first field, resolving
+	// keys that detection would split wrongly, such as
+	// "billing.eu.invoice:2017:42:7" when "billing" uses ".".  Longer prefixes
+	// should come first.
+	Forced []ForcedDelimiter
+	// counts is the number of keys grouped using each delimiter.
+	counts [256]int64
+}
+
+// ForcedDelimiter assigns Delimiter to keys whose first field is Prefix.
+type ForcedDelimiter struct {
+	Prefix    string
+	Delimiter byte
+}
+
+// Classify implements Classifier.
+func (ac *AutoFieldClassifier) Classify(key []byte) (string, bool) {
+	delim, ok := ac.delimiter(key)
+	if !ok {
+		return "", false
+	}
+	group, ok := firstFields(key, ac.Fields, delim)
+	if ok {
+		atomic.AddInt64(&ac.counts[delim], 1)
+	}
+	return group, ok
+}
+
+// delimiter returns the delimiter of key, and false if it has none.
+func (ac *AutoFieldClassifier) delimiter(key []byte) (byte, bool) {
+	for _, f := range ac.Forced {
+		if len(key) > len(f.Prefix) && key[len(f.Prefix)] == f.Delimiter &&
+			string(key[:len(f.Prefix)]) == f.Prefix {
+			return f.Delimiter, true
+		}
+	}
+	var best byte
+	bestCount, bestFirst := 0, len(key)
+	for i := 0; i < len(ac.Delimiters); i++ {
+		c := ac.Delimiters[i]
+		n := bytes.Count(key, []byte{c})
+		if n == 0 {
+			continue
+		}
+		if first := bytes.IndexByte(key, c); n > bestCount || n == bestCount && first < bestFirst {
+			best, bestCount, bestFirst = c, n, first
+		}
+	}
+	return best, bestCount > 0
+}
+
+// DelimiterCounts returns the number of keys grouped using each delimiter that
+// has been used, to show the mix of conventions in a cache.
+func (ac *AutoFieldClassifier) DelimiterCounts() map[string]int64 {
+	counts := make(map[string]int64)
+	for c := range ac.counts {
+		if n := atomic.LoadInt64(&ac.counts[c]); n > 0 {
+			counts[string(rune(c))] = n
+		}
+	}
+	return counts
+}
+
+// DelimiterCounter is implemented by a Classifier that counts the keys grouped
+// using each delimiter, such as AutoFieldClassifier.
+type DelimiterCounter interface {
+	DelimiterCounts() map[string]int64
+}
+
+// maxGroupsTracked limits the number of groups whose member keys are
+// remembered, in case a classifier creates a group for nearly every key.
+const maxGroupsTracked = 4096
+
+// maxGroupMembers is the number of member keys remembered for each group.
+const maxGroupMembers = 8
+
+// classifyStage replaces the key of each event with its group, remembering a
+// few of the keys seen in each group.
+type classifyStage struct {
+	c Classifier
+
+	sync.Mutex
+	members map[string][]string
+}
+
+// classifyEvents rewrites the key of each classified event in place, returning
+// the number of calls made to the Classifier and the time they took.
+func (cs *classifyStage) classifyEvents(evts []model.Event) (int, time.Duration) {
+	if cs.c == nil || len(evts) == 0 {
+		return 0, 0
+	}
+	type membership struct{ group, key string }
+	var joined []membership
+	var buf []byte
+
+	start := time.Now()
+	for i := range evts {
+		buf = append(buf[:0], evts[i].Key...)
+		if group, ok := cs.c.Classify(buf); ok {
+			joined = append(joined, membership{group, evts[i].Key})
+			evts[i].Key = group
+		}
+	}
+	elapsed := time.Since(start)
+
+	if len(joined) == 0 {
+		return len(evts), elapsed
+	}
+	cs.Lock()
+	defer cs.Unlock()
+	if cs.members == nil {
+		cs.members = make(map[string][]string)
+	}
+	for _, m := range joined {
+		cs.addMember(m.group, m.key)
+	}
+	return len(evts), elapsed
+}
+
+func (cs *classifyStage) addMember(group, key string) {
+	keys, ok := cs.members[group]
+	if !ok && len(cs.members) >= maxGroupsTracked {
+		return
+	}
+	for _, k := range keys {
+		if k == key {
+			return
+		}
+	}
+	if len(keys) < maxGroupMembers {
+		cs.members[group] = append(keys, key)
+	} else {
+		cs.members[group] = append(keys[1:], key)
+	}
+}
+
+// groupKeys returns the most recently seen distinct member keys of group,
+// oldest first.
+func (cs *classifyStage) groupKeys(group string) ([]string, bool) {
+	cs.Lock()
+	defer cs.Unlock()
+	keys, ok := cs.members[group]
+	return append([]string(nil), keys...), ok
+}
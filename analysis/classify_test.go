@@ -0,0 +1,143 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestFieldClassifier(t *testing.T) {
+	cases := []struct {
+		key   string
+		group string
+		ok    bool
+	}{
+		{"shard:17:user:1234", "shard:17", true},
+		{"shard:17:", "shard:17", true},
+		{"shard:17", "", false},
+		{"", "", false},
+	}
+	c := FieldClassifier{Fields: 2}
+	for _, tc := range cases {
+		group, ok := c.Classify([]byte(tc.key))
+		if group != tc.group || ok != tc.ok {
+			t.Errorf("Classify(%q) = %q, %v", tc.key, group, ok)
+		}
+	}
+}
+
+func TestNewClassifier(t *testing.T) {
+	c, err := NewClassifier("field:3")
+	if err != nil || c != (FieldClassifier{Fields: 3}) {
+		t.Error(c, err)
+	}
+	for _, spec := range []string{"field", "field:0", "field:x"} {
+		if _, err := NewClassifier(spec); err != errBadFieldCount {
+			t.Errorf("NewClassifier(%q): %v", spec, err)
+		}
+	}
+	if _, err := NewClassifier("nonesuch:1"); err != errUnknownClassifier {
+		t.Error("expected error, got", err)
+	}
+
+	RegisterClassifier("test", func(arg string) (Classifier, error) {
+		return FieldClassifier{Fields: len(arg)}, nil
+	})
+	if c, err := NewClassifier("test:ab"); err != nil || c != (FieldClassifier{Fields: 2}) {
+		t.Error(c, err)
+	}
+}
+
+func TestAutoFieldClassifier(t *testing.T) {
+	c, err := NewClassifier("field:2,auto,billing=.,bill=|")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		key   string
+		group string
+		ok    bool
+	}{
+		{"shard:17:user:1234", "shard:17", true},
+		{"team|cart|items", "team|cart", true},
+		{"web.session.abc", "web.session", true},
+		// most frequent wins over first
+		{"v2.user:17:name", "v2.user:17", true},
+		{"user:17:v2.name", "user:17", true},
+		// equally frequent, first wins
+		{"a.b:c", "a.b:c", false},
+		{"a.b.c:d:e", "a.b", true},
+		{"billing.eu.invoice:2017:42:7", "billing.eu", true},
+		{"bill|eu|invoice:2017:42:7", "bill|eu", true},
+		{"billing:invoice:2017", "billing:invoice", true},
+		{"plain", "", false},
+	}
+	for _, tc := range cases {
+		group, ok := c.Classify([]byte(tc.key))
+		if ok != tc.ok || ok && group != tc.group {
+			t.Errorf("Classify(%q) = %q, %v", tc.key, group, ok)
+		}
+	}
+	counts := c.(DelimiterCounter).DelimiterCounts()
+	if !reflect.DeepEqual(counts, map[string]int64{":": 4, "|": 2, ".": 3}) {
+		t.Error(counts)
+	}
+
+	for _, spec := range []string{"field:2,auto=", "field:2,billing", "field:2,=", "field:2,bogus"} {
+		if _, err := NewClassifier(spec); err != errBadFieldSpec {
+			t.Errorf("NewClassifier(%q): %v", spec, err)
+		}
+	}
+	c, err = NewClassifier("field:1,auto=|")
+	if group, ok := c.Classify([]byte("a.b|c")); err != nil || !ok || group != "a.b" {
+		t.Error(group, ok, err)
+	}
+}
+
+func TestClassifyEvents(t *testing.T) {
+	cs := classifyStage{c: FieldClassifier{Fields: 1}}
+	evts := []model.Event{
+		{Type: model.EventGetHit, Key: "user:1"},
+		{Type: model.EventGetHit, Key: "user:2"},
+		{Type: model.EventGetHit, Key: "user:1"},
+		{Type: model.EventGetHit, Key: "plain"},
+	}
+	calls, _ := cs.classifyEvents(evts)
+	if calls != len(evts) {
+		t.Error("counted", calls, "calls")
+	}
+	var keys []string
+	for _, e := range evts {
+		keys = append(keys, e.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"user", "user", "user", "plain"}) {
+		t.Error(keys)
+	}
+	if members, ok := cs.groupKeys("user"); !ok || !reflect.DeepEqual(members, []string{"user:1", "user:2"}) {
+		t.Error(members, ok)
+	}
+	if _, ok := cs.groupKeys("plain"); ok {
+		t.Error("unclassified key recorded as a group")
+	}
+}
+
+func TestClassifyMembersBounded(t *testing.T) {
+	cs := classifyStage{c: FieldClassifier{Fields: 1}}
+	for i := 0; i < maxGroupMembers+2; i++ {
+		cs.classifyEvents([]model.Event{{Key: fmt.Sprint("user:", i)}})
+	}
+	members, _ := cs.groupKeys("user")
+	if len(members) != maxGroupMembers || members[len(members)-1] != fmt.Sprint("user:", maxGroupMembers+1) {
+		t.Error(members)
+	}
+}
+
+func TestClassifyDisabled(t *testing.T) {
+	var cs classifyStage
+	evts := []model.Event{{Key: "user:1"}}
+	if calls, _ := cs.classifyEvents(evts); calls != 0 || evts[0].Key != "user:1" {
+		t.Error(calls, evts)
+	}
+}
@@ -0,0 +1,270 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/protocol/model"
+)
+
+// DefaultColdConnAge is the age below which a connection counts as cold.
+// Clients that connect for a single request, such as short-lived functions,
+// make all of their requests within a few seconds of connecting.
+const DefaultColdConnAge = 5 * time.Second
+
+// DefaultColdConnShare and DefaultColdConnRequests are the thresholds of
+// SetColdConnAlert.
+const (
+	DefaultColdConnShare    = 0.5
+	DefaultColdConnRequests = 1000
+)
+
+// minColdConnRequests is the number of requests a key needs in a window
+// before it can be reported as requested mostly from cold connections.
+const minColdConnRequests = 10
+
+// maxColdKeysReported is the number of keys with the most requests from cold
+// connections included in each report.
+const maxColdKeysReported = 256
+
+// ColdConnKey counts the requests for a key, and those made on connections
+// opened less than the cold connection age before.
+type ColdConnKey struct {
+	Key      string
+	Requests int64
+	Cold     int64
+}
+
+// ColdPercent returns the percentage of requests made on cold connections.
+func (ck ColdConnKey) ColdPercent() float64 {
+	if ck.Requests == 0 {
+		return 0
+	}
+	return float64(ck.Cold) * 100 / float64(ck.Requests)
+}
+
+// coldConnTracker counts the requests for each key made on connections opened
+// moments before, over the same window as each report.  Many fresh
+// connections each requesting the same key, as when a burst of short-lived
+// clients starts at once, stampede that key while the connections themselves
+// each look idle.  Connections picked up part way through, whose opening was
+// not seen, count as established.  Each worker has its own coldConnTracker,
+// counting the keys assigned to it, so every key is counted by a single
+// tracker.  coldConnTracker is threadsafe.
+type coldConnTracker struct {
+	sync.Mutex
+	settings *coldConnSettings
+	// alerts returns the logger for alerts, or nil.
+	alerts func() log.Logger
+	// limit is the number of keys counted in a window, or 0 for
+	// maxOwnedKeys.
+	limit int
+	keys  map[string]*ColdConnKey
+	// alerted is the set of keys already alerted on in the current window.
+	alerted map[string]bool
+}
+
+// coldConnSettings are the settings shared by the coldConnTracker of every
+// worker.  coldConnSettings is threadsafe.
+type coldConnSettings struct {
+	sync.Mutex
+	// current holds the current coldConnConfig, replaced whole by every
+	// change, so that trackers read it without locking.
+	current atomic.Value
+}
+
+type coldConnConfig struct {
+	age time.Duration
+	// alertShare and alertRequests are the share of requests from cold
+	// connections and the requests in a window that a key must both reach
+	// before an alert is logged, or 0 to disable alerts.
+	alertShare    float64
+	alertRequests int64
+	// acked is the set of keys acknowledged by the user, for which no
+	// alerts are logged.  It is never modified once stored.
+	acked map[string]bool
+}
+
+func (cs *coldConnSettings) load() coldConnConfig {
+	if cs == nil {
+		return coldConnConfig{}
+	}
+	cfg, _ := cs.current.Load().(coldConnConfig)
+	return cfg
+}
+
+// update stores a copy of the current settings as changed by f.
+func (cs *coldConnSettings) update(f func(*coldConnConfig)) {
+	cs.Lock()
+	defer cs.Unlock()
+	cfg := cs.load()
+	f(&cfg)
+	cs.current.Store(cfg)
+}
+
+func (cs *coldConnSettings) setAcked(keys []string) {
+	acked := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		acked[k] = true
+	}
+	cs.update(func(cfg *coldConnConfig) { cfg.acked = acked })
+}
+
+// record counts each retrieval in evts against its key, and whether it was
+// made on a cold connection.
+func (ct *coldConnTracker) record(evts []model.Event) {
+	if len(evts) == 0 {
+		return
+	}
+	cfg := ct.settings.load()
+	if cfg.age == 0 {
+		cfg.age = DefaultColdConnAge
+	}
+	limit := ct.limit
+	if limit == 0 {
+		limit = maxOwnedKeys
+	}
+	ct.Lock()
+	defer ct.Unlock()
+	if ct.keys == nil {
+		ct.keys = make(map[string]*ColdConnKey)
+	}
+	for _, e := range evts {
+		if e.Type != model.EventGetHit && e.Type != model.EventGetMiss {
+			continue
+		}
+		ck, ok := ct.keys[e.Key]
+		if !ok {
+			if len(ct.keys) >= limit {
+				continue
+			}
+			ck = &ColdConnKey{Key: e.Key}
+			ct.keys[e.Key] = ck
+		}
+		ck.Requests++
+		if !e.ConnOpened.IsZero() && !e.Timestamp.IsZero() && e.Timestamp.Sub(e.ConnOpened) < cfg.age {
+			ck.Cold++
+			ct.checkAlert(cfg, ck)
+		}
+	}
+}
+
+// checkAlert logs an alert the first time in a window that ck reaches both
+// alert thresholds of cfg.
+func (ct *coldConnTracker) checkAlert(cfg coldConnConfig, ck *ColdConnKey) {
+	if cfg.alertShare <= 0 || ck.Requests < cfg.alertRequests || ct.alerted[ck.Key] || cfg.acked[ck.Key] {
+		return
+	}
+	if ck.ColdPercent() < cfg.alertShare*100 {
+		return
+	}
+	if ct.alerted == nil {
+		ct.alerted = make(map[string]bool)
+	}
+	ct.alerted[ck.Key] = true
+	if ct.alerts == nil {
+		return
+	}
+	if logger := ct.alerts(); logger != nil {
+		logger.Log(fmt.Sprintf("ALERT: key %s got %.0f%% of %d requests from connections opened within %v",
+			ck.Key, ck.ColdPercent(), ck.Requests, cfg.age))
+	}
+}
+
+// window returns the keys requested mostly on cold connections since the
+// start of the current window, in no particular order.  If shouldReset is
+// true, a new window begins.
+func (ct *coldConnTracker) window(shouldReset bool) []ColdConnKey {
+	ct.Lock()
+	defer ct.Unlock()
+	var keys []ColdConnKey
+	for _, ck := range ct.keys {
+		if isColdConnKey(*ck) {
+			keys = append(keys, *ck)
+		}
+	}
+	if shouldReset {
+		ct.keys = nil
+		ct.alerted = nil
+	}
+	return keys
+}
+
+// topColdConnKeys orders keys by requests from cold connections, most first,
+// keeping those included in a report.
+func topColdConnKeys(keys []ColdConnKey) []ColdConnKey {
+	sortColdConnKeys(keys)
+	if len(keys) > maxColdKeysReported {
+		keys = keys[:maxColdKeysReported]
+	}
+	return keys
+}
+
+// isColdConnKey returns true if most of the requests for ck were made on cold
+// connections, and there were enough for that to matter.
+func isColdConnKey(ck ColdConnKey) bool {
+	return ck.Requests >= minColdConnRequests && ck.ColdPercent() >= DefaultColdConnShare*100
+}
+
+// sortColdConnKeys orders keys by requests from cold connections, most first.
+func sortColdConnKeys(keys []ColdConnKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Cold != keys[j].Cold {
+			return keys[i].Cold > keys[j].Cold
+		}
+		return keys[i].Key < keys[j].Key
+	})
+}
+
+// mergeColdConnKeys combines the keys of two reports, adding the counts of
+// keys present in both.
+func mergeColdConnKeys(a, b []ColdConnKey) []ColdConnKey {
+	index := make(map[string]int, len(a))
+	merged := append([]ColdConnKey(nil), a...)
+	for i, ck := range merged {
+		index[ck.Key] = i
+	}
+	for _, ck := range b {
+		i, ok := index[ck.Key]
+		if !ok {
+			index[ck.Key] = len(merged)
+			merged = append(merged, ck)
+			continue
+		}
+		merged[i].Requests += ck.Requests
+		merged[i].Cold += ck.Cold
+	}
+	sortColdConnKeys(merged)
+	return merged
+}
+
+// SetColdConnAge sets the age below which a connection counts as cold, or
+// restores DefaultColdConnAge if age is 0.  SetColdConnAge is threadsafe.
+func (p *Pool) SetColdConnAge(age time.Duration) {
+	p.coldConns.update(func(cfg *coldConnConfig) { cfg.age = age })
+}
+
+// SetColdConnAlert causes an alert to be logged when at least share of the
+// requests for a key are made on cold connections, once the key has had at
+// least requests requests, over the period of a report.  A share of 0
+// disables alerts.  SetColdConnAlert is threadsafe.
+func (p *Pool) SetColdConnAlert(share float64, requests int64) {
+	p.coldConns.update(func(cfg *coldConnConfig) {
+		cfg.alertShare, cfg.alertRequests = share, requests
+	})
+}
+
+// coldConnKeys returns the keys requested mostly on cold connections over the
+// period of a report, from every worker.  If shouldReset is true, a new
+// period begins.
+func (p *Pool) coldConnKeys(shouldReset bool) []ColdConnKey {
+	var keys []ColdConnKey
+	for _, w := range p.workers {
+		keys = append(keys, w.coldConns.window(shouldReset)...)
+	}
+	return topColdConnKeys(keys)
+}
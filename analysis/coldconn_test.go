@@ -0,0 +1,125 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/protocol/model"
+)
+
+var coldStart = time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+
+// requestAt returns a miss on key made at, on a connection opened at opened
+// or picked up part way through if opened is the zero Time.
+func requestAt(key string, at, opened time.Time) model.Event {
+	return model.Event{Type: model.EventGetMiss, Key: key, Timestamp: at, ConnOpened: opened}
+}
+
+func TestColdConns(t *testing.T) {
+	var ct coldConnTracker
+	var evts []model.Event
+	for i := 0; i < 9; i++ {
+		// a fresh connection for each request
+		opened := coldStart.Add(time.Duration(i) * time.Second)
+		evts = append(evts, requestAt("hot", opened.Add(time.Millisecond), opened))
+	}
+	evts = append(evts,
+		requestAt("hot", coldStart.Add(time.Minute), coldStart),
+		requestAt("hot", coldStart.Add(time.Minute), time.Time{}),
+		requestAt("steady", coldStart.Add(time.Second), time.Time{}),
+		model.Event{Type: model.EventSet, Key: "hot", Timestamp: coldStart, ConnOpened: coldStart},
+	)
+	for i := 0; i < 10; i++ {
+		evts = append(evts, requestAt("few", coldStart, coldStart))
+	}
+	ct.record(evts)
+
+	got := topColdConnKeys(ct.window(true))
+	want := []ColdConnKey{{"few", 10, 10}, {"hot", 11, 9}}
+	if !reflect.DeepEqual(got, want) {
+		t.Error(got)
+	}
+	if got := ct.window(true); got != nil {
+		t.Error("after reset:", got)
+	}
+
+	// below the minimum requests
+	ct.record([]model.Event{requestAt("k", coldStart, coldStart)})
+	if got := ct.window(false); got != nil {
+		t.Error(got)
+	}
+}
+
+func TestColdConnAge(t *testing.T) {
+	var cs coldConnSettings
+	cs.update(func(cfg *coldConnConfig) { cfg.age = time.Minute })
+	ct := coldConnTracker{settings: &cs}
+	var evts []model.Event
+	for i := 0; i < minColdConnRequests; i++ {
+		evts = append(evts, requestAt("k", coldStart.Add(30*time.Second), coldStart))
+	}
+	ct.record(evts)
+	if got := ct.window(false); len(got) != 1 || got[0].Cold != minColdConnRequests {
+		t.Error(got)
+	}
+}
+
+func TestColdConnAlert(t *testing.T) {
+	var cs coldConnSettings
+	cs.update(func(cfg *coldConnConfig) { cfg.alertShare, cfg.alertRequests = 0.8, 20 })
+	cs.setAcked([]string{"acked"})
+	logger := &countingLogger{}
+	ct := coldConnTracker{settings: &cs, alerts: func() log.Logger { return logger }}
+	var evts []model.Event
+	for i := 0; i < 30; i++ {
+		evts = append(evts, requestAt("k", coldStart, coldStart), requestAt("acked", coldStart, coldStart))
+	}
+	ct.record(evts)
+	want := []string{"ALERT: key k got 100% of 20 requests from connections opened within 5s"}
+	if !reflect.DeepEqual(logger.messages, want) {
+		t.Error(logger.messages)
+	}
+
+	// once per window
+	ct.window(true)
+	ct.record(evts)
+	if len(logger.messages) != 2 {
+		t.Error(logger.messages)
+	}
+}
+
+func TestColdConnsUnkeyedReport(t *testing.T) {
+	// rows keyed by client are spread over the workers, but each key is
+	// still counted whole
+	p, err := New(4, "client,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var evts []model.Event
+	for i := 0; i < 20; i++ {
+		evt := requestAt("k", coldStart, coldStart)
+		evt.Client = fmt.Sprint("10.0.0.", i)
+		evts = append(evts, evt)
+	}
+	p.HandleEvents(evts)
+	rep := p.Report(true)
+	if want := []ColdConnKey{{"k", 20, 20}}; !reflect.DeepEqual(rep.ColdConnKeys, want) {
+		t.Error(rep.ColdConnKeys)
+	}
+	if len(rep.Rows) != 20 {
+		t.Error("rows:", len(rep.Rows))
+	}
+}
+
+func TestMergeColdConnKeys(t *testing.T) {
+	a := []ColdConnKey{{"x", 10, 6}, {"y", 20, 12}}
+	b := []ColdConnKey{{"x", 10, 10}}
+	want := []ColdConnKey{{"x", 20, 16}, {"y", 20, 12}}
+	if merged := mergeColdConnKeys(a, b); !reflect.DeepEqual(merged, want) {
+		t.Error(merged)
+	}
+}
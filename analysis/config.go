@@ -0,0 +1,53 @@
+package analysis
+
+import (
+	"sync"
+	"time"
+)
+
+// ConfigChange is a setting changed while memsniff runs, such as the basis of
+// the bw column, after which numbers may change for reasons other than
+// traffic.
+type ConfigChange struct {
+	// Time is when the setting was changed.
+	Time time.Time
+	// Source is how the setting was changed, such as keyboard, prompt or
+	// http.
+	Source string
+	// Setting names the setting changed, and Value is its new value.
+	Setting string
+	Value   string
+}
+
+// configLog holds the settings changed in the current window.  configLog is
+// threadsafe.
+type configLog struct {
+	sync.Mutex
+	changes []ConfigChange
+}
+
+func (cl *configLog) add(c ConfigChange) {
+	cl.Lock()
+	defer cl.Unlock()
+	cl.changes = append(cl.changes, c)
+}
+
+// window returns the changes made since the start of the current window, in
+// the order made.  If shouldReset is true, a new window begins.
+func (cl *configLog) window(shouldReset bool) []ConfigChange {
+	cl.Lock()
+	defer cl.Unlock()
+	changes := append([]ConfigChange(nil), cl.changes...)
+	if shouldReset {
+		cl.changes = nil
+	}
+	return changes
+}
+
+// RecordConfigChange notes that setting was changed to value through source,
+// to be listed in the ConfigChanges of the next report.  Each place a setting
+// can be changed while running records the change after making it.
+// RecordConfigChange is threadsafe.
+func (p *Pool) RecordConfigChange(source, setting, value string) {
+	p.configs.add(ConfigChange{Time: p.now(), Source: source, Setting: setting, Value: value})
+}
@@ -0,0 +1,49 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+// TestConfigChanges checks that settings changed are listed in reports until
+// one resets, and are combined when reports are merged.
+func TestConfigChanges(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	now := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	if rep := p.Report(true); rep.ConfigChanges != nil {
+		t.Error("changes before any made:", rep.ConfigChanges)
+	}
+	p.RecordConfigChange("keyboard", "bw", "req")
+	now = now.Add(time.Second)
+	p.RecordConfigChange("http", "maintenance", "off")
+	want := []ConfigChange{
+		{now.Add(-time.Second), "keyboard", "bw", "req"},
+		{now, "http", "maintenance", "off"},
+	}
+	if rep := p.Report(false); len(rep.ConfigChanges) != 2 || rep.ConfigChanges[0] != want[0] || rep.ConfigChanges[1] != want[1] {
+		t.Error("first report:", rep.ConfigChanges)
+	}
+	first := p.Report(true)
+	if len(first.ConfigChanges) != 2 {
+		t.Error("not kept until reset:", first.ConfigChanges)
+	}
+	if rep := p.Report(true); rep.ConfigChanges != nil {
+		t.Error("kept after reset:", rep.ConfigChanges)
+	}
+
+	other := first
+	other.ConfigChanges = []ConfigChange{{now, "prompt", "ack", "a"}}
+	merged, err := MergeReports([]Report{first, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.ConfigChanges) != 3 || merged.ConfigChanges[2].Setting != "ack" {
+		t.Error("merged:", merged.ConfigChanges)
+	}
+}
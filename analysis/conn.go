@@ -0,0 +1,189 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/protocol/model"
+)
+
+// maxConnsTracked limits the number of connections whose traffic is counted
+// in a single window, and the number remembered as having raised an alert.
+const maxConnsTracked = 1 << 16
+
+// maxConnsReported is the number of connections with the most response bytes
+// included in each report.
+const maxConnsReported = 256
+
+// DefaultAmplificationRatio and DefaultAmplificationBytes are the thresholds
+// of SetAmplificationAlert.  Gets of large values legitimately return hundreds
+// of times the bytes requested, but rarely a thousand times, and a busy
+// connection is needed for the ratio to matter.
+const (
+	DefaultAmplificationRatio = 1000
+	DefaultAmplificationBytes = 10 << 20
+)
+
+// ConnTraffic is the number of bytes carried in each direction by a single
+// connection over the period covered by a report.
+type ConnTraffic struct {
+	// Conn is the address and port of the client end of the connection.
+	Conn          string
+	RequestBytes  int64
+	ResponseBytes int64
+}
+
+// Amplification returns the ratio of response bytes to request bytes, and
+// false if the ratio is undefined because no request bytes were seen, as when
+// only the server's side of a connection is captured.
+func (ct ConnTraffic) Amplification() (float64, bool) {
+	if ct.RequestBytes == 0 {
+		return 0, false
+	}
+	return float64(ct.ResponseBytes) / float64(ct.RequestBytes), true
+}
+
+// connTracker counts the bytes carried by each connection over the same window
+// as each report, and warns of connections whose responses are much larger
+// than their requests, as in a reflection attack or a client repeatedly
+// fetching a huge value.  connTracker is threadsafe.
+type connTracker struct {
+	sync.Mutex
+	conns map[string]*ConnTraffic
+	// alertRatio and alertBytes are the amplification and response bytes
+	// in a window that a connection must both reach before a warning is
+	// logged, or 0 to disable warnings.
+	alertRatio float64
+	alertBytes int64
+	// alerted is the set of connections already warned about.
+	alerted map[string]bool
+}
+
+func (ct *connTracker) setAlert(ratio float64, bytes int64) {
+	ct.Lock()
+	defer ct.Unlock()
+	ct.alertRatio, ct.alertBytes = ratio, bytes
+}
+
+// take removes traffic events from evts, adding them to the counts of their
+// connections.  The remaining events are returned.
+func (ct *connTracker) take(logger log.Logger, evts []model.Event) []model.Event {
+	if !hasTrafficEvents(evts) {
+		return evts
+	}
+	ct.Lock()
+	defer ct.Unlock()
+	if ct.conns == nil {
+		ct.conns = make(map[string]*ConnTraffic)
+	}
+	kept := evts[:0]
+	for _, e := range evts {
+		if e.Type != model.EventTraffic {
+			kept = append(kept, e)
+			continue
+		}
+		c, ok := ct.conns[e.Key]
+		if !ok {
+			if len(ct.conns) >= maxConnsTracked {
+				continue
+			}
+			c = &ConnTraffic{Conn: e.Key}
+			ct.conns[e.Key] = c
+		}
+		c.RequestBytes += int64(e.RequestSize)
+		c.ResponseBytes += int64(e.Size)
+		ct.checkAmplification(logger, c)
+	}
+	return kept
+}
+
+// hasTrafficEvents returns true if evts includes traffic events.
+func hasTrafficEvents(evts []model.Event) bool {
+	for _, e := range evts {
+		if e.Type == model.EventTraffic {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAmplification logs a warning the first time c reaches both alert
+// thresholds.
+func (ct *connTracker) checkAmplification(logger log.Logger, c *ConnTraffic) {
+	if ct.alertRatio <= 0 || c.ResponseBytes < ct.alertBytes || ct.alerted[c.Conn] {
+		return
+	}
+	ratio, ok := c.Amplification()
+	if !ok || ratio < ct.alertRatio {
+		return
+	}
+	if ct.alerted == nil || len(ct.alerted) >= maxConnsTracked {
+		ct.alerted = make(map[string]bool)
+	}
+	ct.alerted[c.Conn] = true
+	if logger != nil {
+		logger.Log(fmt.Sprintf("ALERT: connection %s received %d response bytes for %d request bytes (%.0f:1)",
+			c.Conn, c.ResponseBytes, c.RequestBytes, ratio))
+	}
+}
+
+// window returns the traffic of the connections with the most response bytes
+// since the start of the current window, most first.  If shouldReset is true,
+// a new window begins.
+func (ct *connTracker) window(shouldReset bool) []ConnTraffic {
+	ct.Lock()
+	defer ct.Unlock()
+	conns := make([]ConnTraffic, 0, len(ct.conns))
+	for _, c := range ct.conns {
+		conns = append(conns, *c)
+	}
+	if shouldReset {
+		ct.conns = nil
+	}
+	sortConns(conns)
+	if len(conns) > maxConnsReported {
+		conns = conns[:maxConnsReported]
+	}
+	return conns
+}
+
+// sortConns orders conns by response bytes, most first, then by connection.
+func sortConns(conns []ConnTraffic) {
+	sort.Slice(conns, func(i, j int) bool {
+		if conns[i].ResponseBytes != conns[j].ResponseBytes {
+			return conns[i].ResponseBytes > conns[j].ResponseBytes
+		}
+		return conns[i].Conn < conns[j].Conn
+	})
+}
+
+// mergeConns sums the traffic of each connection in a and b.
+func mergeConns(a, b []ConnTraffic) []ConnTraffic {
+	index := make(map[string]int, len(a))
+	merged := append([]ConnTraffic(nil), a...)
+	for i, c := range merged {
+		index[c.Conn] = i
+	}
+	for _, c := range b {
+		i, ok := index[c.Conn]
+		if !ok {
+			index[c.Conn] = len(merged)
+			merged = append(merged, c)
+			continue
+		}
+		merged[i].RequestBytes += c.RequestBytes
+		merged[i].ResponseBytes += c.ResponseBytes
+	}
+	sortConns(merged)
+	return merged
+}
+
+// SetAmplificationAlert causes a warning to be logged when a connection
+// receives at least ratio times as many bytes in responses as it sent in
+// requests, and at least bytes response bytes, over the period of a report.
+// A ratio of 0 disables warnings.  SetAmplificationAlert is threadsafe.
+func (p *Pool) SetAmplificationAlert(ratio float64, bytes int64) {
+	p.conns.setAlert(ratio, bytes)
+}
@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func traffic(conn string, request, response int) model.Event {
+	return model.Event{Type: model.EventTraffic, Key: conn, RequestSize: request, Size: response}
+}
+
+func TestConnTake(t *testing.T) {
+	var ct connTracker
+	evts := []model.Event{
+		traffic("10.0.0.1:4000", 10, 100),
+		{Type: model.EventGetHit, Key: "k", Size: 5},
+		traffic("10.0.0.2:4000", 0, 50),
+		traffic("10.0.0.1:4000", 20, 300),
+	}
+	kept := ct.take(nil, evts)
+	if len(kept) != 1 || kept[0].Key != "k" {
+		t.Error(kept)
+	}
+	expected := []ConnTraffic{
+		{Conn: "10.0.0.1:4000", RequestBytes: 30, ResponseBytes: 400},
+		{Conn: "10.0.0.2:4000", RequestBytes: 0, ResponseBytes: 50},
+	}
+	if conns := ct.window(true); !reflect.DeepEqual(conns, expected) {
+		t.Error("first window:", conns)
+	}
+	if conns := ct.window(true); len(conns) != 0 {
+		t.Error("empty window:", conns)
+	}
+}
+
+func TestAmplification(t *testing.T) {
+	if ratio, ok := (ConnTraffic{RequestBytes: 10, ResponseBytes: 250}).Amplification(); !ok || ratio != 25 {
+		t.Error(ratio, ok)
+	}
+	if _, ok := (ConnTraffic{ResponseBytes: 250}).Amplification(); ok {
+		t.Error("ratio defined without request bytes")
+	}
+}
+
+func TestAmplificationAlert(t *testing.T) {
+	var ct connTracker
+	var logger countingLogger
+	ct.setAlert(100, 1000)
+
+	// ratio high enough but too few bytes, then both
+	ct.take(&logger, []model.Event{traffic("a:1", 5, 900)})
+	if len(logger.messages) != 0 {
+		t.Error("alerted below byte threshold:", logger.messages)
+	}
+	ct.take(&logger, []model.Event{traffic("a:1", 0, 600), traffic("a:1", 0, 600)})
+	if len(logger.messages) != 1 {
+		t.Error("expected one alert:", logger.messages)
+	}
+
+	// many bytes but a low ratio, or an undefined one
+	ct.take(&logger, []model.Event{traffic("b:1", 1000, 5000), traffic("c:1", 0, 5000)})
+	if len(logger.messages) != 1 {
+		t.Error("unexpected alert:", logger.messages)
+	}
+}
+
+func TestConnReport(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.HandleEvents([]model.Event{traffic("10.0.0.1:4000", 10, 100)})
+
+	rep := p.Report(true)
+	if len(rep.Connections) != 1 || rep.Connections[0].ResponseBytes != 100 {
+		t.Error(rep.Connections)
+	}
+	if s := p.Stats(); s.EventsHandled != 0 {
+		t.Error("traffic event handled as a key:", s.EventsHandled)
+	}
+}
+
+func TestMergeConns(t *testing.T) {
+	a := []ConnTraffic{{"x:1", 1, 10}, {"y:1", 2, 5}}
+	b := []ConnTraffic{{"y:1", 3, 20}}
+	expected := []ConnTraffic{{"y:1", 5, 25}, {"x:1", 1, 10}}
+	if merged := mergeConns(a, b); !reflect.DeepEqual(merged, expected) {
+		t.Error(merged)
+	}
+}
@@ -0,0 +1,55 @@
+package analysis
+
+import (
+	"math"
+)
+
+// CostWeights is a rough model of the server CPU spent on each kind of
+// operation, in units of the work done to serve a single small get hit.
+// See cost for the formula.
+type CostWeights struct {
+	// Hit is the cost of a get that found its key.
+	Hit float64
+	// Miss is the cost of a get that did not find its key.
+	Miss float64
+	// Set is the cost of storing a value.
+	Set float64
+	// KB is the cost of each kilobyte (1024 bytes) of requests parsed,
+	// including values stored, and values returned.
+	KB float64
+}
+
+// DefaultCostWeights are rough guesses, not measurements of memcached, chosen
+// only to rank the kinds of work in a plausible order:
+//
+// A hit is the unit of cost: parsing the request, a hash lookup, updating
+// the LRU and writing a response header.
+//
+// A miss is guessed to cost a little more than a hit, at 1.5, since a client
+// that misses usually goes on to do more work against the cache.
+//
+// A set, including the one with which clients usually answer a miss,
+// allocates memory, may evict another item and takes the locks a get avoids,
+// so is guessed at 3.
+//
+// Copying bytes to and from the network, in values returned and stored alike,
+// is taken to be cheap next to the fixed cost of an operation, so 4KB of
+// traffic costs as much as a hit.  Values of a few hundred bytes add little;
+// large values come to dominate.
+var DefaultCostWeights = CostWeights{Hit: 1, Miss: 1.5, Set: 3, KB: 0.25}
+
+// cost estimates a key's contribution to server CPU:
+//
+//	cost = w.Hit*hits + w.Miss*misses + w.Set*sets + w.KB*(bytes+reqBytes)/1024
+//
+// where sets is the number of values stored, bytes the total size of values
+// returned and reqBytes the total size of requests for the key, including the
+// values stored.  Unlike score, cost is linear in its inputs, so the costs of
+// keys, or of the same key in different reports, may be added together.
+func cost(w CostWeights, hits, misses, sets, bytes, reqBytes int64) int64 {
+	c := w.Hit*float64(hits) + w.Miss*float64(misses) + w.Set*float64(sets) + w.KB*float64(bytes+reqBytes)/1024
+	if c >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(math.Floor(c + 0.5))
+}
@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestCostDefaultWeights(t *testing.T) {
+	// 10 hits, 30 misses at 1.5, 2 sets at 3, 4KB of values and 4KB of
+	// requests
+	if c := cost(DefaultCostWeights, 10, 30, 2, 4096, 4096); c != 63 {
+		t.Error("cost:", c)
+	}
+}
+
+func TestCostOrdering(t *testing.T) {
+	w := DefaultCostWeights
+	hit, miss, set := cost(w, 100, 0, 0, 0, 0), cost(w, 0, 100, 0, 0, 0), cost(w, 0, 0, 100, 0, 0)
+	if !(hit < miss && miss < set) {
+		t.Error("hit", hit, "miss", miss, "set", set)
+	}
+}
+
+func TestCostWeights(t *testing.T) {
+	w := CostWeights{Hit: 1, Miss: 0, KB: 0}
+	if c := cost(w, 10, 30, 2, 4096, 4096); c != 10 {
+		t.Error("cost:", c)
+	}
+	w = CostWeights{Set: 5}
+	if c := cost(w, 10, 30, 2, 4096, 4096); c != 10 {
+		t.Error("cost:", c)
+	}
+	w = CostWeights{KB: 1}
+	// bytes round to the nearest kilobyte
+	if c := cost(w, 10, 30, 0, 1536, 0); c != 2 {
+		t.Error("cost:", c)
+	}
+}
+
+func TestCostAdds(t *testing.T) {
+	// merging reports sums costs, which is exact as cost is linear
+	a := cost(DefaultCostWeights, 10, 2, 1, 8192, 100)
+	b := cost(DefaultCostWeights, 30, 6, 3, 24576, 300)
+	if c := cost(DefaultCostWeights, 40, 8, 4, 32768, 400); c != a+b {
+		t.Error("cost:", a, b, c)
+	}
+}
+
+// TestCostSetSize checks that the cost of a set grows with the size of the
+// value stored.
+func TestCostSetSize(t *testing.T) {
+	p, err := New(1, "key,cost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetRankBasis(RankSets)
+	p.HandleEvents([]model.Event{
+		{Type: model.EventSet, Key: "small", Size: 10},
+		{Type: model.EventSet, Key: "large", Size: 1 << 20},
+	})
+	costs := make(map[string]int64)
+	for _, row := range p.Report(true).Rows {
+		costs[row.Key[0]] = row.Values[0]
+	}
+	// 3 for the set, and 0.25 for each of the 1024 kilobytes
+	if costs["small"] != 3 || costs["large"] != 259 {
+		t.Error(costs)
+	}
+}
@@ -0,0 +1,73 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func repeatedHits(key string, n int) []model.Event {
+	evts := make([]model.Event, n)
+	for i := range evts {
+		evts[i] = model.Event{Type: model.EventGetHit, Key: key, Size: 10}
+	}
+	return evts
+}
+
+func reportKeys(rep Report) []string {
+	var keys []string
+	for _, r := range rep.Rows {
+		keys = append(keys, r.Key[0])
+	}
+	return keys
+}
+
+// TestCumulativeDecay checks that a key busy long ago does not outrank one busy
+// now once it has decayed.
+func TestCumulativeDecay(t *testing.T) {
+	p, err := New(4, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	now := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	p.SetCumulativeDecay(30 * time.Minute)
+
+	p.HandleEvents(repeatedHits("9am", 1000))
+	p.Report(false)
+
+	now = now.Add(20 * time.Minute)
+	p.HandleEvents(repeatedHits("now", 10))
+	rep := p.ReportTop(false, 1, -1)
+	if keys := reportKeys(rep); len(keys) != 1 || keys[0] != "9am" || rep.TotalRows != 2 {
+		t.Error("before decay:", keys, rep.TotalRows)
+	}
+
+	now = now.Add(20 * time.Minute)
+	p.HandleEvents(repeatedHits("now", 10))
+	rep = p.ReportTop(false, 1, -1)
+	if keys := reportKeys(rep); len(keys) != 1 || keys[0] != "now" || rep.TotalRows != 1 {
+		t.Error("after decay:", keys, rep.TotalRows)
+	}
+	if rep.Rows[0].Values[0] != 200 {
+		t.Error("total since first seen:", rep.Rows[0].Values)
+	}
+	if rep.Decay != 30*time.Minute {
+		t.Error(rep.Decay)
+	}
+}
+
+func TestCumulativeDecayNotOnReset(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetCumulativeDecay(time.Nanosecond)
+	p.HandleEvents(repeatedHits("k", 1))
+	if rep := p.Report(true); len(rep.Rows) != 1 || rep.Decay != 0 {
+		t.Error(rep.Rows, rep.Decay)
+	}
+}
@@ -0,0 +1,237 @@
+package analysis
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// derivedColumn is a value column computed as a report is assembled, from
+// aggregates collected alongside the requested ones in hidden columns.
+type derivedColumn struct {
+	// name identifies the column in a format.
+	name string
+	// inputs are the aggregates from which the column is derived.
+	inputs []string
+	// title returns the name of the column as shown in reports.
+	title func(p *Pool) string
+	// compute derives the value of the column from its inputs, in order,
+	// and the values stored and deletions of the key, which are counted
+	// apart from the aggregates.
+	compute func(p *Pool, inputs []int64, ops OpCounts) int64
+}
+
+var derivedColumns = []derivedColumn{
+	{
+		name:   "score",
+		inputs: []string{"sum(hit)", "sum(miss)", "sum(size)"},
+		title:  func(*Pool) string { return "score" },
+		compute: func(p *Pool, in []int64, _ OpCounts) int64 {
+			return score(p.scoreWeights, in[0], in[1], in[2])
+		},
+	},
+	{
+		name:   "cost",
+		inputs: []string{"sum(hit)", "sum(miss)", "sum(size)", "sum(reqsize)"},
+		title:  func(*Pool) string { return "cost" },
+		compute: func(p *Pool, in []int64, ops OpCounts) int64 {
+			return cost(p.costWeights, in[0], in[1], ops.Sets, in[2], in[3]+ops.SetBytes)
+		},
+	},
+	{
+		name:   "bw",
+		inputs: []string{"sum(size)", "sum(reqsize)"},
+		title:  func(p *Pool) string { return "bw(" + p.BandwidthBasis().String() + ")" },
+		compute: func(p *Pool, in []int64, _ OpCounts) int64 {
+			return p.BandwidthBasis().bytes(in[0], in[1])
+		},
+	},
+	{
+		name:    "req/clnt",
+		inputs:  []string{"count(size)", "distinct(client)"},
+		title:   func(*Pool) string { return "req/clnt" },
+		compute: func(p *Pool, in []int64, _ OpCounts) int64 { return perClient(in[0], in[1]) },
+	},
+	{
+		name:   "split",
+		inputs: []string{"distinct(server)"},
+		title:  func(*Pool) string { return "split" },
+		compute: func(p *Pool, in []int64, _ OpCounts) int64 {
+			if in[0] > 1 {
+				return 1
+			}
+			return 0
+		},
+	},
+	{
+		name:    "multi%",
+		inputs:  []string{"sum(multi)", "count(size)"},
+		title:   func(*Pool) string { return "multi%" },
+		compute: func(p *Pool, in []int64, _ OpCounts) int64 { return percentOf(in[0], in[1]) },
+	},
+	{
+		name:    "top%",
+		inputs:  []string{"top(client)", "top(conn)"},
+		title:   func(p *Pool) string { return p.TopContributor().title() },
+		compute: func(p *Pool, in []int64, _ OpCounts) int64 { return p.TopContributor().share(in[0], in[1]) },
+	},
+}
+
+// perClient returns requests divided evenly among clients, rounded.  Any
+// requests imply at least one client, even if none was identified, so a key
+// with an unknown or single client reports all of its requests.
+func perClient(requests, clients int64) int64 {
+	if clients < 1 {
+		clients = 1
+	}
+	return (requests + clients/2) / clients
+}
+
+// derivedPlacement locates a derived column in a report.
+type derivedPlacement struct {
+	col *derivedColumn
+	// pos is the index of the column among the value columns of a report.
+	pos int
+	// inputOffset is the index of the first input of the column among the
+	// hidden aggregates.
+	inputOffset int
+}
+
+// extractDerived removes derived columns from format, returning the remaining
+// format followed by the hidden aggregates required by the derived columns,
+// and where each derived column belongs in a report.
+func extractDerived(format string) (string, []derivedPlacement) {
+	var placements []derivedPlacement
+	var remaining, hidden []string
+	var numValues int
+	for _, field := range strings.Split(format, ",") {
+		trimmed := strings.TrimSpace(field)
+		if col := findDerived(trimmed); col != nil {
+			placements = append(placements, derivedPlacement{
+				col:         col,
+				pos:         numValues,
+				inputOffset: len(hidden),
+			})
+			hidden = append(hidden, col.inputs...)
+			numValues++
+			continue
+		}
+		if strings.Contains(trimmed, "(") {
+			numValues++
+		}
+		remaining = append(remaining, field)
+	}
+	return strings.Join(append(remaining, hidden...), ","), placements
+}
+
+func findDerived(name string) *derivedColumn {
+	for i := range derivedColumns {
+		if derivedColumns[i].name == name {
+			return &derivedColumns[i]
+		}
+	}
+	return nil
+}
+
+// numHidden returns the number of hidden aggregates collected for the derived
+// columns of p.
+func (p *Pool) numHidden() int {
+	var n int
+	for _, d := range p.derived {
+		n += len(d.col.inputs)
+	}
+	return n
+}
+
+// valColNames returns the names of the value columns in reports.
+func (p *Pool) valColNames() []string {
+	// the request count follows the hidden aggregates of derived columns
+	visible := p.kaf.AggFields[:len(p.kaf.AggFields)-p.numHidden()-1]
+	if len(p.derived) == 0 {
+		return visible
+	}
+	names := make([]string, 0, len(visible)+len(p.derived))
+	for _, d := range p.derived {
+		for len(names) < d.pos {
+			names = append(names, visible[0])
+			visible = visible[1:]
+		}
+		names = append(names, d.col.title(p))
+	}
+	return append(names, visible...)
+}
+
+// withDerived returns the values for a report row given the results of
+// aggregation and the operations on the key, computing derived columns and
+// removing hidden aggregates.
+func (p *Pool) withDerived(vals []int64, ops OpCounts) []int64 {
+	if len(p.derived) == 0 {
+		return vals
+	}
+	numHidden := p.numHidden()
+	visible := vals[:len(vals)-numHidden]
+	hidden := vals[len(vals)-numHidden:]
+	res := make([]int64, 0, len(visible)+len(p.derived))
+	for _, d := range p.derived {
+		for len(res) < d.pos {
+			res = append(res, visible[0])
+			visible = visible[1:]
+		}
+		inputs := hidden[d.inputOffset : d.inputOffset+len(d.col.inputs)]
+		res = append(res, d.col.compute(p, inputs, ops))
+	}
+	return append(res, visible...)
+}
+
+// BandwidthBasis selects the traffic measured by the bw column.
+type BandwidthBasis int32
+
+const (
+	// ResponseBytes measures the size of values returned.
+	ResponseBytes BandwidthBasis = iota
+	// RequestBytes measures the size of requests.
+	RequestBytes
+	// CombinedBytes measures both requests and values returned.
+	CombinedBytes
+
+	numBandwidthBases
+)
+
+func (b BandwidthBasis) String() string {
+	switch b {
+	case ResponseBytes:
+		return "resp"
+	case RequestBytes:
+		return "req"
+	case CombinedBytes:
+		return "all"
+	default:
+		return "unknown"
+	}
+}
+
+// Next returns the basis following b, wrapping around after the last.
+func (b BandwidthBasis) Next() BandwidthBasis {
+	return (b + 1) % numBandwidthBases
+}
+
+func (b BandwidthBasis) bytes(response, request int64) int64 {
+	switch b {
+	case RequestBytes:
+		return request
+	case CombinedBytes:
+		return response + request
+	default:
+		return response
+	}
+}
+
+// SetBandwidthBasis selects the traffic measured by the bw column of future
+// reports.  SetBandwidthBasis is threadsafe.
+func (p *Pool) SetBandwidthBasis(b BandwidthBasis) {
+	atomic.StoreInt32(&p.bwBasis, int32(b))
+}
+
+// BandwidthBasis returns the traffic measured by the bw column.
+func (p *Pool) BandwidthBasis() BandwidthBasis {
+	return BandwidthBasis(atomic.LoadInt32(&p.bwBasis))
+}
@@ -0,0 +1,137 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestExtractDerived(t *testing.T) {
+	cases := []struct {
+		format    string
+		remaining string
+		pos       []int
+	}{
+		{"key,max(size),sum(size)", "key,max(size),sum(size)", nil},
+		{"key,score,sum(size)", "key,sum(size),sum(hit),sum(miss),sum(size)", []int{0}},
+		{"key, max(size), score", "key, max(size),sum(hit),sum(miss),sum(size)", []int{1}},
+		{"key,bw,score,max(size)", "key,max(size),sum(size),sum(reqsize),sum(hit),sum(miss),sum(size)", []int{0, 1}},
+		{"score", "sum(hit),sum(miss),sum(size)", []int{0}},
+	}
+	for _, c := range cases {
+		remaining, placements := extractDerived(c.format)
+		var pos []int
+		for _, d := range placements {
+			pos = append(pos, d.pos)
+		}
+		if remaining != c.remaining || !reflect.DeepEqual(pos, c.pos) {
+			t.Errorf("extractDerived(%q) = %q, %v", c.format, remaining, pos)
+		}
+	}
+}
+
+func TestWithDerived(t *testing.T) {
+	p, err := New(1, "key,max(size),score,sum(size),bw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// visible max(size)=100, sum(size)=1000, then hidden hit, miss, size for
+	// score and size, reqsize for bw
+	vals := []int64{100, 1000, 10, 30, 1000, 1000, 200}
+	res := p.withDerived(vals, OpCounts{})
+	expected := []int64{100, 3000, 1000, 1000}
+	if !reflect.DeepEqual(res, expected) {
+		t.Error(res)
+	}
+
+	p.SetBandwidthBasis(RequestBytes)
+	res = p.withDerived(vals, OpCounts{})
+	if res[3] != 200 {
+		t.Error(res)
+	}
+	p.SetBandwidthBasis(CombinedBytes)
+	res = p.withDerived(vals, OpCounts{})
+	if res[3] != 1200 {
+		t.Error(res)
+	}
+}
+
+func TestDerivedColumnNames(t *testing.T) {
+	p, err := New(1, "key,max(size),score,sum(size),bw,req/clnt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"max(size)", "score", "sum(size)", "bw(resp)", "req/clnt"}
+	if names := p.valColNames(); !reflect.DeepEqual(names, expected) {
+		t.Error(names)
+	}
+	p.SetBandwidthBasis(p.BandwidthBasis().Next())
+	expected[3] = "bw(req)"
+	if names := p.valColNames(); !reflect.DeepEqual(names, expected) {
+		t.Error(names)
+	}
+}
+
+func TestPerClient(t *testing.T) {
+	cases := []struct {
+		requests, clients, expected int64
+	}{
+		{10000, 400, 25},
+		{10000, 3, 3333},
+		{5, 2, 3},
+		{7, 1, 7},
+		{7, 0, 7},
+		{0, 0, 0},
+	}
+	for _, c := range cases {
+		if res := perClient(c.requests, c.clients); res != c.expected {
+			t.Errorf("perClient(%d, %d) = %d", c.requests, c.clients, res)
+		}
+	}
+}
+
+func TestBandwidthBasisWraps(t *testing.T) {
+	if b := CombinedBytes.Next(); b != ResponseBytes {
+		t.Error(b)
+	}
+}
+
+func TestCostColumn(t *testing.T) {
+	p, err := New(1, "key,cost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// hidden hit, miss, size, reqsize
+	vals := []int64{10, 30, 4096, 4096}
+	ops := OpCounts{Gets: 40, Sets: 2}
+	if res := p.withDerived(vals, ops); !reflect.DeepEqual(res, []int64{63}) {
+		t.Error(res)
+	}
+	p.SetCostWeights(CostWeights{Hit: 1})
+	if res := p.withDerived(vals, ops); !reflect.DeepEqual(res, []int64{10}) {
+		t.Error(res)
+	}
+}
+
+func TestSplitColumn(t *testing.T) {
+	p, err := New(1, "key,split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.HandleEvents([]model.Event{
+		{Type: model.EventGetHit, Key: "owned", Server: "10.0.0.1:11211"},
+		{Type: model.EventGetHit, Key: "owned", Server: "10.0.0.1:11211"},
+		{Type: model.EventGetHit, Key: "split", Server: "10.0.0.1:11211"},
+		{Type: model.EventGetMiss, Key: "split", Server: "10.0.0.2:11211"},
+	})
+	rep := p.Report(true)
+	rep.SortBy(0)
+	if len(rep.Rows) != 2 || rep.Rows[0].Values[0] != 0 || rep.Rows[1].Values[0] != 1 {
+		t.Error(rep.Rows)
+	}
+	if rep.KeysSplit != 1 {
+		t.Error("split keys:", rep.KeysSplit)
+	}
+}
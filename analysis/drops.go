@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DropCounter returns running totals of the inputs dropped and offered to a
+// stage upstream of a Pool, such as packets the decoder could not keep up
+// with.
+type DropCounter func() (dropped, total int64)
+
+// dropSnapshot records drop counters at a report boundary.
+type dropSnapshot struct {
+	dropped, total                 int64
+	upstreamDropped, upstreamTotal int64
+}
+
+// dropTracker computes the fraction of input dropped over the same window as
+// each report.  dropTracker is threadsafe.
+type dropTracker struct {
+	sync.Mutex
+	upstream DropCounter
+	// since is the snapshot at the start of the current window.
+	since dropSnapshot
+}
+
+func (dt *dropTracker) setUpstream(dc DropCounter) {
+	dt.Lock()
+	defer dt.Unlock()
+	dt.upstream = dc
+}
+
+func (dt *dropTracker) snapshot(s *Stats) dropSnapshot {
+	dropped := atomic.LoadInt64(&s.EventsDropped)
+	snap := dropSnapshot{
+		dropped: dropped,
+		total:   dropped + atomic.LoadInt64(&s.EventsHandled),
+	}
+	if dt.upstream != nil {
+		snap.upstreamDropped, snap.upstreamTotal = dt.upstream()
+	}
+	return snap
+}
+
+// dropRate returns the fraction of input lost upstream or in the Pool since
+// the start of the current window.  If shouldReset is true, a new window
+// begins.
+func (dt *dropTracker) dropRate(s *Stats, shouldReset bool) float64 {
+	dt.Lock()
+	defer dt.Unlock()
+	now := dt.snapshot(s)
+	kept := (1 - fraction(now.dropped-dt.since.dropped, now.total-dt.since.total)) *
+		(1 - fraction(now.upstreamDropped-dt.since.upstreamDropped, now.upstreamTotal-dt.since.upstreamTotal))
+	if shouldReset {
+		dt.since = now
+	}
+	return 1 - kept
+}
+
+func fraction(n, d int64) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// SetUpstreamDrops sets a counter of input dropped before reaching the Pool,
+// so that it is included in Report.DropRate.  SetUpstreamDrops is threadsafe.
+func (p *Pool) SetUpstreamDrops(dc DropCounter) {
+	p.drops.setUpstream(dc)
+}
@@ -0,0 +1,50 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestDropRateWindows(t *testing.T) {
+	var s Stats
+	var dt dropTracker
+
+	s.addHandled(90)
+	s.addDropped(10)
+	if r := dt.dropRate(&s, true); !closeTo(r, 0.1) {
+		t.Error("first window:", r)
+	}
+
+	// only the new window counts after a reset
+	s.addHandled(100)
+	if r := dt.dropRate(&s, false); r != 0 {
+		t.Error("second window:", r)
+	}
+	s.addDropped(100)
+	if r := dt.dropRate(&s, true); !closeTo(r, 0.5) {
+		t.Error("second window:", r)
+	}
+	if r := dt.dropRate(&s, true); r != 0 {
+		t.Error("empty window:", r)
+	}
+}
+
+func TestDropRateUpstream(t *testing.T) {
+	var s Stats
+	var dt dropTracker
+	var upDropped, upTotal int64
+	dt.setUpstream(func() (int64, int64) { return upDropped, upTotal })
+	dt.dropRate(&s, true)
+
+	// half of packets lost upstream, then 20% of the rest lost in analysis
+	upDropped, upTotal = 50, 100
+	s.addHandled(40)
+	s.addDropped(10)
+	if r := dt.dropRate(&s, true); !closeTo(r, 0.6) {
+		t.Error("combined:", r)
+	}
+}
@@ -0,0 +1,83 @@
+package analysis
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// MergeDuplicates merges each row of r whose key repeats that of an earlier
+// row into the earlier row, combining values by MergeRuleFor, and returns the
+// number of rows merged away.  A report should never list a key twice, so a
+// non-zero result indicates a bug in whatever assembled r, but merging keeps
+// the bug from showing a key twice or counting it twice in totals.
+func (r *Report) MergeDuplicates() int {
+	index := make(map[string]int, len(r.Rows))
+	var rules []MergeRule
+	kept := r.Rows[:0]
+	for _, row := range r.Rows {
+		k := flatKey(row.Key)
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(kept)
+			kept = append(kept, row)
+			continue
+		}
+		if rules == nil {
+			rules = make([]MergeRule, len(r.ValColNames))
+			for j, name := range r.ValColNames {
+				rules[j] = MergeRuleFor(name)
+			}
+		}
+		// kept rows may share their values with the caller
+		vals := append([]int64(nil), kept[i].Values...)
+		for j, v := range row.Values {
+			if j < len(vals) {
+				vals[j] = rules[j].merge(vals[j], v)
+			}
+		}
+		kept[i].Values = vals
+		kept[i].Ops = kept[i].Ops.add(row.Ops)
+	}
+	merged := len(r.Rows) - len(kept)
+	r.Rows = kept
+	if r.TotalRows >= merged {
+		r.TotalRows -= merged
+	}
+	return merged
+}
+
+// duplicateKeysMessage describes a report that listed keys more than once.
+func duplicateKeysMessage(n int) string {
+	return fmt.Sprintf("report listed %d duplicate keys, which were merged (bug)", n)
+}
+
+// checkDuplicates merges duplicate keys in rep, counting them and logging a
+// warning, or panicking if strict invariants are set.
+func (p *Pool) checkDuplicates(rep *Report) {
+	n := rep.MergeDuplicates()
+	if n == 0 {
+		return
+	}
+	if p.strictInvariants() {
+		panic("analysis: " + duplicateKeysMessage(n))
+	}
+	atomic.AddInt64(&p.stats.DuplicateKeys, int64(n))
+	if p.Logger != nil {
+		p.Logger.Log("Warning:", duplicateKeysMessage(n))
+	}
+}
+
+// SetStrictInvariants causes a report that breaks an invariant, such as by
+// listing a key twice, to panic instead of being repaired, so that the bug
+// responsible is caught in development.  SetStrictInvariants is threadsafe.
+func (p *Pool) SetStrictInvariants(strict bool) {
+	var v int32
+	if strict {
+		v = 1
+	}
+	atomic.StoreInt32(&p.strict, v)
+}
+
+func (p *Pool) strictInvariants() bool {
+	return atomic.LoadInt32(&p.strict) != 0
+}
@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// duplicatedReport returns a report listing key a twice, as a merge bug might.
+func duplicatedReport() Report {
+	return Report{
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"sum(size)", "max(size)"},
+		Rows: []ReportRow{
+			{Key: []string{"a"}, Values: []int64{10, 10}, Ops: OpCounts{Gets: 1}},
+			{Key: []string{"b"}, Values: []int64{5, 5}, Ops: OpCounts{Gets: 1}},
+			{Key: []string{"a"}, Values: []int64{30, 20}, Ops: OpCounts{Gets: 2, Sets: 1}},
+		},
+		TotalRows: 3,
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	rep := duplicatedReport()
+	if n := rep.MergeDuplicates(); n != 1 {
+		t.Error(n)
+	}
+	want := []ReportRow{
+		{Key: []string{"a"}, Values: []int64{40, 20}, Ops: OpCounts{Gets: 3, Sets: 1}},
+		{Key: []string{"b"}, Values: []int64{5, 5}, Ops: OpCounts{Gets: 1}},
+	}
+	if !reflect.DeepEqual(rep.Rows, want) || rep.TotalRows != 2 {
+		t.Error(rep.Rows, rep.TotalRows)
+	}
+	if n := rep.MergeDuplicates(); n != 0 {
+		t.Error("merged again:", n)
+	}
+}
+
+func TestCheckDuplicates(t *testing.T) {
+	p, err := New(1, "key,sum(size),max(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	logger := &countingLogger{}
+	p.Logger = logger
+
+	rep := duplicatedReport()
+	p.checkDuplicates(&rep)
+	if len(rep.Rows) != 2 || p.Stats().DuplicateKeys != 1 {
+		t.Error(rep.Rows, p.Stats().DuplicateKeys)
+	}
+	if len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "1 duplicate keys") {
+		t.Error(logger.messages)
+	}
+
+	p.SetStrictInvariants(true)
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic with strict invariants")
+		}
+	}()
+	rep = duplicatedReport()
+	p.checkDuplicates(&rep)
+}
+
+// TestReportUniqueKeys checks that rows keyed by fields other than the
+// datastore key are each gathered by a single worker.
+func TestReportUniqueKeys(t *testing.T) {
+	p, err := New(8, "client,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetStrictInvariants(true)
+	var evts []model.Event
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		evts = append(evts, model.Event{Type: model.EventGetHit, Key: key, Size: 10, Client: "10.0.0.1"})
+	}
+	p.HandleEvents(evts)
+	rep := p.Report(false)
+	if len(rep.Rows) != 1 || rep.Rows[0].Values[0] != 80 {
+		t.Error(rep.Rows)
+	}
+}
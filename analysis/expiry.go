@@ -0,0 +1,186 @@
+package analysis
+
+import (
+	"sync"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// DefaultExpiryTolerance is how long before a value's expected expiry a miss
+// on its key is still attributed to expiry, allowing for the server checking
+// expiry only to the second and for its clock differing from ours.
+const DefaultExpiryTolerance = 2 * time.Second
+
+// maxExpiryTracked limits the number of keys whose expiry is remembered.  Once
+// reached, the key whose value was stored longest ago is forgotten to make
+// room for another.
+const maxExpiryTracked = 1 << 16
+
+// KeyExpiry describes what is known of the expiry of a key from the values
+// stored for it.
+type KeyExpiry struct {
+	// Stored is when the last value was stored.
+	Stored time.Time
+	// TTL is the lifetime of the last value stored, or 0 if it never
+	// expires.
+	TTL time.Duration
+	// ExpiryMisses and ColdMisses count the misses since the last value
+	// was stored, after and before it expired.
+	ExpiryMisses int64
+	ColdMisses   int64
+}
+
+// Expires returns when the last value stored expires, or the zero time if it
+// never expires.
+func (ke KeyExpiry) Expires() time.Time {
+	if ke.TTL == 0 {
+		return time.Time{}
+	}
+	return ke.Stored.Add(ke.TTL)
+}
+
+// expiryTracker remembers when the values stored for keys expire, to tell
+// misses due to expiry, which call for a longer TTL or refreshing ahead of
+// expiry, from cold misses on keys never stored or evicted, which call for
+// populating the cache or giving it more memory.
+type expiryTracker struct {
+	tolerance time.Duration
+	now       func() time.Time
+
+	sync.Mutex
+	keys map[string]*KeyExpiry
+	// stores lists the keys stored, oldest first, to choose which to
+	// forget.  Entries for keys since deleted or stored again are skipped
+	// and eventually compacted away.
+	stores []storedKey
+}
+
+// storedKey records that a value was stored for key at stored.
+type storedKey struct {
+	key    string
+	stored time.Time
+}
+
+// record notes when each value stored in evts expires, forgets the values of
+// deleted keys, and marks misses on keys whose values have expired, in the
+// order they occurred.
+func (et *expiryTracker) record(evts []model.Event) {
+	if !hasExpiryEvents(evts) {
+		return
+	}
+	now := et.now()
+	et.Lock()
+	defer et.Unlock()
+	if et.keys == nil {
+		et.keys = make(map[string]*KeyExpiry)
+	}
+	for i, e := range evts {
+		switch e.Type {
+		case model.EventSet:
+			et.store(e, eventTime(e, now))
+		case model.EventDelete:
+			delete(et.keys, e.Key)
+		case model.EventGetMiss:
+			evts[i].Expired = et.miss(e.Key, eventTime(e, now))
+		}
+	}
+}
+
+// hasExpiryEvents returns true if evts includes sets, deletions or misses.
+func hasExpiryEvents(evts []model.Event) bool {
+	for _, e := range evts {
+		if e.Type == model.EventSet || e.Type == model.EventDelete || e.Type == model.EventGetMiss {
+			return true
+		}
+	}
+	return false
+}
+
+func (et *expiryTracker) store(e model.Event, now time.Time) {
+	ke, ok := et.keys[e.Key]
+	if !ok {
+		if len(et.keys) >= maxExpiryTracked {
+			et.evictOldest()
+		}
+		ke = &KeyExpiry{}
+		et.keys[e.Key] = ke
+	}
+	ttl := time.Duration(e.TTL) * time.Second
+	if e.TTL < 0 {
+		// expired on arrival, which a zero TTL would not express
+		ttl = time.Nanosecond
+	}
+	*ke = KeyExpiry{Stored: now, TTL: ttl}
+	if len(et.stores) >= 2*maxExpiryTracked {
+		et.compact()
+	}
+	et.stores = append(et.stores, storedKey{e.Key, now})
+}
+
+// current returns true if sk is the last store of a key still tracked.
+func (et *expiryTracker) current(sk storedKey) bool {
+	ke, ok := et.keys[sk.key]
+	return ok && ke.Stored.Equal(sk.stored)
+}
+
+// evictOldest forgets the key whose value was stored longest ago.
+func (et *expiryTracker) evictOldest() {
+	for len(et.stores) > 0 {
+		sk := et.stores[0]
+		et.stores = et.stores[1:]
+		if et.current(sk) {
+			delete(et.keys, sk.key)
+			return
+		}
+	}
+}
+
+// compact drops the entries of stores for keys since deleted or stored again.
+func (et *expiryTracker) compact() {
+	stores := make([]storedKey, 0, len(et.keys))
+	for _, sk := range et.stores {
+		if et.current(sk) {
+			stores = append(stores, sk)
+		}
+	}
+	et.stores = stores
+}
+
+// miss records a miss on key, returning true if its last value stored had
+// expired, give or take the tolerance.
+func (et *expiryTracker) miss(key string, now time.Time) bool {
+	ke, ok := et.keys[key]
+	if !ok {
+		return false
+	}
+	if ke.TTL == 0 || now.Before(ke.Expires().Add(-et.tolerance)) {
+		ke.ColdMisses++
+		return false
+	}
+	ke.ExpiryMisses++
+	return true
+}
+
+func (et *expiryTracker) expiry(key string) (KeyExpiry, bool) {
+	et.Lock()
+	defer et.Unlock()
+	ke, ok := et.keys[key]
+	if !ok {
+		return KeyExpiry{}, false
+	}
+	return *ke, true
+}
+
+// SetExpiryTolerance sets how long before a value's expected expiry a miss on
+// its key is still attributed to expiry.  SetExpiryTolerance is not
+// threadsafe and should be called before the Pool is in use.
+func (p *Pool) SetExpiryTolerance(d time.Duration) {
+	p.expiry.tolerance = d
+}
+
+// Expiry returns what is known of the expiry of key, and whether a value has
+// been seen stored for it.
+func (p *Pool) Expiry(key string) (KeyExpiry, bool) {
+	return p.expiry.expiry(key)
+}
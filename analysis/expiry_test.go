@@ -0,0 +1,176 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// fakeNow returns a clock that is set by the returned function, in seconds
+// from the start of the test.
+func fakeNow() (func() time.Time, func(secs float64)) {
+	start := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	return func() time.Time { return now }, func(secs float64) {
+		now = start.Add(time.Duration(secs * float64(time.Second)))
+	}
+}
+
+// fakeExpiryTracker returns an expiryTracker with the default tolerance on a
+// fake clock.
+func fakeExpiryTracker() (*expiryTracker, func(secs float64)) {
+	now, at := fakeNow()
+	return &expiryTracker{tolerance: DefaultExpiryTolerance, now: now}, at
+}
+
+func set(key string, ttl int) model.Event {
+	return model.Event{Type: model.EventSet, Key: key, Size: 10, TTL: ttl}
+}
+
+func miss(key string) model.Event {
+	return model.Event{Type: model.EventGetMiss, Key: key}
+}
+
+// expiredAt returns whether a miss on key at secs from start is attributed to
+// expiry.
+func expiredAt(et *expiryTracker, at func(float64), secs float64, key string) bool {
+	at(secs)
+	evts := []model.Event{miss(key)}
+	et.record(evts)
+	return evts[0].Expired
+}
+
+func TestExpiryBoundary(t *testing.T) {
+	cases := []struct {
+		secs    float64
+		expired bool
+	}{
+		{1, false},
+		{7.9, false},
+		// within the 2s tolerance of expiry at 10s
+		{8.1, true},
+		{10, true},
+		{3600, true},
+	}
+	for _, c := range cases {
+		et, at := fakeExpiryTracker()
+		et.record([]model.Event{set("k", 10)})
+		if e := expiredAt(et, at, c.secs, "k"); e != c.expired {
+			t.Errorf("miss at %vs: expired=%v", c.secs, e)
+		}
+	}
+}
+
+func TestExpiryColdMiss(t *testing.T) {
+	et, at := fakeExpiryTracker()
+	et.record([]model.Event{set("forever", 0), set("instant", -1)})
+	if expiredAt(et, at, 60, "never-set") {
+		t.Error("miss on key never stored attributed to expiry")
+	}
+	if expiredAt(et, at, 86400, "forever") {
+		t.Error("miss on key without TTL attributed to expiry")
+	}
+	if !expiredAt(et, at, 0, "instant") {
+		t.Error("miss on value expired on arrival not attributed to expiry")
+	}
+}
+
+func TestExpiryReset(t *testing.T) {
+	et, at := fakeExpiryTracker()
+	et.record([]model.Event{set("k", 10)})
+	expiredAt(et, at, 5, "k")
+	expiredAt(et, at, 15, "k")
+	expiredAt(et, at, 16, "k")
+	ke, ok := et.expiry("k")
+	if !ok || ke.ColdMisses != 1 || ke.ExpiryMisses != 2 {
+		t.Error(ke, ok)
+	}
+
+	// storing a value again restarts the TTL and the counts
+	at(20)
+	et.record([]model.Event{set("k", 10)})
+	if expiredAt(et, at, 25, "k") {
+		t.Error("miss before the new value expired attributed to expiry")
+	}
+	ke, _ = et.expiry("k")
+	if ke.ColdMisses != 1 || ke.ExpiryMisses != 0 || ke.Expires() != ke.Stored.Add(10*time.Second) {
+		t.Error(ke)
+	}
+}
+
+func TestExpiryInOrder(t *testing.T) {
+	et, at := fakeExpiryTracker()
+	et.record([]model.Event{set("k", 1)})
+	at(30)
+	hit := model.Event{Type: model.EventGetHit, Key: "k", Size: 10}
+	// the miss precedes the set that repopulates the key
+	evts := []model.Event{miss("k"), set("k", 1), hit}
+	et.record(evts)
+	expected := []model.Event{miss("k"), set("k", 1), hit}
+	expected[0].Expired = true
+	if !reflect.DeepEqual(evts, expected) {
+		t.Error(evts)
+	}
+}
+
+func TestExpiryDelete(t *testing.T) {
+	et, at := fakeExpiryTracker()
+	et.record([]model.Event{set("k", 10), {Type: model.EventDelete, Key: "k"}})
+	if _, ok := et.expiry("k"); ok {
+		t.Error("expiry of deleted key remembered")
+	}
+	if expiredAt(et, at, 30, "k") {
+		t.Error("miss on deleted key attributed to expiry")
+	}
+}
+
+// TestExpiryCap checks that once the most keys are tracked, a key stored
+// afterward is tracked in place of the key stored longest ago.
+func TestExpiryCap(t *testing.T) {
+	et, at := fakeExpiryTracker()
+	evts := make([]model.Event, maxExpiryTracked)
+	for i := range evts {
+		evts[i] = set(fmt.Sprint("k", i), 10)
+	}
+	et.record(evts)
+	at(1)
+	// storing k0 again leaves k1 the oldest
+	et.record([]model.Event{set("k0", 10), set("new", 10)})
+
+	if !expiredAt(et, at, 20, "new") {
+		t.Error("miss on key stored after the cap not attributed to expiry")
+	}
+	if _, ok := et.expiry("k1"); ok {
+		t.Error("oldest key not forgotten")
+	}
+	if _, ok := et.expiry("k0"); !ok {
+		t.Error("key stored again forgotten")
+	}
+	if len(et.keys) != maxExpiryTracked {
+		t.Error(len(et.keys), "keys tracked")
+	}
+}
+
+func TestExpiryMissFields(t *testing.T) {
+	p, err := New(1, "key,sum(expmiss),sum(coldmiss),count(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	now, at := fakeNow()
+	p.expiry.now = now
+	p.HandleEvents([]model.Event{set("k", 10), miss("k")})
+	at(11)
+	p.HandleEvents([]model.Event{miss("k"), miss("k")})
+
+	rep := p.Report(false)
+	if len(rep.Rows) != 1 || !reflect.DeepEqual(rep.Rows[0].Values, []int64{2, 1, 3}) {
+		t.Error(rep.Rows)
+	}
+	if _, ok := p.Expiry("k"); !ok {
+		t.Error("expiry of k unknown")
+	}
+}
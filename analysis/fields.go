@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseFields splits a comma-separated list of column names, such as
+// "key,sum(size)", returning nil for an empty list.
+func ParseFields(desc string) []string {
+	if strings.TrimSpace(desc) == "" {
+		return nil
+	}
+	fields := strings.Split(desc, ",")
+	for i, f := range fields {
+		fields[i] = strings.TrimSpace(f)
+	}
+	return fields
+}
+
+// CheckFields returns an error naming the first of fields that is not one of
+// the key or value columns given, and listing those that are.
+func CheckFields(fields, keyCols, valCols []string) error {
+	valid := append(append([]string(nil), keyCols...), valCols...)
+	for _, f := range fields {
+		if indexOf(valid, f) < 0 {
+			return fmt.Errorf("unknown field %q; valid fields are %s", f, strings.Join(valid, ", "))
+		}
+	}
+	return nil
+}
+
+// SelectFields keeps only the columns of r named in fields, in the order
+// given, with key columns still ahead of value columns.  Rows whose keys
+// become equal once key columns are dropped are merged by MergeRuleFor.  An
+// empty fields keeps every column.
+func (r *Report) SelectFields(fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	if err := CheckFields(fields, r.KeyColNames, r.ValColNames); err != nil {
+		return err
+	}
+	var keyIdx, valIdx []int
+	var keyCols, valCols []string
+	for _, f := range fields {
+		if i := indexOf(r.KeyColNames, f); i >= 0 {
+			keyIdx, keyCols = append(keyIdx, i), append(keyCols, f)
+		} else {
+			i = indexOf(r.ValColNames, f)
+			valIdx, valCols = append(valIdx, i), append(valCols, f)
+		}
+	}
+
+	rows := make([]ReportRow, len(r.Rows))
+	for i, row := range r.Rows {
+		rows[i] = ReportRow{
+			Key:    make([]string, len(keyIdx)),
+			Values: make([]int64, len(valIdx)),
+			Ops:    row.Ops,
+		}
+		for j, k := range keyIdx {
+			rows[i].Key[j] = row.Key[k]
+		}
+		for j, k := range valIdx {
+			rows[i].Values[j] = row.Values[k]
+		}
+	}
+	r.KeyColNames, r.ValColNames, r.Rows = keyCols, valCols, rows
+	r.MergeDuplicates()
+	return nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
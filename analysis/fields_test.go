@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	if f := ParseFields(" key, sum(size) "); !reflect.DeepEqual(f, []string{"key", "sum(size)"}) {
+		t.Error(f)
+	}
+	if f := ParseFields(" "); f != nil {
+		t.Error(f)
+	}
+}
+
+func TestCheckFields(t *testing.T) {
+	err := CheckFields([]string{"key", "requests"}, []string{"key"}, []string{"sum(size)"})
+	if err == nil || err.Error() != `unknown field "requests"; valid fields are key, sum(size)` {
+		t.Error(err)
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	rep := Report{
+		KeyColNames: []string{"key", "client"},
+		ValColNames: []string{"max(size)", "sum(size)"},
+		Rows: []ReportRow{
+			{Key: []string{"a", "10.0.0.1"}, Values: []int64{10, 30}, Ops: OpCounts{Gets: 3}},
+			{Key: []string{"b", "10.0.0.1"}, Values: []int64{5, 5}, Ops: OpCounts{Gets: 1}},
+			{Key: []string{"a", "10.0.0.2"}, Values: []int64{20, 20}, Ops: OpCounts{Gets: 1}},
+		},
+		TotalRows: 3,
+	}
+	// dropping client merges the rows of key a
+	if err := rep.SelectFields([]string{"sum(size)", "key", "max(size)"}); err != nil {
+		t.Fatal(err)
+	}
+	want := Report{
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"sum(size)", "max(size)"},
+		Rows: []ReportRow{
+			{Key: []string{"a"}, Values: []int64{50, 20}, Ops: OpCounts{Gets: 4}},
+			{Key: []string{"b"}, Values: []int64{5, 5}, Ops: OpCounts{Gets: 1}},
+		},
+		TotalRows: 2,
+	}
+	if !reflect.DeepEqual(rep, want) {
+		t.Errorf("%+v", rep)
+	}
+
+	if err := rep.SelectFields([]string{"client"}); err == nil {
+		t.Error("selected a dropped field")
+	}
+	if err := rep.SelectFields(nil); err != nil || !reflect.DeepEqual(rep, want) {
+		t.Error(err, rep)
+	}
+}
@@ -1,50 +1,93 @@
 package analysis
 
 import (
+	"errors"
 	"github.com/box/memsniff/protocol/model"
 	"regexp"
+	"strings"
 	"sync"
 )
 
-// filter is a threadsafe container for a regex.
+var errEmptyExclusion = errors.New("nothing to exclude after !")
+
+// filter is a threadsafe container for the patterns keys are matched against.
 type filter struct {
 	sync.RWMutex
-	r *regexp.Regexp
+	m *keyMatcher
+}
+
+// keyMatcher selects the keys matching any of include, or all keys if there
+// are none, and none of exclude, so that exclusions take precedence.
+type keyMatcher struct {
+	include, exclude []*regexp.Regexp
+}
+
+func (m *keyMatcher) match(key string) bool {
+	for _, re := range m.exclude {
+		if re.MatchString(key) {
+			return false
+		}
+	}
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, re := range m.include {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
 }
 
 func (f *filter) filterEvents(rs []model.Event) []model.Event {
-	re := f.regex()
-	if re == nil {
+	m := f.matcher()
+	if m == nil {
 		return rs
 	}
 
 	matches := make([]model.Event, 0, len(rs))
 	for _, r := range rs {
-		if re.MatchString(r.Key) {
+		if m.match(r.Key) {
 			matches = append(matches, r)
 		}
 	}
 	return matches
 }
 
-func (f *filter) regex() *regexp.Regexp {
+func (f *filter) matcher() *keyMatcher {
 	f.RLock()
 	defer f.RUnlock()
-	return f.r
+	return f.m
 }
 
-func (f *filter) setPattern(pattern string) (err error) {
-	var r *regexp.Regexp
-	if pattern != "" {
-		r, err = regexp.Compile(pattern)
+// setPatterns replaces the patterns of f.  A pattern starting with ! excludes
+// the keys matching the rest of it, and one starting with \! matches a literal
+// !.  Empty patterns are ignored.  If any pattern is invalid, f is unchanged.
+func (f *filter) setPatterns(patterns ...string) error {
+	m := &keyMatcher{}
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		terms := &m.include
+		if strings.HasPrefix(p, "!") {
+			terms, p = &m.exclude, p[1:]
+			if p == "" {
+				return errEmptyExclusion
+			}
+		}
+		re, err := regexp.Compile(p)
 		if err != nil {
-			return
+			return err
 		}
+		*terms = append(*terms, re)
+	}
+	if len(m.include) == 0 && len(m.exclude) == 0 {
+		m = nil
 	}
 
 	f.Lock()
 	defer f.Unlock()
-	f.r = r
-
-	return
+	f.m = m
+	return nil
 }
@@ -7,7 +7,7 @@ import (
 
 func TestEmptyMatchesAll(t *testing.T) {
 	f := &filter{}
-	_ = f.setPattern("")
+	_ = f.setPatterns("")
 	if !match(f, "hello") {
 		t.Fail()
 	}
@@ -18,7 +18,7 @@ func TestEmptyMatchesAll(t *testing.T) {
 
 func TestPatternMatchesSubstring(t *testing.T) {
 	f := &filter{}
-	_ = f.setPattern("world")
+	_ = f.setPatterns("world")
 	if !match(f, "hello world") {
 		t.Fail()
 	}
@@ -26,7 +26,7 @@ func TestPatternMatchesSubstring(t *testing.T) {
 
 func TestPatternFiltersNonMatching(t *testing.T) {
 	f := &filter{}
-	_ = f.setPattern("world")
+	_ = f.setPatterns("world")
 	if match(f, "hello nurse") {
 		t.Fail()
 	}
@@ -34,8 +34,8 @@ func TestPatternFiltersNonMatching(t *testing.T) {
 
 func TestEmptyOverwritesPrior(t *testing.T) {
 	f := &filter{}
-	_ = f.setPattern("hello")
-	_ = f.setPattern("")
+	_ = f.setPatterns("hello")
+	_ = f.setPatterns("")
 	if !match(f, "foobar") {
 		t.Fail()
 	}
@@ -43,7 +43,7 @@ func TestEmptyOverwritesPrior(t *testing.T) {
 
 func TestInvalidMatchesAll(t *testing.T) {
 	f := &filter{}
-	err := f.setPattern("[abc")
+	err := f.setPatterns("[abc")
 	if err == nil {
 		t.Error("did not return error for invalid regex")
 	}
@@ -59,3 +59,68 @@ func match(f *filter, key string) bool {
 		},
 	})) == 1
 }
+
+func TestExcludedPatterns(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		keys     map[string]bool
+	}{
+		// exclusions take precedence over inclusions
+		{[]string{"^session:", "!^session:health"}, map[string]bool{
+			"session:1234":   true,
+			"session:health": false,
+			"user:1234":      false,
+		}},
+		{[]string{"!^session:health", "^session:"}, map[string]bool{
+			"session:health:1": false,
+			"session:1234":     true,
+		}},
+		// without inclusions, every key not excluded matches
+		{[]string{"!health", "!^tmp:"}, map[string]bool{
+			"user:1234":   true,
+			"user:health": false,
+			"tmp:1":       false,
+		}},
+		// a key matching any inclusion matches
+		{[]string{"^user:", "^session:"}, map[string]bool{
+			"user:1":    true,
+			"session:1": true,
+			"item:1":    false,
+		}},
+		// \! at the start matches a literal !
+		{[]string{`\!important`}, map[string]bool{
+			"!important": true,
+			"important":  false,
+		}},
+		{[]string{`!\!`}, map[string]bool{
+			"a!b": false,
+			"ab":  true,
+		}},
+	}
+	for _, c := range cases {
+		f := &filter{}
+		if err := f.setPatterns(c.patterns...); err != nil {
+			t.Fatal(c.patterns, err)
+		}
+		for key, want := range c.keys {
+			if match(f, key) != want {
+				t.Errorf("%q: matched %q: %v", c.patterns, key, !want)
+			}
+		}
+	}
+}
+
+func TestInvalidPatternsKeepPrior(t *testing.T) {
+	f := &filter{}
+	if err := f.setPatterns("^user:"); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][]string{{"^session:", "![abc"}, {"!"}} {
+		if err := f.setPatterns(bad...); err == nil {
+			t.Error("no error for", bad)
+		}
+		if !match(f, "user:1") || match(f, "session:1") {
+			t.Error("prior patterns replaced by", bad)
+		}
+	}
+}
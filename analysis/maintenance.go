@@ -0,0 +1,83 @@
+package analysis
+
+import (
+	"sync"
+	"time"
+
+	"github.com/box/memsniff/log"
+)
+
+// DefaultMaintenance is the length of a maintenance window started without
+// giving one.
+const DefaultMaintenance = 30 * time.Minute
+
+// maintenanceWindow is a period during which wild swings in traffic are
+// expected, such as a planned failover, and alerts are marked as suppressed.
+// maintenanceWindow is threadsafe.
+type maintenanceWindow struct {
+	sync.Mutex
+	until time.Time
+	// announced is true once the end of the window has been logged.
+	announced bool
+}
+
+func (mw *maintenanceWindow) set(until time.Time) {
+	mw.Lock()
+	defer mw.Unlock()
+	mw.until, mw.announced = until, false
+}
+
+// active returns the end of the window and true if now falls within it.
+func (mw *maintenanceWindow) active(now time.Time) (time.Time, bool) {
+	mw.Lock()
+	defer mw.Unlock()
+	return mw.until, now.Before(mw.until)
+}
+
+// ended returns the end of the window and true the first time it is called
+// once the window has passed.
+func (mw *maintenanceWindow) ended(now time.Time) (time.Time, bool) {
+	mw.Lock()
+	defer mw.Unlock()
+	if mw.until.IsZero() || mw.announced || now.Before(mw.until) {
+		return time.Time{}, false
+	}
+	mw.announced = true
+	return mw.until, true
+}
+
+// suppressedLogger marks each message logged to Logger as a suppressed alert.
+type suppressedLogger struct {
+	log.Logger
+	until time.Time
+}
+
+func (sl suppressedLogger) Log(items ...interface{}) {
+	sl.Logger.Log(append(items, "[suppressed: maintenance until "+sl.until.Format("15:04")+"]")...)
+}
+
+// alertLogger returns the Logger to which alerts are logged, which marks them
+// as suppressed during a maintenance window.
+func (p *Pool) alertLogger() log.Logger {
+	if p.Logger == nil {
+		return nil
+	}
+	if until, ok := p.maintenance.active(p.now()); ok {
+		return suppressedLogger{p.Logger, until}
+	}
+	return p.Logger
+}
+
+// SetMaintenance starts a maintenance window lasting until the given time, or
+// ends the current one if until is the zero Time.  Alerts are still logged
+// during the window, marked as suppressed, and the end of the window is logged
+// by the first report built after it.  SetMaintenance is threadsafe.
+func (p *Pool) SetMaintenance(until time.Time) {
+	p.maintenance.set(until)
+}
+
+// Maintenance returns the end of the current maintenance window, and false if
+// none is in progress.  Maintenance is threadsafe.
+func (p *Pool) Maintenance() (time.Time, bool) {
+	return p.maintenance.active(p.now())
+}
@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// TestMaintenanceSuppressesAlerts checks that alerts raised during a
+// maintenance window are still logged, marked as suppressed, and that the end
+// of the window is logged once.
+func TestMaintenanceSuppressesAlerts(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var logger countingLogger
+	p.Logger = &logger
+	now := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	p.SetAmplificationAlert(100, 1000)
+
+	p.SetMaintenance(now.Add(30 * time.Minute))
+	if until, ok := p.Maintenance(); !ok || !until.Equal(now.Add(30*time.Minute)) {
+		t.Error("window not started:", until, ok)
+	}
+	p.HandleEvents([]model.Event{traffic("a:1", 5, 5000)})
+	p.Report(true)
+	if len(logger.messages) != 1 || !strings.HasPrefix(logger.messages[0], "ALERT:") ||
+		!strings.HasSuffix(logger.messages[0], "[suppressed: maintenance until 09:30]") {
+		t.Error("alert during window:", logger.messages)
+	}
+
+	now = now.Add(31 * time.Minute)
+	if _, ok := p.Maintenance(); ok {
+		t.Error("window still active after it ended")
+	}
+	p.Report(true)
+	p.Report(true)
+	if len(logger.messages) != 2 || logger.messages[1] != "Maintenance window ended at09:30:00" {
+		t.Error("end of window:", logger.messages)
+	}
+	p.HandleEvents([]model.Event{traffic("b:1", 5, 5000)})
+	if len(logger.messages) != 3 || strings.Contains(logger.messages[2], "suppressed") {
+		t.Error("alert after window:", logger.messages)
+	}
+}
+
+// TestMaintenanceEndedEarly checks that a window ended by SetMaintenance is not
+// announced as having run out.
+func TestMaintenanceEndedEarly(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var logger countingLogger
+	p.Logger = &logger
+	p.Report(true)
+	p.SetMaintenance(time.Now().Add(time.Hour))
+	p.SetMaintenance(time.Time{})
+	if _, ok := p.Maintenance(); ok {
+		t.Error("window not ended")
+	}
+	p.Report(true)
+	if len(logger.messages) != 0 {
+		t.Error(logger.messages)
+	}
+}
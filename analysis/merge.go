@@ -0,0 +1,261 @@
+package analysis
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errColumnMismatch is returned when reports with different columns are
+// combined.
+var errColumnMismatch = errors.New("reports have different columns")
+
+// MergeRule describes how values of a column are combined across reports, and
+// so how far a merged value can be trusted.
+type MergeRule int
+
+const (
+	// MergeSum adds values, giving the exact total.  It applies to sum and
+	// count aggregates and the bw and cost columns.
+	MergeSum MergeRule = iota
+	// MergeMax keeps the largest value, giving the exact maximum.
+	MergeMax
+	// MergeMin keeps the smallest value, giving the exact minimum.
+	MergeMin
+	// MergeBoundByMax keeps the largest value, which is an upper bound on
+	// the merged mean, percentile or share of the busiest caller.  The true
+	// value cannot be recovered from per-report summaries.
+	MergeBoundByMax
+	// MergeBoundBySum adds distinct counts, giving an upper bound that is
+	// exact when reports saw disjoint sets of values.
+	MergeBoundBySum
+	// MergeApproximate keeps the largest value, for derived columns such as
+	// score and req/clnt that are not monotonic in their inputs.  The merged
+	// value is indicative only.
+	MergeApproximate
+)
+
+// MergeRuleFor returns the rule by which values of the named column are
+// merged.
+func MergeRuleFor(column string) MergeRule {
+	agg := column
+	if i := strings.IndexByte(column, '('); i >= 0 {
+		agg = column[:i]
+	}
+	switch agg {
+	case "sum", "count", "bw", "cost":
+		return MergeSum
+	case "max":
+		return MergeMax
+	case "min":
+		return MergeMin
+	case "avg", "mean", "multi%", "top", "top%", "top clnt%", "top conn%":
+		return MergeBoundByMax
+	case "distinct":
+		return MergeBoundBySum
+	}
+	if len(agg) >= 3 && agg[0] == 'p' && strings.IndexFunc(agg[1:], notDigit) < 0 {
+		return MergeBoundByMax
+	}
+	return MergeApproximate
+}
+
+func notDigit(r rune) bool {
+	return r < '0' || r > '9'
+}
+
+// Exact returns true if values merged by r are exact rather than estimates.
+func (r MergeRule) Exact() bool {
+	return r == MergeSum || r == MergeMax || r == MergeMin
+}
+
+func (r MergeRule) merge(a, b int64) int64 {
+	switch r {
+	case MergeSum, MergeBoundBySum:
+		return a + b
+	case MergeMin:
+		if b < a {
+			return b
+		}
+		return a
+	}
+	if b > a {
+		return b
+	}
+	return a
+}
+
+// MergeReports combines reports on the same columns from several sources into
+// one, merging the values of each key according to MergeRuleFor.  A key
+// missing from some reports is merged from those it appears in.
+//
+// The merged report has the latest Timestamp of its inputs, and its rows are
+// ordered by key so that the result does not depend on the order of reports.
+// Rank it with SortBy or Limit as needed.  Keys left out of limited inputs
+// are not counted, so TotalRows is the number of distinct keys in Rows.  Skew
+// and KeysSplit cannot be recovered from the inputs, and are left empty.
+func MergeReports(reports []Report) (Report, error) {
+	if len(reports) == 0 {
+		return Report{}, nil
+	}
+	merged := Report{
+		KeyColNames: reports[0].KeyColNames,
+		ValColNames: reports[0].ValColNames,
+		RankBasis:   reports[0].RankBasis,
+	}
+	rules := make([]MergeRule, len(merged.ValColNames))
+	for i, name := range merged.ValColNames {
+		rules[i] = MergeRuleFor(name)
+	}
+
+	index := make(map[string]int)
+	for _, rep := range reports {
+		if !sameColumns(rep, merged) {
+			return Report{}, errColumnMismatch
+		}
+		if rep.Timestamp.After(merged.Timestamp) {
+			merged.Timestamp = rep.Timestamp
+		}
+		merged.KeysSingleGet += rep.KeysSingleGet
+		merged.KeysMultiGet += rep.KeysMultiGet
+		merged.UnattributedResponses += rep.UnattributedResponses
+		merged.UnattributedBytes += rep.UnattributedBytes
+		merged.Connections = mergeConns(merged.Connections, rep.Connections)
+		// each node sees the restarts of the servers it talks to
+		merged.Restarts = append(merged.Restarts, rep.Restarts...)
+		merged.ConfigChanges = append(merged.ConfigChanges, rep.ConfigChanges...)
+		merged.RoutedRequests += rep.RoutedRequests
+		merged.MisroutedRequests += rep.MisroutedRequests
+		merged.Misroutes = mergeMisroutes(merged.Misroutes, rep.Misroutes)
+		merged.ColdConnKeys = mergeColdConnKeys(merged.ColdConnKeys, rep.ColdConnKeys)
+		merged.SLO = mergeSLOStatus(merged.SLO, rep.SLO)
+		merged.Warmup = mergeWarmup(merged.Warmup, rep.Warmup)
+		merged.Discontinuous = merged.Discontinuous || rep.Discontinuous
+		if rep.Decay > merged.Decay {
+			merged.Decay = rep.Decay
+		}
+		for _, row := range rep.Rows {
+			k := flatKey(row.Key)
+			i, ok := index[k]
+			if !ok {
+				index[k] = len(merged.Rows)
+				merged.Rows = append(merged.Rows, ReportRow{
+					Key:    row.Key,
+					Values: append([]int64(nil), row.Values...),
+					Ops:    row.Ops,
+				})
+				continue
+			}
+			vals := merged.Rows[i].Values
+			for j, v := range row.Values {
+				vals[j] = rules[j].merge(vals[j], v)
+			}
+			merged.Rows[i].Ops = merged.Rows[i].Ops.add(row.Ops)
+		}
+	}
+	sortByKey(merged.Rows)
+	merged.TotalRows = len(merged.Rows)
+	return merged, nil
+}
+
+// Delta describes the changes from one report to another on the same columns.
+// Each list is ordered by key.
+type Delta struct {
+	// Before and After are the times of the compared reports.
+	Before, After time.Time
+	KeyColNames   []string
+	ValColNames   []string
+	// Changed holds keys present in both reports.
+	Changed []DeltaRow
+	// Added holds keys present only in the later report.
+	Added []ReportRow
+	// Removed holds keys present only in the earlier report.
+	Removed []ReportRow
+}
+
+// DeltaRow compares the values of a single key in two reports.
+type DeltaRow struct {
+	Key    []string
+	Before []int64
+	After  []int64
+	// Change is After minus Before for each column.  Where either value is
+	// an estimate, such as a merged bound, so is the change, and it is not
+	// itself a bound.
+	Change []int64
+}
+
+// DiffReports compares report b against an earlier report a.  Keys present in
+// both are listed in Changed even if none of their values differ.
+func DiffReports(a, b Report) (Delta, error) {
+	if !sameColumns(a, b) {
+		return Delta{}, errColumnMismatch
+	}
+	d := Delta{
+		Before:      a.Timestamp,
+		After:       b.Timestamp,
+		KeyColNames: b.KeyColNames,
+		ValColNames: b.ValColNames,
+	}
+	before := make(map[string]ReportRow, len(a.Rows))
+	for _, row := range a.Rows {
+		before[flatKey(row.Key)] = row
+	}
+	for _, row := range b.Rows {
+		k := flatKey(row.Key)
+		prev, ok := before[k]
+		if !ok {
+			d.Added = append(d.Added, row)
+			continue
+		}
+		delete(before, k)
+		change := make([]int64, len(row.Values))
+		for i := range row.Values {
+			change[i] = row.Values[i] - prev.Values[i]
+		}
+		d.Changed = append(d.Changed, DeltaRow{
+			Key:    row.Key,
+			Before: prev.Values,
+			After:  row.Values,
+			Change: change,
+		})
+	}
+	for _, row := range before {
+		d.Removed = append(d.Removed, row)
+	}
+
+	sort.Slice(d.Changed, func(i, j int) bool {
+		return flatKey(d.Changed[i].Key) < flatKey(d.Changed[j].Key)
+	})
+	sortByKey(d.Added)
+	sortByKey(d.Removed)
+	return d, nil
+}
+
+func sameColumns(a, b Report) bool {
+	return stringsEqual(a.KeyColNames, b.KeyColNames) && stringsEqual(a.ValColNames, b.ValColNames)
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// flatKey joins the key fields of a row into a single string that sorts in
+// the same order as the fields.
+func flatKey(key []string) string {
+	return strings.Join(key, "\x00")
+}
+
+func sortByKey(rows []ReportRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		return flatKey(rows[i].Key) < flatKey(rows[j].Key)
+	})
+}
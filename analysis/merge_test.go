@@ -0,0 +1,160 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	mergeT0 = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	mergeT1 = mergeT0.Add(time.Second)
+)
+
+func mergeReport(ts time.Time, rows ...ReportRow) Report {
+	return Report{
+		Timestamp:   ts,
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"sum(size)", "max(size)", "min(size)", "p99(size)", "distinct(client)", "score"},
+		Rows:        rows,
+		TotalRows:   len(rows),
+	}
+}
+
+func row(key string, vals ...int64) ReportRow {
+	return ReportRow{Key: []string{key}, Values: vals}
+}
+
+func TestMergeRuleFor(t *testing.T) {
+	cases := map[string]MergeRule{
+		"sum(size)":        MergeSum,
+		"count(size)":      MergeSum,
+		"bw(req)":          MergeSum,
+		"cost":             MergeSum,
+		"max(size)":        MergeMax,
+		"min(reqsize)":     MergeMin,
+		"avg(size)":        MergeBoundByMax,
+		"p99(size)":        MergeBoundByMax,
+		"p999(size)":       MergeBoundByMax,
+		"distinct(client)": MergeBoundBySum,
+		"score":            MergeApproximate,
+		"req/clnt":         MergeApproximate,
+		"pending":          MergeApproximate,
+	}
+	for name, expected := range cases {
+		if r := MergeRuleFor(name); r != expected {
+			t.Errorf("MergeRuleFor(%q) = %d", name, r)
+		}
+	}
+	if !MergeMax.Exact() || MergeBoundByMax.Exact() {
+		t.Error("Exact")
+	}
+}
+
+func TestMergeReports(t *testing.T) {
+	a := mergeReport(mergeT0,
+		row("b", 10, 5, 1, 5, 2, 7),
+		row("a", 1, 1, 1, 1, 1, 1))
+	b := mergeReport(mergeT1,
+		row("b", 20, 3, 0, 9, 3, 4),
+		row("c", 2, 2, 2, 2, 1, 2))
+
+	merged, err := MergeReports([]Report{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := mergeReport(mergeT1,
+		row("a", 1, 1, 1, 1, 1, 1),
+		row("b", 30, 5, 0, 9, 5, 7),
+		row("c", 2, 2, 2, 2, 1, 2))
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v\ngot %v", expected, merged)
+	}
+
+	// merging in the other order gives the same result
+	reversed, _ := MergeReports([]Report{b, a})
+	if !reflect.DeepEqual(reversed, merged) {
+		t.Errorf("order dependent: %v", reversed)
+	}
+
+	// inputs are not modified
+	if a.Rows[0].Values[0] != 10 {
+		t.Error("input modified:", a.Rows[0])
+	}
+}
+
+func TestMergeReportsEmpty(t *testing.T) {
+	merged, err := MergeReports(nil)
+	if err != nil || len(merged.Rows) != 0 {
+		t.Error(merged, err)
+	}
+}
+
+func TestMergeReportsColumnMismatch(t *testing.T) {
+	a := mergeReport(mergeT0)
+	b := mergeReport(mergeT1)
+	b.ValColNames = []string{"sum(size)"}
+	if _, err := MergeReports([]Report{a, b}); err != errColumnMismatch {
+		t.Error("expected mismatch, got", err)
+	}
+	if _, err := DiffReports(a, b); err != errColumnMismatch {
+		t.Error("expected mismatch, got", err)
+	}
+}
+
+func TestDiffReports(t *testing.T) {
+	a := mergeReport(mergeT0,
+		row("gone", 1, 1, 1, 1, 1, 1),
+		row("same", 5, 5, 5, 5, 5, 5),
+		row("grew", 10, 5, 1, 5, 2, 7))
+	b := mergeReport(mergeT1,
+		row("new", 2, 2, 2, 2, 1, 2),
+		row("grew", 20, 3, 0, 9, 3, 4),
+		row("same", 5, 5, 5, 5, 5, 5))
+
+	d, err := DiffReports(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Before != mergeT0 || d.After != mergeT1 {
+		t.Error("times:", d.Before, d.After)
+	}
+	expectedChanged := []DeltaRow{
+		{
+			Key:    []string{"grew"},
+			Before: []int64{10, 5, 1, 5, 2, 7},
+			After:  []int64{20, 3, 0, 9, 3, 4},
+			Change: []int64{10, -2, -1, 4, 1, -3},
+		},
+		{
+			Key:    []string{"same"},
+			Before: []int64{5, 5, 5, 5, 5, 5},
+			After:  []int64{5, 5, 5, 5, 5, 5},
+			Change: []int64{0, 0, 0, 0, 0, 0},
+		},
+	}
+	if !reflect.DeepEqual(d.Changed, expectedChanged) {
+		t.Error("changed:", d.Changed)
+	}
+	if len(d.Added) != 1 || d.Added[0].Key[0] != "new" {
+		t.Error("added:", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Key[0] != "gone" {
+		t.Error("removed:", d.Removed)
+	}
+}
+
+func TestDiffMultiFieldKeys(t *testing.T) {
+	// keys that would collide if fields were concatenated without a separator
+	a := Report{KeyColNames: []string{"key", "client"}, ValColNames: []string{"sum(size)"},
+		Rows: []ReportRow{{Key: []string{"ab", "c"}, Values: []int64{1}}}}
+	b := Report{KeyColNames: []string{"key", "client"}, ValColNames: []string{"sum(size)"},
+		Rows: []ReportRow{{Key: []string{"a", "bc"}, Values: []int64{2}}}}
+	d, err := DiffReports(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Changed) != 0 || len(d.Added) != 1 || len(d.Removed) != 1 {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,205 @@
+package analysis
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// maxClientsReported is the number of clients with the most misrouted
+// requests included in each report.
+const maxClientsReported = 256
+
+// ClientRouting counts the requests from one client checked against the ring,
+// and those sent to a server other than the one owning their key.
+type ClientRouting struct {
+	Client    string
+	Requests  int64
+	Misrouted int64
+}
+
+// MisroutedPercent returns the percentage of requests that were misrouted.
+func (cr ClientRouting) MisroutedPercent() float64 {
+	if cr.Requests == 0 {
+		return 0
+	}
+	return float64(cr.Misrouted) * 100 / float64(cr.Requests)
+}
+
+// KeyRouting counts the requests for one key checked against the ring, and
+// those sent to a server other than Owner, the one the ring assigns it to.
+type KeyRouting struct {
+	Owner     string
+	Requests  int64
+	Misrouted int64
+}
+
+// routeChecker compares the server handling each retrieval with the one a
+// consistent-hash ring says owns its key, over the same window as each report.
+// In a capture on clients after the ring is resized, clients still hashing to
+// the old layout send most of their requests to the wrong server, where they
+// miss.  routeChecker is threadsafe.
+type routeChecker struct {
+	sync.Mutex
+	// enabled is 1 while ring is set, so that record need not lock
+	// otherwise.
+	enabled int32
+	ring    *Ring
+	clients map[string]*ClientRouting
+	keys    map[string]*KeyRouting
+	// requests and misrouted are the totals over all clients.
+	requests, misrouted int64
+}
+
+func (rc *routeChecker) setRing(r *Ring) {
+	rc.Lock()
+	defer rc.Unlock()
+	rc.ring = r
+	var enabled int32
+	if r != nil {
+		enabled = 1
+	}
+	atomic.StoreInt32(&rc.enabled, enabled)
+	rc.reset()
+}
+
+func (rc *routeChecker) reset() {
+	rc.clients = make(map[string]*ClientRouting)
+	rc.keys = make(map[string]*KeyRouting)
+	rc.requests, rc.misrouted = 0, 0
+}
+
+// record checks the server of each retrieval in evts against the ring.  Keys
+// are checked as sent by the client, before any normalization.
+func (rc *routeChecker) record(evts []model.Event) {
+	if atomic.LoadInt32(&rc.enabled) == 0 || !hasServers(evts) {
+		return
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	if rc.ring == nil {
+		return
+	}
+	for _, e := range evts {
+		if e.Server == "" || (e.Type != model.EventGetHit && e.Type != model.EventGetMiss) {
+			continue
+		}
+		kr, ok := rc.keys[e.Key]
+		if !ok {
+			kr = &KeyRouting{Owner: rc.ring.Server(e.Key)}
+			if len(rc.keys) < maxOwnedKeys {
+				rc.keys[e.Key] = kr
+			}
+		}
+		cr, ok := rc.clients[e.Client]
+		if !ok {
+			cr = &ClientRouting{Client: e.Client}
+			if len(rc.clients) < maxConnsTracked {
+				rc.clients[e.Client] = cr
+			}
+		}
+		misrouted := int64(0)
+		if e.Server != kr.Owner {
+			misrouted = 1
+		}
+		kr.Requests++
+		kr.Misrouted += misrouted
+		cr.Requests++
+		cr.Misrouted += misrouted
+		rc.requests++
+		rc.misrouted += misrouted
+	}
+}
+
+// window returns the number of requests checked and misrouted since the start
+// of the current window, and the clients with the most misrouted requests,
+// most first.  If shouldReset is true, a new window begins.
+func (rc *routeChecker) window(shouldReset bool) (requests, misrouted int64, clients []ClientRouting) {
+	rc.Lock()
+	defer rc.Unlock()
+	if rc.ring == nil {
+		return 0, 0, nil
+	}
+	for _, cr := range rc.clients {
+		if cr.Misrouted > 0 {
+			clients = append(clients, *cr)
+		}
+	}
+	sortMisroutes(clients)
+	if len(clients) > maxClientsReported {
+		clients = clients[:maxClientsReported]
+	}
+	requests, misrouted = rc.requests, rc.misrouted
+	if shouldReset {
+		rc.reset()
+	}
+	return requests, misrouted, clients
+}
+
+// hasServers returns true if any event in evts names its server.
+func hasServers(evts []model.Event) bool {
+	for _, e := range evts {
+		if e.Server != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// sortMisroutes orders clients by misrouted requests, most first.
+func sortMisroutes(clients []ClientRouting) {
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Misrouted != clients[j].Misrouted {
+			return clients[i].Misrouted > clients[j].Misrouted
+		}
+		return clients[i].Client < clients[j].Client
+	})
+}
+
+// mergeMisroutes combines the routing of clients in two reports, adding the
+// counts of clients present in both.
+func mergeMisroutes(a, b []ClientRouting) []ClientRouting {
+	index := make(map[string]int, len(a))
+	merged := append([]ClientRouting(nil), a...)
+	for i, cr := range merged {
+		index[cr.Client] = i
+	}
+	for _, cr := range b {
+		i, ok := index[cr.Client]
+		if !ok {
+			index[cr.Client] = len(merged)
+			merged = append(merged, cr)
+			continue
+		}
+		merged[i].Requests += cr.Requests
+		merged[i].Misrouted += cr.Misrouted
+	}
+	sortMisroutes(merged)
+	return merged
+}
+
+func (rc *routeChecker) routing(key string) (KeyRouting, bool) {
+	rc.Lock()
+	defer rc.Unlock()
+	kr, ok := rc.keys[key]
+	if !ok {
+		return KeyRouting{}, false
+	}
+	return *kr, true
+}
+
+// SetRing sets the consistent-hash ring against which the server handling each
+// retrieval is checked, or stops checking if r is nil.  The ring describes the
+// servers that clients in the capture should be sharding keys across.
+func (p *Pool) SetRing(r *Ring) {
+	p.routes.setRing(r)
+}
+
+// Routing returns the server owning key according to the ring set by
+// SetRing, with the requests for key since the start of the current report
+// and how many were sent to another server, and whether any have been seen.
+func (p *Pool) Routing(key string) (KeyRouting, bool) {
+	return p.routes.routing(key)
+}
@@ -0,0 +1,66 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func routed(client, key, server string) model.Event {
+	return model.Event{Type: model.EventGetMiss, Key: key, Client: client, Server: server}
+}
+
+func TestMisroutes(t *testing.T) {
+	r := evenRing(t, 3)
+	owner := r.Server("k")
+	var wrong string
+	for _, s := range []string{"10.0.0.1:11211", "10.0.0.2:11211"} {
+		if s != owner {
+			wrong = s
+			break
+		}
+	}
+
+	var rc routeChecker
+	rc.record([]model.Event{routed("c1", "k", wrong)})
+	if requests, _, _ := rc.window(false); requests != 0 {
+		t.Error("checked without a ring")
+	}
+	rc.setRing(r)
+	rc.record([]model.Event{
+		routed("c1", "k", owner),
+		routed("c2", "k", wrong),
+		routed("c2", "k", wrong),
+		routed("c3", "k", wrong),
+		{Type: model.EventGetHit, Key: "k", Client: "c4"},
+		{Type: model.EventSet, Key: "k", Client: "c4", Server: wrong},
+	})
+	kr, ok := rc.routing("k")
+	if !ok || kr != (KeyRouting{Owner: owner, Requests: 4, Misrouted: 3}) {
+		t.Error(kr, ok)
+	}
+	requests, misrouted, clients := rc.window(true)
+	if requests != 4 || misrouted != 3 {
+		t.Error(requests, misrouted)
+	}
+	want := []ClientRouting{{"c2", 2, 2}, {"c3", 1, 1}}
+	if !reflect.DeepEqual(clients, want) {
+		t.Error(clients)
+	}
+	if requests, _, clients := rc.window(true); requests != 0 || clients != nil {
+		t.Error("after reset:", requests, clients)
+	}
+	if _, ok := rc.routing("k"); ok {
+		t.Error("routing kept after reset")
+	}
+}
+
+func TestMergeMisroutes(t *testing.T) {
+	a := []ClientRouting{{"x", 10, 1}, {"y", 4, 2}}
+	b := []ClientRouting{{"x", 5, 5}}
+	want := []ClientRouting{{"x", 15, 6}, {"y", 4, 2}}
+	if merged := mergeMisroutes(a, b); !reflect.DeepEqual(merged, want) {
+		t.Error(merged)
+	}
+}
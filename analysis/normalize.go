@@ -0,0 +1,86 @@
+package analysis
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// KeyNormalization is a set of transformations applied to keys before they
+// are analyzed, so that keys differing only in ways a client should not have
+// introduced are counted together.
+type KeyNormalization int32
+
+const (
+	// NormalizeLower converts keys to lower case.
+	NormalizeLower KeyNormalization = 1 << iota
+	// NormalizeTrim removes leading and trailing whitespace from keys.
+	NormalizeTrim
+)
+
+var errBadNormalization = errors.New("key normalization must be a list of lower and trim")
+
+// ParseKeyNormalization parses a comma-separated list of normalizations, each
+// one of "lower" or "trim".  The empty string disables normalization.
+func ParseKeyNormalization(desc string) (KeyNormalization, error) {
+	var n KeyNormalization
+	if strings.TrimSpace(desc) == "" {
+		return n, nil
+	}
+	for _, name := range strings.Split(desc, ",") {
+		switch strings.TrimSpace(name) {
+		case "lower":
+			n |= NormalizeLower
+		case "trim":
+			n |= NormalizeTrim
+		default:
+			return 0, errBadNormalization
+		}
+	}
+	return n, nil
+}
+
+// apply returns key with the normalizations in n applied.  Trimming happens
+// first, though the order does not change the result.
+func (n KeyNormalization) apply(key string) string {
+	if n&NormalizeTrim != 0 {
+		key = strings.TrimSpace(key)
+	}
+	if n&NormalizeLower != 0 {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// normalizer is a threadsafe container for a KeyNormalization.
+type normalizer struct {
+	n int32
+}
+
+func (nz *normalizer) set(n KeyNormalization) {
+	atomic.StoreInt32(&nz.n, int32(n))
+}
+
+// apply returns key with the current normalizations applied.
+func (nz *normalizer) apply(key string) string {
+	return KeyNormalization(atomic.LoadInt32(&nz.n)).apply(key)
+}
+
+// normalizeEvents rewrites the key of each event in place, returning the
+// number of events whose key changed.
+func (nz *normalizer) normalizeEvents(evts []model.Event) int {
+	n := KeyNormalization(atomic.LoadInt32(&nz.n))
+	if n == 0 {
+		return 0
+	}
+	var changed int
+	for i := range evts {
+		if key := n.apply(evts[i].Key); key != evts[i].Key {
+			evts[i].Key = key
+			changed++
+		}
+	}
+	return changed
+}
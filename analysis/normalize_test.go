@@ -0,0 +1,66 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestParseKeyNormalization(t *testing.T) {
+	cases := []struct {
+		desc     string
+		expected KeyNormalization
+	}{
+		{"", 0},
+		{"lower", NormalizeLower},
+		{"trim", NormalizeTrim},
+		{"lower,trim", NormalizeLower | NormalizeTrim},
+		{" trim , lower ", NormalizeLower | NormalizeTrim},
+	}
+	for _, c := range cases {
+		n, err := ParseKeyNormalization(c.desc)
+		if err != nil || n != c.expected {
+			t.Errorf("ParseKeyNormalization(%q) = %v, %v", c.desc, n, err)
+		}
+	}
+	if _, err := ParseKeyNormalization("upper"); err != errBadNormalization {
+		t.Error("expected error, got", err)
+	}
+}
+
+func TestNormalizeEvents(t *testing.T) {
+	var nz normalizer
+	evts := []model.Event{{Key: "User:1"}, {Key: "user:1 "}, {Key: "user:1"}}
+	if n := nz.normalizeEvents(evts); n != 0 || evts[0].Key != "User:1" {
+		t.Error("normalized by default:", n, evts)
+	}
+
+	nz.set(NormalizeLower | NormalizeTrim)
+	if n := nz.normalizeEvents(evts); n != 2 {
+		t.Error("changed:", n)
+	}
+	for _, e := range evts {
+		if e.Key != "user:1" {
+			t.Errorf("%q", e.Key)
+		}
+	}
+}
+
+// TestNormalizeBeforeWatch checks that watched keys match normalized keys.
+func TestNormalizeBeforeWatch(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetKeyNormalization(NormalizeLower | NormalizeTrim)
+	p.SetWatchedKeys([]string{"user:1"})
+	p.HandleEvents([]model.Event{{Type: model.EventGetHit, Key: " User:1", Size: 5}})
+
+	if samples, _ := p.WatchedSizes("user:1"); len(samples) != 1 {
+		t.Error("samples:", samples)
+	}
+	if n := p.Stats().KeysNormalized; n != 1 {
+		t.Error("normalized:", n)
+	}
+}
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// maxServersPerKey limits the servers counted separately for each key.
+const maxServersPerKey = 8
+
+// maxOwnedKeys limits the keys whose servers are counted in a single window,
+// shared among the workers.
+const maxOwnedKeys = 1 << 16
+
+// otherServers names the requests for a key handled by servers beyond the
+// first maxServersPerKey.
+const otherServers = "(others)"
+
+// ServerCount is the number of requests for a key handled by one server.
+type ServerCount struct {
+	Server   string
+	Requests int64
+}
+
+// ownershipTracker counts the requests for each key handled by each server,
+// over the same window as each report.  In a capture on clients that shard
+// keys by consistent hashing, every key should be served by a single server;
+// keys served by several suggest clients disagreeing on the ring, or the ring
+// changing, each of which causes duplicate cache fills.  Each worker has its
+// own ownershipTracker, counting the keys assigned to it, so every key is
+// counted by a single tracker.  ownershipTracker is threadsafe.
+type ownershipTracker struct {
+	sync.Mutex
+	// limit is the number of keys counted in a window, or 0 for
+	// maxOwnedKeys.
+	limit int
+	keys  map[string][]ServerCount
+	// split is the number of keys served by more than one server.
+	split int
+}
+
+// record counts the server of each retrieval in evts.
+func (ot *ownershipTracker) record(evts []model.Event) {
+	if len(evts) == 0 {
+		return
+	}
+	limit := ot.limit
+	if limit == 0 {
+		limit = maxOwnedKeys
+	}
+	ot.Lock()
+	defer ot.Unlock()
+	if ot.keys == nil {
+		ot.keys = make(map[string][]ServerCount)
+	}
+	for _, e := range evts {
+		if e.Server == "" || (e.Type != model.EventGetHit && e.Type != model.EventGetMiss) {
+			continue
+		}
+		servers, ok := ot.keys[e.Key]
+		if !ok && len(ot.keys) >= limit {
+			continue
+		}
+		ot.keys[e.Key] = ot.add(servers, e.Server)
+	}
+}
+
+// add counts a request handled by server among servers, returning the
+// updated counts.
+func (ot *ownershipTracker) add(servers []ServerCount, server string) []ServerCount {
+	for i := range servers {
+		if servers[i].Server == server {
+			servers[i].Requests++
+			return servers
+		}
+	}
+	if len(servers) == 1 {
+		ot.split++
+	}
+	if len(servers) < maxServersPerKey {
+		return append(servers, ServerCount{server, 1})
+	}
+	if last := &servers[len(servers)-1]; last.Server == otherServers {
+		last.Requests++
+		return servers
+	}
+	return append(servers, ServerCount{otherServers, 1})
+}
+
+// window returns the number of keys served by more than one server since the
+// start of the current window.  If shouldReset is true, a new window begins.
+func (ot *ownershipTracker) window(shouldReset bool) int {
+	ot.Lock()
+	defer ot.Unlock()
+	split := ot.split
+	if shouldReset {
+		ot.keys = nil
+		ot.split = 0
+	}
+	return split
+}
+
+func (ot *ownershipTracker) servers(key string) ([]ServerCount, bool) {
+	ot.Lock()
+	defer ot.Unlock()
+	servers, ok := ot.keys[key]
+	if !ok {
+		return nil, false
+	}
+	res := append([]ServerCount(nil), servers...)
+	sort.SliceStable(res, func(i, j int) bool {
+		if (res[i].Server == otherServers) != (res[j].Server == otherServers) {
+			return res[j].Server == otherServers
+		}
+		return res[i].Requests > res[j].Requests
+	})
+	return res, true
+}
+
+// Servers returns the number of requests for key handled by each server since
+// the start of the current report, busiest first, and whether any have been
+// seen.  key is as reported, after any normalization and grouping.  Beyond
+// the first few servers, requests are counted together under "(others)",
+// listed last.
+func (p *Pool) Servers(key string) ([]ServerCount, bool) {
+	return p.workers[p.keySlot(key)].owners.servers(key)
+}
+
+// keysSplit returns the number of keys served by more than one server over
+// the period of a report, from every worker.  If shouldReset is true, a new
+// period begins.
+func (p *Pool) keysSplit(shouldReset bool) int {
+	var split int
+	for _, w := range p.workers {
+		split += w.owners.window(shouldReset)
+	}
+	return split
+}
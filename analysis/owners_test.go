@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func served(key, server string) model.Event {
+	return model.Event{Type: model.EventGetHit, Key: key, Server: server}
+}
+
+func TestOwnership(t *testing.T) {
+	var ot ownershipTracker
+	ot.record([]model.Event{
+		served("a", "s1"),
+		served("a", "s2"),
+		served("a", "s2"),
+		served("b", "s1"),
+		{Type: model.EventGetHit, Key: "c"},
+	})
+	servers, ok := ot.servers("a")
+	if !ok || !reflect.DeepEqual(servers, []ServerCount{{"s2", 2}, {"s1", 1}}) {
+		t.Error(servers, ok)
+	}
+	if _, ok := ot.servers("c"); ok {
+		t.Error("servers recorded for an event without a server")
+	}
+	if split := ot.window(true); split != 1 {
+		t.Error("first window:", split)
+	}
+	if split := ot.window(true); split != 0 {
+		t.Error("empty window:", split)
+	}
+	if _, ok := ot.servers("a"); ok {
+		t.Error("servers kept after reset")
+	}
+}
+
+func TestOwnershipBounded(t *testing.T) {
+	var ot ownershipTracker
+	var evts []model.Event
+	for i := 0; i < maxServersPerKey+3; i++ {
+		evts = append(evts, served("k", fmt.Sprint("s", i)))
+	}
+	evts = append(evts, served("k", "s0"))
+	ot.record(evts)
+	servers, _ := ot.servers("k")
+	if len(servers) != maxServersPerKey+1 {
+		t.Fatal(servers)
+	}
+	if servers[0] != (ServerCount{"s0", 2}) || servers[maxServersPerKey] != (ServerCount{otherServers, 3}) {
+		t.Error(servers)
+	}
+	if split := ot.window(false); split != 1 {
+		t.Error("split keys:", split)
+	}
+}
+
+func TestOwnershipUnkeyedReport(t *testing.T) {
+	p, err := New(4, "client,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var evts []model.Event
+	for i := 0; i < 8; i++ {
+		evt := served("a", fmt.Sprint("s", i%2))
+		evt.Client = fmt.Sprint("10.0.0.", i)
+		evts = append(evts, evt)
+	}
+	p.HandleEvents(evts)
+	if rep := p.Report(false); rep.KeysSplit != 1 {
+		t.Error("split keys:", rep.KeysSplit)
+	}
+	if servers, ok := p.Servers("a"); !ok || !reflect.DeepEqual(servers, []ServerCount{{"s0", 4}, {"s1", 4}}) {
+		t.Error(servers, ok)
+	}
+}
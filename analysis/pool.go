@@ -8,6 +8,7 @@ import (
 	"github.com/box/memsniff/protocol/model"
 	"hash/fnv"
 	"sync/atomic"
+	"time"
 )
 
 // Pool tracks datastore activity by hashing inputs to fixed workers.
@@ -17,12 +18,53 @@ import (
 // by the Pool.
 type Pool struct {
 	// A Logger instance for debugging.  No logging is done if nil.
-	Logger  log.Logger
-	workers []worker
-	filter  filter
-	stats   Stats
+	Logger       log.Logger
+	workers      []worker
+	normalize    normalizer
+	filter       filter
+	stats        Stats
+	drops        dropTracker
+	batches      batchTracker
+	unattributed unattributedTracker
+	conns        connTracker
+	restarts     restartTracker
+	skew         skewTracker
+	routes       routeChecker
+	coldConns    coldConnSettings
+	slo          sloTracker
+	warmup       warmupTracker
+	clock        captureClock
+	expiry       expiryTracker
+	watches      watchList
+	samples      valueSampler
+	classify     classifyStage
+	maintenance  maintenanceWindow
+	configs      configLog
+	chunks       chunkStage
 
 	kaf aggregate.KeyAggregatorFactory
+	// derived lists the derived columns in reports, in order.
+	derived      []derivedPlacement
+	scoreWeights ScoreWeights
+	costWeights  CostWeights
+	bwBasis      int32
+	rankBasis    int32
+	topBy        int32
+	// strict is 1 if reports breaking an invariant panic.
+	strict int32
+	// discontinuous is 1 if the next report is to be marked
+	// Discontinuous.
+	discontinuous int32
+	// partitionByKey is true if the key fields of reports include the
+	// datastore key, so that events can be assigned to workers by key
+	// alone.
+	partitionByKey bool
+	// decay is how long a key may go unseen before it is removed from
+	// reports that do not reset, or 0 to keep keys indefinitely.
+	decay time.Duration
+	now   func() time.Time
+	// onReport is called with every report built, or is nil.
+	onReport ReportHook
 }
 
 // Stats contains performance metrics for a Pool.
@@ -31,6 +73,32 @@ type Stats struct {
 	EventsHandled int64
 	// number of events sent to HandleEvents that were discarded
 	EventsDropped int64
+	// number of events whose key was changed by key normalization, and
+	// so may have been counted with another key
+	KeysNormalized int64
+	// number of calls made to the Classifier set by SetClassifier, and
+	// their total duration in nanoseconds
+	ClassifierCalls int64
+	ClassifierNanos int64
+	// number of keys retrieved alone and alongside others in a single
+	// request, counted before the filter pattern is applied
+	KeysSingleGet int64
+	KeysMultiGet  int64
+	// number of responses that could not be matched to a key, and their
+	// total size in bytes
+	UnattributedResponses int64
+	UnattributedBytes     int64
+	// number of rows merged into others by reports listing a key more
+	// than once, which should never happen
+	DuplicateKeys int64
+}
+
+// ClassifierCost returns the mean duration of a call to the Classifier.
+func (s Stats) ClassifierCost() time.Duration {
+	if s.ClassifierCalls == 0 {
+		return 0
+	}
+	return time.Duration(s.ClassifierNanos / s.ClassifierCalls)
 }
 
 func (s *Stats) addHandled(n int) {
@@ -42,67 +110,159 @@ func (s *Stats) addDropped(n int) {
 
 }
 
+func (s *Stats) addNormalized(n int) {
+	if n > 0 {
+		atomic.AddInt64(&s.KeysNormalized, int64(n))
+	}
+}
+
+func (s *Stats) addClassified(calls int, elapsed time.Duration) {
+	if calls > 0 {
+		atomic.AddInt64(&s.ClassifierCalls, int64(calls))
+		atomic.AddInt64(&s.ClassifierNanos, int64(elapsed))
+	}
+}
+
 // New returns a new Pool.
 //
 // numWorkers determines the number of workers to hotlists to create.  More
 // workers gives more potential parallelism and performance, but increased
 // memory consumption.
 //
-// reportSize determines the number of entries returned from Report.
+// format lists the key fields and aggregates to report, as accepted by
+// aggregate.NewKeyAggregatorFactory.  It may also include the derived columns
+// "score", the cache-efficiency score described by ScoreWeights, "cost", the
+// estimated server CPU described by CostWeights, "bw", the total bytes
+// transferred as selected by SetBandwidthBasis, "req/clnt", the requests per
+// distinct client, "multi%", the percentage of retrievals made as part of a
+// multi-key request, and "split", 1 for a key handled by more than one server.
 func New(numWorkers int, format string) (*Pool, error) {
-	kaf, err := aggregate.NewKeyAggregatorFactory(format)
+	format, derived := extractDerived(format)
+	kaf, err := aggregate.NewKeyAggregatorFactory(format + "," + requestCountInput)
 	if err != nil {
 		return nil, err
 	}
 	p := &Pool{
-		kaf:     kaf,
-		workers: make([]worker, numWorkers),
+		kaf:          kaf,
+		workers:      make([]worker, numWorkers),
+		derived:      derived,
+		scoreWeights: DefaultScoreWeights,
+		costWeights:  DefaultCostWeights,
+		expiry:       expiryTracker{tolerance: DefaultExpiryTolerance, now: time.Now},
+		restarts:     restartTracker{closes: DefaultRestartCloses, span: DefaultRestartWindow},
+		now:          time.Now,
+	}
+
+	for _, f := range kaf.KeyFields {
+		if f == "key" {
+			p.partitionByKey = true
+		}
 	}
 
 	for i := 0; i < numWorkers; i++ {
-		p.workers[i] = newWorker(kaf)
+		owners := &ownershipTracker{limit: maxOwnedKeys / numWorkers}
+		p.workers[i] = newWorker(kaf, owners, &coldConnTracker{
+			settings: &p.coldConns,
+			alerts:   p.alertLogger,
+			limit:    maxOwnedKeys / numWorkers,
+		})
 	}
 
 	return p, nil
 }
 
 // HandleEvents adds records for a set of datastore operations to the Pool.
+// The events pass through these stages in order:
+//
+//  1. The traffic of each connection, responses that could not be matched
+//     to a key, and connections closed and accepted by servers are counted,
+//     the last checked for restarts, and are not otherwise analyzed.
+//  2. The server handling each retrieval is checked against the ring set by
+//     SetRing, and its latency recorded for the SLO set by SetLatencySLO.
+//  3. Keys are normalized as set by SetKeyNormalization, so that every later
+//     stage sees normalized keys.
+//  4. Values stored and misses are timed against expiry, keys stored or
+//     served are checked against the reference list set by
+//     SetReferenceKeys, and multi-key gets are counted.
+//  5. Sizes of watched keys are recorded, along with any values sampled for
+//     them.
+//  6. Events not matching the filter pattern are discarded.
+//  7. Chunks are folded into their values as set by SetChunkPattern.
+//  8. Keys are replaced by their group if a Classifier is set, so watched
+//     keys and the filter pattern apply to individual keys.
+//  9. The events are dispatched to their assigned workers, which also count
+//     the servers handling each key and its requests made on newly opened
+//     connections.  If a worker is overloaded, all inputs for that worker
+//     will be discarded and statistics for this Pool updated to reflect the
+//     lost data.
 //
-// The events will be dispatched to their assigned workers.  If a worker
-// is overloaded, all inputs for that worker  will be discarded and statistics
-// for this Pool updated to reflect the lost data.
+// evts may be modified in place.
 //
 // HandleEvents is threadsafe.
 func (p *Pool) HandleEvents(evts []model.Event) {
-	perWorkerEvents := p.partitionEvents(p.filter.filterEvents(evts))
-	for i, events := range perWorkerEvents {
-		if len(events) > 0 {
-			err := p.workers[i].handleEvents(events)
+	p.clock.observe(evts, p.now())
+	alerts := p.alertLogger()
+	evts = p.conns.take(alerts, evts)
+	evts = p.restarts.take(alerts, evts, p.now())
+	evts = p.unattributed.take(&p.stats, p.Logger, evts)
+	p.routes.record(evts)
+	p.slo.record(evts)
+	p.stats.addNormalized(p.normalize.normalizeEvents(evts))
+	p.expiry.record(evts)
+	p.warmup.record(evts)
+	countBatches(&p.stats, evts)
+	p.watches.record(alerts, evts)
+	p.samples.record(evts)
+	evts = p.filter.filterEvents(evts)
+	p.dispatch(p.chunks.fold(evts, p.now()))
+}
+
+// dispatch classifies evts and sends them to the workers building reports.
+func (p *Pool) dispatch(evts []model.Event) {
+	p.stats.addClassified(p.classify.classifyEvents(evts))
+	for i, b := range p.partitionEvents(evts) {
+		if len(b.rows) > 0 || len(b.keys) > 0 {
+			err := p.workers[i].handleEvents(b)
 			if err == errQueueFull {
-				p.stats.addDropped(len(events))
+				p.stats.addDropped(len(b.rows))
 				continue
 			}
-			p.stats.addHandled(len(events))
+			p.stats.addHandled(len(b.rows))
 		}
 	}
 }
 
-func (p *Pool) partitionEvents(evts []model.Event) [][]model.Event {
-	perWorkerEvents := make([][]model.Event, len(p.workers))
+// partitionEvents assigns each event to a worker by its datastore key, which
+// also decides the worker counting it against its key.  If reports are not
+// keyed by datastore key, the rows are assigned separately by their own key
+// fields.
+func (p *Pool) partitionEvents(evts []model.Event) []batch {
+	perWorker := make([]batch, len(p.workers))
 	for _, e := range evts {
 		slot := p.keySlot(e.Key)
-		perWorkerEvents[slot] = append(perWorkerEvents[slot], e)
+		if p.partitionByKey {
+			perWorker[slot].rows = append(perWorker[slot].rows, e)
+			perWorker[slot].keys = perWorker[slot].rows
+			continue
+		}
+		perWorker[slot].keys = append(perWorker[slot].keys, e)
+		// every event contributing to a row must reach the same worker,
+		// or the row would be reported once per worker
+		slot = p.keySlot(p.kaf.FlatKey(e))
+		perWorker[slot].rows = append(perWorker[slot].rows, e)
 	}
-	return perWorkerEvents
+	return perWorker
 }
 
-// SetFilterPattern sets an RE2 pattern for future data points.  Only operations
-// on keys matching pattern will have statistics collected.  Setting a
-// new filter invalidates existing results, so current statistics are cleared
-// before returning.  If pattern is the empty string statistics are collected
-// for all keys.
-func (p *Pool) SetFilterPattern(pattern string) error {
-	err := p.filter.setPattern(pattern)
+// SetFilterPattern sets RE2 patterns for future data points.  Only operations
+// on keys matching any of the patterns will have statistics collected, except
+// that a pattern starting with ! excludes the keys matching the rest of it,
+// whatever else they match.  A pattern starting with \! matches a literal !.
+// Setting a new filter invalidates existing results, so current statistics
+// are cleared before returning.  If no patterns are given, or all are the
+// empty string, statistics are collected for all keys.
+func (p *Pool) SetFilterPattern(patterns ...string) error {
+	err := p.filter.setPatterns(patterns...)
 	if err != nil {
 		return err
 	}
@@ -110,6 +270,113 @@ func (p *Pool) SetFilterPattern(pattern string) error {
 	return nil
 }
 
+// SetKeyNormalization sets the transformations applied to keys before they are
+// analyzed.  SetKeyNormalization is threadsafe.
+func (p *Pool) SetKeyNormalization(n KeyNormalization) {
+	p.normalize.set(n)
+}
+
+// SetClassifier causes activity to be reported by the group c assigns each key
+// to, rather than by key.  The keys seen in each group are available from
+// GroupKeys.  SetClassifier is not threadsafe and should be called before the
+// Pool is in use.
+func (p *Pool) SetClassifier(c Classifier) {
+	p.classify.c = c
+}
+
+// GroupKeys returns up to 8 of the keys most recently seen in group, oldest
+// first, and whether any key has been assigned to group.
+func (p *Pool) GroupKeys(group string) ([]string, bool) {
+	return p.classify.groupKeys(group)
+}
+
+// DelimiterCounts returns the number of keys grouped using each delimiter, if
+// the Classifier set by SetClassifier counts them, or nil.
+func (p *Pool) DelimiterCounts() map[string]int64 {
+	if dc, ok := p.classify.c.(DelimiterCounter); ok {
+		return dc.DelimiterCounts()
+	}
+	return nil
+}
+
+// SetAcknowledgedKeys replaces the set of keys the user has acknowledged as
+// expected to be busy.  No alerts are logged for acknowledged keys.
+// SetAcknowledgedKeys is threadsafe.
+func (p *Pool) SetAcknowledgedKeys(keys []string) {
+	p.watches.setAcked(keys)
+	p.coldConns.setAcked(keys)
+}
+
+// SetWatchedKeys replaces the set of keys for which the size of each value
+// returned is recorded, regardless of any filter pattern.  Up to the most
+// recent 256 sizes are retained for each key.
+func (p *Pool) SetWatchedKeys(keys []string) {
+	p.watches.setKeys(keys)
+}
+
+// Watched returns whether key is among those set by SetWatchedKeys, after any
+// normalization of keys.  Watched is threadsafe.
+func (p *Pool) Watched(key string) bool {
+	return p.watches.watched(p.normalize.apply(key))
+}
+
+// SetGrowthAlert causes a warning to be logged when the value of a watched key
+// grows by at least bytes without shrinking in between.  A value of 0
+// disables warnings.
+func (p *Pool) SetGrowthAlert(bytes int) {
+	p.watches.setGrowthAlert(bytes)
+}
+
+// WatchedSizes returns the recorded value sizes for key, oldest first, and
+// whether key is being watched.
+func (p *Pool) WatchedSizes(key string) ([]SizeSample, bool) {
+	return p.watches.history(key)
+}
+
+// SetScoreWeights changes the weights used to compute the cache-efficiency
+// score in future reports.  SetScoreWeights is not threadsafe and should be
+// called before the Pool is in use.
+func (p *Pool) SetScoreWeights(w ScoreWeights) {
+	p.scoreWeights = w
+}
+
+// SetCostWeights changes the model used to compute the cost column in future
+// reports.  SetCostWeights is not threadsafe and should be called before the
+// Pool is in use.
+func (p *Pool) SetCostWeights(w CostWeights) {
+	p.costWeights = w
+}
+
+// SetCumulativeDecay causes keys not seen for d to be removed when building a
+// report that does not reset the Pool, so that in cumulative mode keys that
+// were busy long ago give way to those busy now.  Keys are removed at most once
+// per report, and are only timed from the first report after decay is set.  A
+// value of 0 keeps keys indefinitely.  SetCumulativeDecay is not threadsafe and
+// should be called before the Pool is in use.
+func (p *Pool) SetCumulativeDecay(d time.Duration) {
+	p.decay = d
+}
+
+// ReportHook receives each report built by a Pool, with all of its rows.  It
+// is called before the report is returned, and must neither modify the report
+// nor retain its rows, which may be reordered or discarded by the caller.
+type ReportHook func(Report)
+
+// SetReportHook causes h to be called with every report built by Report or
+// ReportTop, such as to archive them, or disables it if h is nil.
+// SetReportHook is not threadsafe and should be called before the Pool is in
+// use.
+func (p *Pool) SetReportHook(h ReportHook) {
+	p.onReport = h
+}
+
+// MarkDiscontinuous marks the next report built by Report or ReportTop as
+// Discontinuous, before it is passed to the ReportHook, because the period it
+// covers was interrupted.
+func (p *Pool) MarkDiscontinuous() {
+	atomic.StoreInt32(&p.discontinuous, 1)
+}
+
 // Reset clears all recorded activity from this Pool.  This operation is
 // asynchronous, and may still be in progress when Reset returns.  New data
 // added by calling HandleGetResponse after Reset returns may be lost, and
@@ -121,12 +388,30 @@ func (p *Pool) Reset() {
 	}
 }
 
+// Close shuts down all workers once queued events are processed, and waits for
+// them to exit.  HandleEvents, Report, and Reset must not be called during or
+// after Close.
+func (p *Pool) Close() {
+	for i := range p.workers {
+		p.workers[i].close()
+	}
+}
+
 // Stats returns a record of total activity reported to this Pool, including
 // input that was dropped due to not keeping up.
 func (p *Pool) Stats() Stats {
 	return p.stats
 }
 
+// QueueDepth returns the number of batches of events waiting for workers.
+func (p *Pool) QueueDepth() int {
+	var n int
+	for _, w := range p.workers {
+		n += len(w.eventChan)
+	}
+	return n
+}
+
 func (p *Pool) keySlot(key string) int {
 	hash := fnv.New64a()
 	// writing to a Hash can never fail
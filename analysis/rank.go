@@ -0,0 +1,80 @@
+package analysis
+
+import "sync/atomic"
+
+// OpCounts counts the operations on a key by class.
+type OpCounts struct {
+	Gets    int64
+	Sets    int64
+	Deletes int64
+	// SetBytes is the total size of the values stored.
+	SetBytes int64
+}
+
+func (oc OpCounts) add(other OpCounts) OpCounts {
+	return OpCounts{oc.Gets + other.Gets, oc.Sets + other.Sets, oc.Deletes + other.Deletes, oc.SetBytes + other.SetBytes}
+}
+
+// RankBasis selects the operations by which keys are ranked in reports.
+type RankBasis int32
+
+const (
+	// RankAll ranks keys by the columns given to SortBy, which measure
+	// retrievals, as though no basis were set.
+	RankAll RankBasis = iota
+	// RankGets ranks keys by the number of retrievals.
+	RankGets
+	// RankSets ranks keys by the number of values stored.
+	RankSets
+	// RankDeletes ranks keys by the number of deletions.
+	RankDeletes
+
+	numRankBases
+)
+
+func (b RankBasis) String() string {
+	switch b {
+	case RankAll:
+		return "all"
+	case RankGets:
+		return "gets"
+	case RankSets:
+		return "sets"
+	case RankDeletes:
+		return "deletes"
+	default:
+		return "unknown"
+	}
+}
+
+// Next returns the basis following b, wrapping around after the last.
+func (b RankBasis) Next() RankBasis {
+	return (b + 1) % numRankBases
+}
+
+// count returns the operations in ops that rank a key under b, or all of them
+// under RankAll.
+func (b RankBasis) count(ops OpCounts) int64 {
+	switch b {
+	case RankAll:
+		return ops.Gets + ops.Sets + ops.Deletes
+	case RankSets:
+		return ops.Sets
+	case RankDeletes:
+		return ops.Deletes
+	default:
+		return ops.Gets
+	}
+}
+
+// SetRankBasis selects the operations by which keys are ranked in future
+// reports.  Every class of operation is counted whatever the basis, so
+// changing it discards nothing.  SetRankBasis is threadsafe.
+func (p *Pool) SetRankBasis(b RankBasis) {
+	atomic.StoreInt32(&p.rankBasis, int32(b))
+}
+
+// RankBasis returns the operations by which keys are ranked.
+func (p *Pool) RankBasis() RankBasis {
+	return RankBasis(atomic.LoadInt32(&p.rankBasis))
+}
@@ -0,0 +1,101 @@
+package analysis
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// rankedKeys returns the keys of rep in order.
+func rankedKeys(rep Report) []string {
+	var keys []string
+	for _, row := range rep.Rows {
+		keys = append(keys, row.Key[0])
+	}
+	return keys
+}
+
+func TestRankBasis(t *testing.T) {
+	p, err := New(2, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	hit := func(key string, size int) model.Event {
+		return model.Event{Type: model.EventGetHit, Key: key, Size: size}
+	}
+	p.HandleEvents([]model.Event{
+		hit("big", 1000),
+		hit("busy", 10), hit("busy", 10), hit("busy", 10),
+		{Type: model.EventSet, Key: "busy", Size: 10},
+		{Type: model.EventSet, Key: "written", Size: 5, TTL: 60},
+		{Type: model.EventSet, Key: "written", Size: 5, TTL: 60},
+		{Type: model.EventDelete, Key: "gone"},
+	})
+
+	cases := []struct {
+		basis RankBasis
+		keys  []string
+	}{
+		// keys never retrieved tie, and are put in order here
+		{RankAll, []string{"big", "busy", "gone", "written"}},
+		{RankGets, []string{"busy", "big"}},
+		{RankSets, []string{"written", "busy"}},
+		{RankDeletes, []string{"gone"}},
+	}
+	for _, c := range cases {
+		p.SetRankBasis(c.basis)
+		rep := p.ReportTop(false, 10, -1)
+		keys := rankedKeys(rep)
+		if c.basis == RankAll && len(keys) == len(c.keys) {
+			sort.Strings(keys[2:])
+		}
+		if !reflect.DeepEqual(keys, c.keys) || rep.RankBasis != c.basis {
+			t.Error(c.basis, keys)
+		}
+	}
+
+	// every class is counted whatever the basis
+	p.SetRankBasis(RankGets)
+	rep := p.Report(false)
+	rep.SortBy(-1)
+	if want := (OpCounts{Gets: 3, Sets: 1, SetBytes: 10}); rep.Rows[0].Ops != want {
+		t.Error(rep.Rows[0].Ops)
+	}
+	// values stored are not aggregated
+	if rep.Rows[0].Values[0] != 30 {
+		t.Error(rep.Rows[0].Values)
+	}
+}
+
+// TestRankAllSetsOnly checks that under RankAll a key only ever stored is
+// counted and reported.
+func TestRankAllSetsOnly(t *testing.T) {
+	if n := RankAll.count(OpCounts{Gets: 1, Sets: 2, Deletes: 3}); n != 6 {
+		t.Error(n)
+	}
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.HandleEvents([]model.Event{{Type: model.EventSet, Key: "written", Size: 5}})
+	rep := p.Report(false)
+	if keys := rankedKeys(rep); !reflect.DeepEqual(keys, []string{"written"}) || rep.Rows[0].Ops.Sets != 1 {
+		t.Error(keys)
+	}
+}
+
+func TestRankBasisNext(t *testing.T) {
+	b := RankAll
+	var names []string
+	for i := 0; i < 5; i++ {
+		names = append(names, b.String())
+		b = b.Next()
+	}
+	if want := []string{"all", "gets", "sets", "deletes", "all"}; !reflect.DeepEqual(names, want) {
+		t.Error(names)
+	}
+}
@@ -2,6 +2,7 @@ package analysis
 
 import (
 	"sort"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,22 +10,150 @@ import (
 type ReportRow struct {
 	Key    []string
 	Values []int64
+	// Ops counts the operations on the key by class.
+	Ops OpCounts
 }
 
 // Report represents key activity submitted to a Pool since the last call to
 // Reset.
 type Report struct {
-	// when this report was generated
+	// Timestamp is the end of the period covered by this report, by the
+	// capture time of the newest event it includes.  Without timestamped
+	// events it is when the report was generated.
 	Timestamp   time.Time
 	KeyColNames []string
 	ValColNames []string
 	Rows        []ReportRow
+	// TotalRows is the number of keys active when the report was generated,
+	// which may exceed len(Rows) once the report is limited.
+	TotalRows int
+	// DropRate is the fraction of responses dropped, by the decoder or the
+	// analysis Pool, over the period covered by this report.  Values in the
+	// report are underestimated by roughly this fraction.
+	DropRate float64
+	// KeysSingleGet and KeysMultiGet count the keys retrieved alone and
+	// alongside others in a single request, over the period covered by
+	// this report and before any filter pattern is applied.
+	KeysSingleGet int64
+	KeysMultiGet  int64
+	// UnattributedResponses and UnattributedBytes count the responses over
+	// the period covered by this report that could not be matched to a
+	// key, and so are missing from Rows.
+	UnattributedResponses int64
+	UnattributedBytes     int64
+	// Connections is the traffic of the connections that received the most
+	// response bytes over the period covered by this report, most first.
+	Connections []ConnTraffic
+	// Restarts are the servers found to have restarted over the period
+	// covered by this report, in the order found.
+	Restarts []ServerRestart
+	// ConfigChanges are the settings changed while running over the period
+	// covered by this report, in the order changed, as recorded by
+	// Pool.RecordConfigChange.
+	ConfigChanges []ConfigChange
+	// KeysSplit is the number of keys handled by more than one server over
+	// the period covered by this report, which in a capture on clients
+	// sharding keys across servers indicates disagreement on which server
+	// owns a key.
+	KeysSplit int
+	// RoutedRequests is the number of retrievals over the period covered by
+	// this report whose server was checked against the ring set by
+	// Pool.SetRing, and MisroutedRequests the number sent to a server
+	// other than the one owning their key.  Both are 0 if no ring is set.
+	RoutedRequests    int64
+	MisroutedRequests int64
+	// Misroutes is the routing of the clients with the most misrouted
+	// requests, most first.
+	Misroutes []ClientRouting
+	// ColdConnKeys are the keys with the most requests over the period
+	// covered by this report made on connections opened moments before,
+	// most first, among those requested mostly that way.
+	ColdConnKeys []ColdConnKey
+	// SLO is the latency of retrievals since the previous report compared
+	// with the SLO set by Pool.SetLatencySLO, or nil if none is set.
+	SLO *SLOStatus
+	// Warmup is how much of the reference list set by
+	// Pool.SetReferenceKeys has been seen since the start of the capture,
+	// or nil if none is set.
+	Warmup *WarmupProgress
+	// Skew summarizes how unevenly requests were spread across keys over
+	// the period covered by this report, including keys left out of Rows.
+	Skew KeySkew
+	// Decay is how long a key could go unseen before being removed from
+	// this report, if it did not reset the Pool, or 0 if keys were kept
+	// indefinitely.
+	Decay time.Duration
+	// RankBasis is the operations by which SortBy and Limit rank keys
+	// ahead of their columns.  Only keys with operations of that class are
+	// included, and under RankAll keys with any operation.
+	RankBasis RankBasis
+	// Discontinuous is set, by calling Pool.MarkDiscontinuous before the
+	// report is built, when the period covered by this report was
+	// interrupted, for example by the host being suspended, so
+	// that its length does not reflect the time spent capturing.  Rates
+	// computed over such a period are meaningless.
+	Discontinuous bool
 }
 
 func (r *Report) SortBy(columns ...int) {
 	sort.Sort(&reportSort{r, columns})
 }
 
+// Limit keeps only the first n rows of r when ranked by columns, sorted as
+// SortBy would leave them.  Selecting a few rows from many is much cheaper
+// than sorting them all.  If n is negative, all rows are kept.
+func (r *Report) Limit(n int, columns ...int) {
+	if n < 0 || n >= len(r.Rows) {
+		r.SortBy(columns...)
+		return
+	}
+	if n == 0 {
+		r.Rows = r.Rows[:0]
+		return
+	}
+	rs := &reportSort{r, columns}
+	h := worstFirst{rs, n}
+	h.init()
+	for i := n; i < len(r.Rows); i++ {
+		if rs.Less(i, 0) {
+			rs.Swap(i, 0)
+			h.down(0)
+		}
+	}
+	r.Rows = r.Rows[:n]
+	r.SortBy(columns...)
+}
+
+// worstFirst arranges the first n rows of a report as a binary heap with the
+// lowest ranked row at the root, so that it can be replaced by any better row.
+type worstFirst struct {
+	rs *reportSort
+	n  int
+}
+
+func (h worstFirst) init() {
+	for i := h.n/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+}
+
+func (h worstFirst) down(i int) {
+	for {
+		worst := i
+		if l := 2*i + 1; l < h.n && h.rs.Less(worst, l) {
+			worst = l
+		}
+		if r := 2*i + 2; r < h.n && h.rs.Less(worst, r) {
+			worst = r
+		}
+		if worst == i {
+			return
+		}
+		h.rs.Swap(i, worst)
+		i = worst
+	}
+}
+
 type reportSort struct {
 	report      *Report
 	sortColumns []int
@@ -35,6 +164,13 @@ func (rs *reportSort) Len() int {
 }
 
 func (rs *reportSort) Less(a, b int) bool {
+	if basis := rs.report.RankBasis; basis != RankAll {
+		opsA := basis.count(rs.report.Rows[a].Ops)
+		opsB := basis.count(rs.report.Rows[b].Ops)
+		if opsA != opsB {
+			return opsA > opsB
+		}
+	}
 	for _, col := range rs.sortColumns {
 		descending := col < 0
 		if descending {
@@ -83,32 +219,100 @@ func (rs *reportSort) Swap(a, b int) {
 //
 // The returned report does not represent a consistent snapshot since
 // information is collected from workers concurrent with new information
-// coming in.
+// coming in.  It does include all events from calls to HandleEvents that
+// returned before Report was called.
 //
 // If shouldReset is true, then a best effort will be made to clear data
-// in the Pool while building the report.  Since clearing data is an
+// in the Pool while building the report.  Otherwise keys not seen recently
+// are first removed, as set by SetCumulativeDecay.  Since clearing data is an
 // asynchronous operation across the workers in the pool, some information
 // may be carried over between successive reports, and some data may be
 // lost entirely.
+//
+// Ages of keys are measured by the capture time of the events handled, which
+// continues to advance with the wall clock while no events arrive.
 func (p *Pool) Report(shouldReset bool) Report {
 	var rows []ReportRow
+	var requests []int64
+	decay := p.decay
+	if shouldReset {
+		decay = 0
+	}
+	basis := p.RankBasis()
+	wall := p.now()
+	now := p.clock.end(wall)
+	p.dispatch(p.chunks.flush(now, shouldReset))
 	for _, w := range p.workers {
+		if decay > 0 {
+			w.ageOut(now, now.Add(-decay))
+		}
 		workerEntries := w.result()
 		if shouldReset {
 			w.reset()
 		}
-		for i := range workerEntries.keyFields {
-			row := ReportRow{
-				Key:    workerEntries.keyFields[i],
-				Values: workerEntries.aggResults[i],
+		for i, vals := range workerEntries.aggResults {
+			last := len(vals) - 1
+			ops := workerEntries.ops[i]
+			ops.Gets = vals[last]
+			if basis.count(ops) == 0 {
+				continue
 			}
-			rows = append(rows, row)
+			rows = append(rows, ReportRow{
+				Key:    workerEntries.keyFields[i],
+				Values: p.withDerived(vals[:last], ops),
+				Ops:    ops,
+			})
 		}
 	}
-	return Report{
-		Timestamp:   time.Now(),
+	rep := Report{
+		Timestamp:   now,
 		KeyColNames: p.kaf.KeyFields,
-		ValColNames: p.kaf.AggFields,
+		ValColNames: p.valColNames(),
 		Rows:        rows,
+		TotalRows:   len(rows),
+		DropRate:    p.drops.dropRate(&p.stats, shouldReset),
+		Decay:       decay,
+		RankBasis:   basis,
+		// set before the ReportHook is called, so that it is archived
+		Discontinuous: atomic.SwapInt32(&p.discontinuous, 0) != 0,
 	}
+	p.checkDuplicates(&rep)
+	for _, row := range rep.Rows {
+		if row.Ops.Gets > 0 {
+			requests = append(requests, row.Ops.Gets)
+		}
+	}
+	rep.Skew = keySkew(requests)
+	p.skew.set(rep.Skew)
+	rep.KeysSingleGet, rep.KeysMultiGet = p.batches.window(&p.stats, shouldReset)
+	rep.UnattributedResponses, rep.UnattributedBytes = p.unattributed.window(&p.stats, shouldReset)
+	rep.Connections = p.conns.window(shouldReset)
+	rep.Restarts = p.restarts.window(shouldReset)
+	rep.ConfigChanges = p.configs.window(shouldReset)
+	rep.KeysSplit = p.keysSplit(shouldReset)
+	rep.RoutedRequests, rep.MisroutedRequests, rep.Misroutes = p.routes.window(shouldReset)
+	rep.ColdConnKeys = p.coldConnKeys(shouldReset)
+	rep.SLO = p.slo.end(p.alertLogger(), now)
+	rep.Warmup = p.warmup.window(now)
+	if until, ok := p.maintenance.ended(wall); ok && p.Logger != nil {
+		p.Logger.Log("Maintenance window ended at", until.Format("15:04:05"))
+	}
+	if p.onReport != nil {
+		p.onReport(rep)
+	}
+	return rep
+}
+
+// ColumnNames returns the key and value column names of reports from p.
+func (p *Pool) ColumnNames() (keyCols, valCols []string) {
+	return p.kaf.KeyFields, p.valColNames()
+}
+
+// ReportTop is like Report, but keeps only the n busiest keys when ranked by
+// columns, as accepted by Report.SortBy.  Consumers that can only show a few
+// rows should prefer ReportTop to sorting a full report.
+func (p *Pool) ReportTop(shouldReset bool, n int, columns ...int) Report {
+	rep := p.Report(shouldReset)
+	rep.Limit(n, columns...)
+	return rep
 }
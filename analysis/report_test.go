@@ -0,0 +1,127 @@
+package analysis
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/box/memsniff/loadgen"
+	"github.com/box/memsniff/protocol/model"
+)
+
+func randomReport(n int) Report {
+	r := rand.New(rand.NewSource(1))
+	rep := Report{
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"sum(size)"},
+		Rows:        make([]ReportRow, n),
+		TotalRows:   n,
+	}
+	for i := range rep.Rows {
+		rep.Rows[i] = ReportRow{
+			Key:    []string{strconv.Itoa(i)},
+			Values: []int64{r.Int63n(1000)},
+		}
+	}
+	return rep
+}
+
+func TestLimitMatchesSort(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 100, 999, 1000, 2000, -1} {
+		sorted := randomReport(1000)
+		sorted.SortBy(-1, 0)
+		limited := randomReport(1000)
+		limited.Limit(n, -1, 0)
+
+		expected := sorted.Rows
+		if n >= 0 && n < len(expected) {
+			expected = expected[:n]
+		}
+		if !reflect.DeepEqual(limited.Rows, expected) {
+			t.Errorf("Limit(%d) differs from SortBy", n)
+		}
+		if limited.TotalRows != 1000 {
+			t.Error("TotalRows:", limited.TotalRows)
+		}
+	}
+}
+
+func BenchmarkReportSortAll(b *testing.B) {
+	rep := randomReport(50000)
+	for i := 0; i < b.N; i++ {
+		r := rep
+		r.Rows = append([]ReportRow(nil), rep.Rows...)
+		r.SortBy(-1)
+	}
+}
+
+func BenchmarkReportLimit(b *testing.B) {
+	rep := randomReport(50000)
+	for i := 0; i < b.N; i++ {
+		r := rep
+		r.Rows = append([]ReportRow(nil), rep.Rows...)
+		r.Limit(80, -1)
+	}
+}
+
+func BenchmarkHandleEvents(b *testing.B) {
+	p, err := New(4, "key,sum(size),count(size),p99(size)")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer p.Close()
+	g := loadgen.New(loadgen.DefaultConfig)
+	batches := make([][]model.Event, 64)
+	for i := range batches {
+		batches[i] = g.Batch(64)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		evts := append([]model.Event(nil), batches[i%len(batches)]...)
+		p.HandleEvents(evts)
+	}
+}
+
+// TestReportHook checks that the hook sees every row of a report, even when
+// ReportTop keeps only a few.
+func TestReportHook(t *testing.T) {
+	p, err := New(4, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var hooked int
+	p.SetReportHook(func(rep Report) {
+		hooked = len(rep.Rows)
+	})
+	for i := 0; i < 10; i++ {
+		p.HandleEvents(repeatedHits(strconv.Itoa(i), i+1))
+	}
+	rep := p.ReportTop(true, 3, 1)
+	if hooked != 10 || len(rep.Rows) != 3 {
+		t.Errorf("hook saw %d rows, ReportTop returned %d", hooked, len(rep.Rows))
+	}
+}
+
+// TestReportHookDiscontinuous checks that the hook sees a report marked
+// Discontinuous, and that only the next report is marked.
+func TestReportHookDiscontinuous(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var hooked []bool
+	p.SetReportHook(func(rep Report) {
+		hooked = append(hooked, rep.Discontinuous)
+	})
+	p.MarkDiscontinuous()
+	if rep := p.Report(true); !rep.Discontinuous {
+		t.Error("report not marked")
+	}
+	p.ReportTop(true, 1)
+	if len(hooked) != 2 || !hooked[0] || hooked[1] {
+		t.Error(hooked)
+	}
+}
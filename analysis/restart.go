@@ -0,0 +1,217 @@
+package analysis
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/protocol/model"
+)
+
+// DefaultRestartCloses and DefaultRestartWindow are the thresholds of
+// SetRestartDetection.  A busy client fleet closes a few connections at a
+// time, while a restarting server closes every connection at once.
+const (
+	DefaultRestartCloses = 20
+	DefaultRestartWindow = 5 * time.Second
+)
+
+// restartReconnectWait is how long after the start of a burst of closes the
+// clients of a server have to reconnect for it to count as a restart rather
+// than the server going away.
+const restartReconnectWait = time.Minute
+
+// maxRestartServers limits the servers whose closes are tracked, and the
+// restarts included in each report.
+const maxRestartServers = 1024
+
+// ServerRestart is a restart of a server inferred from its connections: a
+// burst of connections closed by the server, followed by clients connecting
+// again.
+type ServerRestart struct {
+	// Server is the address and port of the server.
+	Server string
+	// Time is when the server closed the first connection of the burst.
+	Time time.Time
+	// Closed is the number of connections the server closed in the burst,
+	// and Reconnected the number it accepted afterwards until the restart
+	// was confirmed.
+	Closed      int64
+	Reconnected int64
+}
+
+// serverCloses is the recent closes of one server.
+type serverCloses struct {
+	// recent are the times of the closes over the last span, oldest
+	// first.
+	recent []time.Time
+	// burst, if not nil, is a burst of closes awaiting reconnects.
+	burst *ServerRestart
+}
+
+// restartTracker detects servers restarting, by a burst of connections closed
+// by a server followed by its clients connecting again.  Connections closed
+// by clients, as when they are redeployed, are not counted.  restartTracker is
+// threadsafe.
+type restartTracker struct {
+	sync.Mutex
+	// closes is the number of connections a server must close within
+	// span to start a burst, or 0 to disable detection.
+	closes  int
+	span    time.Duration
+	servers map[string]*serverCloses
+	// detected are the restarts confirmed in the current window, and last
+	// the time of the latest restart of each server.
+	detected []ServerRestart
+	last     map[string]time.Time
+}
+
+func (rt *restartTracker) set(closes int, window time.Duration) {
+	rt.Lock()
+	defer rt.Unlock()
+	rt.closes, rt.span = closes, window
+	rt.servers = nil
+}
+
+// take removes connection events from evts, detecting restarts from them.
+// The remaining events are returned.
+func (rt *restartTracker) take(logger log.Logger, evts []model.Event, now time.Time) []model.Event {
+	if !hasConnEvents(evts) {
+		return evts
+	}
+	rt.Lock()
+	defer rt.Unlock()
+	kept := evts[:0]
+	for _, e := range evts {
+		switch e.Type {
+		case model.EventConnClosed:
+			if rt.closes > 0 {
+				rt.closed(e.Server, eventTime(e, now))
+			}
+		case model.EventConnAccepted:
+			if rt.closes > 0 {
+				rt.accepted(logger, e.Server, eventTime(e, now))
+			}
+		default:
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// hasConnEvents returns true if evts includes connection events.
+func hasConnEvents(evts []model.Event) bool {
+	for _, e := range evts {
+		if e.Type == model.EventConnClosed || e.Type == model.EventConnAccepted {
+			return true
+		}
+	}
+	return false
+}
+
+// server returns the closes of server as of t, creating them if create is
+// true, or nil if they are not tracked.  A burst whose clients failed to
+// reconnect in time is forgotten.
+func (rt *restartTracker) server(server string, t time.Time, create bool) *serverCloses {
+	sc, ok := rt.servers[server]
+	if !ok {
+		if !create || len(rt.servers) >= maxRestartServers {
+			return nil
+		}
+		if rt.servers == nil {
+			rt.servers = make(map[string]*serverCloses)
+		}
+		sc = &serverCloses{}
+		rt.servers[server] = sc
+	}
+	if sc.burst != nil && t.Sub(sc.burst.Time) > restartReconnectWait {
+		sc.burst = nil
+	}
+	return sc
+}
+
+func (rt *restartTracker) closed(server string, t time.Time) {
+	sc := rt.server(server, t, true)
+	if sc == nil {
+		return
+	}
+	if sc.burst != nil {
+		if sc.burst.Reconnected == 0 {
+			sc.burst.Closed++
+		}
+		return
+	}
+	cutoff := t.Add(-rt.span)
+	i := 0
+	for i < len(sc.recent) && sc.recent[i].Before(cutoff) {
+		i++
+	}
+	sc.recent = append(sc.recent[i:], t)
+	if len(sc.recent) >= rt.closes {
+		sc.burst = &ServerRestart{Server: server, Time: sc.recent[0], Closed: int64(len(sc.recent))}
+		sc.recent = nil
+	}
+}
+
+// accepted counts a connection accepted by server towards the reconnects
+// following a burst of closes, confirming a restart once half of the
+// connections closed have been opened again.
+func (rt *restartTracker) accepted(logger log.Logger, server string, t time.Time) {
+	sc := rt.server(server, t, false)
+	if sc == nil || sc.burst == nil {
+		return
+	}
+	b := sc.burst
+	b.Reconnected++
+	if 2*b.Reconnected < b.Closed {
+		return
+	}
+	sc.burst = nil
+	if rt.last == nil {
+		rt.last = make(map[string]time.Time)
+	}
+	rt.last[server] = b.Time
+	if len(rt.detected) < maxRestartServers {
+		rt.detected = append(rt.detected, *b)
+	}
+	if logger != nil {
+		logger.Log(fmt.Sprintf("ALERT: server %s appears to have restarted at %s (%d connections closed, %d reopened)",
+			server, b.Time.Format("15:04:05"), b.Closed, b.Reconnected))
+	}
+}
+
+// window returns the restarts confirmed since the start of the current window,
+// in the order confirmed.  If shouldReset is true, a new window begins.
+func (rt *restartTracker) window(shouldReset bool) []ServerRestart {
+	rt.Lock()
+	defer rt.Unlock()
+	restarts := append([]ServerRestart(nil), rt.detected...)
+	if shouldReset {
+		rt.detected = nil
+	}
+	return restarts
+}
+
+func (rt *restartTracker) lastRestart(server string) (time.Time, bool) {
+	rt.Lock()
+	defer rt.Unlock()
+	t, ok := rt.last[server]
+	return t, ok
+}
+
+// SetRestartDetection logs an alert and reports a restart when a server closes
+// at least closes connections within window, and its clients then open at
+// least half as many again within a minute.  Only connections the server
+// closes first count, so clients disconnecting, as when they are redeployed,
+// do not look like a restart.  A closes of 0 disables detection.
+// SetRestartDetection is threadsafe.
+func (p *Pool) SetRestartDetection(closes int, window time.Duration) {
+	p.restarts.set(closes, window)
+}
+
+// LastRestart returns when server last appeared to restart, and false if it
+// has not been seen restarting.  LastRestart is threadsafe.
+func (p *Pool) LastRestart(server string) (time.Time, bool) {
+	return p.restarts.lastRestart(server)
+}
@@ -0,0 +1,112 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+var restartStart = time.Date(2017, 6, 1, 14, 2, 11, 0, time.UTC)
+
+// connEvents returns n events of type typ for server, a millisecond apart
+// starting at start.
+func connEvents(typ model.EventType, server string, n int, start time.Time) []model.Event {
+	evts := make([]model.Event, n)
+	for i := range evts {
+		evts[i] = model.Event{Type: typ, Server: server, Timestamp: start.Add(time.Duration(i) * time.Millisecond)}
+	}
+	return evts
+}
+
+func TestRestartDetected(t *testing.T) {
+	rt := restartTracker{closes: 20, span: 5 * time.Second}
+	logger := &countingLogger{}
+	evts := connEvents(model.EventConnClosed, "10.3.4.7:11211", 30, restartStart)
+	evts = append(evts, model.Event{Type: model.EventGetMiss, Key: "k"})
+	evts = append(evts, connEvents(model.EventConnAccepted, "10.3.4.7:11211", 15, restartStart.Add(time.Second))...)
+	kept := rt.take(logger, evts, restartStart)
+	if len(kept) != 1 || kept[0].Key != "k" {
+		t.Error("connection events not removed:", kept)
+	}
+
+	want := []string{"ALERT: server 10.3.4.7:11211 appears to have restarted at 14:02:11 (30 connections closed, 15 reopened)"}
+	if !reflect.DeepEqual(logger.messages, want) {
+		t.Error(logger.messages)
+	}
+	wantRestarts := []ServerRestart{{Server: "10.3.4.7:11211", Time: restartStart, Closed: 30, Reconnected: 15}}
+	if got := rt.window(true); !reflect.DeepEqual(got, wantRestarts) {
+		t.Error(got)
+	}
+	if got := rt.window(true); len(got) != 0 {
+		t.Error("after reset:", got)
+	}
+	if last, ok := rt.lastRestart("10.3.4.7:11211"); !ok || !last.Equal(restartStart) {
+		t.Error("last restart:", last, ok)
+	}
+	if _, ok := rt.lastRestart("10.3.4.8:11211"); ok {
+		t.Error("restart of a server never seen")
+	}
+}
+
+func TestRestartNotDetected(t *testing.T) {
+	tests := []struct {
+		name string
+		evts []model.Event
+	}{
+		{"too few closes", append(
+			connEvents(model.EventConnClosed, "s:1", 19, restartStart),
+			connEvents(model.EventConnAccepted, "s:1", 19, restartStart.Add(time.Second))...)},
+		{"closes spread out", append(append(
+			connEvents(model.EventConnClosed, "s:1", 10, restartStart),
+			connEvents(model.EventConnClosed, "s:1", 10, restartStart.Add(10*time.Second))...),
+			connEvents(model.EventConnAccepted, "s:1", 20, restartStart.Add(11*time.Second))...)},
+		{"few reconnects", append(
+			connEvents(model.EventConnClosed, "s:1", 30, restartStart),
+			connEvents(model.EventConnAccepted, "s:1", 14, restartStart.Add(time.Second))...)},
+		{"reconnects too late", append(
+			connEvents(model.EventConnClosed, "s:1", 30, restartStart),
+			connEvents(model.EventConnAccepted, "s:1", 30, restartStart.Add(2*time.Minute))...)},
+		{"reconnects to another server", append(
+			connEvents(model.EventConnClosed, "s:1", 30, restartStart),
+			connEvents(model.EventConnAccepted, "s:2", 30, restartStart.Add(time.Second))...)},
+	}
+	for _, tt := range tests {
+		rt := restartTracker{closes: 20, span: 5 * time.Second}
+		logger := &countingLogger{}
+		rt.take(logger, tt.evts, restartStart)
+		if got := rt.window(true); len(got) != 0 || len(logger.messages) != 0 {
+			t.Errorf("%s: %v %v", tt.name, got, logger.messages)
+		}
+	}
+}
+
+func TestPoolRestarts(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetRestartDetection(0, DefaultRestartWindow)
+	p.HandleEvents(append(
+		connEvents(model.EventConnClosed, "s:1", 100, restartStart),
+		connEvents(model.EventConnAccepted, "s:1", 100, restartStart.Add(time.Second))...))
+	if rep := p.Report(true); len(rep.Restarts) != 0 {
+		t.Error(rep.Restarts)
+	}
+	if _, ok := p.LastRestart("s:1"); ok {
+		t.Error("restart detected while disabled")
+	}
+
+	p.SetRestartDetection(DefaultRestartCloses, DefaultRestartWindow)
+	p.HandleEvents(append(
+		connEvents(model.EventConnClosed, "s:1", 100, restartStart),
+		connEvents(model.EventConnAccepted, "s:1", 100, restartStart.Add(time.Second))...))
+	if rep := p.Report(true); len(rep.Restarts) != 1 {
+		t.Error(rep.Restarts)
+	}
+	if last, ok := p.LastRestart("s:1"); !ok || !last.Equal(restartStart) {
+		t.Error("last restart:", last, ok)
+	}
+}
@@ -0,0 +1,135 @@
+package analysis
+
+import (
+	"bufio"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RingHashes lists the hash algorithms understood by NewRing.
+var RingHashes = []string{"ketama"}
+
+// ketamaHashesPerServer is the number of MD5 digests taken for each server of
+// an evenly weighted ketama ring, each giving four points on the ring.
+const ketamaHashesPerServer = 40
+
+var errEmptyRing = errors.New("ring has no servers")
+
+// RingServer is a server in a consistent-hash ring, receiving a share of the
+// keys in proportion to its Weight.
+type RingServer struct {
+	// Addr is the address and port of the server as configured in clients,
+	// such as 10.0.0.1:11211.
+	Addr   string
+	Weight int
+}
+
+type ringPoint struct {
+	hash   uint32
+	server string
+}
+
+// Ring maps each key to the server that clients sharing it by consistent
+// hashing send it to.
+type Ring struct {
+	points []ringPoint
+}
+
+// NewRing builds the ring of servers for the named hash algorithm.  Only
+// "ketama" is supported, placing servers as libketama and libmemcached's
+// weighted ketama distribution do.
+func NewRing(hash string, servers []RingServer) (*Ring, error) {
+	if hash != "ketama" {
+		return nil, fmt.Errorf("unsupported ring hash %q, must be one of %s", hash, strings.Join(RingHashes, ", "))
+	}
+	if len(servers) == 0 {
+		return nil, errEmptyRing
+	}
+	var total int
+	for _, s := range servers {
+		if s.Weight <= 0 {
+			return nil, fmt.Errorf("ring server %s has weight %d, must be positive", s.Addr, s.Weight)
+		}
+		total += s.Weight
+	}
+	r := &Ring{}
+	for _, s := range servers {
+		// computed in the same precision as libketama, so that the
+		// number of points matches when weights do not divide evenly
+		pct := float32(s.Weight) / float32(total)
+		n := int(math.Floor(float64(float32(float64(pct) * ketamaHashesPerServer * float64(len(servers))))))
+		for k := 0; k < n; k++ {
+			digest := md5.Sum([]byte(s.Addr + "-" + strconv.Itoa(k)))
+			for h := 0; h < 4; h++ {
+				r.points = append(r.points, ringPoint{ketamaPoint(digest, h), s.Addr})
+			}
+		}
+	}
+	sort.SliceStable(r.points, func(i, j int) bool {
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r, nil
+}
+
+// ketamaPoint returns the hth point of an MD5 digest, taken as a little-endian
+// integer.
+func ketamaPoint(digest [md5.Size]byte, h int) uint32 {
+	return uint32(digest[3+h*4])<<24 | uint32(digest[2+h*4])<<16 | uint32(digest[1+h*4])<<8 | uint32(digest[h*4])
+}
+
+// Server returns the address of the server owning key: that of the first
+// point on the ring at or after the hash of key, wrapping around to the
+// first point.
+func (r *Ring) Server(key string) string {
+	h := ketamaPoint(md5.Sum([]byte(key)), 0)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].server
+}
+
+// ReadRingServers reads a list of servers, one per line as an address and
+// port optionally followed by a weight, which defaults to 1.  Blank lines and
+// lines starting with # are ignored.
+func ReadRingServers(r io.Reader) ([]RingServer, error) {
+	var servers []RingServer
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		s := RingServer{Addr: fields[0], Weight: 1}
+		if _, _, err := net.SplitHostPort(s.Addr); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected address and optional weight", line)
+		}
+		if len(fields) == 2 {
+			w, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad weight %q", line, fields[1])
+			}
+			s.Weight = w
+		}
+		servers = append(servers, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, errEmptyRing
+	}
+	return servers, nil
+}
@@ -0,0 +1,106 @@
+package analysis
+
+import (
+	"crypto/md5"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func evenRing(t *testing.T, n int) *Ring {
+	var servers []RingServer
+	for i := 0; i < n; i++ {
+		servers = append(servers, RingServer{fmt.Sprintf("10.0.0.%d:11211", i+1), 1})
+	}
+	r, err := NewRing("ketama", servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestKetamaPoint(t *testing.T) {
+	// MD5 of the empty string starts d4 1d 8c d9 8f 00 b2 04
+	digest := md5.Sum(nil)
+	if p := ketamaPoint(digest, 0); p != 0xd98c1dd4 {
+		t.Errorf("%x", p)
+	}
+	if p := ketamaPoint(digest, 1); p != 0x04b2008f {
+		t.Errorf("%x", p)
+	}
+}
+
+// TestKetamaPoints checks that each server of an even ring has 160 points, even
+// where its share of the ring is not exactly representable.
+func TestKetamaPoints(t *testing.T) {
+	for _, n := range []int{1, 3, 7, 10} {
+		if points := len(evenRing(t, n).points); points != 160*n {
+			t.Errorf("%d servers: %d points", n, points)
+		}
+	}
+}
+
+// TestRingBalanced checks that keys are spread across servers in proportion to
+// their weights.
+func TestRingBalanced(t *testing.T) {
+	r, err := NewRing("ketama", []RingServer{{"a:1", 1}, {"b:1", 1}, {"c:1", 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 40000; i++ {
+		counts[r.Server(fmt.Sprint("user:", i))]++
+	}
+	for server, want := range map[string]int{"a:1": 10000, "b:1": 10000, "c:1": 20000} {
+		if got := counts[server]; got < want*8/10 || got > want*12/10 {
+			t.Errorf("%s owns %d keys, want about %d", server, got, want)
+		}
+	}
+}
+
+// TestRingConsistent checks that adding a server only moves keys to it.
+func TestRingConsistent(t *testing.T) {
+	before, after := evenRing(t, 3), evenRing(t, 4)
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprint("user:", i)
+		if was, is := before.Server(key), after.Server(key); was != is {
+			moved++
+			if is != "10.0.0.4:11211" {
+				t.Fatalf("%s moved from %s to %s", key, was, is)
+			}
+		}
+	}
+	if moved < 1500 || moved > 3500 {
+		t.Error("moved", moved, "of 10000 keys")
+	}
+}
+
+func TestNewRingErrors(t *testing.T) {
+	if _, err := NewRing("jump", []RingServer{{"a:1", 1}}); err == nil {
+		t.Error("unsupported hash accepted")
+	}
+	if _, err := NewRing("ketama", nil); err != errEmptyRing {
+		t.Error(err)
+	}
+	if _, err := NewRing("ketama", []RingServer{{"a:1", 0}}); err == nil {
+		t.Error("zero weight accepted")
+	}
+}
+
+func TestReadRingServers(t *testing.T) {
+	servers, err := ReadRingServers(strings.NewReader("# cache ring\n10.0.0.1:11211\n\n  10.0.0.2:11211   3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RingServer{{"10.0.0.1:11211", 1}, {"10.0.0.2:11211", 3}}
+	if !reflect.DeepEqual(servers, want) {
+		t.Error(servers)
+	}
+	for _, bad := range []string{"", "# empty\n", "10.0.0.1\n", "10.0.0.1:11211 heavy\n", "10.0.0.1:11211 1 2\n"} {
+		if _, err := ReadRingServers(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
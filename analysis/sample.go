@@ -0,0 +1,159 @@
+package analysis
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// DefaultValueSampleLen is the number of leading bytes of a value sampled
+// unless set otherwise, and MaxValueSampleLen the most that may be set.
+const (
+	DefaultValueSampleLen = 256
+	MaxValueSampleLen     = 4096
+)
+
+var (
+	errValueSamplingOff = errors.New("value sampling is off (use --sample-values)")
+	errNotWatched       = errors.New("only watched keys can be sampled (use --watch)")
+)
+
+// ValueSample is the start of a value retrieved for a key.
+type ValueSample struct {
+	Time time.Time
+	// Size is the length of the whole value, and Data its first bytes.
+	Size int
+	Data string
+}
+
+// valueSampler keeps the first bytes of the next value retrieved for each key
+// armed by the user, replacing any earlier sample of the key.  Samples are
+// held only in memory, and never included in reports.  valueSampler is
+// threadsafe.
+type valueSampler struct {
+	sync.Mutex
+	// length is the number of bytes sampled, or 0 if sampling is off.
+	length int32
+	// armed is the number of armed keys, letting SampleLen skip locking
+	// in the common case.
+	armed   int32
+	keys    map[string]bool
+	samples map[string]ValueSample
+}
+
+func (vs *valueSampler) set(length int) {
+	vs.Lock()
+	defer vs.Unlock()
+	if length > MaxValueSampleLen {
+		length = MaxValueSampleLen
+	}
+	if length < 0 {
+		length = 0
+	}
+	atomic.StoreInt32(&vs.length, int32(length))
+	vs.keys, vs.samples = nil, nil
+	atomic.StoreInt32(&vs.armed, 0)
+}
+
+func (vs *valueSampler) arm(key string) error {
+	vs.Lock()
+	defer vs.Unlock()
+	if atomic.LoadInt32(&vs.length) == 0 {
+		return errValueSamplingOff
+	}
+	if vs.keys == nil {
+		vs.keys = make(map[string]bool)
+	}
+	vs.keys[key] = true
+	atomic.StoreInt32(&vs.armed, int32(len(vs.keys)))
+	return nil
+}
+
+// sampleLen returns the number of bytes to sample of the value of key.
+func (vs *valueSampler) sampleLen(key string) int {
+	if atomic.LoadInt32(&vs.armed) == 0 {
+		return 0
+	}
+	vs.Lock()
+	defer vs.Unlock()
+	if !vs.keys[key] {
+		return 0
+	}
+	return int(atomic.LoadInt32(&vs.length))
+}
+
+// record keeps the sample of each armed key in evts, disarming the key.  A key
+// stays armed until a sample of at least one byte is taken.
+func (vs *valueSampler) record(evts []model.Event) {
+	if atomic.LoadInt32(&vs.armed) == 0 {
+		return
+	}
+	vs.Lock()
+	defer vs.Unlock()
+	now := time.Now()
+	for i := range evts {
+		e := &evts[i]
+		if e.Sample == "" {
+			continue
+		}
+		if vs.keys[e.Key] {
+			if vs.samples == nil {
+				vs.samples = make(map[string]ValueSample)
+			}
+			vs.samples[e.Key] = ValueSample{eventTime(*e, now), e.Size, e.Sample}
+			delete(vs.keys, e.Key)
+		}
+		// the bytes are not needed further, even if the key was
+		// disarmed by an earlier sample
+		e.Sample = ""
+	}
+	atomic.StoreInt32(&vs.armed, int32(len(vs.keys)))
+}
+
+func (vs *valueSampler) sample(key string) (ValueSample, bool) {
+	vs.Lock()
+	defer vs.Unlock()
+	s, ok := vs.samples[key]
+	return s, ok
+}
+
+// SetValueSampling allows the first length bytes of values retrieved for
+// watched keys to be sampled on request, up to MaxValueSampleLen.  A length
+// of 0 turns sampling off and discards any samples held.  Values can hold
+// private data, so sampling is off by default.  SetValueSampling is
+// threadsafe.
+func (p *Pool) SetValueSampling(length int) {
+	p.samples.set(length)
+}
+
+// ValueSampling returns the number of bytes of a value sampled, or 0 if
+// sampling is off.
+func (p *Pool) ValueSampling() int {
+	return int(atomic.LoadInt32(&p.samples.length))
+}
+
+// ArmValueSample samples the next value retrieved for the watched key,
+// returning an error if value sampling is off or key is not watched.
+// ArmValueSample is threadsafe.
+func (p *Pool) ArmValueSample(key string) error {
+	if _, ok := p.watches.history(key); !ok {
+		return errNotWatched
+	}
+	return p.samples.arm(key)
+}
+
+// ValueSample returns the last sample taken of a value of key, and whether
+// there is one.
+func (p *Pool) ValueSample(key string) (ValueSample, bool) {
+	return p.samples.sample(key)
+}
+
+// SampleLen implements model.ValueSampler, asking for the first bytes of the
+// next value retrieved for each key armed by ArmValueSample.  key is compared
+// after normalization.
+func (p *Pool) SampleLen(key string) int {
+	return p.samples.sampleLen(p.normalize.apply(key))
+}
@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestValueSample(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetWatchedKeys([]string{"hot"})
+	if err := p.ArmValueSample("hot"); err != errValueSamplingOff {
+		t.Error(err)
+	}
+
+	p.SetKeyNormalization(NormalizeLower)
+	p.SetValueSampling(8)
+	if err := p.ArmValueSample("cold"); err != errNotWatched {
+		t.Error(err)
+	}
+	if err := p.ArmValueSample("hot"); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.SampleLen("HOT"); n != 8 {
+		t.Error("sample length:", n)
+	}
+	if n := p.SampleLen("cold"); n != 0 {
+		t.Error("sampled unarmed key:", n)
+	}
+
+	evts := []model.Event{{Type: model.EventGetHit, Key: "HOT", Size: 2000, Sample: "<html><"}}
+	p.HandleEvents(evts)
+	vs, ok := p.ValueSample("hot")
+	if !ok || vs.Size != 2000 || vs.Data != "<html><" {
+		t.Error(vs, ok)
+	}
+	if evts[0].Sample != "" {
+		t.Error("sample passed on for analysis")
+	}
+	// sampling is one-shot
+	if n := p.SampleLen("hot"); n != 0 {
+		t.Error("still armed:", n)
+	}
+
+	p.SetValueSampling(MaxValueSampleLen + 1)
+	if n := p.ValueSampling(); n != MaxValueSampleLen {
+		t.Error("sample length not capped:", n)
+	}
+	if _, ok := p.ValueSample("hot"); ok {
+		t.Error("sample kept after sampling was reset")
+	}
+}
@@ -0,0 +1,48 @@
+package analysis
+
+import (
+	"math"
+)
+
+// ScoreWeights sets the relative importance of each factor in the
+// cache-efficiency score.  See score for the formula.
+type ScoreWeights struct {
+	// Size weights the mean size of values served.
+	Size float64
+	// Miss weights the fraction of requests that missed.
+	Miss float64
+	// Rate weights the number of requests.
+	Rate float64
+}
+
+// DefaultScoreWeights gives each factor equal importance, so that the score
+// estimates the bytes per interval the backing store must serve on behalf of
+// a key due to cache misses.
+var DefaultScoreWeights = ScoreWeights{Size: 1, Miss: 1, Rate: 1}
+
+// score approximates how much backend load a key's cache misses generate:
+//
+//	score = size^w.Size * missRate^w.Miss * requests^w.Rate
+//
+// where size is the mean size of values served on hits, missRate is the
+// fraction of requests that missed, and requests is the number of hits plus
+// misses.  With the default weights this is size * misses, the number of
+// bytes that had to be fetched from elsewhere because the key was not in
+// cache.  Setting w.Rate to zero instead ranks keys by the cost of a single
+// request, regardless of how popular they are.
+//
+// Misses carry no value, so the size of a key that never hit is unknown and
+// it scores zero.
+func score(w ScoreWeights, hits, misses, bytes int64) int64 {
+	requests := hits + misses
+	if hits == 0 || requests == 0 {
+		return 0
+	}
+	size := float64(bytes) / float64(hits)
+	missRate := float64(misses) / float64(requests)
+	s := math.Pow(size, w.Size) * math.Pow(missRate, w.Miss) * math.Pow(float64(requests), w.Rate)
+	if s >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(math.Floor(s + 0.5))
+}
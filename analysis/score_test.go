@@ -0,0 +1,39 @@
+package analysis
+
+import (
+	"testing"
+)
+
+func TestScoreDefaultWeights(t *testing.T) {
+	// 10 hits of 100 bytes each, 30 misses: 30 misses * 100 bytes
+	if s := score(DefaultScoreWeights, 10, 30, 1000); s != 3000 {
+		t.Error("score:", s)
+	}
+}
+
+func TestScoreIgnoringRate(t *testing.T) {
+	w := ScoreWeights{Size: 1, Miss: 1, Rate: 0}
+	// 100 bytes per hit, 75% miss rate
+	if s := score(w, 10, 30, 1000); s != 75 {
+		t.Error("score:", s)
+	}
+	// same size and miss rate at a tenth of the traffic scores the same
+	if s := score(w, 1, 3, 100); s != 75 {
+		t.Error("score:", s)
+	}
+}
+
+func TestScoreNoMisses(t *testing.T) {
+	if s := score(DefaultScoreWeights, 10, 0, 1000); s != 0 {
+		t.Error("score:", s)
+	}
+}
+
+func TestScoreNoHits(t *testing.T) {
+	if s := score(DefaultScoreWeights, 0, 10, 0); s != 0 {
+		t.Error("score:", s)
+	}
+	if s := score(DefaultScoreWeights, 0, 0, 0); s != 0 {
+		t.Error("score:", s)
+	}
+}
@@ -0,0 +1,86 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// requestCountInput is the hidden aggregate collected for every key, after
+// those of derived columns, to measure how requests are spread across keys.
+const requestCountInput = "count(size)"
+
+// KeySkew summarizes how unevenly requests were spread across keys over the
+// period of a report.
+//
+// It is computed from every key analyzed, not only the rows shown, but only
+// approximates the traffic captured: requests dropped by the Pool are
+// missing, and keys excluded by a filter pattern are not counted.  Drops fall
+// on whole batches of events regardless of key, so they reduce the counts of
+// busy and quiet keys alike and barely move the result unless most events
+// were dropped.  With a Classifier set, requests are counted by group.
+type KeySkew struct {
+	// Keys and Requests are the number of distinct keys and requests
+	// counted.
+	Keys     int
+	Requests int64
+	// Gini is the Gini coefficient of requests across keys, from 0 when
+	// every key received as many requests, towards 1 as they concentrate
+	// on a single key.
+	Gini float64
+	// Top1Share is the fraction of requests made for the busiest 1% of
+	// keys, and at least the busiest key.
+	Top1Share float64
+}
+
+// keySkew computes the skew of requests, the number of requests for each key.
+// requests is sorted in place.
+func keySkew(requests []int64) KeySkew {
+	ks := KeySkew{Keys: len(requests)}
+	if len(requests) == 0 {
+		return ks
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i] < requests[j] })
+	// G = 2 Σ i·x_i / (n Σ x_i) - (n+1)/n, for x ascending and i from 1
+	var weighted float64
+	for i, r := range requests {
+		ks.Requests += r
+		weighted += float64(i+1) * float64(r)
+	}
+	if ks.Requests == 0 {
+		return ks
+	}
+	n := float64(len(requests))
+	ks.Gini = 2*weighted/(n*float64(ks.Requests)) - (n+1)/n
+
+	top := int(math.Ceil(n / 100))
+	var topRequests int64
+	for _, r := range requests[len(requests)-top:] {
+		topRequests += r
+	}
+	ks.Top1Share = float64(topRequests) / float64(ks.Requests)
+	return ks
+}
+
+// skewTracker remembers the skew of the most recent report.
+type skewTracker struct {
+	sync.Mutex
+	last KeySkew
+}
+
+func (st *skewTracker) set(ks KeySkew) {
+	st.Lock()
+	defer st.Unlock()
+	st.last = ks
+}
+
+func (st *skewTracker) get() KeySkew {
+	st.Lock()
+	defer st.Unlock()
+	return st.last
+}
+
+// Skew returns the skew of requests across keys in the most recent report.
+func (p *Pool) Skew() KeySkew {
+	return p.skew.get()
+}
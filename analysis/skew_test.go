@@ -0,0 +1,67 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestKeySkew(t *testing.T) {
+	many := make([]int64, 200)
+	for i := range many {
+		many[i] = 1
+	}
+	many[17], many[150] = 101, 101
+
+	cases := []struct {
+		requests []int64
+		gini     float64
+		top1     float64
+	}{
+		{[]int64{1, 1, 1, 1}, 0, 0.25},
+		{[]int64{10, 0, 0, 0}, 0.75, 1},
+		{[]int64{4, 2, 3, 1}, 0.25, 0.4},
+		// the busiest 1% of 200 keys is 2 keys
+		{many, 0.495, 0.505},
+		{[]int64{7}, 0, 1},
+	}
+	for _, c := range cases {
+		ks := keySkew(append([]int64(nil), c.requests...))
+		if math.Abs(ks.Gini-c.gini) > 1e-9 || math.Abs(ks.Top1Share-c.top1) > 1e-9 {
+			t.Errorf("%v: gini %v, top 1%% %v", c.requests, ks.Gini, ks.Top1Share)
+		}
+		if ks.Keys != len(c.requests) {
+			t.Error("keys:", ks.Keys)
+		}
+	}
+	if ks := keySkew(nil); ks != (KeySkew{}) {
+		t.Error("empty:", ks)
+	}
+}
+
+func TestReportSkew(t *testing.T) {
+	p, err := New(4, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var evts []model.Event
+	for i, key := range []string{"a", "b", "c", "d"} {
+		for j := 0; j <= i; j++ {
+			evts = append(evts, model.Event{Type: model.EventGetHit, Key: key, Size: 1})
+		}
+	}
+	p.HandleEvents(evts)
+
+	rep := p.ReportTop(true, 1, -1)
+	if rep.Skew.Keys != 4 || rep.Skew.Requests != 10 || math.Abs(rep.Skew.Gini-0.25) > 1e-9 {
+		t.Error(rep.Skew)
+	}
+	if len(rep.ValColNames) != 1 || len(rep.Rows[0].Values) != 1 {
+		t.Error("request count not hidden:", rep.ValColNames, rep.Rows)
+	}
+	if p.Skew() != rep.Skew {
+		t.Error("last skew:", p.Skew())
+	}
+}
@@ -0,0 +1,198 @@
+package analysis
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/protocol/model"
+	"github.com/codahale/hdrhistogram"
+)
+
+// DefaultSLOPercentile and DefaultSLOWindow are the percentile of latency
+// held to a latency SLO, and the period over which compliance is reported,
+// unless set otherwise.
+const (
+	DefaultSLOPercentile = 99
+	DefaultSLOWindow     = time.Hour
+)
+
+// maxSLOLatency is the largest latency measured exactly, in microseconds.
+// Longer latencies are recorded as this.
+const maxSLOLatency = int64(time.Minute / time.Microsecond)
+
+// SLOStatus is the latency of retrievals over the most recent report interval
+// compared with a latency SLO, and how many recent intervals complied with it.
+type SLOStatus struct {
+	// Target is the latency that Percentile percent of retrievals in each
+	// interval must not exceed.
+	Target     time.Duration
+	Percentile float64
+	// Window is the period over which Intervals and Compliant are counted.
+	Window time.Duration
+	// Measured is the number of retrievals in the interval whose latency
+	// was measured, and Observed the latency at Percentile among them, to
+	// three significant figures.
+	Measured int64
+	Observed time.Duration
+	// Violated is true if more than 100-Percentile percent of the measured
+	// retrievals took longer than Target.  An interval with no measured
+	// retrievals never violates the SLO.
+	Violated bool
+	// Intervals is the number of intervals ending within Window with any
+	// measured retrievals, and Compliant the number of those that did not
+	// violate the SLO.
+	Intervals int
+	Compliant int
+}
+
+// CompliantPercent returns the percentage of recent intervals that complied
+// with the SLO, or 100 if none had any measured retrievals.
+func (s SLOStatus) CompliantPercent() float64 {
+	if s.Intervals == 0 {
+		return 100
+	}
+	return float64(s.Compliant) * 100 / float64(s.Intervals)
+}
+
+// sloInterval is the outcome of one interval with measured retrievals.
+type sloInterval struct {
+	end      time.Time
+	violated bool
+}
+
+// sloTracker checks the latency of retrievals in each report interval against
+// a latency SLO, from a histogram of the latencies of all retrievals in the
+// interval.  Each report is an interval, whether or not it resets the Pool, so
+// that a cumulative view still checks each interval on its own.  sloTracker
+// is threadsafe.
+type sloTracker struct {
+	sync.Mutex
+	// enabled is 1 while an SLO is set, so that record need not lock
+	// otherwise.
+	enabled int32
+	// target is the latency SLO, or 0 if disabled.
+	target     time.Duration
+	percentile float64
+	window     time.Duration
+	hist       *hdrhistogram.Histogram
+	// over counts the retrievals in the current interval slower than
+	// target, exactly rather than to the precision of hist.
+	over    int64
+	history []sloInterval
+}
+
+func (st *sloTracker) set(target time.Duration, percentile float64, window time.Duration) {
+	st.Lock()
+	defer st.Unlock()
+	st.target, st.percentile, st.window = target, percentile, window
+	st.hist, st.history = nil, nil
+	var enabled int32
+	if target > 0 {
+		st.hist = hdrhistogram.New(1, maxSLOLatency, 3)
+		enabled = 1
+	}
+	atomic.StoreInt32(&st.enabled, enabled)
+}
+
+// record adds the latency of each retrieval in evts whose latency is known to
+// the histogram of the current interval.
+func (st *sloTracker) record(evts []model.Event) {
+	if atomic.LoadInt32(&st.enabled) == 0 {
+		return
+	}
+	st.Lock()
+	defer st.Unlock()
+	if st.hist == nil {
+		return
+	}
+	for _, e := range evts {
+		if (e.Type != model.EventGetHit && e.Type != model.EventGetMiss) || e.Latency <= 0 {
+			continue
+		}
+		if e.Latency > st.target {
+			st.over++
+		}
+		us := int64(e.Latency / time.Microsecond)
+		if us < 1 {
+			us = 1
+		}
+		if st.hist.RecordValue(us) != nil {
+			st.hist.RecordValue(maxSLOLatency)
+		}
+	}
+}
+
+// end ends the interval at now, logging an alert to logger if it violated
+// the SLO, and returns its status, or nil if no SLO is set.
+func (st *sloTracker) end(logger log.Logger, now time.Time) *SLOStatus {
+	st.Lock()
+	defer st.Unlock()
+	if st.hist == nil {
+		return nil
+	}
+	status := &SLOStatus{
+		Target:     st.target,
+		Percentile: st.percentile,
+		Window:     st.window,
+		Measured:   st.hist.TotalCount(),
+	}
+	if status.Measured > 0 {
+		status.Observed = time.Duration(st.hist.ValueAtQuantile(st.percentile)) * time.Microsecond
+		status.Violated = float64(st.over) > float64(status.Measured)*(100-st.percentile)/100
+		st.history = append(st.history, sloInterval{now, status.Violated})
+	}
+	st.hist.Reset()
+	st.over = 0
+
+	i := 0
+	for i < len(st.history) && !st.history[i].end.After(now.Add(-st.window)) {
+		i++
+	}
+	st.history = st.history[i:]
+	status.Intervals = len(st.history)
+	for _, si := range st.history {
+		if !si.violated {
+			status.Compliant++
+		}
+	}
+
+	if status.Violated && logger != nil {
+		logger.Log(fmt.Sprintf("ALERT: p%v latency %v exceeded SLO of %v over %d requests",
+			status.Percentile, status.Observed, status.Target, status.Measured))
+	}
+	return status
+}
+
+// mergeSLOStatus combines the SLO status of two reports, taking the worse
+// latency and adding the interval counts.
+func mergeSLOStatus(a, b *SLOStatus) *SLOStatus {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	merged := *a
+	merged.Measured += b.Measured
+	if b.Observed > merged.Observed {
+		merged.Observed = b.Observed
+	}
+	merged.Violated = a.Violated || b.Violated
+	merged.Intervals += b.Intervals
+	merged.Compliant += b.Compliant
+	return &merged
+}
+
+// SetLatencySLO checks the latency of retrievals in each report against
+// target: an interval violates the SLO if more than 100-percentile percent of
+// its retrievals took longer than target, and each violation is logged as an
+// alert.  Reports count the intervals complying with the SLO over the last
+// window.  A target of 0 disables the SLO.  Latency is measured only for
+// protocols that match each response to its request.  SetLatencySLO is
+// threadsafe.
+func (p *Pool) SetLatencySLO(target time.Duration, percentile float64, window time.Duration) {
+	p.slo.set(target, percentile, window)
+}
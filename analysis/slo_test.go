@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// retrievals returns n retrievals of key, each answered after latency.
+func retrievals(n int, latency time.Duration) []model.Event {
+	evts := make([]model.Event, n)
+	for i := range evts {
+		evts[i] = model.Event{Type: model.EventGetHit, Key: "k", Latency: latency}
+	}
+	return evts
+}
+
+func TestSLO(t *testing.T) {
+	var st sloTracker
+	if st.record(retrievals(1, time.Second)); st.end(nil, coldStart) != nil {
+		t.Error("status without an SLO")
+	}
+
+	st.set(2*time.Millisecond, 99, time.Hour)
+	logger := &countingLogger{}
+	st.record(retrievals(99, time.Millisecond))
+	st.record(retrievals(1, 5*time.Millisecond))
+	// sets and unmeasured retrievals are left out
+	st.record([]model.Event{{Type: model.EventSet, Key: "k", Latency: time.Second}})
+	st.record(retrievals(10, 0))
+	s := st.end(logger, coldStart)
+	if s.Measured != 100 || s.Violated || s.Intervals != 1 || s.Compliant != 1 || len(logger.messages) != 0 {
+		t.Error(s, logger.messages)
+	}
+
+	st.record(retrievals(10, 3*time.Millisecond))
+	s = st.end(logger, coldStart.Add(time.Minute))
+	if !s.Violated || s.Observed/time.Millisecond != 3 || s.Intervals != 2 || s.Compliant != 1 {
+		t.Error(s)
+	}
+	want := []string{"ALERT: p99 latency 3.001ms exceeded SLO of 2ms over 10 requests"}
+	if !reflect.DeepEqual(logger.messages, want) {
+		t.Error(logger.messages)
+	}
+
+	// exactly on target complies
+	st.record(retrievals(10, 2*time.Millisecond))
+	if s = st.end(logger, coldStart.Add(90*time.Second)); s.Violated || s.Intervals != 3 {
+		t.Error(s)
+	}
+
+	// an idle interval neither complies nor violates
+	if s = st.end(logger, coldStart.Add(2*time.Minute)); s.Measured != 0 || s.Violated || s.Intervals != 3 {
+		t.Error(s)
+	}
+
+	// the first interval leaves the window
+	st.record(retrievals(10, time.Millisecond))
+	s = st.end(logger, coldStart.Add(time.Hour+30*time.Second))
+	if s.Intervals != 3 || s.Compliant != 2 || s.CompliantPercent() != 200.0/3 {
+		t.Error(s)
+	}
+}
+
+func TestMergeSLOStatus(t *testing.T) {
+	a := &SLOStatus{Target: time.Millisecond, Measured: 10, Observed: time.Millisecond, Intervals: 4, Compliant: 4}
+	b := &SLOStatus{Target: time.Millisecond, Measured: 5, Observed: 2 * time.Millisecond, Violated: true, Intervals: 4, Compliant: 3}
+	want := &SLOStatus{Target: time.Millisecond, Measured: 15, Observed: 2 * time.Millisecond, Violated: true, Intervals: 8, Compliant: 7}
+	if merged := mergeSLOStatus(a, b); !reflect.DeepEqual(merged, want) {
+		t.Error(merged)
+	}
+	if merged := mergeSLOStatus(nil, a); merged != a {
+		t.Error(merged)
+	}
+}
@@ -0,0 +1,78 @@
+package analysis
+
+import (
+	"sync"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// eventTime returns when e was captured, or fallback if that is unknown.
+func eventTime(e model.Event, fallback time.Time) time.Time {
+	if e.Timestamp.IsZero() {
+		return fallback
+	}
+	return e.Timestamp
+}
+
+// captureClock follows the capture time of the events handled, so that
+// reports and the ages of keys are measured by when traffic was captured
+// rather than when it was analyzed, as when reading a capture file faster or
+// long after it was written.  captureClock is threadsafe.
+type captureClock struct {
+	sync.Mutex
+	// newest is the capture time of the newest event handled, and observed
+	// the wall clock time at which it was handled.
+	newest, observed time.Time
+	// fresh is true if an event has been handled since the last call to
+	// end.
+	fresh bool
+	// ended is the capture time last returned by end.
+	ended time.Time
+}
+
+// observe advances the clock to the newest capture time in evts, handled at
+// wall clock time wall.
+func (cc *captureClock) observe(evts []model.Event, wall time.Time) {
+	var newest time.Time
+	for _, e := range evts {
+		if e.Timestamp.After(newest) {
+			newest = e.Timestamp
+		}
+	}
+	if newest.IsZero() {
+		return
+	}
+	cc.Lock()
+	defer cc.Unlock()
+	cc.fresh = true
+	if newest.After(cc.newest) {
+		cc.newest, cc.observed = newest, wall
+	}
+}
+
+// end returns the capture time up to which data has been covered as of wall
+// clock time wall: that of the newest event handled since the last call, or if
+// there were none, that of the newest event ever handled advanced by the wall
+// clock time since.  Without any timestamped events it returns wall.  Once
+// there are, it never returns a capture time before one it returned earlier,
+// as when events arrive later than the wall clock suggested they would.
+func (cc *captureClock) end(wall time.Time) time.Time {
+	cc.Lock()
+	defer cc.Unlock()
+	if cc.newest.IsZero() {
+		return wall
+	}
+	var end time.Time
+	if cc.fresh {
+		cc.fresh = false
+		end = cc.newest
+	} else {
+		end = cc.newest.Add(wall.Sub(cc.observed))
+	}
+	if end.Before(cc.ended) {
+		end = cc.ended
+	}
+	cc.ended = end
+	return end
+}
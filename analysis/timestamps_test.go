@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestCaptureClock(t *testing.T) {
+	var cc captureClock
+	wall := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if end := cc.end(wall); !end.Equal(wall) {
+		t.Error("without events:", end)
+	}
+
+	captured := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	cc.observe([]model.Event{
+		{Key: "a", Timestamp: captured.Add(time.Second)},
+		{Key: "b", Timestamp: captured},
+		{Key: "c"},
+	}, wall)
+	if end := cc.end(wall.Add(500 * time.Millisecond)); !end.Equal(captured.Add(time.Second)) {
+		t.Error("after events:", end)
+	}
+	// idle, so capture time advances with the wall clock
+	if end := cc.end(wall.Add(3 * time.Second)); !end.Equal(captured.Add(4 * time.Second)) {
+		t.Error("while idle:", end)
+	}
+	// neither an older event nor a newer one arriving later than the wall
+	// clock suggested moves the clock back
+	cc.observe([]model.Event{{Key: "d", Timestamp: captured}}, wall.Add(4*time.Second))
+	if end := cc.end(wall.Add(5 * time.Second)); !end.Equal(captured.Add(4 * time.Second)) {
+		t.Error("after older event:", end)
+	}
+	cc.observe([]model.Event{{Key: "e", Timestamp: captured.Add(2 * time.Second)}}, wall.Add(6*time.Second))
+	if end := cc.end(wall.Add(7 * time.Second)); !end.Equal(captured.Add(4 * time.Second)) {
+		t.Error("after late event:", end)
+	}
+	cc.observe([]model.Event{{Key: "f", Timestamp: captured.Add(10 * time.Second)}}, wall.Add(8*time.Second))
+	if end := cc.end(wall.Add(9 * time.Second)); !end.Equal(captured.Add(10 * time.Second)) {
+		t.Error("after newer event:", end)
+	}
+}
+
+// TestReportCaptureTime checks that reports and the analyses timing events use
+// capture times, as when reading a capture file long after it was written.
+func TestReportCaptureTime(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetWatchedKeys([]string{"w"})
+	captured := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	p.HandleEvents([]model.Event{
+		{Type: model.EventSet, Key: "k", TTL: 60, Timestamp: captured},
+		{Type: model.EventGetHit, Key: "w", Size: 10, Timestamp: captured.Add(time.Second)},
+		{Type: model.EventGetMiss, Key: "k", Timestamp: captured.Add(2 * time.Minute)},
+	})
+	if rep := p.Report(true); !rep.Timestamp.Equal(captured.Add(2 * time.Minute)) {
+		t.Error("report at", rep.Timestamp)
+	}
+	if ke, ok := p.Expiry("k"); !ok || !ke.Stored.Equal(captured) || ke.ExpiryMisses != 1 {
+		t.Error("expiry:", ke, ok)
+	}
+	if samples, ok := p.WatchedSizes("w"); !ok || len(samples) != 1 || !samples[0].Time.Equal(captured.Add(time.Second)) {
+		t.Error("watched sizes:", samples)
+	}
+}
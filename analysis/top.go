@@ -0,0 +1,79 @@
+package analysis
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Contributor selects the callers among which the top% column finds the
+// busiest of each key.
+type Contributor int32
+
+const (
+	// ContributorClient counts requests by client address, so that the
+	// connections of one client count together.
+	ContributorClient Contributor = iota
+	// ContributorConn counts requests by connection.
+	ContributorConn
+	// ContributorNone counts no callers, leaving the top% column unknown.
+	ContributorNone
+)
+
+var contributorNames = []string{"client", "conn", "none"}
+
+func (c Contributor) String() string {
+	if c < 0 || int(c) >= len(contributorNames) {
+		return "unknown"
+	}
+	return contributorNames[c]
+}
+
+// ParseContributor returns the Contributor named by name, one of client,
+// conn or none.
+func ParseContributor(name string) (Contributor, error) {
+	for i, n := range contributorNames {
+		if n == name {
+			return Contributor(i), nil
+		}
+	}
+	return ContributorNone, fmt.Errorf("unknown contributor %q; valid contributors are client, conn, none", name)
+}
+
+// title returns the name of the top% column when counting c.
+func (c Contributor) title() string {
+	switch c {
+	case ContributorClient:
+		return "top clnt%"
+	case ContributorConn:
+		return "top conn%"
+	default:
+		return "top%"
+	}
+}
+
+// share returns the percentage of the requests for a key made by its busiest
+// caller under c, from those of its busiest client and connection, or -1 if
+// no callers are counted.
+func (c Contributor) share(client, conn int64) int64 {
+	switch c {
+	case ContributorClient:
+		return client
+	case ContributorConn:
+		return conn
+	default:
+		return -1
+	}
+}
+
+// SetTopContributor selects the callers among which the top% column of future
+// reports finds the busiest of each key.  Both clients and connections are
+// counted whatever the choice, so changing it discards nothing.
+// SetTopContributor is threadsafe.
+func (p *Pool) SetTopContributor(c Contributor) {
+	atomic.StoreInt32(&p.topBy, int32(c))
+}
+
+// TopContributor returns the callers counted by the top% column.
+func (p *Pool) TopContributor() Contributor {
+	return Contributor(atomic.LoadInt32(&p.topBy))
+}
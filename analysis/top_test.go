@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestTopContributor(t *testing.T) {
+	p, err := New(1, "key,top%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var evts []model.Event
+	for i := 0; i < 50; i++ {
+		// one client holding two connections, and another making one
+		// request in ten
+		evt := model.Event{Type: model.EventGetHit, Key: "k", Client: "10.0.0.1", Conn: "10.0.0.1:40000"}
+		switch {
+		case i%10 == 0:
+			evt.Client, evt.Conn = "10.0.0.2", "10.0.0.2:40000"
+		case i%2 == 0:
+			evt.Conn = "10.0.0.1:40001"
+		}
+		evts = append(evts, evt)
+	}
+
+	cases := []struct {
+		c     Contributor
+		title string
+		share int64
+	}{
+		{ContributorClient, "top clnt%", 90},
+		{ContributorConn, "top conn%", 50},
+		{ContributorNone, "top%", -1},
+	}
+	for _, c := range cases {
+		p.SetTopContributor(c.c)
+		p.HandleEvents(evts)
+		rep := p.Report(true)
+		if !reflect.DeepEqual(rep.ValColNames, []string{c.title}) || len(rep.Rows) != 1 || rep.Rows[0].Values[0] != c.share {
+			t.Errorf("%v: %v %v", c.c, rep.ValColNames, rep.Rows)
+		}
+	}
+}
+
+func TestParseContributor(t *testing.T) {
+	for _, c := range []Contributor{ContributorClient, ContributorConn, ContributorNone} {
+		if parsed, err := ParseContributor(c.String()); err != nil || parsed != c {
+			t.Error(c, parsed, err)
+		}
+	}
+	if _, err := ParseContributor("server"); err == nil {
+		t.Error("server accepted")
+	}
+	if MergeRuleFor("top clnt%") != MergeBoundByMax || MergeRuleFor("top(conn)") != MergeBoundByMax {
+		t.Error("top shares should merge by their maximum")
+	}
+}
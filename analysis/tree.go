@@ -0,0 +1,106 @@
+package analysis
+
+import "strings"
+
+// OtherChildren is the key of the row of RollUp combining the children of a
+// node beyond those listed.
+const OtherChildren = "(other)"
+
+// maxTreeChildren limits the children of a node listed separately by RollUp.
+const maxTreeChildren = 1000
+
+// TreeChild returns the child of the node at prefix that key falls under, in
+// a tree of keys split after each of the characters in delimiters: the prefix
+// of key up to and including its first delimiter after prefix, or key itself
+// if there is none.  key must start with prefix.
+func TreeChild(key, prefix, delimiters string) string {
+	i := strings.IndexAny(key[len(prefix):], delimiters)
+	if i < 0 {
+		return key
+	}
+	return key[:len(prefix)+i+1]
+}
+
+// IsTreeBranch returns true if child, a child of the node at prefix, has
+// children of its own rather than being a key.
+func IsTreeBranch(child, prefix, delimiters string) bool {
+	return len(child) > len(prefix) && strings.ContainsAny(child[len(child)-1:], delimiters)
+}
+
+// TreeParent returns the prefix of the node above the one at prefix, which
+// must not be the root.
+func TreeParent(prefix, delimiters string) string {
+	return prefix[:strings.LastIndexAny(prefix[:len(prefix)-1], delimiters)+1]
+}
+
+// RollUp returns rep with the rows of keys starting with prefix combined into
+// one per child of the node at prefix, in a tree of keys split after each of
+// the characters in delimiters, and other rows removed.  Values are combined
+// according to MergeRuleFor, so that each node summarizes the keys below it.
+//
+// Children are ranked by columns, as for Limit.  Only the first n are listed,
+// or at most maxTreeChildren if n is negative, and the rest are combined in a
+// final row keyed OtherChildren.  TotalRows is the number of children.  If rep
+// has no key column it is returned unchanged.
+func RollUp(rep Report, delimiters, prefix string, n int, columns ...int) Report {
+	col := -1
+	for i, name := range rep.KeyColNames {
+		if name == "key" {
+			col = i
+		}
+	}
+	if col < 0 {
+		return rep
+	}
+	rules := make([]MergeRule, len(rep.ValColNames))
+	for i, name := range rep.ValColNames {
+		rules[i] = MergeRuleFor(name)
+	}
+
+	var rows []ReportRow
+	index := make(map[string]int)
+	for _, row := range rep.Rows {
+		key := row.Key[col]
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		nodeKey := append([]string(nil), row.Key...)
+		nodeKey[col] = TreeChild(key, prefix, delimiters)
+		fk := flatKey(nodeKey)
+		i, ok := index[fk]
+		if !ok {
+			index[fk] = len(rows)
+			rows = append(rows, ReportRow{Key: nodeKey, Values: append([]int64(nil), row.Values...), Ops: row.Ops})
+			continue
+		}
+		for j, v := range row.Values {
+			rows[i].Values[j] = rules[j].merge(rows[i].Values[j], v)
+		}
+		rows[i].Ops = rows[i].Ops.add(row.Ops)
+	}
+
+	tree := rep
+	tree.Rows = rows
+	tree.TotalRows = len(rows)
+	if n < 0 || n > maxTreeChildren {
+		n = maxTreeChildren
+	}
+	tree.SortBy(columns...)
+	if len(rows) <= n {
+		return tree
+	}
+	other := ReportRow{
+		Key:    make([]string, len(rep.KeyColNames)),
+		Values: append([]int64(nil), rows[n].Values...),
+		Ops:    rows[n].Ops,
+	}
+	other.Key[col] = OtherChildren
+	for _, row := range rows[n+1:] {
+		for j, v := range row.Values {
+			other.Values[j] = rules[j].merge(other.Values[j], v)
+		}
+		other.Ops = other.Ops.add(row.Ops)
+	}
+	tree.Rows = append(rows[:n:n], other)
+	return tree
+}
@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func treeReport() Report {
+	return Report{
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"sum(size)", "max(size)"},
+		Rows: []ReportRow{
+			{Key: []string{"user:1:profile"}, Values: []int64{100, 50}},
+			{Key: []string{"user:1:session"}, Values: []int64{10, 10}},
+			{Key: []string{"user:2:profile"}, Values: []int64{300, 300}},
+			{Key: []string{"cart:9"}, Values: []int64{40, 40}},
+			{Key: []string{"config"}, Values: []int64{5, 5}},
+			{Key: []string{"user:"}, Values: []int64{1, 1}},
+		},
+		TotalRows: 6,
+	}
+}
+
+func rowsOf(rep Report) map[string][]int64 {
+	m := make(map[string][]int64)
+	for _, r := range rep.Rows {
+		m[r.Key[0]] = r.Values
+	}
+	return m
+}
+
+func TestRollUp(t *testing.T) {
+	root := RollUp(treeReport(), ":", "", -1, -1)
+	want := map[string][]int64{
+		"user:":  {411, 300},
+		"cart:":  {40, 40},
+		"config": {5, 5},
+	}
+	if got := rowsOf(root); !reflect.DeepEqual(got, want) || root.TotalRows != 3 {
+		t.Error("root:", got, root.TotalRows)
+	}
+	if root.Rows[0].Key[0] != "user:" {
+		t.Error("not ranked:", root.Rows)
+	}
+
+	user := RollUp(treeReport(), ":", "user:", -1, -1)
+	want = map[string][]int64{
+		"user:1:": {110, 50},
+		"user:2:": {300, 300},
+		"user:":   {1, 1},
+	}
+	if got := rowsOf(user); !reflect.DeepEqual(got, want) {
+		t.Error("user:", got)
+	}
+	leaves := RollUp(treeReport(), ":", "user:1:", -1, -1)
+	if got := rowsOf(leaves); len(got) != 2 || got["user:1:profile"] == nil {
+		t.Error("user:1:", got)
+	}
+}
+
+func TestRollUpOther(t *testing.T) {
+	rep := RollUp(treeReport(), ":", "", 1, -1)
+	if len(rep.Rows) != 2 || rep.TotalRows != 3 {
+		t.Fatal(rep.Rows, rep.TotalRows)
+	}
+	other := rep.Rows[1]
+	if other.Key[0] != OtherChildren || !reflect.DeepEqual(other.Values, []int64{45, 40}) {
+		t.Error(other)
+	}
+}
+
+func TestRollUpWithoutKey(t *testing.T) {
+	rep := Report{KeyColNames: []string{"client"}, Rows: []ReportRow{{Key: []string{"10.0.0.1"}}}}
+	if got := RollUp(rep, ":", "", -1); !reflect.DeepEqual(got, rep) {
+		t.Error(got)
+	}
+}
+
+func TestTreeNavigation(t *testing.T) {
+	for _, c := range []struct {
+		key, prefix, child string
+		branch             bool
+	}{
+		{"user:1:profile", "", "user:", true},
+		{"user:1:profile", "user:", "user:1:", true},
+		{"user:1:profile", "user:1:", "user:1:profile", false},
+		{"user:", "", "user:", true},
+		{"user:", "user:", "user:", false},
+		{"a.b|c", "", "a.", true},
+		{"a.b|c", "a.", "a.b|", true},
+	} {
+		child := TreeChild(c.key, c.prefix, ":.|")
+		if child != c.child || IsTreeBranch(child, c.prefix, ":.|") != c.branch {
+			t.Errorf("%q under %q: child %q", c.key, c.prefix, child)
+		}
+	}
+	if p := TreeParent("user:1:", ":"); p != "user:" {
+		t.Error(p)
+	}
+	if p := TreeParent("user:", ":"); p != "" {
+		t.Error(p)
+	}
+}
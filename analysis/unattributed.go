@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/protocol/model"
+)
+
+// unattributedTracker counts response data that could not be matched to a key,
+// over the same window as each report.  unattributedTracker is threadsafe.
+type unattributedTracker struct {
+	// samples is the number of unattributed responses still to be logged.
+	samples int64
+
+	sync.Mutex
+	// sinceResponses and sinceBytes are the totals at the start of the
+	// current window.
+	sinceResponses, sinceBytes int64
+}
+
+func (ut *unattributedTracker) setSamples(n int) {
+	atomic.StoreInt64(&ut.samples, int64(n))
+}
+
+// take removes unattributed events from evts, adding them to the totals in s
+// and logging the start of the first few.  The remaining events are returned.
+func (ut *unattributedTracker) take(s *Stats, logger log.Logger, evts []model.Event) []model.Event {
+	kept := evts[:0]
+	var responses, bytes int64
+	for _, e := range evts {
+		if e.Type != model.EventUnattributed {
+			kept = append(kept, e)
+			continue
+		}
+		responses++
+		bytes += int64(e.Size)
+		if logger != nil && atomic.LoadInt64(&ut.samples) > 0 && atomic.AddInt64(&ut.samples, -1) >= 0 {
+			logger.Log(fmt.Sprintf("unattributed response from %s (%d bytes): %q", e.Client, e.Size, e.Key))
+		}
+	}
+	if responses > 0 {
+		atomic.AddInt64(&s.UnattributedResponses, responses)
+		atomic.AddInt64(&s.UnattributedBytes, bytes)
+	}
+	return kept
+}
+
+// window returns the unattributed responses and bytes counted since the start
+// of the current window.  If shouldReset is true, a new window begins.
+func (ut *unattributedTracker) window(s *Stats, shouldReset bool) (responses, bytes int64) {
+	ut.Lock()
+	defer ut.Unlock()
+	nowResponses := atomic.LoadInt64(&s.UnattributedResponses)
+	nowBytes := atomic.LoadInt64(&s.UnattributedBytes)
+	responses, bytes = nowResponses-ut.sinceResponses, nowBytes-ut.sinceBytes
+	if shouldReset {
+		ut.sinceResponses, ut.sinceBytes = nowResponses, nowBytes
+	}
+	return responses, bytes
+}
+
+// SetUnattributedSamples causes the next n responses that cannot be matched to
+// a key to be logged, with their first few bytes, to help find out why.
+// SetUnattributedSamples is threadsafe.
+func (p *Pool) SetUnattributedSamples(n int) {
+	p.unattributed.setSamples(n)
+}
@@ -0,0 +1,50 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestUnattributedTake(t *testing.T) {
+	var s Stats
+	var ut unattributedTracker
+	var logger countingLogger
+	ut.setSamples(1)
+
+	evts := []model.Event{
+		{Type: model.EventUnattributed, Key: "VALUE k 0 5", Size: 100},
+		{Type: model.EventGetHit, Key: "k", Size: 5},
+		{Type: model.EventUnattributed, Key: "$5", Size: 20},
+	}
+	kept := ut.take(&s, &logger, evts)
+	if len(kept) != 1 || kept[0].Key != "k" {
+		t.Error(kept)
+	}
+	if len(logger.messages) != 1 {
+		t.Error("expected one sample:", logger.messages)
+	}
+	if responses, bytes := ut.window(&s, true); responses != 2 || bytes != 120 {
+		t.Error("first window:", responses, bytes)
+	}
+	if responses, bytes := ut.window(&s, true); responses != 0 || bytes != 0 {
+		t.Error("empty window:", responses, bytes)
+	}
+}
+
+func TestUnattributedNotAnalyzed(t *testing.T) {
+	p, err := New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.HandleEvents([]model.Event{{Type: model.EventUnattributed, Key: "END", Size: 5}})
+
+	rep := p.Report(true)
+	if rep.UnattributedResponses != 1 || rep.UnattributedBytes != 5 {
+		t.Error(rep.UnattributedResponses, rep.UnattributedBytes)
+	}
+	if s := p.Stats(); s.EventsHandled != 0 {
+		t.Error("unattributed event handled as a key:", s.EventsHandled)
+	}
+}
@@ -0,0 +1,218 @@
+package analysis
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// warmupRateWindow is the period over which the recent fill rate of a warmup
+// is measured to estimate when it completes.
+const warmupRateWindow = time.Minute
+
+var errNoReferenceKeys = errors.New("reference key list is empty")
+
+// ReferenceKeys is the list of keys a cache is warmed from, held in a bloom
+// filter so that lists of millions of keys fit in memory.  A key outside the
+// list is occasionally taken to be in it.
+type ReferenceKeys struct {
+	keys *bloomFilter
+	// count is the number of keys in the list, which should name each key
+	// once.
+	count int64
+}
+
+// ReadReferenceKeys reads a list of keys, one per line, ignoring blank lines.
+// The list is read twice, first to size the filter holding it.
+func ReadReferenceKeys(r io.ReadSeeker) (*ReferenceKeys, error) {
+	var n int
+	if err := scanKeys(r, func(string) { n++ }); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errNoReferenceKeys
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	rk := &ReferenceKeys{keys: newBloomFilter(n)}
+	err := scanKeys(r, func(key string) {
+		rk.keys.add(key)
+		rk.count++
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rk, nil
+}
+
+// scanKeys calls f with each key listed in r.
+func scanKeys(r io.Reader, f func(key string)) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if key := strings.TrimSpace(sc.Text()); key != "" {
+			f(key)
+		}
+	}
+	return sc.Err()
+}
+
+// Len returns the number of keys in the list.
+func (rk *ReferenceKeys) Len() int64 {
+	return rk.count
+}
+
+// WarmupProgress is how much of a reference key list has been seen stored or
+// served as hits since the start of the capture.
+type WarmupProgress struct {
+	// Reference is the number of keys in the list, and Observed the number
+	// of them seen stored or served.
+	Reference int64
+	Observed  int64
+	// Unlisted is the number of keys seen stored or served that are not in
+	// the list.  It is remembered in a filter the size of the list, so
+	// undercounts once many more keys outside the list than in it are
+	// seen.
+	Unlisted int64
+	// ETA is the estimated time until every key in the list has been seen,
+	// at the rate keys were observed over the last minute, or 0 if no keys
+	// were observed in that time.
+	ETA time.Duration
+}
+
+// Fraction returns the fraction of the reference keys observed.
+func (wp WarmupProgress) Fraction() float64 {
+	if wp.Reference == 0 {
+		return 0
+	}
+	if wp.Observed >= wp.Reference {
+		return 1
+	}
+	return float64(wp.Observed) / float64(wp.Reference)
+}
+
+// warmupSample is the number of reference keys observed at a moment.
+type warmupSample struct {
+	at       time.Time
+	observed int64
+}
+
+// warmupTracker counts the distinct keys seen stored or served as hits, in and
+// outside a reference list.  Keys are remembered in bloom filters, so a few
+// are taken to have been seen already and are not counted.  Keys in and
+// outside the list are remembered apart, so that however many keys outside
+// the list are seen, progress through the list is still counted.
+// warmupTracker is threadsafe.
+type warmupTracker struct {
+	sync.Mutex
+	// enabled is 1 while ref is set, so that record need not lock
+	// otherwise.
+	enabled int32
+	ref     *ReferenceKeys
+	// seen holds the keys in the list seen, and unlisted those outside it.
+	seen, unlisted *bloomFilter
+	progress       WarmupProgress
+	samples        []warmupSample
+}
+
+func (wt *warmupTracker) set(ref *ReferenceKeys) {
+	wt.Lock()
+	defer wt.Unlock()
+	wt.ref, wt.seen, wt.unlisted, wt.samples = ref, nil, nil, nil
+	wt.progress = WarmupProgress{}
+	var enabled int32
+	if ref != nil {
+		enabled = 1
+		// with room for keys outside the list taken to be in it, which
+		// are about 1% of those seen
+		wt.seen = newBloomFilter(2 * int(ref.count))
+		wt.unlisted = newBloomFilter(int(ref.count))
+		wt.progress.Reference = ref.count
+	}
+	atomic.StoreInt32(&wt.enabled, enabled)
+}
+
+// record counts the keys stored or served as hits in evts that have not been
+// seen before.
+func (wt *warmupTracker) record(evts []model.Event) {
+	if atomic.LoadInt32(&wt.enabled) == 0 {
+		return
+	}
+	wt.Lock()
+	defer wt.Unlock()
+	if wt.ref == nil {
+		return
+	}
+	for _, e := range evts {
+		if e.Type != model.EventSet && e.Type != model.EventGetHit {
+			continue
+		}
+		if !wt.ref.keys.contains(e.Key) {
+			if wt.unlisted.add(e.Key) {
+				wt.progress.Unlisted++
+			}
+		} else if wt.seen.add(e.Key) {
+			wt.progress.Observed++
+		}
+	}
+}
+
+// window returns the progress as of now, or nil if no reference list is set.
+func (wt *warmupTracker) window(now time.Time) *WarmupProgress {
+	wt.Lock()
+	defer wt.Unlock()
+	if wt.ref == nil {
+		return nil
+	}
+	wt.samples = append(wt.samples, warmupSample{now, wt.progress.Observed})
+	// keep the last sample from before the window as the baseline of the rate
+	i := 0
+	for i < len(wt.samples)-1 && !wt.samples[i+1].at.After(now.Add(-warmupRateWindow)) {
+		i++
+	}
+	wt.samples = wt.samples[i:]
+
+	wp := wt.progress
+	oldest := wt.samples[0]
+	filled, elapsed := wp.Observed-oldest.observed, now.Sub(oldest.at)
+	if remaining := wp.Reference - wp.Observed; remaining > 0 && filled > 0 && elapsed > 0 {
+		wp.ETA = time.Duration(float64(elapsed) * float64(remaining) / float64(filled))
+	}
+	return &wp
+}
+
+// mergeWarmup combines the warmup progress of two reports, as of different
+// nodes each warmed from their own list, adding the counts and taking the
+// later ETA.
+func mergeWarmup(a, b *WarmupProgress) *WarmupProgress {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	merged := WarmupProgress{
+		Reference: a.Reference + b.Reference,
+		Observed:  a.Observed + b.Observed,
+		Unlisted:  a.Unlisted + b.Unlisted,
+		ETA:       a.ETA,
+	}
+	if b.ETA > merged.ETA {
+		merged.ETA = b.ETA
+	}
+	return &merged
+}
+
+// SetReferenceKeys tracks how much of ref has been seen stored or served as
+// hits since it was set, to follow the warmup of a new cache node.  Keys are
+// compared after normalization and before the filter pattern and classifier
+// are applied.  A nil ref stops tracking.  SetReferenceKeys is threadsafe.
+func (p *Pool) SetReferenceKeys(ref *ReferenceKeys) {
+	p.warmup.set(ref)
+}
@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestBloomFilter(t *testing.T) {
+	bf := newBloomFilter(1000)
+	for i := 0; i < 1000; i++ {
+		if !bf.add("key" + strconv.Itoa(i)) {
+			t.Error("added twice:", i)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if !bf.contains("key"+strconv.Itoa(i)) || bf.add("key"+strconv.Itoa(i)) {
+			t.Error("lost:", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if bf.contains("other" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Error("false positives:", falsePositives)
+	}
+}
+
+func TestReadReferenceKeys(t *testing.T) {
+	rk, err := ReadReferenceKeys(strings.NewReader("a\n\n  b \nc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rk.Len() != 3 || !rk.keys.contains("b") {
+		t.Error(rk.Len())
+	}
+	if _, err = ReadReferenceKeys(strings.NewReader("\n")); err != errNoReferenceKeys {
+		t.Error(err)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	var wt warmupTracker
+	wt.record([]model.Event{{Type: model.EventSet, Key: "a"}})
+	if wt.window(coldStart) != nil {
+		t.Error("progress without a reference list")
+	}
+
+	rk, _ := ReadReferenceKeys(strings.NewReader("a\nb\nc\nd\n"))
+	wt.set(rk)
+	if wp := wt.window(coldStart); !reflect.DeepEqual(*wp, WarmupProgress{Reference: 4}) {
+		t.Error(wp)
+	}
+	wt.record([]model.Event{
+		{Type: model.EventSet, Key: "a"},
+		{Type: model.EventGetHit, Key: "a"},
+		{Type: model.EventGetHit, Key: "z"},
+		// misses and deletes fill nothing
+		{Type: model.EventGetMiss, Key: "b"},
+		{Type: model.EventDelete, Key: "c"},
+	})
+	wp := wt.window(coldStart.Add(10 * time.Second))
+	want := WarmupProgress{Reference: 4, Observed: 1, Unlisted: 1, ETA: 30 * time.Second}
+	if !reflect.DeepEqual(*wp, want) || wp.Fraction() != 0.25 {
+		t.Error(wp)
+	}
+
+	// the rate is taken over the last minute only
+	wt.record([]model.Event{{Type: model.EventSet, Key: "b"}})
+	wp = wt.window(coldStart.Add(2 * time.Minute))
+	if wp.Observed != 2 || wp.ETA != 220*time.Second {
+		t.Error(wp)
+	}
+	wp = wt.window(coldStart.Add(4 * time.Minute))
+	if wp.ETA != 0 {
+		t.Error("ETA without progress:", wp.ETA)
+	}
+
+	wt.record([]model.Event{{Type: model.EventSet, Key: "c"}, {Type: model.EventSet, Key: "d"}})
+	wp = wt.window(coldStart.Add(5 * time.Minute))
+	if wp.Observed != 4 || wp.ETA != 0 || wp.Fraction() != 1 {
+		t.Error(wp)
+	}
+}
+
+// TestWarmupManyUnlisted checks that progress through the list is still
+// counted after many more keys outside it have been seen.
+func TestWarmupManyUnlisted(t *testing.T) {
+	var wt warmupTracker
+	var list strings.Builder
+	for i := 0; i < 100; i++ {
+		list.WriteString("listed" + strconv.Itoa(i) + "\n")
+	}
+	rk, _ := ReadReferenceKeys(strings.NewReader(list.String()))
+	wt.set(rk)
+	var evts []model.Event
+	for i := 0; i < 5000; i++ {
+		evts = append(evts, model.Event{Type: model.EventSet, Key: "other" + strconv.Itoa(i)})
+	}
+	wt.record(evts)
+	evts = evts[:0]
+	for i := 0; i < 100; i++ {
+		evts = append(evts, model.Event{Type: model.EventGetHit, Key: "listed" + strconv.Itoa(i)})
+	}
+	wt.record(evts)
+
+	wp := wt.window(coldStart)
+	// a few keys may be lost to false positives of the filters
+	if wp.Observed < 95 || wp.Unlisted == 0 {
+		t.Error(wp)
+	}
+}
+
+func TestMergeWarmup(t *testing.T) {
+	a := &WarmupProgress{Reference: 10, Observed: 5, Unlisted: 1, ETA: time.Minute}
+	b := &WarmupProgress{Reference: 20, Observed: 5, ETA: time.Hour}
+	want := WarmupProgress{Reference: 30, Observed: 10, Unlisted: 1, ETA: time.Hour}
+	if m := mergeWarmup(a, b); !reflect.DeepEqual(*m, want) {
+		t.Error(m)
+	}
+	if mergeWarmup(nil, b) != b || mergeWarmup(a, nil) != a {
+		t.Error("nil progress")
+	}
+}
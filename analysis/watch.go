@@ -0,0 +1,176 @@
+package analysis
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/protocol/model"
+)
+
+// watchHistoryLen is the number of size samples retained for each watched key.
+const watchHistoryLen = 256
+
+// SizeSample is the size of a value returned for a watched key, and when it
+// was observed.
+type SizeSample struct {
+	Time time.Time
+	Size int
+}
+
+// sizeHistory is a bounded record of the value sizes observed for a key.
+type sizeHistory struct {
+	// samples is a ring buffer, with the oldest sample at start once full.
+	samples []SizeSample
+	start   int
+
+	// runStart is the size at the start of the current run of non-decreasing
+	// sizes, and alerted is true if that run has already been reported.
+	runStart int
+	alerted  bool
+}
+
+func (h *sizeHistory) add(s SizeSample) {
+	if len(h.samples) < watchHistoryLen {
+		h.samples = append(h.samples, s)
+	} else {
+		h.samples[h.start] = s
+		h.start = (h.start + 1) % watchHistoryLen
+	}
+}
+
+// last returns the most recent sample.  h must not be empty.
+func (h *sizeHistory) last() SizeSample {
+	return h.samples[(h.start+len(h.samples)-1)%len(h.samples)]
+}
+
+// ordered returns a copy of the retained samples, oldest first.
+func (h *sizeHistory) ordered() []SizeSample {
+	res := make([]SizeSample, 0, len(h.samples))
+	res = append(res, h.samples[h.start:]...)
+	res = append(res, h.samples[:h.start]...)
+	return res
+}
+
+// watchList tracks the size of values returned for a fixed set of keys, and
+// warns when one grows steadily.  watchList is threadsafe.
+type watchList struct {
+	sync.Mutex
+	// active is nonzero if any keys are watched, letting record skip locking
+	// in the common case.
+	active int32
+	keys   map[string]*sizeHistory
+	// growthAlert is the number of bytes a watched value may grow without
+	// ever shrinking before a warning is logged, or 0 to disable warnings.
+	growthAlert int
+	// acked is the set of keys acknowledged by the user, for which no
+	// warnings are logged.
+	acked map[string]bool
+}
+
+func (wl *watchList) setKeys(keys []string) {
+	wl.Lock()
+	defer wl.Unlock()
+	wl.keys = make(map[string]*sizeHistory, len(keys))
+	for _, k := range keys {
+		wl.keys[k] = &sizeHistory{}
+	}
+	var active int32
+	if len(keys) > 0 {
+		active = 1
+	}
+	atomic.StoreInt32(&wl.active, active)
+}
+
+func (wl *watchList) setAcked(keys []string) {
+	wl.Lock()
+	defer wl.Unlock()
+	wl.acked = make(map[string]bool, len(keys))
+	for _, k := range keys {
+		wl.acked[k] = true
+	}
+}
+
+func (wl *watchList) setGrowthAlert(bytes int) {
+	wl.Lock()
+	defer wl.Unlock()
+	wl.growthAlert = bytes
+}
+
+// record adds a sample for each successful retrieval of a watched key in evts.
+func (wl *watchList) record(logger log.Logger, evts []model.Event) {
+	if atomic.LoadInt32(&wl.active) == 0 {
+		return
+	}
+	wl.Lock()
+	defer wl.Unlock()
+	now := time.Now()
+	for _, e := range evts {
+		if e.Type != model.EventGetHit {
+			continue
+		}
+		h, ok := wl.keys[e.Key]
+		if !ok {
+			continue
+		}
+		wl.checkGrowth(logger, e.Key, h, e.Size)
+		h.add(SizeSample{eventTime(e, now), e.Size})
+	}
+}
+
+// checkGrowth logs a warning the first time the value for key grows by
+// more than growthAlert bytes without shrinking in between.  It must be called
+// before the new size is added to h.
+func (wl *watchList) checkGrowth(logger log.Logger, key string, h *sizeHistory, size int) {
+	if len(h.samples) == 0 || size < h.last().Size {
+		h.runStart = size
+		h.alerted = false
+		return
+	}
+	growth := size - h.runStart
+	if wl.growthAlert > 0 && growth >= wl.growthAlert && !h.alerted {
+		h.alerted = true
+		if logger != nil && !wl.acked[key] {
+			logger.Log(fmt.Sprintf("ALERT: watched key %s grew by %d bytes to %d bytes without shrinking", key, growth, size))
+		}
+	}
+}
+
+// watched returns whether key is being watched.
+func (wl *watchList) watched(key string) bool {
+	if atomic.LoadInt32(&wl.active) == 0 {
+		return false
+	}
+	wl.Lock()
+	defer wl.Unlock()
+	_, ok := wl.keys[key]
+	return ok
+}
+
+// history returns the retained samples for key, oldest first, and whether key
+// is being watched.
+func (wl *watchList) history(key string) ([]SizeSample, bool) {
+	wl.Lock()
+	defer wl.Unlock()
+	h, ok := wl.keys[key]
+	if !ok {
+		return nil, false
+	}
+	return h.ordered(), true
+}
+
+// GrowthRate returns the average change in size, in bytes per minute, between
+// the first and last of samples, or 0 if they span no time.
+func GrowthRate(samples []SizeSample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.Time.Sub(first.Time)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.Size-first.Size) / elapsed.Minutes()
+}
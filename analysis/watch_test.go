@@ -0,0 +1,127 @@
+package analysis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+type countingLogger struct {
+	messages []string
+}
+
+func (l *countingLogger) Log(items ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprint(items...))
+}
+
+func hits(key string, sizes ...int) []model.Event {
+	evts := make([]model.Event, len(sizes))
+	for i, s := range sizes {
+		evts[i] = model.Event{Type: model.EventGetHit, Key: key, Size: s}
+	}
+	return evts
+}
+
+func TestWatchIgnoresUnwatched(t *testing.T) {
+	var wl watchList
+	wl.setKeys([]string{"watched"})
+	wl.record(nil, hits("other", 1, 2, 3))
+	if samples, ok := wl.history("other"); ok || samples != nil {
+		t.Error("recorded unwatched key")
+	}
+	if samples, ok := wl.history("watched"); !ok || len(samples) != 0 {
+		t.Error("unexpected samples", samples)
+	}
+}
+
+func TestWatchIgnoresMisses(t *testing.T) {
+	var wl watchList
+	wl.setKeys([]string{"watched"})
+	wl.record(nil, []model.Event{{Type: model.EventGetMiss, Key: "watched"}})
+	if samples, _ := wl.history("watched"); len(samples) != 0 {
+		t.Error("recorded miss", samples)
+	}
+}
+
+func TestWatchRingWraps(t *testing.T) {
+	var wl watchList
+	wl.setKeys([]string{"k"})
+	for i := 0; i < watchHistoryLen+10; i++ {
+		wl.record(nil, hits("k", i))
+	}
+	samples, _ := wl.history("k")
+	if len(samples) != watchHistoryLen {
+		t.Fatal("retained", len(samples), "samples")
+	}
+	if samples[0].Size != 10 || samples[len(samples)-1].Size != watchHistoryLen+9 {
+		t.Error("wrong order:", samples[0].Size, samples[len(samples)-1].Size)
+	}
+}
+
+func TestGrowthAlert(t *testing.T) {
+	var wl watchList
+	var logger countingLogger
+	wl.setKeys([]string{"k"})
+	wl.setGrowthAlert(100)
+
+	wl.record(&logger, hits("k", 10, 50, 50, 109))
+	if len(logger.messages) != 0 {
+		t.Error("alerted early:", logger.messages)
+	}
+	wl.record(&logger, hits("k", 110, 500))
+	if len(logger.messages) != 1 {
+		t.Error("expected a single alert:", logger.messages)
+	}
+
+	// shrinking starts a new run, which must grow by the threshold again
+	wl.record(&logger, hits("k", 20, 119))
+	if len(logger.messages) != 1 {
+		t.Error("alerted before regrowth:", logger.messages)
+	}
+	wl.record(&logger, hits("k", 120))
+	if len(logger.messages) != 2 {
+		t.Error("expected a second alert:", logger.messages)
+	}
+}
+
+func TestGrowthAlertDisabled(t *testing.T) {
+	var wl watchList
+	var logger countingLogger
+	wl.setKeys([]string{"k"})
+	wl.record(&logger, hits("k", 1, 1000000))
+	if len(logger.messages) != 0 {
+		t.Error(logger.messages)
+	}
+}
+
+func TestGrowthAlertAcknowledged(t *testing.T) {
+	var wl watchList
+	var logger countingLogger
+	wl.setKeys([]string{"k"})
+	wl.setGrowthAlert(100)
+	wl.setAcked([]string{"k"})
+	wl.record(&logger, hits("k", 1, 1000))
+	if len(logger.messages) != 0 {
+		t.Error(logger.messages)
+	}
+	if h, _ := wl.history("k"); len(h) != 2 {
+		t.Error("acknowledged key not recorded:", h)
+	}
+}
+
+func TestGrowthRate(t *testing.T) {
+	start := time.Now()
+	samples := []SizeSample{
+		{start, 100},
+		{start.Add(time.Minute), 150},
+		{start.Add(2 * time.Minute), 300},
+	}
+	if r := GrowthRate(samples); r != 100 {
+		t.Error("rate:", r)
+	}
+	if r := GrowthRate(samples[:1]); r != 0 {
+		t.Error("rate:", r)
+	}
+}
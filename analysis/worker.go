@@ -5,42 +5,78 @@ import (
 	"github.com/box/memsniff/analysis/aggregate"
 	"github.com/box/memsniff/protocol/model"
 	"sync"
-)
-
-var (
-	aggregatorPool = sync.Pool{}
+	"time"
 )
 
 // worker accumulates usage data for a set of cache keys.
 type worker struct {
 	// channel for reports of cache key activity
-	eventChan chan []model.Event
+	eventChan chan batch
 	// channel for requests for the current data summary
 	resRequest chan struct{}
 	// channel for data summaries
 	resReply chan result
 	// channel for requests to reset all data t to an empty state
 	resetRequest chan bool
+	// channel for requests to remove keys not seen recently
+	ageOutRequest chan ageOutRequest
+	// closed when the worker exits
+	stopped chan struct{}
 
 	// create KeyAggregators based on the configured format
 	aggregatorFactory aggregate.KeyAggregatorFactory
 	// one KeyAggregator per key, where key is determined by aggregatorFactory
 	aggregators map[string]aggregate.KeyAggregator
+	// spare holds aggregators of removed keys for reuse.  It is private to
+	// the worker, since aggregators only suit the format they were made for.
+	spare *sync.Pool
+	// lastSeen is when each key was last seen, once keys are aged out, or
+	// the zero time for keys seen since the last request to age them out.
+	lastSeen map[string]time.Time
+	// writes counts the values stored and deletions for each key that has
+	// had any, which are not aggregated.
+	writes map[string]*OpCounts
+	// owners and coldConns count the servers handling, and the requests
+	// made on cold connections for, the datastore keys assigned to this
+	// worker.
+	owners    *ownershipTracker
+	coldConns *coldConnTracker
+}
+
+// batch is a set of events sent to a worker.
+type batch struct {
+	// rows are the events aggregated into the rows of reports.
+	rows []model.Event
+	// keys are the events counted against their datastore key, each of
+	// which is assigned to this worker.  keys is the same as rows when
+	// reports are keyed by datastore key.
+	keys []model.Event
+}
+
+// ageOutRequest asks a worker to remove keys last seen before cutoff.
+type ageOutRequest struct {
+	now, cutoff time.Time
 }
 
 // errQueueFull is returned by handleGetResponse if the worker cannot keep
 // up with incoming calls.
 var errQueueFull = errors.New("analysis worker queue full")
 
-func newWorker(kaf aggregate.KeyAggregatorFactory) worker {
+func newWorker(kaf aggregate.KeyAggregatorFactory, owners *ownershipTracker, coldConns *coldConnTracker) worker {
 	w := worker{
-		eventChan:    make(chan []model.Event, 1024),
-		resRequest:   make(chan struct{}),
-		resReply:     make(chan result),
-		resetRequest: make(chan bool),
+		eventChan:     make(chan batch, 1024),
+		resRequest:    make(chan struct{}),
+		resReply:      make(chan result),
+		resetRequest:  make(chan bool),
+		ageOutRequest: make(chan ageOutRequest),
+		stopped:       make(chan struct{}),
 
 		aggregatorFactory: kaf,
 		aggregators:       make(map[string]aggregate.KeyAggregator),
+		writes:            make(map[string]*OpCounts),
+		spare:             &sync.Pool{},
+		owners:            owners,
+		coldConns:         coldConns,
 	}
 	go w.loop()
 	return w
@@ -48,12 +84,12 @@ func newWorker(kaf aggregate.KeyAggregatorFactory) worker {
 
 // handleEvents asynchronously processes events.
 // handleEvents is threadsafe.
-// evts should not be modified by the caller.
-func (w *worker) handleEvents(evts []model.Event) error {
+// The events of b should not be modified by the caller.
+func (w *worker) handleEvents(b batch) error {
 	// Make sure we copy r.Key before we return, since it may be a pointer
 	// into a buffer that will be overwritten.
 	select {
-	case w.eventChan <- evts:
+	case w.eventChan <- b:
 		return nil
 	default:
 		return errQueueFull
@@ -74,37 +110,93 @@ func (w *worker) reset() {
 	w.resetRequest <- true
 }
 
-// close exits this worker. Calls to handleEvents after calling close
-// will panic.
+// ageOut removes keys last seen before cutoff, as of now.  Keys are only timed
+// once ageOut has first been called, as of that call.
+func (w *worker) ageOut(now, cutoff time.Time) {
+	w.ageOutRequest <- ageOutRequest{now, cutoff}
+}
+
+// close exits this worker once queued events are processed, and waits for it
+// to exit.  Calls to handleEvents after calling close will panic.
 func (w *worker) close() {
 	close(w.eventChan)
+	<-w.stopped
 }
 
 func (w *worker) loop() {
+	defer close(w.stopped)
 	for {
 		select {
-		case events, ok := <-w.eventChan:
+		case b, ok := <-w.eventChan:
 			if !ok {
 				return
 			}
-			for _, evt := range events {
-				w.handleEvent(evt)
-			}
+			w.handleBatch(b)
 
 		case <-w.resRequest:
+			w.handleQueued()
 			w.resReply <- w.assembleResults()
 
 		case <-w.resetRequest:
 			w.resetAggregators()
+
+		case req := <-w.ageOutRequest:
+			w.handleQueued()
+			w.handleAgeOut(req)
+		}
+	}
+}
+
+// handleQueued processes the events already queued, so that results include
+// every call to handleEvents that returned before they were requested.
+func (w *worker) handleQueued() {
+	for n := len(w.eventChan); n > 0; n-- {
+		b, ok := <-w.eventChan
+		if !ok {
+			return
 		}
+		w.handleBatch(b)
 	}
 }
 
+func (w *worker) handleBatch(b batch) {
+	for _, evt := range b.rows {
+		w.handleEvent(evt)
+	}
+	w.owners.record(b.keys)
+	w.coldConns.record(b.keys)
+}
+
 func (w *worker) resetAggregators() {
-	for key, ka := range w.aggregators {
-		delete(w.aggregators, key)
-		ka.Reset()
-		aggregatorPool.Put(&ka)
+	for key := range w.aggregators {
+		w.removeAggregator(key)
+	}
+}
+
+func (w *worker) removeAggregator(key string) {
+	ka := w.aggregators[key]
+	delete(w.aggregators, key)
+	delete(w.writes, key)
+	if w.lastSeen != nil {
+		delete(w.lastSeen, key)
+	}
+	ka.Reset()
+	w.spare.Put(&ka)
+}
+
+func (w *worker) handleAgeOut(req ageOutRequest) {
+	if w.lastSeen == nil {
+		w.lastSeen = make(map[string]time.Time, len(w.aggregators))
+		for key := range w.aggregators {
+			w.lastSeen[key] = req.now
+		}
+	}
+	for key, seen := range w.lastSeen {
+		if seen.IsZero() {
+			w.lastSeen[key] = req.now
+		} else if seen.Before(req.cutoff) {
+			w.removeAggregator(key)
+		}
 	}
 }
 
@@ -114,7 +206,7 @@ func (w *worker) handleEvent(evt model.Event) {
 	if !ok {
 		// Need to create an aggregator for this key.
 		// First try to reuse an aggregator from the pool.
-		if fromPool := aggregatorPool.Get(); fromPool != nil {
+		if fromPool := w.spare.Get(); fromPool != nil {
 			ka = *fromPool.(*aggregate.KeyAggregator)
 		} else {
 			agg := w.aggregatorFactory.New()
@@ -125,7 +217,31 @@ func (w *worker) handleEvent(evt model.Event) {
 		w.aggregators[mapKey] = ka
 	}
 
-	ka.Add(evt)
+	switch evt.Type {
+	case model.EventSet, model.EventDelete:
+		w.countWrite(mapKey, evt)
+	default:
+		ka.Add(evt)
+	}
+	if w.lastSeen != nil {
+		w.lastSeen[mapKey] = time.Time{}
+	}
+}
+
+// countWrite counts a value stored or deleted for mapKey, and the size of a
+// value stored.
+func (w *worker) countWrite(mapKey string, evt model.Event) {
+	oc, ok := w.writes[mapKey]
+	if !ok {
+		oc = &OpCounts{}
+		w.writes[mapKey] = oc
+	}
+	if evt.Type == model.EventSet {
+		oc.Sets++
+		oc.SetBytes += int64(evt.Size)
+	} else {
+		oc.Deletes++
+	}
 }
 
 type result struct {
@@ -133,15 +249,21 @@ type result struct {
 	keyFields [][]string
 	// aggResults[x] is the aggregate results for keyFields[x], in format-determined order.
 	aggResults [][]int64
+	// ops[x] counts the values stored and deletions for keyFields[x].
+	ops []OpCounts
 }
 
 func (w *worker) assembleResults() (res result) {
 	res.keyFields = make([][]string, len(w.aggregators))
 	res.aggResults = make([][]int64, len(w.aggregators))
+	res.ops = make([]OpCounts, len(w.aggregators))
 	var i int
-	for _, ka := range w.aggregators {
+	for mapKey, ka := range w.aggregators {
 		res.keyFields[i] = ka.Key
 		res.aggResults[i] = ka.Result()
+		if oc, ok := w.writes[mapKey]; ok {
+			res.ops[i] = *oc
+		}
 		i++
 	}
 	return
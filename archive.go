@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/archive"
+	"github.com/box/memsniff/diskbudget"
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/presentation"
+	flag "github.com/spf13/pflag"
+)
+
+const archiveWatermark = " ARCHIVE — not live "
+
+var (
+	errExportUsage = errors.New("usage: memsniff export [--output json|csv] ARCHIVE...")
+	errViewUsage   = errors.New("usage: memsniff view ARCHIVE...")
+	errViewNoGui   = errors.New("memsniff view requires the interactive interface; use memsniff export for text")
+	errNoArchives  = errors.New("no archives found")
+)
+
+// reportSink is where archiveHook writes reports: an archive.Sink, or an
+// archive.Failover between two.
+type reportSink interface {
+	Write(rep analysis.Report) error
+	Close() error
+}
+
+// archiveSink returns the sink of --report-archive, failing over to
+// --report-archive-fallback if given.  The archives of each directory are
+// held to budget and capped at limit.
+func archiveSink(budget *diskbudget.Budget, limit int64) (reportSink, error) {
+	primary, err := archive.NewSink(*reportArchive)
+	if err == nil {
+		err = primary.SetBudget(budget.Register("report archive", limit))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if *archiveBackup == "" {
+		return primary, nil
+	}
+	fallback, err := archive.NewSink(*archiveBackup)
+	if err == nil {
+		err = fallback.SetBudget(budget.Register("report archive fallback", limit))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("--report-archive-fallback: %v", err)
+	}
+	return archive.NewFailover(logger, primary, *reportArchive, fallback, *archiveBackup, *archiveWait), nil
+}
+
+// archiveHook returns a hook that writes every report to sink.  Archiving stops
+// after the first error, which is logged.
+func archiveHook(sink reportSink) analysis.ReportHook {
+	failed := false
+	return func(rep analysis.Report) {
+		if failed {
+			return
+		}
+		if err := sink.Write(rep); err != nil {
+			failed = true
+			logger.Log("Report archive:", err, "(no further reports archived)")
+		}
+	}
+}
+
+// runExport implements "memsniff export", converting archived reports to
+// JSON, one object per report, or CSV, one line per key per report.  Each
+// argument is an archive or a directory of them.  It returns the process exit
+// status.
+func runExport(args []string, out io.Writer) int {
+	if len(args) == 0 {
+		log.ConsoleLogger{}.Log(errExportUsage)
+		return 1
+	}
+	format := *output
+	if !flag.CommandLine.Changed("output") {
+		format = "json"
+	}
+	var w reportExporter
+	switch format {
+	case "json":
+		w = &jsonExporter{enc: json.NewEncoder(out)}
+	case "csv":
+		w = &csvExporter{w: csv.NewWriter(out)}
+	default:
+		log.ConsoleLogger{}.Log("export output must be json or csv")
+		return 1
+	}
+	if *fields != "" {
+		w = fieldExporter{w, analysis.ParseFields(*fields)}
+	}
+
+	files, err := archive.Files(args)
+	if err != nil {
+		log.ConsoleLogger{}.Log(err)
+		return 2
+	}
+	for _, path := range files {
+		var werr error
+		err := archive.ReadFile(path, func(rep analysis.Report) bool {
+			werr = w.write(rep)
+			return werr == nil
+		})
+		if werr != nil {
+			log.ConsoleLogger{}.Log(werr)
+			return 1
+		}
+		if err == io.ErrUnexpectedEOF {
+			log.ConsoleLogger{}.Log(path+":", "ends part way through a report, which was skipped")
+		} else if err != nil {
+			log.ConsoleLogger{}.Log(path+":", err)
+			return 2
+		}
+	}
+	if err := w.flush(); err != nil {
+		log.ConsoleLogger{}.Log(err)
+		return 1
+	}
+	return 0
+}
+
+// reportExporter writes reports in an export format.
+type reportExporter interface {
+	write(rep analysis.Report) error
+	flush() error
+}
+
+// fieldExporter includes only the named columns of each report in the output
+// of an underlying reportExporter.  A report lacking any of the columns is an
+// error.
+type fieldExporter struct {
+	reportExporter
+	fields []string
+}
+
+func (e fieldExporter) write(rep analysis.Report) error {
+	if err := rep.SelectFields(e.fields); err != nil {
+		return fmt.Errorf("--fields: report of %v: %v", rep.Timestamp.UTC().Format(time.RFC3339), err)
+	}
+	return e.reportExporter.write(rep)
+}
+
+// exportedReport is the JSON form of a report.  Each row is an object with a
+// member for every column.
+type exportedReport struct {
+	Timestamp             time.Time                `json:"timestamp"`
+	Discontinuous         bool                     `json:"discontinuous,omitempty"`
+	TotalRows             int                      `json:"total_rows"`
+	DropRate              float64                  `json:"drop_rate"`
+	KeysSingleGet         int64                    `json:"keys_single_get"`
+	KeysMultiGet          int64                    `json:"keys_multi_get"`
+	UnattributedResponses int64                    `json:"unattributed_responses"`
+	UnattributedBytes     int64                    `json:"unattributed_bytes"`
+	KeysSplit             int                      `json:"keys_split"`
+	DecaySeconds          float64                  `json:"decay_seconds,omitempty"`
+	Skew                  exportedSkew             `json:"skew"`
+	Warmup                *exportedWarmup          `json:"warmup,omitempty"`
+	Connections           []exportedConn           `json:"connections,omitempty"`
+	Restarts              []exportedRestart        `json:"restarts,omitempty"`
+	ConfigChanged         []exportedConfigChange   `json:"config_changed,omitempty"`
+	Rows                  []map[string]interface{} `json:"rows"`
+}
+
+type exportedSkew struct {
+	Keys      int     `json:"keys"`
+	Requests  int64   `json:"requests"`
+	Gini      float64 `json:"gini"`
+	Top1Share float64 `json:"top1_share"`
+}
+
+type exportedWarmup struct {
+	ReferenceKeys int64   `json:"reference_keys"`
+	Observed      int64   `json:"observed"`
+	Unlisted      int64   `json:"unlisted"`
+	ETASeconds    float64 `json:"eta_seconds,omitempty"`
+}
+
+type exportedConn struct {
+	Conn          string `json:"conn"`
+	RequestBytes  int64  `json:"request_bytes"`
+	ResponseBytes int64  `json:"response_bytes"`
+}
+
+type exportedRestart struct {
+	Server      string    `json:"server"`
+	Time        time.Time `json:"time"`
+	Closed      int64     `json:"closed"`
+	Reconnected int64     `json:"reconnected"`
+}
+
+type exportedConfigChange struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Setting string    `json:"setting"`
+	Value   string    `json:"value"`
+}
+
+type jsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e *jsonExporter) write(rep analysis.Report) error {
+	er := exportedReport{
+		Timestamp:             rep.Timestamp.UTC(),
+		Discontinuous:         rep.Discontinuous,
+		TotalRows:             rep.TotalRows,
+		DropRate:              rep.DropRate,
+		KeysSingleGet:         rep.KeysSingleGet,
+		KeysMultiGet:          rep.KeysMultiGet,
+		UnattributedResponses: rep.UnattributedResponses,
+		UnattributedBytes:     rep.UnattributedBytes,
+		KeysSplit:             rep.KeysSplit,
+		DecaySeconds:          rep.Decay.Seconds(),
+		Skew:                  exportedSkew(rep.Skew),
+		Rows:                  make([]map[string]interface{}, len(rep.Rows)),
+	}
+	if wp := rep.Warmup; wp != nil {
+		er.Warmup = &exportedWarmup{wp.Reference, wp.Observed, wp.Unlisted, wp.ETA.Seconds()}
+	}
+	for _, c := range rep.Connections {
+		er.Connections = append(er.Connections, exportedConn(c))
+	}
+	for _, r := range rep.Restarts {
+		er.Restarts = append(er.Restarts, exportedRestart{r.Server, r.Time.UTC(), r.Closed, r.Reconnected})
+	}
+	for _, c := range rep.ConfigChanges {
+		er.ConfigChanged = append(er.ConfigChanged, exportedConfigChange{c.Time.UTC(), c.Source, c.Setting, c.Value})
+	}
+	for i, row := range rep.Rows {
+		m := make(map[string]interface{}, len(row.Key)+len(row.Values))
+		for j, name := range rep.KeyColNames {
+			m[name] = row.Key[j]
+		}
+		for j, name := range rep.ValColNames {
+			m[name] = row.Values[j]
+		}
+		er.Rows[i] = m
+	}
+	return e.enc.Encode(er)
+}
+
+func (e *jsonExporter) flush() error {
+	return nil
+}
+
+// csvExporter writes a line per key per report, preceded by the time of the
+// report.  A report with no keys is written as a single line with empty key
+// columns and zero values, so that an idle interval still appears.  A header
+// line starts the output and precedes any change of columns.
+type csvExporter struct {
+	w                *csv.Writer
+	keyCols, valCols []string
+}
+
+func (e *csvExporter) write(rep analysis.Report) error {
+	if e.keyCols == nil || !reflect.DeepEqual(rep.KeyColNames, e.keyCols) || !reflect.DeepEqual(rep.ValColNames, e.valCols) {
+		e.keyCols, e.valCols = rep.KeyColNames, rep.ValColNames
+		header := append([]string{"timestamp"}, rep.KeyColNames...)
+		if err := e.w.Write(append(header, rep.ValColNames...)); err != nil {
+			return err
+		}
+	}
+	ts := rep.Timestamp.UTC().Format(time.RFC3339Nano)
+	if len(rep.Rows) == 0 {
+		rec := append([]string{ts}, make([]string, len(rep.KeyColNames))...)
+		for range rep.ValColNames {
+			rec = append(rec, "0")
+		}
+		return e.w.Write(rec)
+	}
+	for _, row := range rep.Rows {
+		rec := append([]string{ts}, row.Key...)
+		for _, v := range row.Values {
+			rec = append(rec, strconv.FormatInt(v, 10))
+		}
+		if err := e.w.Write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *csvExporter) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// runView implements "memsniff view", showing archived reports in the
+// interactive interface, one every interval.  It returns the process exit
+// status.
+func runView(args []string) int {
+	if len(args) == 0 {
+		log.ConsoleLogger{}.Log(errViewUsage)
+		return 1
+	}
+	if *ui == "text" || *noGui {
+		log.ConsoleLogger{}.Log(errViewNoGui)
+		return 1
+	}
+	thresholds, err := presentation.ParseDropThresholds(*dropThresholds)
+	if err != nil {
+		log.ConsoleLogger{}.Log(err)
+		return 1
+	}
+	numbers, err := numberFormat()
+	if err != nil {
+		log.ConsoleLogger{}.Log(err)
+		return 1
+	}
+	files, err := archive.Files(args)
+	if err == nil && len(files) == 0 {
+		err = errNoArchives
+	}
+	if err != nil {
+		log.ConsoleLogger{}.Log(err)
+		return 2
+	}
+
+	buffered := &log.BufferLogger{}
+	logger.SetLogger(buffered)
+	player, err := archive.NewPlayer(logger, files)
+	if err != nil {
+		log.ConsoleLogger{}.Log(err)
+		return 2
+	}
+	defer player.Close()
+
+	updateInterval := time.Duration(*interval) * time.Second
+	stats := presentation.NewStatTracker(func() presentation.Stats { return presentation.Stats{} })
+	cui := presentation.New(player, updateInterval, false, stats, thresholds, archiveWatermark, *keyTree, numbers, nil)
+	logger.SetLogger(cui)
+	go buffered.WriteTo(cui)
+	logger.Log("Showing", len(files), "archive(s), a report every", updateInterval)
+	if err := cui.Run(); err != nil {
+		logger.SetLogger(log.ConsoleLogger{})
+		logger.Log(err)
+		return 1
+	}
+	return 0
+}
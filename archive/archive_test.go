@@ -0,0 +1,524 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/diskbudget"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// sampleReports returns reports exercising every field, with a change of
+// columns part way through.
+func sampleReports() []analysis.Report {
+	start := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	reps := []analysis.Report{
+		{
+			Timestamp:   start,
+			KeyColNames: []string{"key"},
+			ValColNames: []string{"max(size)", "sum(size)"},
+			Rows: []analysis.ReportRow{
+				{Key: []string{"user:1000:profile"}, Values: []int64{512, 51200}},
+				{Key: []string{"user:1000:session"}, Values: []int64{64, 640}},
+				{Key: []string{"user:1001:profile"}, Values: []int64{480, 960}},
+			},
+			TotalRows:             3,
+			DropRate:              0.015,
+			KeysSingleGet:         90,
+			KeysMultiGet:          12,
+			UnattributedResponses: 2,
+			UnattributedBytes:     300,
+			Connections: []analysis.ConnTraffic{
+				{Conn: "10.0.0.5:40122", RequestBytes: 2000, ResponseBytes: 52000},
+			},
+			KeysSplit: 1,
+			Skew:      analysis.KeySkew{Keys: 3, Requests: 104, Gini: 0.25, Top1Share: 0.5},
+		},
+		{
+			Timestamp:   start.Add(time.Second),
+			KeyColNames: []string{"key"},
+			ValColNames: []string{"max(size)", "sum(size)"},
+			Rows: []analysis.ReportRow{
+				{Key: []string{"user:1000:profile"}, Values: []int64{512, 1024}},
+			},
+			TotalRows:     1,
+			Discontinuous: true,
+			Warmup:        &analysis.WarmupProgress{Reference: 1000, Observed: 420, Unlisted: 3, ETA: 12 * time.Minute},
+			Restarts: []analysis.ServerRestart{
+				{Server: "10.0.0.9:11211", Time: start.Add(-3 * time.Second), Closed: 40, Reconnected: 22},
+			},
+			ConfigChanges: []analysis.ConfigChange{
+				{Time: start.Add(500 * time.Millisecond), Source: "keyboard", Setting: "bw", Value: "request"},
+			},
+		},
+		{
+			Timestamp:   start.Add(2 * time.Second),
+			KeyColNames: []string{"client", "key"},
+			ValColNames: []string{"count(size)"},
+			Rows: []analysis.ReportRow{
+				{Key: []string{"10.0.0.5", "a"}, Values: []int64{-1}},
+				{Key: []string{"10.0.0.5", "b"}, Values: []int64{7}},
+				{Key: []string{"10.0.0.6", "a"}, Values: []int64{0}},
+			},
+			TotalRows: 5,
+			Decay:     30 * time.Minute,
+		},
+	}
+	return reps
+}
+
+func writeArchive(t *testing.T, reps []analysis.Report) []byte {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, rep := range reps {
+		if err := w.Write(rep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func readArchive(t *testing.T, b []byte) []analysis.Report {
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reps []analysis.Report
+	for {
+		rep, err := r.Next()
+		if err == io.EOF {
+			return reps
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		reps = append(reps, rep)
+	}
+}
+
+func checkReports(t *testing.T, got, want []analysis.Report) {
+	if len(got) != len(want) {
+		t.Fatalf("read %d reports, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) {
+			t.Errorf("report %d: timestamp %v, want %v", i, got[i].Timestamp, want[i].Timestamp)
+		}
+		got[i].Timestamp = want[i].Timestamp
+		for j := range got[i].Restarts {
+			if j < len(want[i].Restarts) && got[i].Restarts[j].Time.Equal(want[i].Restarts[j].Time) {
+				got[i].Restarts[j].Time = want[i].Restarts[j].Time
+			}
+		}
+		for j := range got[i].ConfigChanges {
+			if j < len(want[i].ConfigChanges) && got[i].ConfigChanges[j].Time.Equal(want[i].ConfigChanges[j].Time) {
+				got[i].ConfigChanges[j].Time = want[i].ConfigChanges[j].Time
+			}
+		}
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("report %d:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	reps := sampleReports()
+	checkReports(t, readArchive(t, writeArchive(t, reps)), reps)
+}
+
+// TestSortsRows checks that rows are archived in order of key, without
+// reordering those of the report written.
+func TestSortsRows(t *testing.T) {
+	rep := sampleReports()[0]
+	rep.Rows[0], rep.Rows[2] = rep.Rows[2], rep.Rows[0]
+	first := rep.Rows[0].Key[0]
+	got := readArchive(t, writeArchive(t, []analysis.Report{rep}))
+	if rep.Rows[0].Key[0] != first {
+		t.Error("rows of written report were reordered")
+	}
+	if got[0].Rows[0].Key[0] != "user:1000:profile" {
+		t.Error("rows not sorted:", got[0].Rows)
+	}
+}
+
+// TestVersion1Readable checks that archives written in version 1 of the format
+// can still be read.  testdata/v1.msar must never be regenerated once the
+// format has moved on.
+func TestVersion1Readable(t *testing.T) {
+	path := filepath.Join("testdata", "v1.msar")
+	if *update && Version == 1 {
+		if err := ioutil.WriteFile(path, writeArchive(t, sampleReports()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Version() != 1 {
+		t.Errorf("version %d", r.Version())
+	}
+	// fields added in later versions read as absent
+	want := sampleReports()
+	for i := range want {
+		want[i].Warmup = nil
+		want[i].Restarts = nil
+		want[i].ConfigChanges = nil
+	}
+	checkReports(t, readArchive(t, b), want)
+}
+
+// TestVersion2Readable checks that archives written in version 2 of the format
+// can still be read.  testdata/v2.msar must never be regenerated once the
+// format has moved on.
+func TestVersion2Readable(t *testing.T) {
+	path := filepath.Join("testdata", "v2.msar")
+	if *update && Version == 2 {
+		if err := ioutil.WriteFile(path, writeArchive(t, sampleReports()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Version() != 2 {
+		t.Errorf("version %d", r.Version())
+	}
+	// fields added in later versions read as absent
+	want := sampleReports()
+	for i := range want {
+		want[i].Restarts = nil
+		want[i].ConfigChanges = nil
+	}
+	checkReports(t, readArchive(t, b), want)
+}
+
+// TestVersion3Readable checks that archives written in version 3 of the format
+// can still be read.  testdata/v3.msar must never be regenerated once the
+// format has moved on.
+func TestVersion3Readable(t *testing.T) {
+	path := filepath.Join("testdata", "v3.msar")
+	if *update && Version == 3 {
+		if err := ioutil.WriteFile(path, writeArchive(t, sampleReports()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Version() != 3 {
+		t.Errorf("version %d", r.Version())
+	}
+	// fields added in later versions read as absent
+	want := sampleReports()
+	for i := range want {
+		want[i].ConfigChanges = nil
+	}
+	checkReports(t, readArchive(t, b), want)
+}
+
+func TestNewerVersion(t *testing.T) {
+	b := writeArchive(t, sampleReports())
+	b[len(magic)] = Version + 1
+	_, err := NewReader(bytes.NewReader(b))
+	if err != (VersionError{Version + 1}) {
+		t.Error(err)
+	}
+}
+
+func TestNotArchive(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("{\"Rows\": []}")))
+	if err != ErrNotArchive {
+		t.Error(err)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	b := writeArchive(t, sampleReports())
+	r, err := NewReader(bytes.NewReader(b[:len(b)-3]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Next(); err != io.ErrUnexpectedEOF {
+		t.Error(err)
+	}
+}
+
+// TestCompact checks that a typical report takes much less space archived than
+// as JSON.
+func TestCompact(t *testing.T) {
+	var reps []analysis.Report
+	start := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		rep := analysis.Report{
+			Timestamp:   start.Add(time.Duration(i) * time.Second),
+			KeyColNames: []string{"key"},
+			ValColNames: []string{"max(size)", "sum(size)", "count(size)"},
+		}
+		for k := 0; k < 1000; k++ {
+			n := int64(k%37 + 1)
+			rep.Rows = append(rep.Rows, analysis.ReportRow{
+				Key:    []string{fmt.Sprintf("user:%d:profile", 100000+k*7)},
+				Values: []int64{512 + n, 512 * n, n},
+			})
+		}
+		rep.TotalRows = len(rep.Rows)
+		reps = append(reps, rep)
+	}
+	var js bytes.Buffer
+	enc := json.NewEncoder(&js)
+	for _, rep := range reps {
+		if err := enc.Encode(rep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archived := writeArchive(t, reps)
+	if ratio := float64(js.Len()) / float64(len(archived)); ratio < 5 {
+		t.Errorf("archive of %d bytes only %.1f times smaller than %d bytes of JSON", len(archived), ratio, js.Len())
+	}
+}
+
+// TestSink checks that a Sink starts a new archive each day, and that Files
+// lists them in order.
+func TestSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsniff-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reps := sampleReports()
+	reps[2].Timestamp = reps[1].Timestamp.Add(24 * time.Hour)
+	for _, rep := range reps {
+		if err := s.Write(rep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Files([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "memsniff-20170601-090000.msar"),
+		filepath.Join(dir, "memsniff-20170602-090001.msar"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatal(files)
+	}
+	var got []analysis.Report
+	for _, f := range files {
+		err := ReadFile(f, func(rep analysis.Report) bool {
+			got = append(got, rep)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkReports(t, got, reps)
+}
+
+// TestSinkBudget checks that a Sink held to a budget deletes older archives,
+// including those of earlier runs, to make room, starting a new archive when
+// the current one has to go, and drops reports that cannot fit.
+func TestSinkBudget(t *testing.T) {
+	reps := sampleReports()
+	var largest int64
+	for _, rep := range reps {
+		var buf bytes.Buffer
+		if err := NewWriter(&buf).Write(rep); err != nil {
+			t.Fatal(err)
+		}
+		if n := int64(buf.Len()); n > largest {
+			largest = n
+		}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		limit  int64
+		kept   []analysis.Report
+		paused bool
+	}{
+		{"one report per archive", largest, reps[2:], false},
+		{"no room", 8, nil, true},
+	} {
+		dir, err := ioutil.TempDir("", "memsniff-archive")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		old := filepath.Join(dir, "memsniff-20170501-090000.msar")
+		if err := ioutil.WriteFile(old, make([]byte, 64), 0644); err != nil {
+			t.Fatal(err)
+		}
+		past := time.Now().Add(-30 * 24 * time.Hour)
+		if err := os.Chtimes(old, past, past); err != nil {
+			t.Fatal(err)
+		}
+
+		budget := diskbudget.New(0, nil)
+		s, err := NewSink(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetBudget(budget.Register("report archive", tt.limit)); err != nil {
+			t.Fatal(err)
+		}
+		for _, rep := range reps {
+			if err := s.Write(rep); err != nil {
+				t.Fatal(tt.name+":", err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := Files([]string{dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []analysis.Report
+		var size int64
+		for _, f := range files {
+			err := ReadFile(f, func(rep analysis.Report) bool {
+				got = append(got, rep)
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size += fi.Size()
+		}
+		checkReports(t, got, tt.kept)
+		usage := budget.Usage().Sinks[0]
+		if usage.Bytes != size || usage.Files != len(files) || usage.Paused != tt.paused {
+			t.Errorf("%s: usage %+v of %d bytes in %d files", tt.name, usage, size, len(files))
+		}
+	}
+}
+
+// TestPlayer checks that a Player steps through archives, limiting rows, and
+// stays on the last report.
+func TestPlayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsniff-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	reps := sampleReports()
+	var paths []string
+	for i, rep := range reps {
+		paths = append(paths, filepath.Join(dir, fmt.Sprint(i)+Extension))
+		if err := ioutil.WriteFile(paths[i], writeArchive(t, []analysis.Report{rep}), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths = append(paths[:1], append([]string{filepath.Join(dir, "missing")}, paths[1:]...)...)
+
+	var logged []string
+	p, err := NewPlayer(logFunc(func(items ...interface{}) {
+		logged = append(logged, fmt.Sprint(items...))
+	}), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if keyCols, _ := p.ColumnNames(); !reflect.DeepEqual(keyCols, []string{"key"}) {
+		t.Error(keyCols)
+	}
+	rep := p.ReportTop(true, 1, -2)
+	if len(rep.Rows) != 1 || rep.Rows[0].Key[0] != "user:1000:profile" {
+		t.Error(rep.Rows)
+	}
+	for _, want := range []time.Time{reps[1].Timestamp, reps[2].Timestamp, reps[2].Timestamp} {
+		if rep := p.ReportTop(true, 10); !rep.Timestamp.Equal(want) {
+			t.Errorf("report at %v, want %v", rep.Timestamp, want)
+		}
+	}
+	if len(logged) != 2 || logged[1] != "End of archive" {
+		t.Error(logged)
+	}
+}
+
+// TestPlayerDuplicates checks that a Player merges keys listed twice by a
+// malformed archive, and warns of them.
+func TestPlayerDuplicates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsniff-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rep := sampleReports()[0]
+	rep.Rows = append(rep.Rows, analysis.ReportRow{Key: []string{"user:1000:profile"}, Values: []int64{600, 100}})
+	rep.TotalRows++
+	path := filepath.Join(dir, "dup"+Extension)
+	if err := ioutil.WriteFile(path, writeArchive(t, []analysis.Report{rep}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var logged []string
+	p, err := NewPlayer(logFunc(func(items ...interface{}) {
+		logged = append(logged, fmt.Sprint(items...))
+	}), []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	got := p.ReportTop(true, 10, -1)
+	if len(got.Rows) != 3 || got.TotalRows != 3 || !reflect.DeepEqual(got.Rows[0].Values, []int64{600, 51300}) {
+		t.Error(got.Rows)
+	}
+	if len(logged) == 0 || !strings.Contains(logged[0], "duplicate keys") {
+		t.Error(logged)
+	}
+}
+
+type logFunc func(items ...interface{})
+
+func (f logFunc) Log(items ...interface{}) {
+	f(items...)
+}
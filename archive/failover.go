@@ -0,0 +1,143 @@
+package archive
+
+import (
+	"errors"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/log"
+)
+
+// DefaultFailoverProbe is how often a Failover writing to its fallback tries
+// its primary again.
+const DefaultFailoverProbe = time.Minute
+
+var errStalled = errors.New("write stalled")
+
+// reportSink is the part of a Sink used by a Failover.
+type reportSink interface {
+	Write(rep analysis.Report) error
+	Close() error
+}
+
+// Failover writes reports to a primary Sink, such as on a network file system,
+// and to a fallback Sink, such as on local disk, while writes to the primary
+// fail or take longer than a timeout.  Each switch is logged, with the number
+// of reports written to the destination left.  While on the fallback, the
+// next report after each probe period is offered to the primary, switching
+// back if it is written in time.  Each destination starts a new archive when
+// switched to, so that the archives of both directories interleave by name.
+//
+// A write that stalls cannot be abandoned, so the primary is not tried again
+// until it finishes.  The report is written to the fallback too, and appears
+// in both if the stalled write eventually succeeds.
+type Failover struct {
+	logger            log.Logger
+	primary, fallback reportSink
+	primaryName       string
+	fallbackName      string
+	timeout           time.Duration
+	probe             time.Duration
+	// failedOver is set while reports are written to the fallback, and
+	// tried is when the primary was last tried since.
+	failedOver bool
+	tried      time.Time
+	// stalled receives the result of the write to the primary that last
+	// timed out, and is nil once it has finished.
+	stalled chan error
+	// written counts the reports written to the current destination since
+	// it was switched to.
+	written int
+}
+
+// NewFailover returns a Failover writing to primary, in directory
+// primaryName, and to fallback, in fallbackName, while the primary fails or
+// takes longer than timeout to write a report.  Switches are logged to
+// logger.
+func NewFailover(logger log.Logger, primary *Sink, primaryName string, fallback *Sink, fallbackName string, timeout time.Duration) *Failover {
+	return &Failover{
+		logger:       logger,
+		primary:      primary,
+		fallback:     fallback,
+		primaryName:  primaryName,
+		fallbackName: fallbackName,
+		timeout:      timeout,
+		probe:        DefaultFailoverProbe,
+	}
+}
+
+// Write writes rep to the primary, or to the fallback while failed over.  It
+// returns an error only if the fallback cannot be written.
+func (f *Failover) Write(rep analysis.Report) error {
+	if f.usePrimary() {
+		err := f.writePrimary(rep)
+		if err == nil {
+			if f.failedOver {
+				f.logger.Log("Report archive: writing to", f.primaryName, "again after", f.written, "reports to", f.fallbackName)
+				f.fallback.Close()
+				f.failedOver, f.written = false, 0
+			}
+			f.written++
+			return nil
+		}
+		if !f.failedOver {
+			f.logger.Log("Report archive:", f.primaryName+":", err, "after", f.written, "reports; writing to", f.fallbackName, "until it recovers")
+			f.failedOver, f.written = true, 0
+		}
+		f.tried = time.Now()
+	}
+	if err := f.fallback.Write(rep); err != nil {
+		return err
+	}
+	f.written++
+	return nil
+}
+
+// usePrimary returns whether the next report should be offered to the
+// primary.
+func (f *Failover) usePrimary() bool {
+	if f.stalled != nil {
+		select {
+		case <-f.stalled:
+			f.stalled = nil
+			// end the archive the stalled write was to, so that
+			// the next write starts a new one
+			f.primary.Close()
+		default:
+			return false
+		}
+	}
+	return !f.failedOver || time.Since(f.tried) >= f.probe
+}
+
+// writePrimary writes rep to the primary, giving up after the timeout.  The
+// archive written to is closed on failure, so that any partial record ends
+// it.
+func (f *Failover) writePrimary(rep analysis.Report) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- f.primary.Write(rep)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			f.primary.Close()
+		}
+		return err
+	case <-time.After(f.timeout):
+		f.stalled = done
+		return errStalled
+	}
+}
+
+// Close closes the current archives, except that of a primary write that has
+// not finished.
+func (f *Failover) Close() error {
+	err := f.fallback.Close()
+	if f.stalled == nil {
+		if perr := f.primary.Close(); err == nil {
+			err = perr
+		}
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+)
+
+// fakeSink records the values of the reports written to it, failing with err
+// if set, and first waiting for block to be closed if it is not nil.
+type fakeSink struct {
+	mu     sync.Mutex
+	values []int64
+	err    error
+	block  chan struct{}
+}
+
+func (s *fakeSink) Write(rep analysis.Report) error {
+	s.mu.Lock()
+	block, err := s.block, s.err
+	s.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = append(s.values, rep.Rows[0].Values[0])
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	return nil
+}
+
+func (s *fakeSink) set(err error, block chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err, s.block = err, block
+}
+
+func (s *fakeSink) written() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.values...)
+}
+
+// TestFailover checks that reports go to the fallback while the primary fails
+// or stalls, and to the primary again once it recovers.
+func TestFailover(t *testing.T) {
+	primary, fallback := &fakeSink{}, &fakeSink{}
+	var logged []string
+	f := &Failover{
+		logger: logFunc(func(items ...interface{}) {
+			logged = append(logged, strings.TrimSpace(fmt.Sprintln(items...)))
+		}),
+		primary:      primary,
+		fallback:     fallback,
+		primaryName:  "nfs",
+		fallbackName: "local",
+		timeout:      20 * time.Millisecond,
+	}
+	write := func(n int64) {
+		t.Helper()
+		if err := f.Write(indexReport(time.Time{}, n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(0)
+	primary.set(errors.New("stale file handle"), nil)
+	write(1)
+	primary.set(nil, nil)
+	write(2)
+	block := make(chan struct{})
+	primary.set(nil, block)
+	write(3)
+	// the primary is not tried while its write is stalled
+	primary.set(nil, nil)
+	write(4)
+	close(block)
+	for len(primary.written()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	write(5)
+
+	if got := primary.written(); !reflect.DeepEqual(got, []int64{0, 2, 3, 5}) {
+		t.Error("primary:", got)
+	}
+	if got := fallback.written(); !reflect.DeepEqual(got, []int64{1, 3, 4}) {
+		t.Error("fallback:", got)
+	}
+	want := []string{
+		"stale file handle after 1 reports",
+		"again after 1 reports",
+		"write stalled after 1 reports",
+		"again after 2 reports",
+	}
+	if len(logged) != len(want) {
+		t.Fatal(logged)
+	}
+	for i := range want {
+		if !strings.Contains(logged[i], want[i]) {
+			t.Errorf("logged %q, want %q", logged[i], want[i])
+		}
+	}
+}
+
+// TestFilesMerged checks that the archives of several directories are listed
+// in the order they were written.
+func TestFilesMerged(t *testing.T) {
+	root, err := ioutil.TempDir("", "memsniff-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dirs := []string{filepath.Join(root, "primary"), filepath.Join(root, "fallback")}
+	start := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		// alternate between the directories, as a Failover does
+		s, err := NewSink(dirs[i%2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(indexReport(start.Add(time.Duration(i)*time.Minute), int64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	single := filepath.Join(root, "single"+Extension)
+	if err := ioutil.WriteFile(single, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Files([]string{single, dirs[0], dirs[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		single,
+		filepath.Join(dirs[0], "memsniff-20170601-090000"+Extension),
+		filepath.Join(dirs[1], "memsniff-20170601-090100"+Extension),
+		filepath.Join(dirs[0], "memsniff-20170601-090200"+Extension),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %v, want %v", files, want)
+	}
+}
@@ -0,0 +1,442 @@
+// Package archive stores reports in a compact binary format for long-term
+// keeping, and reads them back.
+//
+// An archive file starts with the four bytes "MSAR" and the format version as
+// an unsigned varint.  A series of records follows, one per report, each an
+// unsigned varint giving the length of the record body and then the body.
+// Integers in a body are signed varints unless noted, and strings are an
+// unsigned varint length followed by that many bytes.  A version 1 body holds,
+// in order:
+//
+//	timestamp    nanoseconds since the timestamp of the previous record in
+//	             the file, or since the Unix epoch for the first
+//	flags        unsigned varint: 1 if the report is discontinuous, 2 if
+//	             column names follow
+//	columns      only if flagged: the count and names of the key columns,
+//	             then of the value columns; otherwise those of the previous
+//	             record apply
+//	summary      TotalRows, DropRate as the little-endian bits of a float64,
+//	             KeysSingleGet, KeysMultiGet, UnattributedResponses,
+//	             UnattributedBytes, KeysSplit, Decay in nanoseconds, and
+//	             Skew as Keys, Requests, and the float64 bits of Gini and
+//	             Top1Share
+//	connections  the count of connections, then for each its address,
+//	             RequestBytes, and ResponseBytes
+//	rows         the count of rows, then for each every key column, as the
+//	             unsigned lengths of the prefix and then the suffix it shares
+//	             with the same column of the previous row and the rest between
+//	             them as a string, followed by every value
+//
+// Rows are written sorted by key so that consecutive keys share long prefixes,
+// and keys following a pattern such as user:N:profile often share suffixes.
+//
+// A version 2 body continues with:
+//
+//	warmup       unsigned varint: 1 if warmup progress follows, then its
+//	             Reference, Observed, Unlisted, and ETA in nanoseconds
+//
+// A version 3 body continues with:
+//
+//	restarts     the count of server restarts, then for each its server,
+//	             Time in nanoseconds since the timestamp of the record,
+//	             Closed, and Reconnected
+//
+// A version 4 body continues with:
+//
+//	config       the count of settings changed, then for each its Time in
+//	             nanoseconds since the timestamp of the record, Source,
+//	             Setting, and Value
+//
+// Fields added in later versions are appended to the body, so that a record is
+// decoded by reading the fields of its file's version.  Any change to the
+// meaning of existing fields needs a new version in which they are read
+// differently, and every earlier version must remain readable.
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+)
+
+// Version is the format version of archives written by this package.
+const Version = 4
+
+// magic identifies an archive file.
+const magic = "MSAR"
+
+// maxRecordSize limits the length of a record body accepted by a Reader, so
+// that a corrupt length does not exhaust memory.
+const maxRecordSize = 1 << 30
+
+// Flags of a record.
+const (
+	flagDiscontinuous = 1 << iota
+	flagColumns
+)
+
+var (
+	// ErrNotArchive is returned when reading a file that does not start
+	// like an archive.
+	ErrNotArchive = errors.New("not a memsniff report archive")
+	errCorrupt    = errors.New("corrupt archive record")
+)
+
+// VersionError is returned when reading an archive written in a later format
+// than this package understands.
+type VersionError struct {
+	Version uint64
+}
+
+func (e VersionError) Error() string {
+	return fmt.Sprintf("archive format version %d is newer than supported (%d)", e.Version, Version)
+}
+
+// encoder appends the fields of a record body to buf.
+type encoder struct {
+	buf     []byte
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) uvarint(v uint64) {
+	n := binary.PutUvarint(e.scratch[:], v)
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+func (e *encoder) varint(v int64) {
+	n := binary.PutVarint(e.scratch[:], v)
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+func (e *encoder) float(v float64) {
+	binary.LittleEndian.PutUint64(e.scratch[:8], math.Float64bits(v))
+	e.buf = append(e.buf, e.scratch[:8]...)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uvarint(uint64(len(ss)))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+// decoder reads the fields of a record body.  After the first error every
+// field reads as zero, and err is set.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errCorrupt
+	}
+	d.buf = nil
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) float() float64 {
+	if len(d.buf) < 8 {
+		d.fail()
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
+
+// count reads the number of items that follow, each taking at least one byte.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) strings() []string {
+	ss := make([]string, d.count())
+	for i := range ss {
+		ss[i] = d.string()
+	}
+	return ss
+}
+
+// encodeRecord appends the body of a record holding rep to e.  prev is the
+// timestamp of the previous record in the file, or the zero Time for the
+// first, and columns is true if the column names must be included.  rep.Rows
+// must be sorted by key.
+func encodeRecord(e *encoder, rep analysis.Report, prev time.Time, columns bool) {
+	var base int64
+	if !prev.IsZero() {
+		base = prev.UnixNano()
+	}
+	e.varint(rep.Timestamp.UnixNano() - base)
+	var flags uint64
+	if rep.Discontinuous {
+		flags |= flagDiscontinuous
+	}
+	if columns {
+		flags |= flagColumns
+	}
+	e.uvarint(flags)
+	if columns {
+		e.strings(rep.KeyColNames)
+		e.strings(rep.ValColNames)
+	}
+
+	e.varint(int64(rep.TotalRows))
+	e.float(rep.DropRate)
+	e.varint(rep.KeysSingleGet)
+	e.varint(rep.KeysMultiGet)
+	e.varint(rep.UnattributedResponses)
+	e.varint(rep.UnattributedBytes)
+	e.varint(int64(rep.KeysSplit))
+	e.varint(int64(rep.Decay))
+	e.varint(int64(rep.Skew.Keys))
+	e.varint(rep.Skew.Requests)
+	e.float(rep.Skew.Gini)
+	e.float(rep.Skew.Top1Share)
+
+	e.uvarint(uint64(len(rep.Connections)))
+	for _, c := range rep.Connections {
+		e.string(c.Conn)
+		e.varint(c.RequestBytes)
+		e.varint(c.ResponseBytes)
+	}
+
+	e.uvarint(uint64(len(rep.Rows)))
+	var prevKey []string
+	for _, row := range rep.Rows {
+		for j, k := range row.Key {
+			var prefix, suffix int
+			if prevKey != nil {
+				prefix = sharedPrefix(prevKey[j], k)
+				suffix = sharedSuffix(prevKey[j][prefix:], k[prefix:])
+			}
+			e.uvarint(uint64(prefix))
+			e.uvarint(uint64(suffix))
+			e.string(k[prefix : len(k)-suffix])
+		}
+		for _, v := range row.Values {
+			e.varint(v)
+		}
+		prevKey = row.Key
+	}
+
+	if wp := rep.Warmup; wp != nil {
+		e.uvarint(1)
+		e.varint(wp.Reference)
+		e.varint(wp.Observed)
+		e.varint(wp.Unlisted)
+		e.varint(int64(wp.ETA))
+	} else {
+		e.uvarint(0)
+	}
+
+	e.uvarint(uint64(len(rep.Restarts)))
+	for _, r := range rep.Restarts {
+		e.string(r.Server)
+		e.varint(r.Time.UnixNano() - rep.Timestamp.UnixNano())
+		e.varint(r.Closed)
+		e.varint(r.Reconnected)
+	}
+
+	e.uvarint(uint64(len(rep.ConfigChanges)))
+	for _, c := range rep.ConfigChanges {
+		e.varint(c.Time.UnixNano() - rep.Timestamp.UnixNano())
+		e.string(c.Source)
+		e.string(c.Setting)
+		e.string(c.Value)
+	}
+}
+
+// decodeRecord decodes a record body written in version, given the timestamp
+// and column names of the previous record in the file.
+func decodeRecord(body []byte, version uint64, prev analysis.Report) (analysis.Report, error) {
+	d := &decoder{buf: body}
+	rep, err := decodeHeader(d, prev)
+	if err != nil {
+		return rep, err
+	}
+
+	rep.TotalRows = int(d.varint())
+	rep.DropRate = d.float()
+	rep.KeysSingleGet = d.varint()
+	rep.KeysMultiGet = d.varint()
+	rep.UnattributedResponses = d.varint()
+	rep.UnattributedBytes = d.varint()
+	rep.KeysSplit = int(d.varint())
+	rep.Decay = time.Duration(d.varint())
+	rep.Skew.Keys = int(d.varint())
+	rep.Skew.Requests = d.varint()
+	rep.Skew.Gini = d.float()
+	rep.Skew.Top1Share = d.float()
+
+	if n := d.count(); n > 0 {
+		rep.Connections = make([]analysis.ConnTraffic, n)
+		for i := range rep.Connections {
+			c := &rep.Connections[i]
+			c.Conn = d.string()
+			c.RequestBytes = d.varint()
+			c.ResponseBytes = d.varint()
+		}
+	}
+
+	rep.Rows = make([]analysis.ReportRow, d.count())
+	numKeys, numVals := len(rep.KeyColNames), len(rep.ValColNames)
+	for i := range rep.Rows {
+		row := analysis.ReportRow{
+			Key:    make([]string, numKeys),
+			Values: make([]int64, numVals),
+		}
+		for j := range row.Key {
+			prefix, suffix := d.uvarint(), d.uvarint()
+			middle := d.bytes()
+			var prevKey string
+			if i > 0 {
+				prevKey = rep.Rows[i-1].Key[j]
+			}
+			if prefix+suffix > uint64(len(prevKey)) {
+				d.fail()
+				continue
+			}
+			row.Key[j] = prevKey[:prefix] + string(middle) + prevKey[uint64(len(prevKey))-suffix:]
+		}
+		for j := range row.Values {
+			row.Values[j] = d.varint()
+		}
+		rep.Rows[i] = row
+	}
+	if version < 2 {
+		return rep, d.err
+	}
+
+	if d.uvarint() != 0 {
+		rep.Warmup = &analysis.WarmupProgress{
+			Reference: d.varint(),
+			Observed:  d.varint(),
+			Unlisted:  d.varint(),
+			ETA:       time.Duration(d.varint()),
+		}
+	}
+	if version < 3 {
+		return rep, d.err
+	}
+
+	if n := d.count(); n > 0 {
+		rep.Restarts = make([]analysis.ServerRestart, n)
+		for i := range rep.Restarts {
+			r := &rep.Restarts[i]
+			r.Server = d.string()
+			r.Time = time.Unix(0, rep.Timestamp.UnixNano()+d.varint())
+			r.Closed = d.varint()
+			r.Reconnected = d.varint()
+		}
+	}
+	if version < 4 {
+		return rep, d.err
+	}
+
+	if n := d.count(); n > 0 {
+		rep.ConfigChanges = make([]analysis.ConfigChange, n)
+		for i := range rep.ConfigChanges {
+			c := &rep.ConfigChanges[i]
+			c.Time = time.Unix(0, rep.Timestamp.UnixNano()+d.varint())
+			c.Source = d.string()
+			c.Setting = d.string()
+			c.Value = d.string()
+		}
+	}
+	return rep, d.err
+}
+
+// decodeHeader decodes the timestamp, flags and column names that start a
+// record body, given the previous record in the file as for decodeRecord.
+func decodeHeader(d *decoder, prev analysis.Report) (analysis.Report, error) {
+	var rep analysis.Report
+	var base int64
+	if !prev.Timestamp.IsZero() {
+		base = prev.Timestamp.UnixNano()
+	}
+	rep.Timestamp = time.Unix(0, base+d.varint())
+	flags := d.uvarint()
+	rep.Discontinuous = flags&flagDiscontinuous != 0
+	if flags&flagColumns != 0 {
+		rep.KeyColNames = d.strings()
+		rep.ValColNames = d.strings()
+	} else if prev.KeyColNames == nil {
+		return rep, errCorrupt
+	} else {
+		rep.KeyColNames, rep.ValColNames = prev.KeyColNames, prev.ValColNames
+	}
+	return rep, d.err
+}
+
+// sharedSuffix returns the length of the longest common suffix of a and b.
+func sharedSuffix(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 1; i <= n; i++ {
+		if a[len(a)-i] != b[len(b)-i] {
+			return i - 1
+		}
+	}
+	return n
+}
+
+// sharedPrefix returns the length of the longest common prefix of a and b.
+func sharedPrefix(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
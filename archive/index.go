@@ -0,0 +1,263 @@
+package archive
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/log"
+)
+
+// headerPeek is the number of bytes read at each record while indexing, enough
+// for the length of the record and the start of its body in all but records
+// that change the column names.
+const headerPeek = 256
+
+// Index finds the archived reports covering given times among the archives a
+// Sink writes to a directory, so that live reports can be compared with the
+// past.  Archives are located by the time in their names, and indexed by the
+// timestamp of each record only when first needed, reading just the start of
+// each record.  The archive being written is indexed further as it grows.
+// Index is threadsafe.
+type Index struct {
+	logger log.Logger
+	dir    string
+	mu     sync.Mutex
+	files  map[string]*fileIndex
+}
+
+// NewIndex returns an Index of the archives in dir.  Archives that cannot be
+// read are logged to logger once, and then ignored.
+func NewIndex(logger log.Logger, dir string) *Index {
+	return &Index{logger: logger, dir: dir, files: make(map[string]*fileIndex)}
+}
+
+// record locates a record within an archive.
+type record struct {
+	// offset is the position of the length preceding the record body.
+	offset        int64
+	timestamp     time.Time
+	discontinuous bool
+	// keyCols and valCols are the column names of the record, shared with
+	// the records around it.
+	keyCols, valCols []string
+}
+
+// prev returns the header of r as the previous record given to decodeRecord.
+func (r record) prev() analysis.Report {
+	return analysis.Report{Timestamp: r.timestamp, KeyColNames: r.keyCols, ValColNames: r.valCols}
+}
+
+// fileIndex is the records of one archive, indexed as far as next.
+type fileIndex struct {
+	path    string
+	start   time.Time
+	version uint64
+	records []record
+	next    int64
+	// failed is set once the archive could not be read, and it is skipped
+	// from then on.
+	failed bool
+}
+
+// At returns the archived report covering t, and the length of the period it
+// covers.  That is the first report not before t, if the report preceding it
+// in the same archive is before t.  It returns false if no report covers t,
+// such as when memsniff was not running then, or if the report covering it
+// was interrupted, so that its period is not known.
+func (x *Index) At(t time.Time) (analysis.Report, time.Duration, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	files := x.list()
+	// the archive covering t is the last readable one to start no later
+	// than t, unless t falls after its last report and before the first of
+	// the next
+	i := sort.Search(len(files), func(i int) bool { return files[i].start.After(t) }) - 1
+	for i >= 0 && !x.extend(files[i]) {
+		i--
+	}
+	if i < 0 {
+		i = 0
+	}
+	for ; i < len(files); i++ {
+		fi := files[i]
+		if !x.extend(fi) {
+			continue
+		}
+		j := sort.Search(len(fi.records), func(j int) bool { return !fi.records[j].timestamp.Before(t) })
+		if j == len(fi.records) {
+			continue
+		}
+		if j == 0 || fi.records[j].discontinuous {
+			return analysis.Report{}, 0, false
+		}
+		rep, err := fi.read(j)
+		if err != nil {
+			x.fail(fi, err)
+			return analysis.Report{}, 0, false
+		}
+		return rep, rep.Timestamp.Sub(fi.records[j-1].timestamp), true
+	}
+	return analysis.Report{}, 0, false
+}
+
+// list returns the archives in the directory, in order of the time they
+// start, forgetting those that have been removed.
+func (x *Index) list() []*fileIndex {
+	paths, err := filepath.Glob(filepath.Join(x.dir, "memsniff-*"+Extension))
+	if err != nil {
+		return nil
+	}
+	present := make(map[string]bool, len(paths))
+	var files []*fileIndex
+	for _, path := range paths {
+		fi, ok := x.files[path]
+		if !ok {
+			name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "memsniff-"), Extension)
+			start, err := time.Parse("20060102-150405", name)
+			if err != nil {
+				continue
+			}
+			fi = &fileIndex{path: path, start: start}
+			x.files[path] = fi
+		}
+		present[path] = true
+		files = append(files, fi)
+	}
+	for path := range x.files {
+		if !present[path] {
+			delete(x.files, path)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].start.Before(files[j].start) })
+	return files
+}
+
+// extend indexes the records written to fi since it was last indexed,
+// returning false if it cannot be read.
+func (x *Index) extend(fi *fileIndex) bool {
+	if fi.failed {
+		return false
+	}
+	if err := fi.extend(); err != nil {
+		x.fail(fi, err)
+		return false
+	}
+	return true
+}
+
+func (x *Index) fail(fi *fileIndex, err error) {
+	fi.failed = true
+	x.logger.Log(fi.path+":", err)
+}
+
+func (fi *fileIndex) extend() error {
+	f, err := os.Open(fi.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := st.Size()
+	buf := make([]byte, headerPeek)
+	if fi.version == 0 {
+		n, _ := f.ReadAt(buf[:len(magic)+binary.MaxVarintLen64], 0)
+		if n < len(magic) {
+			// nothing written yet
+			return nil
+		}
+		if string(buf[:len(magic)]) != magic {
+			return ErrNotArchive
+		}
+		version, m := binary.Uvarint(buf[len(magic):n])
+		if m <= 0 || version == 0 {
+			return ErrNotArchive
+		}
+		if version > Version {
+			return VersionError{version}
+		}
+		fi.version, fi.next = version, int64(len(magic)+m)
+	}
+
+	var prev analysis.Report
+	if len(fi.records) > 0 {
+		prev = fi.records[len(fi.records)-1].prev()
+	}
+	for fi.next < size {
+		n, err := f.ReadAt(buf, fi.next)
+		if n == 0 {
+			return err
+		}
+		length, m := binary.Uvarint(buf[:n])
+		if m <= 0 || length > maxRecordSize {
+			if m == 0 {
+				// the length is still being written
+				return nil
+			}
+			return errCorrupt
+		}
+		end := fi.next + int64(m) + int64(length)
+		if end > size {
+			// the record is still being written
+			return nil
+		}
+		body := buf[m:n]
+		if uint64(len(body)) > length {
+			body = body[:length]
+		}
+		header, err := decodeHeader(&decoder{buf: body}, prev)
+		if err != nil && uint64(len(body)) < length {
+			// the column names run past the bytes peeked
+			body = make([]byte, length)
+			if _, err := f.ReadAt(body, fi.next+int64(m)); err != nil {
+				return err
+			}
+			header, err = decodeHeader(&decoder{buf: body}, prev)
+		}
+		if err != nil {
+			return err
+		}
+		fi.records = append(fi.records, record{fi.next, header.Timestamp, header.Discontinuous, header.KeyColNames, header.ValColNames})
+		fi.next, prev = end, header
+	}
+	return nil
+}
+
+// read decodes record j of fi.
+func (fi *fileIndex) read(j int) (analysis.Report, error) {
+	f, err := os.Open(fi.path)
+	if err != nil {
+		return analysis.Report{}, err
+	}
+	defer f.Close()
+	var prefix [binary.MaxVarintLen64]byte
+	n, err := f.ReadAt(prefix[:], fi.records[j].offset)
+	if n == 0 {
+		return analysis.Report{}, err
+	}
+	length, m := binary.Uvarint(prefix[:n])
+	if m <= 0 {
+		return analysis.Report{}, errCorrupt
+	}
+	body := make([]byte, length)
+	if _, err := f.ReadAt(body, fi.records[j].offset+int64(m)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return analysis.Report{}, err
+	}
+	var prev analysis.Report
+	if j > 0 {
+		prev = fi.records[j-1].prev()
+	}
+	return decodeRecord(body, fi.version, prev)
+}
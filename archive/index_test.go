@@ -0,0 +1,109 @@
+package archive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+)
+
+// indexReport returns a report at ts with a single key counting n.
+func indexReport(ts time.Time, n int64) analysis.Report {
+	return analysis.Report{
+		Timestamp:   ts,
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"count(size)"},
+		Rows:        []analysis.ReportRow{{Key: []string{"k"}, Values: []int64{n}}},
+	}
+}
+
+// TestIndex checks that an Index finds the report covering a time across
+// archives, including one still being written, and declines times no report
+// covers.
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsniff-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reports every 10 seconds from 23:59:30 to 00:00:20, with the one at
+	// 23:59:50 interrupted, and the columns renamed at midnight
+	start := time.Date(2017, 6, 1, 23, 59, 30, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		rep := indexReport(start.Add(time.Duration(i)*10*time.Second), int64(i))
+		rep.Discontinuous = i == 2
+		if i >= 3 {
+			rep.ValColNames = []string{strings.Repeat("long column name ", 20)}
+		}
+		if err := s.Write(rep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var logged []string
+	x := NewIndex(logFunc(func(items ...interface{}) {
+		logged = append(logged, fmt.Sprint(items...))
+	}), dir)
+
+	cases := []struct {
+		t    time.Time
+		want int64
+		ok   bool
+	}{
+		// before the first report, whose period is not known
+		{start.Add(-5 * time.Second), 0, false},
+		{start.Add(5 * time.Second), 1, true},
+		{start.Add(10 * time.Second), 1, true},
+		// the interrupted report
+		{start.Add(15 * time.Second), 0, false},
+		// the first report of the second archive
+		{start.Add(25 * time.Second), 0, false},
+		{start.Add(35 * time.Second), 4, true},
+		{start.Add(40 * time.Second), 4, true},
+		// after the last report
+		{start.Add(55 * time.Second), 0, false},
+	}
+	for _, c := range cases {
+		rep, span, ok := x.At(c.t)
+		if ok != c.ok {
+			t.Errorf("%v: found %v", c.t, ok)
+			continue
+		}
+		if ok && (rep.Rows[0].Values[0] != c.want || span != 10*time.Second) {
+			t.Errorf("%v: %v over %v, want %d", c.t, rep.Rows, span, c.want)
+		}
+	}
+
+	// the archive being written is indexed further as it grows
+	if err := s.Write(indexReport(start.Add(time.Minute), 6)); err != nil {
+		t.Fatal(err)
+	}
+	if rep, _, ok := x.At(start.Add(55 * time.Second)); !ok || rep.Rows[0].Values[0] != 6 {
+		t.Error(rep, ok)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an unreadable archive is logged once and skipped
+	bad := filepath.Join(dir, "memsniff-20170602-000005"+Extension)
+	if err := ioutil.WriteFile(bad, []byte("not an archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if rep, _, ok := x.At(start.Add(45 * time.Second)); !ok || rep.Rows[0].Values[0] != 5 {
+			t.Error(rep, ok)
+		}
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], ErrNotArchive.Error()) {
+		t.Error(logged)
+	}
+}
@@ -0,0 +1,212 @@
+package archive
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/log"
+)
+
+// errNoValues is returned when asked to sample a value from an archive.
+var errNoValues = errors.New("values are not archived")
+
+// Player replays archived reports in place of an analysis.Pool, returning the
+// next report from each call to ReportTop, so that archives can be browsed in
+// the interactive interface.  After the last report it is returned again.
+//
+// Details that are not archived, such as the value sizes of watched keys and
+// the routing of requests against a ring, are never available, and changing
+// the bandwidth basis has no effect.
+type Player struct {
+	logger  log.Logger
+	files   []string
+	f       *os.File
+	r       *Reader
+	current analysis.Report
+	ended   bool
+}
+
+// NewPlayer returns a Player for the archives in files, which are read in
+// order.  Problems with an archive, other than the first report not being
+// readable, are logged to logger and the archive skipped.
+func NewPlayer(logger log.Logger, files []string) (*Player, error) {
+	p := &Player{logger: logger, files: files}
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+	rep, err := p.r.Next()
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	p.current = rep
+	return p, nil
+}
+
+// open starts reading the first archive remaining in files.
+func (p *Player) open() error {
+	if len(p.files) == 0 {
+		return io.EOF
+	}
+	f, err := os.Open(p.files[0])
+	if err != nil {
+		return err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	p.f, p.r = f, r
+	return nil
+}
+
+// advance moves to the next report, if there is one.
+func (p *Player) advance() {
+	for !p.ended {
+		if p.r != nil {
+			rep, err := p.r.Next()
+			if err == nil {
+				p.current = rep
+				return
+			}
+			if err != io.EOF {
+				p.logger.Log(p.files[0]+":", err)
+			}
+			p.f.Close()
+			p.f, p.r = nil, nil
+			p.files = p.files[1:]
+		}
+		if err := p.open(); err == io.EOF {
+			p.ended = true
+			p.logger.Log("End of archive")
+		} else if err != nil {
+			p.logger.Log(p.files[0]+":", err)
+			p.files = p.files[1:]
+		}
+	}
+}
+
+// ReportTop returns the next archived report, keeping only the first n rows
+// when ranked by columns, as Report.Limit does.  The first call returns the
+// first report.  shouldReset is ignored.
+func (p *Player) ReportTop(shouldReset bool, n int, columns ...int) analysis.Report {
+	rep := p.current
+	rep.Rows = append([]analysis.ReportRow(nil), rep.Rows...)
+	if dups := rep.MergeDuplicates(); dups > 0 {
+		p.logger.Log("Warning: archived report at", rep.Timestamp.Format("15:04:05"), "listed", dups, "duplicate keys, which were merged")
+	}
+	rep.Limit(n, columns...)
+	p.advance()
+	return rep
+}
+
+// MarkDiscontinuous does nothing, as archived reports record whether they
+// were Discontinuous.
+func (p *Player) MarkDiscontinuous() {}
+
+// ColumnNames returns the key and value column names of the report that the
+// next call to ReportTop returns.
+func (p *Player) ColumnNames() (keyCols, valCols []string) {
+	return p.current.KeyColNames, p.current.ValColNames
+}
+
+// BandwidthBasis returns analysis.ResponseBytes, since the basis of archived
+// reports is not recorded.
+func (p *Player) BandwidthBasis() analysis.BandwidthBasis {
+	return analysis.ResponseBytes
+}
+
+// SetBandwidthBasis does nothing, since archived reports cannot be
+// recomputed.
+func (p *Player) SetBandwidthBasis(analysis.BandwidthBasis) {}
+
+// RankBasis returns analysis.RankAll, since archived reports are ranked only
+// by their columns.
+func (p *Player) RankBasis() analysis.RankBasis {
+	return analysis.RankAll
+}
+
+// SetRankBasis does nothing, since archived reports cannot be recomputed.
+func (p *Player) SetRankBasis(analysis.RankBasis) {}
+
+// SetAcknowledgedKeys does nothing, since no alerts are raised on archived
+// reports.
+func (p *Player) SetAcknowledgedKeys([]string) {}
+
+// GroupKeys returns false, since the keys in groups are not archived.
+func (p *Player) GroupKeys(string) ([]string, bool) {
+	return nil, false
+}
+
+// Chunks returns false, since the chunks of values are not archived.
+func (p *Player) Chunks(string) (analysis.ChunkFanout, bool) {
+	return analysis.ChunkFanout{}, false
+}
+
+// Expiry returns false, since expiry of values is not archived.
+func (p *Player) Expiry(string) (analysis.KeyExpiry, bool) {
+	return analysis.KeyExpiry{}, false
+}
+
+// Servers returns false, since the servers handling each key are not
+// archived.
+func (p *Player) Servers(string) ([]analysis.ServerCount, bool) {
+	return nil, false
+}
+
+// WatchedSizes returns false, since value sizes are not archived.
+func (p *Player) WatchedSizes(string) ([]analysis.SizeSample, bool) {
+	return nil, false
+}
+
+// ValueSampling returns 0, since values are not archived.
+func (p *Player) ValueSampling() int {
+	return 0
+}
+
+// ArmValueSample returns an error, since values are not archived.
+func (p *Player) ArmValueSample(string) error {
+	return errNoValues
+}
+
+// ValueSample returns false, since values are not archived.
+func (p *Player) ValueSample(string) (analysis.ValueSample, bool) {
+	return analysis.ValueSample{}, false
+}
+
+// Routing returns false, since the routing of each key is not archived.
+func (p *Player) Routing(string) (analysis.KeyRouting, bool) {
+	return analysis.KeyRouting{}, false
+}
+
+// LastRestart returns false, since restarts are archived only in the reports
+// in which they were detected.
+func (p *Player) LastRestart(string) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// SetMaintenance does nothing, since no alerts are raised on archived
+// reports.
+func (p *Player) SetMaintenance(time.Time) {}
+
+// Maintenance returns false, since maintenance windows are not archived.
+func (p *Player) Maintenance() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// RecordConfigChange does nothing, since the settings of archived reports
+// cannot be changed.  Changes made while they were archived are in their
+// ConfigChanges.
+func (p *Player) RecordConfigChange(source, setting, value string) {}
+
+// Close releases the archive being read.
+func (p *Player) Close() {
+	if p.f != nil {
+		p.f.Close()
+		p.f, p.r = nil, nil
+	}
+}
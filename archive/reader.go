@@ -0,0 +1,138 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/box/memsniff/analysis"
+)
+
+// Reader reads reports from a single archive.
+type Reader struct {
+	r       *bufio.Reader
+	version uint64
+	prev    analysis.Report
+	body    []byte
+}
+
+// NewReader returns a Reader for the archive in r, after checking its header.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, header); err != nil || string(header) != magic {
+		return nil, ErrNotArchive
+	}
+	version, err := binary.ReadUvarint(br)
+	if err != nil || version == 0 {
+		return nil, ErrNotArchive
+	}
+	if version > Version {
+		return nil, VersionError{version}
+	}
+	return &Reader{r: br, version: version}, nil
+}
+
+// Version returns the format version in which the archive was written.
+func (r *Reader) Version() uint64 {
+	return r.version
+}
+
+// Next returns the next report in the archive, with rows sorted by key.  It
+// returns io.EOF at the end of the archive, and io.ErrUnexpectedEOF if the
+// archive ends part way through a record, as when memsniff was killed while
+// writing it.
+func (r *Reader) Next() (analysis.Report, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		return analysis.Report{}, io.EOF
+	}
+	if err != nil {
+		return analysis.Report{}, io.ErrUnexpectedEOF
+	}
+	if n > maxRecordSize {
+		return analysis.Report{}, errCorrupt
+	}
+	if uint64(cap(r.body)) < n {
+		r.body = make([]byte, n)
+	}
+	r.body = r.body[:n]
+	if _, err := io.ReadFull(r.r, r.body); err != nil {
+		return analysis.Report{}, io.ErrUnexpectedEOF
+	}
+	rep, err := decodeRecord(r.body, r.version, r.prev)
+	if err != nil {
+		return analysis.Report{}, err
+	}
+	r.prev = rep
+	return rep, nil
+}
+
+// Files returns the archives named by paths, replacing each directory with
+// the archives it contains.  The archives of all the directories given are
+// in order of name, which is the order in which Sinks wrote them, so that
+// those a Failover wrote to two directories are merged.
+func Files(paths []string) ([]string, error) {
+	var files []string
+	// found holds the positions in files of archives found in directories
+	var found []int
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*"+Extension))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			found = append(found, len(files))
+			files = append(files, m)
+		}
+	}
+	sorted := make([]string, len(found))
+	for i, j := range found {
+		sorted[i] = files[j]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return filepath.Base(sorted[i]) < filepath.Base(sorted[j])
+	})
+	for i, j := range found {
+		files[j] = sorted[i]
+	}
+	return files, nil
+}
+
+// ReadFile calls fn with each report in the archive at path, in order, until
+// fn returns false.  If the archive ends part way through a record, ReadFile
+// returns io.ErrUnexpectedEOF after calling fn with every complete report.
+func ReadFile(path string, fn func(analysis.Report) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return err
+	}
+	for {
+		rep, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(rep) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/diskbudget"
+)
+
+// Extension is the file name extension of archives written by a Sink.
+const Extension = ".msar"
+
+// Writer writes reports to a single archive.
+type Writer struct {
+	w       io.Writer
+	enc     encoder
+	started bool
+	// prev is the timestamp and columns of the previous record written.
+	prev analysis.Report
+}
+
+// NewWriter returns a Writer that writes an archive to w.  Nothing is written
+// until the first report.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write appends a record holding rep to the archive.  The rows of rep are not
+// modified.
+func (w *Writer) Write(rep analysis.Report) error {
+	if !w.started {
+		header := make([]byte, len(magic)+binary.MaxVarintLen64)
+		copy(header, magic)
+		n := binary.PutUvarint(header[len(magic):], Version)
+		if _, err := w.w.Write(header[:len(magic)+n]); err != nil {
+			return err
+		}
+		w.started = true
+	}
+
+	sorted := rep
+	sorted.Rows = append([]analysis.ReportRow(nil), rep.Rows...)
+	sort.Slice(sorted.Rows, func(i, j int) bool {
+		return keyLess(sorted.Rows[i].Key, sorted.Rows[j].Key)
+	})
+	columns := w.prev.KeyColNames == nil ||
+		!reflect.DeepEqual(rep.KeyColNames, w.prev.KeyColNames) ||
+		!reflect.DeepEqual(rep.ValColNames, w.prev.ValColNames)
+
+	w.enc.buf = w.enc.buf[:0]
+	encodeRecord(&w.enc, sorted, w.prev.Timestamp, columns)
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(w.enc.buf)))
+	if _, err := w.w.Write(prefix[:n]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(w.enc.buf); err != nil {
+		return err
+	}
+	w.prev = analysis.Report{
+		Timestamp:   rep.Timestamp,
+		KeyColNames: rep.KeyColNames,
+		ValColNames: rep.ValColNames,
+	}
+	return nil
+}
+
+// keyLess orders keys by each column in turn.
+func keyLess(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// Sink writes reports to archives in a directory, starting a new file each
+// day, so that old archives can be removed or compressed individually.  Files
+// are named for the time of their first report, in UTC, such as
+// memsniff-20170601-090000.msar.
+type Sink struct {
+	dir string
+	// path is the archive being written, if w is not nil, which is
+	// created by the first record written to it.
+	path string
+	f    *os.File
+	w    *Writer
+	day  string
+	// pending holds the record being written, so that it reaches the file
+	// in a single write once the budget allows it.
+	pending bytes.Buffer
+	budget  *diskbudget.Sink
+}
+
+// NewSink returns a Sink writing to archives in dir, which is created if
+// necessary.
+func NewSink(dir string) (*Sink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Sink{dir: dir}, nil
+}
+
+// SetBudget holds the archives in the directory of s, including those left by
+// earlier runs, to budget.  Reports that do not fit are dropped, ending the
+// current archive so that the next report starts a new one.  SetBudget must
+// be called before the first Write.
+func (s *Sink) SetBudget(budget *diskbudget.Sink) error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+Extension))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			budget.Existing(path, fi.Size(), fi.ModTime())
+		}
+	}
+	s.budget = budget
+	return nil
+}
+
+// Write appends rep to the current archive, first starting a new one if the
+// day has changed.  Each report is written to the file before Write returns,
+// so that at most the last record is lost if memsniff is killed.
+func (s *Sink) Write(rep analysis.Report) error {
+	ts := rep.Timestamp.UTC()
+	if day := ts.Format("20060102"); s.w == nil || day != s.day {
+		if err := s.start(ts); err != nil {
+			return err
+		}
+	}
+	if err := s.encode(rep); err != nil {
+		return err
+	}
+	if s.budget != nil {
+		action := s.budget.Reserve(int64(s.pending.Len()))
+		if action == diskbudget.Rotate {
+			if err := s.start(ts); err != nil {
+				return err
+			}
+			if err := s.encode(rep); err != nil {
+				return err
+			}
+			action = s.budget.Reserve(int64(s.pending.Len()))
+		}
+		if action != diskbudget.Write {
+			return s.Close()
+		}
+	}
+	if s.f == nil {
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		s.f = f
+	}
+	_, err := s.f.Write(s.pending.Bytes())
+	return err
+}
+
+// start closes the current archive, if any, and starts a new one named for
+// ts.
+func (s *Sink) start(ts time.Time) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	s.path = filepath.Join(s.dir, "memsniff-"+ts.Format("20060102-150405")+Extension)
+	s.w, s.day = NewWriter(&s.pending), ts.Format("20060102")
+	if s.budget != nil {
+		s.budget.Create(s.path)
+	}
+	return nil
+}
+
+// encode replaces the pending record with rep.
+func (s *Sink) encode(rep analysis.Report) error {
+	s.pending.Reset()
+	return s.w.Write(rep)
+}
+
+// Close closes the current archive, if any.  A later Write starts a new one.
+func (s *Sink) Close() error {
+	if s.w == nil {
+		return nil
+	}
+	var err error
+	if s.f != nil {
+		err = s.f.Close()
+	}
+	if s.budget != nil {
+		s.budget.Close()
+	}
+	s.f, s.w = nil, nil
+	return err
+}
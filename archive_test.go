@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/archive"
+)
+
+func exportReports() []analysis.Report {
+	start := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	return []analysis.Report{
+		{
+			Timestamp:   start,
+			KeyColNames: []string{"key"},
+			ValColNames: []string{"sum(size)"},
+			Rows: []analysis.ReportRow{
+				{Key: []string{"a"}, Values: []int64{10}},
+				{Key: []string{"b"}, Values: []int64{20}},
+			},
+			TotalRows: 2,
+		},
+		{
+			Timestamp:   start.Add(time.Second),
+			KeyColNames: []string{"key", "client"},
+			ValColNames: []string{"sum(size)"},
+			Rows: []analysis.ReportRow{
+				{Key: []string{"a", "10.0.0.1"}, Values: []int64{5}},
+			},
+			TotalRows: 1,
+			Warmup:    &analysis.WarmupProgress{Reference: 100, Observed: 40, Unlisted: 2, ETA: time.Minute},
+			Restarts:  []analysis.ServerRestart{{Server: "10.0.0.9:11211", Time: start, Closed: 40, Reconnected: 22}},
+			ConfigChanges: []analysis.ConfigChange{
+				{Time: start.Add(500 * time.Millisecond), Source: "keyboard", Setting: "bw", Value: "req"},
+			},
+		},
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	e := &csvExporter{w: csv.NewWriter(&buf)}
+	for _, rep := range exportReports() {
+		if err := e.write(rep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := `timestamp,key,sum(size)
+2017-06-01T09:00:00Z,a,10
+2017-06-01T09:00:00Z,b,20
+timestamp,key,client,sum(size)
+2017-06-01T09:00:01Z,a,10.0.0.1,5
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestExportCSVFields(t *testing.T) {
+	var buf bytes.Buffer
+	e := fieldExporter{&csvExporter{w: csv.NewWriter(&buf)}, []string{"sum(size)", "key"}}
+	for _, rep := range exportReports() {
+		if err := e.write(rep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+	// the header is unchanged once client is dropped
+	want := `timestamp,key,sum(size)
+2017-06-01T09:00:00Z,a,10
+2017-06-01T09:00:00Z,b,20
+2017-06-01T09:00:01Z,a,5
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	e.fields = []string{"client"}
+	if err := e.write(exportReports()[0]); err == nil || !strings.Contains(err.Error(), "valid fields are key, sum(size)") {
+		t.Error(err)
+	}
+}
+
+// TestExportCSVNoTraffic checks that a report with no keys still produces a
+// line, so that idle intervals can be told apart from missing ones.
+func TestExportCSVNoTraffic(t *testing.T) {
+	rep := exportReports()[0]
+	rep.Rows, rep.TotalRows = nil, 0
+	var buf bytes.Buffer
+	e := &csvExporter{w: csv.NewWriter(&buf)}
+	if err := e.write(rep); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := `timestamp,key,sum(size)
+2017-06-01T09:00:00Z,,0
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memsniff-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sink, err := archive.NewSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := archiveHook(sink)
+	for _, rep := range exportReports() {
+		hook(rep)
+	}
+	sink.Close()
+
+	var buf bytes.Buffer
+	if status := runExport([]string{dir}, &buf); status != 0 {
+		t.Fatal("exit status", status)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatal(lines)
+	}
+	var er exportedReport
+	if err := json.Unmarshal([]byte(lines[1]), &er); err != nil {
+		t.Fatal(err)
+	}
+	if !er.Timestamp.Equal(exportReports()[1].Timestamp) || len(er.Rows) != 1 ||
+		er.Rows[0]["client"] != "10.0.0.1" || er.Rows[0]["sum(size)"] != 5.0 {
+		t.Errorf("%+v", er)
+	}
+	if er.Warmup == nil || *er.Warmup != (exportedWarmup{100, 40, 2, 60}) {
+		t.Errorf("warmup %+v", er.Warmup)
+	}
+	if len(er.Restarts) != 1 || er.Restarts[0] != (exportedRestart{"10.0.0.9:11211", exportReports()[0].Timestamp, 40, 22}) {
+		t.Errorf("restarts %+v", er.Restarts)
+	}
+	if len(er.ConfigChanged) != 1 || er.ConfigChanged[0] != (exportedConfigChange{exportReports()[0].Timestamp.Add(500 * time.Millisecond), "keyboard", "bw", "req"}) {
+		t.Errorf("config changes %+v", er.ConfigChanged)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "memsniff-20170601-090000"+archive.Extension)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,124 @@
+package assembly
+
+import (
+	"net"
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/protocol/model"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// fetchBytes is the data sent in both directions by fetch.
+const fetchBytes = int64(len("get spam\r\n") + len("VALUE spam 0 1\r\nx\r\nEND\r\n"))
+
+// budgetConsumer returns a Consumer of a conversation between memcached and
+// the client at 10.0.0.client, parsing within budget and reporting to p.
+func budgetConsumer(p *analysis.Pool, budget *model.WorkBudget, client byte) *model.Consumer {
+	sf := streamFactory{analysis: p, protocol: model.ProtocolMemcacheText, budget: budget}
+	return sf.createConsumer(connectionKey{
+		netFlow:       gopacket.NewFlow(layers.EndpointIPv4, net.IP{10, 0, 0, 2}.To4(), net.IP{10, 0, 0, client}.To4()),
+		transportFlow: gopacket.NewFlow(layers.EndpointTCPPort, []byte{0x2b, 0xcb}, []byte{0x9c, 0x40}),
+	})
+}
+
+// fetch retrieves key, a four-letter key with a one-byte value, n times on c.
+func fetch(c *model.Consumer, key string, n int) {
+	for i := 0; i < n; i++ {
+		c.ClientStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("get " + key + "\r\n")}})
+		c.ServerStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("VALUE " + key + " 0 1\r\nx\r\nEND\r\n")}})
+	}
+	c.FlushEvents()
+}
+
+// fetched returns the retrievals of each key reported by p, resetting it.
+func fetched(p *analysis.Pool) map[string]int64 {
+	counts := make(map[string]int64)
+	for _, row := range p.Report(true).Rows {
+		counts[row.Key[0]] = row.Values[0]
+	}
+	return counts
+}
+
+func budgetPool(t *testing.T) *analysis.Pool {
+	p, err := analysis.New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// TestWorkBudget checks that a connection flooding the parser is throttled
+// once it exceeds its budget, without affecting other connections, until the
+// next interval.
+func TestWorkBudget(t *testing.T) {
+	p := budgetPool(t)
+	defer p.Close()
+	budget := &model.WorkBudget{}
+	budget.SetLimit(3 * fetchBytes)
+	hostile, quiet := budgetConsumer(p, budget, 1), budgetConsumer(p, budget, 3)
+
+	fetch(hostile, "spam", 1000)
+	fetch(quiet, "calm", 3)
+	if got := fetched(p); got["spam"] != 3 || got["calm"] != 3 {
+		t.Error("fetches parsed:", got)
+	}
+	if conns, bytes := budget.Throttled(); conns != 1 || bytes != 997*fetchBytes {
+		t.Errorf("throttled %d conns, %d bytes", conns, bytes)
+	}
+
+	budget.EndInterval()
+	fetch(hostile, "spam", 10)
+	// the first request after the gap is lost while the parser resyncs
+	if got := fetched(p); got["spam"] < 2 || got["spam"] > 3 {
+		t.Error("budget not restored:", got)
+	}
+	if conns, _ := budget.Throttled(); conns != 2 {
+		t.Errorf("throttled %d conns, want one per interval", conns)
+	}
+
+	budget.SetLimit(0)
+	fetch(hostile, "spam", 100)
+	if got := fetched(p); got["spam"] < 99 {
+		t.Error("throttled without limit:", got)
+	}
+}
+
+// TestWorkBudgetWatched checks that a connection carrying a watched key is
+// never throttled once the key has been parsed.
+func TestWorkBudgetWatched(t *testing.T) {
+	p := budgetPool(t)
+	defer p.Close()
+	p.SetWatchedKeys([]string{"spam"})
+	budget := &model.WorkBudget{}
+	budget.SetLimit(3 * fetchBytes)
+	c := budgetConsumer(p, budget, 1)
+
+	fetch(c, "spam", 1000)
+	if got := fetched(p); got["spam"] != 1000 {
+		t.Error("fetches parsed:", got)
+	}
+	if conns, bytes := budget.Throttled(); conns != 0 || bytes != 0 {
+		t.Errorf("throttled %d conns, %d bytes", conns, bytes)
+	}
+}
+
+// TestWorkBudgetWatchedLate checks that a watched key first sent after a
+// connection has spent its budget is skipped with the rest of its data, as it
+// is never parsed to be recognized.
+func TestWorkBudgetWatchedLate(t *testing.T) {
+	p := budgetPool(t)
+	defer p.Close()
+	p.SetWatchedKeys([]string{"spam"})
+	budget := &model.WorkBudget{}
+	budget.SetLimit(3 * fetchBytes)
+	c := budgetConsumer(p, budget, 1)
+
+	fetch(c, "eggs", 10)
+	fetch(c, "spam", 10)
+	if got := fetched(p); got["eggs"] != 3 || got["spam"] != 0 {
+		t.Error("fetches parsed:", got)
+	}
+}
@@ -0,0 +1,122 @@
+package assembly
+
+import (
+	"net"
+	"time"
+
+	"github.com/box/memsniff/decode"
+	"github.com/box/memsniff/protocol/model"
+)
+
+// connState is how far the opening or closing of a connection has been seen.
+type connState int
+
+const (
+	// connSynSent is a connection whose client has sent a SYN the server
+	// has not answered.
+	connSynSent connState = iota
+	// connAccepted is a connection whose server has answered the SYN.
+	connAccepted
+	// connClosing is a connection one of whose ends has sent a FIN or
+	// RST.
+	connClosing
+)
+
+type connEntry struct {
+	state    connState
+	lastSeen time.Time
+}
+
+// closeDetector notices connections closed by their server and connections
+// accepted by it, as events from which analysis can tell that a server has
+// restarted.  A connection counts as closed by its server if the server sends
+// a FIN or RST before the client does, so clients disconnecting are not
+// counted, nor are the resets of a server refusing connections.
+type closeDetector struct {
+	ports []int
+	// conns holds the connections being opened or closed, by the flow of
+	// their server end.  Established connections are not tracked.
+	conns  map[flowKey]*connEntry
+	newest time.Time
+}
+
+func newCloseDetector(ports []int) *closeDetector {
+	return &closeDetector{ports: ports, conns: make(map[flowKey]*connEntry)}
+}
+
+// check records dp in the state of its connection, returning an event if dp
+// closes the connection from the server end or accepts it.
+func (cd *closeDetector) check(dp *decode.DecodedPacket) (model.Event, bool) {
+	t := &dp.TCP
+	if !t.SYN && !t.FIN && !t.RST {
+		return model.Event{}, false
+	}
+	ts := dp.Info.Timestamp
+	if ts.After(cd.newest) {
+		cd.newest = ts
+	}
+	tf := t.TransportFlow()
+	fromServer := isInPortlist(cd.ports, int(t.SrcPort))
+	k := flowKey{dp.NetFlow, tf}
+	if !fromServer {
+		k = flowKey{dp.NetFlow.Reverse(), tf.Reverse()}
+	}
+	ce, tracked := cd.conns[k]
+	if !tracked {
+		ce = &connEntry{state: connAccepted}
+	}
+	ce.lastSeen = ts
+
+	if !fromServer {
+		switch {
+		case t.SYN && !t.ACK:
+			ce.state = connSynSent
+			cd.conns[k] = ce
+		case t.FIN || t.RST:
+			ce.state = connClosing
+			cd.conns[k] = ce
+		}
+		return model.Event{}, false
+	}
+
+	var typ model.EventType
+	switch {
+	case t.SYN && t.ACK:
+		if tracked && ce.state == connAccepted {
+			// retransmitted
+			return model.Event{}, false
+		}
+		ce.state = connAccepted
+		cd.conns[k] = ce
+		typ = model.EventConnAccepted
+	case ce.state == connSynSent:
+		// refused
+		delete(cd.conns, k)
+		return model.Event{}, false
+	case ce.state == connClosing:
+		return model.Event{}, false
+	case t.FIN || t.RST:
+		ce.state = connClosing
+		cd.conns[k] = ce
+		typ = model.EventConnClosed
+	default:
+		return model.Event{}, false
+	}
+	return model.Event{
+		Type:      typ,
+		Server:    net.JoinHostPort(dp.NetFlow.Src().String(), tf.Src().String()),
+		Client:    net.JoinHostPort(dp.NetFlow.Dst().String(), tf.Dst().String()),
+		Timestamp: ts,
+	}, true
+}
+
+// forgetIdle stops tracking connections that have seen no SYN, FIN or RST for
+// flowIdle, measured by the newest packet seen.
+func (cd *closeDetector) forgetIdle() {
+	cutoff := cd.newest.Add(-flowIdle)
+	for k, ce := range cd.conns {
+		if ce.lastSeen.Before(cutoff) {
+			delete(cd.conns, k)
+		}
+	}
+}
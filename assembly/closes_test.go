@@ -0,0 +1,75 @@
+package assembly
+
+import (
+	"testing"
+
+	"github.com/box/memsniff/decode"
+	"github.com/box/memsniff/protocol/model"
+	"github.com/google/gopacket/layers"
+)
+
+// serverPacket returns a packet from port 11211 to a client at port 40000.
+func serverPacket(tcp layers.TCP) *decode.DecodedPacket {
+	dp := clientPacket(0, tcp, "")
+	dp.TCP.SrcPort, dp.TCP.DstPort = 11211, 40000
+	dp.TCP.SetInternalPortsForTesting()
+	dp.NetFlow = dp.NetFlow.Reverse()
+	return dp
+}
+
+func TestCloseDetector(t *testing.T) {
+	tests := []struct {
+		name    string
+		packets []*decode.DecodedPacket
+		events  []model.EventType
+	}{
+		{"server closes", []*decode.DecodedPacket{
+			serverPacket(layers.TCP{FIN: true, ACK: true}),
+			clientPacket(100, layers.TCP{FIN: true, ACK: true}, ""),
+		}, []model.EventType{model.EventConnClosed}},
+		{"server resets", []*decode.DecodedPacket{
+			serverPacket(layers.TCP{RST: true}),
+			serverPacket(layers.TCP{RST: true}),
+		}, []model.EventType{model.EventConnClosed}},
+		{"client closes", []*decode.DecodedPacket{
+			clientPacket(100, layers.TCP{FIN: true, ACK: true}, ""),
+			serverPacket(layers.TCP{FIN: true, ACK: true}),
+		}, nil},
+		{"refused", []*decode.DecodedPacket{
+			clientPacket(100, layers.TCP{SYN: true}, ""),
+			serverPacket(layers.TCP{RST: true, ACK: true}),
+		}, nil},
+		{"accepted", []*decode.DecodedPacket{
+			clientPacket(100, layers.TCP{SYN: true}, ""),
+			serverPacket(layers.TCP{SYN: true, ACK: true}),
+			serverPacket(layers.TCP{SYN: true, ACK: true}),
+		}, []model.EventType{model.EventConnAccepted}},
+		{"accepted then closed", []*decode.DecodedPacket{
+			clientPacket(100, layers.TCP{SYN: true}, ""),
+			serverPacket(layers.TCP{SYN: true, ACK: true}),
+			serverPacket(layers.TCP{FIN: true, ACK: true}),
+		}, []model.EventType{model.EventConnAccepted, model.EventConnClosed}},
+	}
+	for _, tt := range tests {
+		cd := newCloseDetector([]int{11211})
+		var events []model.EventType
+		for _, dp := range tt.packets {
+			if e, ok := cd.check(dp); ok {
+				if e.Server != "10.0.0.2:11211" || e.Client != "10.0.0.1:40000" {
+					t.Errorf("%s: event for %s from %s", tt.name, e.Server, e.Client)
+				}
+				events = append(events, e.Type)
+			}
+		}
+		if len(events) != len(tt.events) {
+			t.Errorf("%s: events %v, want %v", tt.name, events, tt.events)
+			continue
+		}
+		for i := range events {
+			if events[i] != tt.events[i] {
+				t.Errorf("%s: events %v, want %v", tt.name, events, tt.events)
+				break
+			}
+		}
+	}
+}
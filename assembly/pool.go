@@ -11,6 +11,24 @@ import (
 type Pool struct {
 	Logger  log.Logger
 	workers []worker
+	budget  *model.WorkBudget
+}
+
+// Stats contains counters for a Pool.
+type Stats struct {
+	// ConnectionsReused is the number of new connections found reusing the
+	// addresses and ports of a connection whose end was not seen.  The old
+	// connection is ended where the new one starts.
+	ConnectionsReused int64
+	// ProtocolReclassified is the number of refused attempts to change the
+	// protocol of a connection once classified, which indicates a bug in a
+	// parser.
+	ProtocolReclassified int64
+	// ConnectionsThrottled is the number of connections that exceeded the
+	// budget set by SetWorkBudget, counting each once per interval in which
+	// it did, and BytesThrottled the bytes they sent that were skipped.
+	ConnectionsThrottled int64
+	BytesThrottled       int64
 }
 
 // New creates a new pool for reassembling TCP streams.
@@ -18,9 +36,10 @@ func New(logger log.Logger, analysis *analysis.Pool, protocol model.ProtocolType
 	p := &Pool{
 		logger,
 		make([]worker, numWorkers),
+		&model.WorkBudget{},
 	}
 	for i := 0; i < numWorkers; i++ {
-		p.workers[i] = newWorker(logger, analysis, protocol, ports)
+		p.workers[i] = newWorker(logger, analysis, protocol, ports, p.budget)
 	}
 	return p
 }
@@ -45,6 +64,49 @@ func (p *Pool) HandlePackets(dps []*decode.DecodedPacket) (err error) {
 	return nil
 }
 
+// Close shuts down all workers after delivering events from connections still
+// in progress, and waits for them to exit.  HandlePackets must not be called
+// during or after Close.
+func (p *Pool) Close() {
+	for _, w := range p.workers {
+		w.close()
+	}
+}
+
+// Stats returns the counters of all workers.
+func (p *Pool) Stats() Stats {
+	var s Stats
+	for _, w := range p.workers {
+		s.ConnectionsReused += w.reuse.connectionsReused()
+	}
+	s.ProtocolReclassified = model.Reclassifications()
+	s.ConnectionsThrottled, s.BytesThrottled = p.budget.Throttled()
+	return s
+}
+
+// SetWorkBudget limits the bytes parsed on each connection per interval, or
+// removes the limit if bytes is 0.  Data beyond the budget is skipped until
+// the next call to EndInterval, except on connections on which a key watched
+// by the analysis.Pool was parsed before their budget was spent.
+// SetWorkBudget is threadsafe.
+func (p *Pool) SetWorkBudget(bytes int64) {
+	p.budget.SetLimit(bytes)
+}
+
+// EndInterval restores the budget set by SetWorkBudget of every connection.
+func (p *Pool) EndInterval() {
+	p.budget.EndInterval()
+}
+
+// QueueDepth returns the number of batches of packets waiting for workers.
+func (p *Pool) QueueDepth() int {
+	var n int
+	for _, w := range p.workers {
+		n += len(w.wiCh)
+	}
+	return n
+}
+
 func (p *Pool) partition(dps []*decode.DecodedPacket) [][]*decode.DecodedPacket {
 	perWorker := make([][]*decode.DecodedPacket, len(p.workers))
 	for _, dp := range dps {
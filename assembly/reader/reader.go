@@ -48,6 +48,12 @@ func (r *Reader) Reset() {
 	r.err = nil
 }
 
+// Len returns the number of bytes buffered, including any gaps left by lost
+// data.
+func (r *Reader) Len() int {
+	return r.buf.Len()
+}
+
 func (r *Reader) Truncate() {
 	r.buf.Truncate()
 }
@@ -0,0 +1,118 @@
+package assembly
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/box/memsniff/decode"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// flowIdle is how long a flow may go without packets before it is forgotten,
+// the same age at which idle connections are flushed from the assembler.
+const flowIdle = time.Minute
+
+type flowKey struct {
+	netFlow, transportFlow gopacket.Flow
+}
+
+// flowState is what is known of one direction of a connection being
+// reassembled.
+type flowState struct {
+	// isn is the sequence number of the SYN that opened the flow, if
+	// synSeen is true.  Otherwise the flow was first seen part way through.
+	isn     uint32
+	synSeen bool
+	// next is the sequence number following the last data seen.
+	next     uint32
+	lastSeen time.Time
+}
+
+// reuseDetector notices connections that reuse the addresses and ports of one
+// still being reassembled, as when a client recycles a port from TIME_WAIT
+// and the end of the old connection was not captured.  Left alone, the
+// assembler would treat the new connection as a continuation of the old one
+// after a gap, and parse it with the old connection's state.
+//
+// A SYN opens a new connection if the flow it belongs to has already carried
+// data or was opened by a SYN with a different sequence number.  A SYN with
+// the same sequence number is a retransmission.
+type reuseDetector struct {
+	flows  map[flowKey]*flowState
+	newest time.Time
+	// reused counts new connections from clients found reusing the
+	// addresses and ports of a connection still tracked, and is updated
+	// atomically.
+	reused int64
+}
+
+func newReuseDetector() *reuseDetector {
+	return &reuseDetector{flows: make(map[flowKey]*flowState)}
+}
+
+// check records dp in the state of its flow.  If dp opens a new connection on
+// a flow still tracked, check returns a reset with which to end the old one
+// before dp is assembled.
+func (rd *reuseDetector) check(dp *decode.DecodedPacket) (*layers.TCP, bool) {
+	t := &dp.TCP
+	if !t.SYN && !t.FIN && !t.RST && len(t.Payload) == 0 {
+		// ignored by the assembler
+		return nil, false
+	}
+	ts := dp.Info.Timestamp
+	if ts.After(rd.newest) {
+		rd.newest = ts
+	}
+	k := flowKey{dp.NetFlow, t.TransportFlow()}
+	st, tracked := rd.flows[k]
+	if t.FIN || t.RST {
+		delete(rd.flows, k)
+		return nil, false
+	}
+
+	var rst *layers.TCP
+	if t.SYN && tracked && (!st.synSeen || st.isn != t.Seq) {
+		reset := *t
+		reset.SYN, reset.ACK, reset.RST = false, false, true
+		reset.Seq = st.next
+		reset.Payload = nil
+		rst = &reset
+		if !t.ACK {
+			atomic.AddInt64(&rd.reused, 1)
+		}
+		tracked = false
+	}
+	end := t.Seq + uint32(len(t.Payload))
+	if t.SYN {
+		end++
+	}
+	if !tracked {
+		st = &flowState{next: end}
+		rd.flows[k] = st
+	}
+	if t.SYN {
+		st.isn, st.synSeen = t.Seq, true
+	}
+	if int32(end-st.next) > 0 {
+		st.next = end
+	}
+	st.lastSeen = ts
+	return rst, rst != nil
+}
+
+// forgetIdle stops tracking flows that have seen no packets for flowIdle,
+// measured by the newest packet seen.
+func (rd *reuseDetector) forgetIdle() {
+	cutoff := rd.newest.Add(-flowIdle)
+	for k, st := range rd.flows {
+		if st.lastSeen.Before(cutoff) {
+			delete(rd.flows, k)
+		}
+	}
+}
+
+// connectionsReused returns the number of reused connections found.
+func (rd *reuseDetector) connectionsReused() int64 {
+	return atomic.LoadInt64(&rd.reused)
+}
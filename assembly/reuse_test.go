@@ -0,0 +1,87 @@
+package assembly
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/decode"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// clientPacket returns a packet from a client at port 40000 to port 11211.
+func clientPacket(seq uint32, tcp layers.TCP, payload string) *decode.DecodedPacket {
+	tcp.SrcPort, tcp.DstPort, tcp.Seq = 40000, 11211, seq
+	tcp.SetInternalPortsForTesting()
+	tcp.Payload = []byte(payload)
+	return &decode.DecodedPacket{
+		Info:    gopacket.CaptureInfo{Timestamp: time.Unix(1500000000, 0)},
+		TCP:     tcp,
+		NetFlow: gopacket.NewFlow(layers.EndpointIPv4, net.IP{10, 0, 0, 1}.To4(), net.IP{10, 0, 0, 2}.To4()),
+	}
+}
+
+func TestReuseDetector(t *testing.T) {
+	tests := []struct {
+		name    string
+		packets []*decode.DecodedPacket
+		reused  bool
+		resetAt uint32
+	}{
+		{"retransmitted SYN", []*decode.DecodedPacket{
+			clientPacket(100, layers.TCP{SYN: true}, ""),
+			clientPacket(100, layers.TCP{SYN: true}, ""),
+		}, false, 0},
+		{"SYN after data", []*decode.DecodedPacket{
+			clientPacket(100, layers.TCP{SYN: true}, ""),
+			clientPacket(101, layers.TCP{ACK: true}, "get foo\r\n"),
+			clientPacket(5000, layers.TCP{SYN: true}, ""),
+		}, true, 110},
+		{"SYN after data seen part way through", []*decode.DecodedPacket{
+			clientPacket(300, layers.TCP{ACK: true}, "get foo\r\n"),
+			clientPacket(5000, layers.TCP{SYN: true}, ""),
+		}, true, 309},
+		{"SYN after FIN", []*decode.DecodedPacket{
+			clientPacket(100, layers.TCP{SYN: true}, ""),
+			clientPacket(101, layers.TCP{ACK: true, FIN: true}, "quit\r\n"),
+			clientPacket(5000, layers.TCP{SYN: true}, ""),
+		}, false, 0},
+	}
+	for _, tt := range tests {
+		rd := newReuseDetector()
+		var rst *layers.TCP
+		var reused bool
+		for _, dp := range tt.packets {
+			rst, reused = rd.check(dp)
+		}
+		if reused != tt.reused {
+			t.Errorf("%s: reused %v, want %v", tt.name, reused, tt.reused)
+			continue
+		}
+		if reused && (!rst.RST || rst.SYN || rst.Seq != tt.resetAt || len(rst.Payload) != 0) {
+			t.Errorf("%s: reset %+v, want RST at %d", tt.name, rst, tt.resetAt)
+		}
+		var want int64
+		if tt.reused {
+			want = 1
+		}
+		if n := rd.connectionsReused(); n != want {
+			t.Errorf("%s: counted %d reused, want %d", tt.name, n, want)
+		}
+	}
+}
+
+func TestReuseDetectorForgetsIdle(t *testing.T) {
+	rd := newReuseDetector()
+	old := clientPacket(101, layers.TCP{ACK: true}, "get foo\r\n")
+	rd.check(old)
+	later := clientPacket(100, layers.TCP{ACK: true}, "x")
+	later.NetFlow = old.NetFlow.Reverse()
+	later.Info.Timestamp = old.Info.Timestamp.Add(2 * flowIdle)
+	rd.check(later)
+	rd.forgetIdle()
+	if len(rd.flows) != 1 {
+		t.Error("flows tracked:", len(rd.flows))
+	}
+}
@@ -3,6 +3,7 @@ package assembly
 import (
 	"encoding/binary"
 	"fmt"
+	"net"
 
 	"github.com/box/memsniff/analysis"
 	"github.com/box/memsniff/log"
@@ -44,6 +45,7 @@ type streamFactory struct {
 	analysis *analysis.Pool
 	protocol model.ProtocolType
 	ports    []int
+	budget   *model.WorkBudget
 
 	halfOpen map[connectionKey]*model.Consumer
 }
@@ -112,7 +114,13 @@ func (sf *streamFactory) createConsumer(ck connectionKey) *model.Consumer {
 	case model.ProtocolRedis:
 		fsm = redis.NewFsm(logger)
 	}
-	return model.New(sf.analysis.HandleEvents, fsm)
+	c := model.New(sf.analysis.HandleEvents, fsm)
+	c.Sampler = sf.analysis
+	c.Budget, c.Watcher = sf.budget, sf.analysis
+	c.Client = ck.netFlow.Dst().String()
+	c.Conn = net.JoinHostPort(c.Client, ck.transportFlow.Dst().String())
+	c.Server = net.JoinHostPort(ck.netFlow.Src().String(), ck.transportFlow.Src().String())
+	return c
 }
 
 func (sf *streamFactory) log(items ...interface{}) {
@@ -24,14 +24,22 @@ type worker struct {
 	logger    log.Logger
 	assembler *tcpassembly.Assembler
 	wiCh      chan workItem
+	reuse     *reuseDetector
+	closes    *closeDetector
+	// handler receives the events of connections closed and accepted by
+	// servers.
+	handler model.EventHandler
+	// stopped is closed when loop exits.
+	stopped chan struct{}
 }
 
-func newWorker(logger log.Logger, analysis *analysis.Pool, protocol model.ProtocolType, ports []int) worker {
+func newWorker(logger log.Logger, analysis *analysis.Pool, protocol model.ProtocolType, ports []int, budget *model.WorkBudget) worker {
 	sf := streamFactory{
 		logger:   logger,
 		analysis: analysis,
 		protocol: protocol,
 		ports:    ports,
+		budget:   budget,
 
 		halfOpen: make(map[connectionKey]*model.Consumer),
 	}
@@ -39,6 +47,10 @@ func newWorker(logger log.Logger, analysis *analysis.Pool, protocol model.Protoc
 		logger:    logger,
 		assembler: tcpassembly.NewAssembler(tcpassembly.NewStreamPool(&sf)),
 		wiCh:      make(chan workItem, 128),
+		reuse:     newReuseDetector(),
+		closes:    newCloseDetector(ports),
+		handler:   analysis.HandleEvents,
+		stopped:   make(chan struct{}),
 	}
 	// Don't let the Assembly buffer much data in an attempt to compensate for out-of-order
 	// and missing packets.  Just report the data as lost downstream and continue.
@@ -57,8 +69,18 @@ func (w worker) handlePackets(dps []*decode.DecodedPacket, doneCh chan<- struct{
 	}
 }
 
+// close flushes all connections once queued packets are processed, and waits
+// for the worker to exit.  Calls to handlePackets after calling close will
+// panic.
+func (w worker) close() {
+	close(w.wiCh)
+	<-w.stopped
+}
+
 func (w worker) loop() {
+	defer close(w.stopped)
 	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 	var mostRecent time.Time
 	for {
 		select {
@@ -67,14 +89,30 @@ func (w worker) loop() {
 			if f > 0 || c > 0 {
 				w.log("Flushed", f, "Closed", c)
 			}
+			w.reuse.forgetIdle()
+			w.closes.forgetIdle()
 
 		case wi, ok := <-w.wiCh:
 			if !ok {
+				// deliver events from connections still in progress
+				w.assembler.FlushAll()
 				return
 			}
+			var connEvents []model.Event
 			for _, dp := range wi.dps {
+				if e, ok := w.closes.check(dp); ok {
+					connEvents = append(connEvents, e)
+				}
+				if rst, ok := w.reuse.check(dp); ok {
+					// end the old connection, so that the new one
+					// starts afresh
+					w.assembler.AssembleWithTimestamp(dp.NetFlow, rst, dp.Info.Timestamp)
+				}
 				w.assembler.AssembleWithTimestamp(dp.NetFlow, &dp.TCP, dp.Info.Timestamp)
 			}
+			if len(connEvents) > 0 {
+				w.handler(connEvents)
+			}
 			wi.doneCh <- struct{}{}
 		}
 	}
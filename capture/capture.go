@@ -5,6 +5,7 @@ package capture
 import (
 	"bytes"
 	"errors"
+	"github.com/box/memsniff/log"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/pcap"
 	"io"
@@ -13,7 +14,11 @@ import (
 )
 
 const (
-	snapLen = 65535
+	// snapLen is the most captured of any packet.  With GRO or LRO, the
+	// kernel hands libpcap TCP segments coalesced into a single frame of up
+	// to 64KB of IP and more with BIG TCP, so snapLen is well above both
+	// the MTU and the largest IP packet, as with tcpdump's default.
+	snapLen = 262144
 )
 
 var (
@@ -38,6 +43,21 @@ type StatProvider interface {
 	Stats() (*pcap.Stats, error)
 }
 
+// TimestampReporter is implemented by PacketSources that know how the
+// timestamps of their packets were taken.
+type TimestampReporter interface {
+	// TimestampSource names the clock that timestamped packets: "adapter"
+	// for the network adapter, "host" for the kernel, or "file" when
+	// timestamps were recorded in a capture file.
+	TimestampSource() string
+}
+
+// hardwareTimestamps lists the pcap timestamp sources taken by the network
+// adapter on receipt, in order of preference.  These avoid the jitter of
+// kernel queueing that affects host timestamps.  Unsynchronized adapter clocks
+// are not used, since their timestamps cannot be compared with the host's.
+var hardwareTimestamps = []string{"adapter"}
+
 // PacketSource is an abstract source of network packets.
 type PacketSource interface {
 	// CollectPackets fills pb with packets.
@@ -49,6 +69,11 @@ type PacketSource interface {
 
 type source struct {
 	*pcap.Handle
+	timestamps string
+}
+
+func (s source) TimestampSource() string {
+	return s.timestamps
 }
 
 // New creates a PacketSource bound to the specified network interface or pcap
@@ -57,48 +82,70 @@ type source struct {
 // bufferSize determines the amount of kernel memory (in MiB) to allocate for
 // temporary storage. A larger bufferSize can reduce dropped packets as
 // revealed by Stats, but use caution as kernel memory is a precious resource.
-func New(netInterface string, infile string, bufferSize int, noDelay bool, ports []int) (PacketSource, error) {
-	var err error
-	handle, err := makeHandle(netInterface, infile, bufferSize)
+//
+// A network interface that fails or goes down is reopened, up to retries
+// times, and the returned PacketSource implements HealthReporter.  Changes in
+// its health are logged to logger.
+func New(logger log.Logger, netInterface string, infile string, bufferSize int, noDelay bool, ports []int, retries int) (PacketSource, error) {
+	open := func() (liveHandle, error) {
+		return openSource(netInterface, infile, bufferSize, ports)
+	}
+	src, err := open()
 	if err != nil {
 		return nil, err
 	}
-	bpf, err := portFilter(ports)
+	if netInterface != "" {
+		return newReopener(logger, netInterface, src, open, retries), nil
+	}
+	if !noDelay {
+		return newReplayer(src, 1000, 8*1024*1024), nil
+	}
+	return src, nil
+}
+
+// openSource opens a capture handle on the network interface or file, filtered
+// to traffic on ports.
+func openSource(netInterface string, infile string, bufferSize int, ports []int) (source, error) {
+	handle, timestamps, err := makeHandle(netInterface, infile, bufferSize)
 	if err != nil {
-		return nil, err
+		return source{}, err
 	}
-	if err = handle.SetBPFFilter(bpf); err != nil {
-		return nil, err
+	bpf, err := portFilter(ports)
+	if err == nil {
+		err = handle.SetBPFFilter(bpf)
 	}
-	if !noDelay && infile != "" {
-		return newReplayer(source{handle}, 1000, 8*1024*1024), nil
+	if err != nil {
+		handle.Close()
+		return source{}, err
 	}
-	return source{handle}, nil
+	return source{handle, timestamps}, nil
 }
 
-func makeHandle(netInterface string, infile string, bufferSize int) (*pcap.Handle, error) {
+func makeHandle(netInterface string, infile string, bufferSize int) (*pcap.Handle, string, error) {
 	var src *pcap.Handle
+	var timestamps string
 	var err error
 
 	if netInterface != "" && infile != "" {
-		return nil, ErrAmbiguousSource
+		return nil, "", ErrAmbiguousSource
 	}
 	if netInterface != "" {
-		src, err = newLiveCapture(netInterface, bufferSize)
+		src, timestamps, err = newLiveCapture(netInterface, bufferSize)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	} else if infile != "" {
 		// OpenOffline interprets "-" as stdin
 		src, err = pcap.OpenOffline(infile)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
+		timestamps = "file"
 	} else {
-		return nil, ErrNoSource
+		return nil, "", ErrNoSource
 	}
 
-	return src, nil
+	return src, timestamps, nil
 }
 
 func portFilter(ports []int) (string, error) {
@@ -115,30 +162,61 @@ func portFilter(ports []int) (string, error) {
 	return filterExpr.String(), nil
 }
 
-func newLiveCapture(netInterface string, bufferSize int) (*pcap.Handle, error) {
+func newLiveCapture(netInterface string, bufferSize int) (*pcap.Handle, string, error) {
 	inactive, err := pcap.NewInactiveHandle(netInterface)
 	defer inactive.CleanUp()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	err = inactive.SetSnapLen(snapLen)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	err = inactive.SetPromisc(true)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	err = inactive.SetTimeout(10 * time.Millisecond)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	err = inactive.SetBufferSize(bufferSize * 1024 * 1024)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	timestamps := setTimestampSource(inactive)
 
-	return inactive.Activate()
+	handle, err := inactive.Activate()
+	return handle, timestamps, err
+}
+
+// setTimestampSource requests hardware timestamps if the interface supports
+// them, returning the name of the timestamp source in effect.  Failures are
+// ignored, leaving the default host timestamps.
+func setTimestampSource(inactive *pcap.InactiveHandle) string {
+	supported := inactive.SupportedTimestamps()
+	names := make([]string, len(supported))
+	for i, ts := range supported {
+		names[i] = ts.String()
+	}
+	i := chooseTimestampSource(names)
+	if i < 0 || inactive.SetTimestampSource(supported[i]) != nil {
+		return "host"
+	}
+	return names[i]
+}
+
+// chooseTimestampSource returns the index of the most preferred hardware
+// timestamp source in supported, or -1 if there is none.
+func chooseTimestampSource(supported []string) int {
+	for _, want := range hardwareTimestamps {
+		for i, name := range supported {
+			if name == want {
+				return i
+			}
+		}
+	}
+	return -1
 }
 
 func (s source) CollectPackets(pb *PacketBuffer) error {
@@ -0,0 +1,29 @@
+package capture
+
+import (
+	"testing"
+)
+
+func TestChooseTimestampSource(t *testing.T) {
+	cases := []struct {
+		supported []string
+		expected  int
+	}{
+		{nil, -1},
+		{[]string{"host", "host_lowprec", "host_hiprec"}, -1},
+		{[]string{"host", "adapter_unsynced"}, -1},
+		{[]string{"host", "adapter_unsynced", "adapter"}, 2},
+	}
+	for _, c := range cases {
+		if i := chooseTimestampSource(c.supported); i != c.expected {
+			t.Errorf("chooseTimestampSource(%v) = %d", c.supported, i)
+		}
+	}
+}
+
+func TestReplayerTimestampSource(t *testing.T) {
+	r := newReplayer(source{timestamps: "file"}, 1, 1)
+	if ts := r.TimestampSource(); ts != "file" {
+		t.Error(ts)
+	}
+}
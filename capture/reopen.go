@@ -0,0 +1,307 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"github.com/box/memsniff/log"
+	"github.com/google/gopacket/pcap"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	errLinkLost = errors.New("link lost")
+	errLinkDown = errors.New("link down")
+)
+
+const (
+	// reopenMinBackoff is the delay before the first attempt to reopen a
+	// lost interface, doubling after each failed attempt up to
+	// reopenMaxBackoff.
+	reopenMinBackoff = time.Second
+	reopenMaxBackoff = 30 * time.Second
+	// stallCheckInterval is how long a live capture may go without packets
+	// before the state of its link is checked.
+	stallCheckInterval = 5 * time.Second
+)
+
+// HealthState is the condition of a live capture.
+type HealthState int
+
+const (
+	// Capturing means packets are being read from the interface.
+	Capturing HealthState = iota
+	// Retrying means the interface was lost and is being reopened.
+	Retrying
+	// Failed means the interface could not be reopened, and no more
+	// attempts will be made.
+	Failed
+)
+
+// Health describes the condition of a live capture.
+type Health struct {
+	State     HealthState
+	Interface string
+	// Err is the reason the interface was lost, when not Capturing.
+	Err error
+	// Retries is the number of failed attempts to reopen the interface.
+	Retries int
+}
+
+func (h Health) String() string {
+	switch h.State {
+	case Retrying:
+		return fmt.Sprintf("%s: %v, retrying…", h.Interface, h.Err)
+	case Failed:
+		return fmt.Sprintf("%s: %v, gave up after %d retries", h.Interface, h.Err, h.Retries)
+	default:
+		return h.Interface + ": capturing"
+	}
+}
+
+// HealthReporter is implemented by PacketSources that recover from losing
+// their network interface.
+type HealthReporter interface {
+	Health() Health
+}
+
+// liveHandle is an open capture on a network interface.
+type liveHandle interface {
+	PacketSource
+	TimestampReporter
+	Close()
+}
+
+// reopener is a PacketSource that reopens its network interface when reading
+// from it fails or its link goes away, for example when a bond flaps or a
+// container's virtual interface is removed.  While the interface is lost,
+// reads time out rather than fail, so the rest of the pipeline keeps running.
+// Capture statistics accumulate across reopened handles.
+type reopener struct {
+	// A Logger instance for reporting lost and recovered interfaces.  No
+	// logging is done if nil.
+	Logger     log.Logger
+	name       string
+	open       func() (liveHandle, error)
+	linkUp     func(name string) error
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	stallCheck time.Duration
+
+	mu sync.Mutex
+	// h is the open handle, or nil while the interface is lost.
+	h      liveHandle
+	health Health
+	// base is the total statistics of handles already closed.
+	base   pcap.Stats
+	closed bool
+
+	// The remaining fields are used only by the goroutine reading packets.
+	lastPacket time.Time
+	lastCheck  time.Time
+	backoff    time.Duration
+	nextRetry  time.Time
+}
+
+func newReopener(logger log.Logger, name string, h liveHandle, open func() (liveHandle, error), maxRetries int) *reopener {
+	now := time.Now()
+	return &reopener{
+		Logger:     logger,
+		name:       name,
+		open:       open,
+		linkUp:     checkLink,
+		maxRetries: maxRetries,
+		minBackoff: reopenMinBackoff,
+		maxBackoff: reopenMaxBackoff,
+		stallCheck: stallCheckInterval,
+		h:          h,
+		health:     Health{Interface: name},
+		lastPacket: now,
+		lastCheck:  now,
+	}
+}
+
+// checkLink returns an error if the network interface name no longer exists
+// or is administratively down.
+func checkLink(name string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return errLinkLost
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return errLinkDown
+	}
+	return nil
+}
+
+func (r *reopener) CollectPackets(pb *PacketBuffer) error {
+	h := r.handle()
+	if h == nil {
+		pb.Clear()
+		return r.idle()
+	}
+	err := h.CollectPackets(pb)
+	return r.check(h, err, pb.PacketLen() > 0)
+}
+
+func (r *reopener) DiscardPacket() error {
+	h := r.handle()
+	if h == nil {
+		return r.idle()
+	}
+	err := h.DiscardPacket()
+	return r.check(h, err, err == nil)
+}
+
+func (r *reopener) Stats() (*pcap.Stats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := r.base
+	if r.h != nil {
+		s, err := r.h.Stats()
+		if err != nil {
+			return nil, err
+		}
+		addStats(&total, s)
+	}
+	return &total, nil
+}
+
+func (r *reopener) TimestampSource() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.h == nil {
+		return "host"
+	}
+	return r.h.TimestampSource()
+}
+
+func (r *reopener) Health() Health {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.health
+}
+
+// Close releases the current handle, if any, and stops further attempts to
+// reopen the interface.
+func (r *reopener) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.h != nil {
+		r.h.Close()
+		r.h = nil
+	}
+}
+
+func (r *reopener) handle() liveHandle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.h
+}
+
+// check inspects the result of reading from h, returning the error to pass to
+// the caller.  Read errors, and stalls during which the link has gone away,
+// cause h to be closed and reopened later.
+func (r *reopener) check(h liveHandle, err error, gotPackets bool) error {
+	now := time.Now()
+	if gotPackets {
+		r.lastPacket = now
+	}
+	switch err {
+	case nil, pcap.NextErrorTimeoutExpired:
+		if now.Sub(r.lastPacket) < r.stallCheck || now.Sub(r.lastCheck) < r.stallCheck {
+			return err
+		}
+		r.lastCheck = now
+		if lerr := r.linkUp(r.name); lerr != nil {
+			r.lose(h, lerr)
+			return pcap.NextErrorTimeoutExpired
+		}
+		return err
+	case io.EOF:
+		r.lose(h, errLinkLost)
+	default:
+		r.lose(h, err)
+	}
+	return pcap.NextErrorTimeoutExpired
+}
+
+// lose closes h, saving its statistics, and schedules the first attempt to
+// reopen the interface.
+func (r *reopener) lose(h liveHandle, cause error) {
+	r.mu.Lock()
+	if r.h != h {
+		// closed by Close while reading
+		r.mu.Unlock()
+		return
+	}
+	if s, err := h.Stats(); err == nil {
+		addStats(&r.base, s)
+	}
+	h.Close()
+	r.h = nil
+	r.health = Health{State: Retrying, Interface: r.name, Err: cause}
+	r.mu.Unlock()
+
+	r.backoff = r.minBackoff
+	r.nextRetry = time.Now().Add(r.backoff)
+	r.log(r.name+":", cause, "- reopening in", r.backoff)
+}
+
+// idle waits briefly while the interface is lost, as a read would, reopening
+// it once the backoff period has passed.
+func (r *reopener) idle() error {
+	time.Sleep(10 * time.Millisecond)
+	r.mu.Lock()
+	giveUp := r.closed || r.health.State == Failed
+	r.mu.Unlock()
+	if giveUp || time.Now().Before(r.nextRetry) {
+		return pcap.NextErrorTimeoutExpired
+	}
+
+	h, err := r.open()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil && r.closed {
+		h.Close()
+		return pcap.NextErrorTimeoutExpired
+	}
+	if err == nil {
+		r.h = h
+		r.health = Health{State: Capturing, Interface: r.name}
+		r.lastPacket = time.Now()
+		r.lastCheck = r.lastPacket
+		r.log(r.name + ": capture resumed")
+		return pcap.NextErrorTimeoutExpired
+	}
+
+	r.health.Retries++
+	if r.health.Retries >= r.maxRetries {
+		r.health.State = Failed
+		r.log(r.health, "-", err)
+		return pcap.NextErrorTimeoutExpired
+	}
+	r.backoff *= 2
+	if r.backoff > r.maxBackoff {
+		r.backoff = r.maxBackoff
+	}
+	r.nextRetry = time.Now().Add(r.backoff)
+	r.log(r.name+": reopen failed:", err, "- retrying in", r.backoff)
+	return pcap.NextErrorTimeoutExpired
+}
+
+func (r *reopener) log(items ...interface{}) {
+	if r.Logger != nil {
+		r.Logger.Log(items...)
+	}
+}
+
+func addStats(total *pcap.Stats, s *pcap.Stats) {
+	total.PacketsReceived += s.PacketsReceived
+	total.PacketsDropped += s.PacketsDropped
+	total.PacketsIfDropped += s.PacketsIfDropped
+}
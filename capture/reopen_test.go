@@ -0,0 +1,137 @@
+package capture
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+)
+
+type fakeHandle struct {
+	err      error
+	received int
+	closed   bool
+}
+
+func (f *fakeHandle) CollectPackets(pb *PacketBuffer) error {
+	pb.Clear()
+	if f.err != nil {
+		return f.err
+	}
+	f.received++
+	return pb.Append(PacketData{Data: []byte{0}})
+}
+
+func (f *fakeHandle) DiscardPacket() error {
+	if f.err != nil {
+		return f.err
+	}
+	f.received++
+	return nil
+}
+
+func (f *fakeHandle) Stats() (*pcap.Stats, error) {
+	return &pcap.Stats{PacketsReceived: f.received}, nil
+}
+
+func (f *fakeHandle) TimestampSource() string { return "host" }
+
+func (f *fakeHandle) Close() { f.closed = true }
+
+// testReopener returns a reopener whose interface can be reopened once
+// openErr is cleared.
+func testReopener(h *fakeHandle, openErr *error, retries int) *reopener {
+	r := newReopener(nil, "eth2", h, func() (liveHandle, error) {
+		if *openErr != nil {
+			return nil, *openErr
+		}
+		return &fakeHandle{}, nil
+	}, retries)
+	r.minBackoff = time.Millisecond
+	r.maxBackoff = 2 * time.Millisecond
+	return r
+}
+
+// collectUntil reads from r until done returns true, failing after a second.
+func collectUntil(t *testing.T, r *reopener, done func() bool) {
+	pb := NewPacketBuffer(1, snapLen)
+	deadline := time.Now().Add(time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out in state", r.Health())
+		}
+		if err := r.CollectPackets(pb); err != nil && err != pcap.NextErrorTimeoutExpired {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReopenAfterError(t *testing.T) {
+	h := &fakeHandle{}
+	openErr := errors.New("no such device")
+	r := testReopener(h, &openErr, 100)
+
+	pb := NewPacketBuffer(1, snapLen)
+	if err := r.CollectPackets(pb); err != nil || pb.PacketLen() != 1 {
+		t.Fatal(err, pb.PacketLen())
+	}
+	h.err = errors.New("read error")
+	if err := r.CollectPackets(pb); err != pcap.NextErrorTimeoutExpired {
+		t.Error("expected timeout, got", err)
+	}
+	if health := r.Health(); health.State != Retrying || !h.closed {
+		t.Error(health, h.closed)
+	}
+
+	collectUntil(t, r, func() bool { return r.Health().Retries >= 2 })
+	openErr = nil
+	collectUntil(t, r, func() bool { return r.Health().State == Capturing })
+	if err := r.CollectPackets(pb); err != nil {
+		t.Error(err)
+	}
+	// counters resume from the lost handle's totals
+	if s, _ := r.Stats(); s.PacketsReceived != 2 {
+		t.Error("received", s.PacketsReceived)
+	}
+}
+
+func TestReopenGivesUp(t *testing.T) {
+	h := &fakeHandle{err: errors.New("read error")}
+	openErr := errors.New("no such device")
+	r := testReopener(h, &openErr, 3)
+
+	collectUntil(t, r, func() bool { return r.Health().State == Failed })
+	if health := r.Health(); health.Retries != 3 || health.String() != "eth2: read error, gave up after 3 retries" {
+		t.Error(health)
+	}
+}
+
+func TestReopenAfterStall(t *testing.T) {
+	h := &fakeHandle{err: pcap.NextErrorTimeoutExpired}
+	openErr := error(nil)
+	r := testReopener(h, &openErr, 3)
+	r.stallCheck = 0
+	r.linkUp = func(string) error { return errLinkDown }
+
+	pb := NewPacketBuffer(1, snapLen)
+	r.CollectPackets(pb)
+	if health := r.Health(); health.State != Retrying || health.String() != "eth2: link down, retrying…" {
+		t.Error(health)
+	}
+}
+
+func TestReopenClosed(t *testing.T) {
+	h := &fakeHandle{}
+	openErr := error(nil)
+	r := testReopener(h, &openErr, 3)
+	r.Close()
+	if !h.closed {
+		t.Error("handle not closed")
+	}
+	time.Sleep(r.minBackoff)
+	pb := NewPacketBuffer(1, snapLen)
+	if err := r.CollectPackets(pb); err != pcap.NextErrorTimeoutExpired || r.handle() != nil {
+		t.Error("reopened after Close:", err)
+	}
+}
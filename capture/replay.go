@@ -107,6 +107,13 @@ func (r *replayer) DiscardPacket() error {
 	return nil
 }
 
+func (r *replayer) TimestampSource() string {
+	if tr, ok := r.src.(TimestampReporter); ok {
+		return tr.TimestampSource()
+	}
+	return "file"
+}
+
 func (r *replayer) Stats() (*pcap.Stats, error) {
 	return &pcap.Stats{
 		PacketsReceived: r.received,
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/capture"
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/protocol/model"
+)
+
+// compareFormat collects the requests and bytes transferred for each key.
+const compareFormat = "key,count(size),bw"
+
+var errCompareUsage = errors.New("usage: memsniff compare [options] BEFORE.pcap AFTER.pcap")
+
+// runCompare implements "memsniff compare", reporting the change in traffic
+// per key between two capture files.  It returns the process exit status.
+func runCompare(args []string, out io.Writer) int {
+	if len(args) != 2 {
+		log.ConsoleLogger{}.Log(errCompareUsage)
+		return 1
+	}
+	if *output != "text" && *output != "json" {
+		log.ConsoleLogger{}.Log("compare output must be text or json")
+		return 1
+	}
+	logger.SetLogger(log.ConsoleLogger{})
+
+	var caps [2]captureSummary
+	for i, path := range args {
+		var err error
+		if caps[i], err = summarizeCapture(path); err != nil {
+			log.ConsoleLogger{}.Log(path+":", err)
+			return 2
+		}
+	}
+	c := compareCaptures(caps[0], caps[1])
+
+	var err error
+	if *output == "json" {
+		err = json.NewEncoder(out).Encode(c)
+	} else {
+		err = c.writeText(out)
+	}
+	if err != nil {
+		log.ConsoleLogger{}.Log(err)
+		return 1
+	}
+	return 0
+}
+
+// captureSummary is the traffic per key in a capture file.
+type captureSummary struct {
+	path   string
+	report analysis.Report
+	// span is the time between the first and last packets.
+	span time.Duration
+}
+
+// summarizeCapture runs a capture file through a pipeline as fast as possible.
+func summarizeCapture(path string) (captureSummary, error) {
+	protocolType := model.GetProtocolType(*protocol)
+	if protocolType == model.ProtocolUnknown {
+		return captureSummary{}, fmt.Errorf("unknown protocol: %s", *protocol)
+	}
+	src, err := capture.New(logger, "", path, *bufferSize, true, *ports, 0)
+	if err != nil {
+		return captureSummary{}, err
+	}
+	pool, err := newAnalysisPool(compareFormat)
+	if err != nil {
+		return captureSummary{}, err
+	}
+	pool.SetBandwidthBasis(analysis.CombinedBytes)
+	span := &spanSource{PacketSource: src}
+
+	pl := newPipeline(logger, span, pool, protocolType, *ports, *decodeWorkers, *assemblyWorkers)
+	pl.start()
+	<-pl.eof
+	if err := pl.drain(stopTimeout); err != nil {
+		return captureSummary{}, err
+	}
+	rep := pool.Report(false)
+	pool.Close()
+	return captureSummary{path, rep, span.last.Sub(span.first)}, nil
+}
+
+// spanSource records the timestamps of the first and last packets collected
+// from a PacketSource.
+type spanSource struct {
+	capture.PacketSource
+	first, last time.Time
+}
+
+func (s *spanSource) CollectPackets(pb *capture.PacketBuffer) error {
+	err := s.PacketSource.CollectPackets(pb)
+	if n := pb.PacketLen(); n > 0 {
+		if s.first.IsZero() {
+			s.first = pb.Packet(0).Info.Timestamp
+		}
+		s.last = pb.Packet(n - 1).Info.Timestamp
+	}
+	return err
+}
+
+// Close releases the underlying source, if it has a capture handle.
+func (s *spanSource) Close() {
+	if c, ok := s.PacketSource.(interface {
+		Close()
+	}); ok {
+		c.Close()
+	}
+}
+
+// comparison is the change in traffic per key from one capture to another.
+type comparison struct {
+	Before captureInfo `json:"before"`
+	After  captureInfo `json:"after"`
+	// Scale is the factor applied to counts from Before so that they cover
+	// the same length of time as After.
+	Scale float64         `json:"scale"`
+	Rows  []comparisonRow `json:"rows"`
+}
+
+type captureInfo struct {
+	Path    string  `json:"path"`
+	Seconds float64 `json:"seconds"`
+}
+
+type comparisonRow struct {
+	Key      string `json:"key"`
+	Requests change `json:"requests"`
+	Bytes    change `json:"bytes"`
+	// Only is "before" or "after" for a key seen in just one capture.
+	Only string `json:"only,omitempty"`
+}
+
+type change struct {
+	Before int64 `json:"before"`
+	After  int64 `json:"after"`
+	Change int64 `json:"change"`
+	// Percent is the change relative to Before, or nil if Before is 0.
+	Percent *float64 `json:"percent"`
+}
+
+func newChange(before, after int64) change {
+	c := change{Before: before, After: after, Change: after - before}
+	if before != 0 {
+		pct := float64(c.Change) * 100 / float64(before)
+		c.Percent = &pct
+	}
+	return c
+}
+
+// compareCaptures compares the traffic per key in two captures, ordered by
+// the largest change in requests and then in bytes.  Counts from before are
+// scaled to the span of after, so that captures of different lengths are
+// compared by rate.
+func compareCaptures(before, after captureSummary) comparison {
+	c := comparison{
+		Before: captureInfo{before.path, before.span.Seconds()},
+		After:  captureInfo{after.path, after.span.Seconds()},
+		Scale:  1,
+	}
+	if before.span > 0 && after.span > 0 {
+		c.Scale = after.span.Seconds() / before.span.Seconds()
+	}
+	scaled := before.report
+	scaled.Rows = make([]analysis.ReportRow, len(before.report.Rows))
+	for i, row := range before.report.Rows {
+		vals := make([]int64, len(row.Values))
+		for j, v := range row.Values {
+			vals[j] = int64(math.Round(float64(v) * c.Scale))
+		}
+		scaled.Rows[i] = analysis.ReportRow{Key: row.Key, Values: vals}
+	}
+
+	delta, err := analysis.DiffReports(scaled, after.report)
+	if err != nil {
+		// both reports come from compareFormat
+		panic(err)
+	}
+	for _, row := range delta.Changed {
+		c.Rows = append(c.Rows, comparisonRow{
+			Key:      row.Key[0],
+			Requests: newChange(row.Before[0], row.After[0]),
+			Bytes:    newChange(row.Before[1], row.After[1]),
+		})
+	}
+	for _, row := range delta.Added {
+		c.Rows = append(c.Rows, comparisonRow{
+			Key:      row.Key[0],
+			Requests: newChange(0, row.Values[0]),
+			Bytes:    newChange(0, row.Values[1]),
+			Only:     "after",
+		})
+	}
+	for _, row := range delta.Removed {
+		c.Rows = append(c.Rows, comparisonRow{
+			Key:      row.Key[0],
+			Requests: newChange(row.Values[0], 0),
+			Bytes:    newChange(row.Values[1], 0),
+			Only:     "before",
+		})
+	}
+	sort.Slice(c.Rows, func(i, j int) bool {
+		a, b := c.Rows[i], c.Rows[j]
+		if x, y := abs(a.Requests.Change), abs(b.Requests.Change); x != y {
+			return x > y
+		}
+		if x, y := abs(a.Bytes.Change), abs(b.Bytes.Change); x != y {
+			return x > y
+		}
+		return a.Key < b.Key
+	})
+	return c
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// writeText writes c as an aligned table.
+func (c comparison) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "before: %s (%.1fs)  after: %s (%.1fs)", c.Before.Path, c.Before.Seconds, c.After.Path, c.After.Seconds)
+	if c.Scale != 1 {
+		fmt.Fprintf(tw, "  before scaled by %.3f", c.Scale)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, strings.Join([]string{"key",
+		"req(before)", "req(after)", "req(Δ)", "req(Δ%)",
+		"bytes(before)", "bytes(after)", "bytes(Δ)", "bytes(Δ%)"}, "\t"))
+	for _, r := range c.Rows {
+		fields := []string{r.Key}
+		for _, ch := range []change{r.Requests, r.Bytes} {
+			fields = append(fields,
+				fmt.Sprint(ch.Before), fmt.Sprint(ch.After),
+				fmt.Sprintf("%+d", ch.Change), r.percent(ch))
+		}
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	return tw.Flush()
+}
+
+// percent formats the relative change ch, flagging keys seen in only one
+// capture.
+func (r comparisonRow) percent(ch change) string {
+	switch {
+	case r.Only == "after":
+		return "new"
+	case r.Only == "before":
+		return "gone"
+	case ch.Percent == nil:
+		return "-"
+	default:
+		return fmt.Sprintf("%+.1f%%", *ch.Percent)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+)
+
+func compareSummary(span time.Duration, rows ...analysis.ReportRow) captureSummary {
+	return captureSummary{
+		path: "test.pcap",
+		report: analysis.Report{
+			KeyColNames: []string{"key"},
+			ValColNames: []string{"count(size)", "bw(all)"},
+			Rows:        rows,
+		},
+		span: span,
+	}
+}
+
+func compareRow(key string, requests, bytes int64) analysis.ReportRow {
+	return analysis.ReportRow{Key: []string{key}, Values: []int64{requests, bytes}}
+}
+
+func TestCompareCaptures(t *testing.T) {
+	before := compareSummary(20*time.Second,
+		compareRow("steady", 100, 1000),
+		compareRow("busier", 20, 200),
+		compareRow("gone", 10, 100))
+	after := compareSummary(10*time.Second,
+		compareRow("steady", 50, 500),
+		compareRow("busier", 40, 400),
+		compareRow("new", 4, 40))
+
+	c := compareCaptures(before, after)
+	if c.Scale != 0.5 {
+		t.Error("scale:", c.Scale)
+	}
+	var keys []string
+	for _, r := range c.Rows {
+		keys = append(keys, r.Key)
+	}
+	// busier +30, gone -5, new +4, steady 0
+	expected := []string{"busier", "gone", "new", "steady"}
+	if len(keys) != len(expected) {
+		t.Fatal(keys)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatal(keys)
+		}
+	}
+
+	busier := c.Rows[0]
+	if busier.Requests.Before != 10 || busier.Requests.Change != 30 || *busier.Requests.Percent != 300 {
+		t.Error(busier.Requests)
+	}
+	if c.Rows[1].Only != "before" || c.Rows[2].Only != "after" || c.Rows[2].Requests.Percent != nil {
+		t.Error(c.Rows[1], c.Rows[2])
+	}
+}
+
+func TestCompareText(t *testing.T) {
+	before := compareSummary(10*time.Second, compareRow("a", 10, 100))
+	after := compareSummary(10*time.Second, compareRow("a", 15, 100), compareRow("b", 1, 5))
+	var buf bytes.Buffer
+	if err := compareCaptures(before, after).writeText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "before: test.pcap (10.0s)  after: test.pcap (10.0s)\n" +
+		"key  req(before)  req(after)  req(Δ)  req(Δ%)  bytes(before)  bytes(after)  bytes(Δ)  bytes(Δ%)\n" +
+		"a    10           15          +5      +50.0%   100            100           +0        +0.0%\n" +
+		"b    0            1           +1      new      0              5             +5        new\n"
+	if buf.String() != expected {
+		t.Errorf("got:\n%s", buf.String())
+	}
+}
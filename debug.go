@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/diskbudget"
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/presentation"
+)
+
+// publishVars publishes the counters of each stage of pl and the depth of its
+// queues through expvar, namespaced under "memsniff.", so that they appear at
+// /debug/vars when --debug-addr is set.  Each is read on request from the
+// same counters as the footer of the interactive interface, and the lifetime
+// and last interval statistics of stats are published as "memsniff.stats", and
+// the disk space taken by each file sink of budget as "memsniff.disk".  The
+// maintenance window of the analysis stage is served at /maintenance.
+// publishVars may only be called once.
+func publishVars(pl *pipeline, stats *presentation.StatTracker, budget *diskbudget.Budget) {
+	for name, f := range pipelineVars(pl) {
+		expvar.Publish(name, f)
+	}
+	expvar.Publish("memsniff.stats", expvar.Func(func() interface{} {
+		return stats.Snapshot()
+	}))
+	expvar.Publish("memsniff.disk", expvar.Func(func() interface{} {
+		return budget.Usage()
+	}))
+	http.Handle("/maintenance", maintenanceHandler{pl.analysis, logger})
+}
+
+func pipelineVars(pl *pipeline) map[string]expvar.Func {
+	return map[string]expvar.Func{
+		"memsniff.capture": func() interface{} {
+			s, err := pl.src.Stats()
+			if err != nil {
+				return nil
+			}
+			return s
+		},
+		"memsniff.decode": func() interface{} {
+			return pl.decode.Stats()
+		},
+		"memsniff.assembly": func() interface{} {
+			return pl.assembly.Stats()
+		},
+		"memsniff.analysis": func() interface{} {
+			return pl.analysis.Stats()
+		},
+		"memsniff.delimiters": func() interface{} {
+			return pl.analysis.DelimiterCounts()
+		},
+		"memsniff.skew": func() interface{} {
+			return pl.analysis.Skew()
+		},
+		"memsniff.queues": func() interface{} {
+			return map[string]int{
+				"assembly": pl.assembly.QueueDepth(),
+				"analysis": pl.analysis.QueueDepth(),
+			}
+		},
+	}
+}
+
+// maintenanceState is the JSON form of a maintenance window.
+type maintenanceState struct {
+	Active bool       `json:"active"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// maintenanceHandler reports the maintenance window of an analysis.Pool on
+// GET, and on POST starts one lasting the form value duration, such as 30m, or
+// ends it if duration is "off".
+type maintenanceHandler struct {
+	pool   *analysis.Pool
+	logger log.Logger
+}
+
+func (h maintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		arg := r.FormValue("duration")
+		if arg == "off" {
+			h.pool.SetMaintenance(time.Time{})
+			h.pool.RecordConfigChange("http", "maintenance", "off")
+			h.logger.Log("Maintenance ended through HTTP")
+			break
+		}
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			http.Error(w, "duration must be positive, such as 30m, or off", http.StatusBadRequest)
+			return
+		}
+		until := time.Now().Add(d)
+		h.pool.SetMaintenance(until)
+		h.pool.RecordConfigChange("http", "maintenance", "until "+until.Format("15:04:05"))
+		h.logger.Log("Maintenance until", until.Format("15:04:05")+" through HTTP; alerts suppressed")
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var st maintenanceState
+	if until, ok := h.pool.Maintenance(); ok {
+		st.Active, st.Until = true, &until
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// serveDebug serves /debug/vars and /maintenance on addr in the background.
+func serveDebug(addr string) {
+	go func() {
+		logger.Log("Serving /debug/vars and /maintenance on", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			logger.Log(err)
+		}
+	}()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/diskbudget"
+	"github.com/box/memsniff/presentation"
+	"github.com/box/memsniff/protocol/model"
+	"github.com/box/memsniff/selfusage"
+)
+
+func TestPublishVars(t *testing.T) {
+	analysisPool, err := analysis.New(4, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newLoopbackSource(t)
+	pl := newPipeline(testLogger{t}, src, analysisPool, model.ProtocolMemcacheText, []int{11211}, 2, 2)
+	pl.start()
+	select {
+	case <-src.delivered:
+	case <-time.After(time.Second):
+		t.Fatal("packets not collected")
+	}
+	if err := pl.stop(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	budget := diskbudget.New(1<<30, nil)
+	budget.Register("report archive", 0).Existing("old.msar", 4096, time.Now())
+	meter := selfusage.New(nil, 0)
+	meter.Sample()
+	publishVars(pl, presentation.NewStatTracker(statGenerator(src, pl.decode, pl.assembly, analysisPool, budget, meter)), budget)
+
+	rec := httptest.NewRecorder()
+	expvar.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars struct {
+		Capture  map[string]int64           `json:"memsniff.capture"`
+		Decode   map[string]int64           `json:"memsniff.decode"`
+		Assembly map[string]int64           `json:"memsniff.assembly"`
+		Analysis map[string]int64           `json:"memsniff.analysis"`
+		Queues   map[string]int64           `json:"memsniff.queues"`
+		Skew     map[string]float64         `json:"memsniff.skew"`
+		Stats    presentation.StatsSnapshot `json:"memsniff.stats"`
+		Disk     diskbudget.Totals          `json:"memsniff.disk"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if _, ok := vars.Capture["PacketsReceived"]; !ok {
+		t.Error("capture:", vars.Capture)
+	}
+	if vars.Decode["PacketsCaptured"] != 4 {
+		t.Error("decode:", vars.Decode)
+	}
+	if _, ok := vars.Assembly["ConnectionsReused"]; !ok {
+		t.Error("assembly:", vars.Assembly)
+	}
+	if vars.Stats.Version != presentation.StatsVersion || vars.Stats.Lifetime.PacketsCaptured != 4 ||
+		vars.Stats.Interval.ResponsesParsed != 1 {
+		t.Error("stats:", vars.Stats)
+	}
+	if vars.Stats.Lifetime.DiskUsed != 4096 || vars.Stats.Lifetime.DiskLimit != 1<<30 {
+		t.Error("disk stats:", vars.Stats.Lifetime)
+	}
+	if vars.Stats.Lifetime.SelfGoroutines == 0 {
+		t.Error("self stats:", vars.Stats.Lifetime)
+	}
+	if vars.Disk.Bytes != 4096 || len(vars.Disk.Sinks) != 1 || vars.Disk.Sinks[0].Files != 1 {
+		t.Error("disk:", vars.Disk)
+	}
+	if vars.Analysis["EventsHandled"] != 1 {
+		t.Error("analysis:", vars.Analysis)
+	}
+	if _, ok := vars.Queues["assembly"]; !ok || len(vars.Queues) != 2 {
+		t.Error("queues:", vars.Queues)
+	}
+	if _, ok := vars.Skew["Gini"]; !ok {
+		t.Error("skew:", vars.Skew)
+	}
+}
+
+func TestMaintenanceHandler(t *testing.T) {
+	pool, err := analysis.New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := maintenanceHandler{pool, testLogger{t}}
+	serve := func(method, target string) (int, maintenanceState) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		var st maintenanceState
+		if rec.Code == 200 {
+			if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+				t.Fatal(err, rec.Body.String())
+			}
+		}
+		return rec.Code, st
+	}
+
+	if code, st := serve("GET", "/maintenance"); code != 200 || st.Active || st.Until != nil {
+		t.Error("initial state:", code, st)
+	}
+	before := time.Now()
+	code, st := serve("POST", "/maintenance?duration=30m")
+	if code != 200 || !st.Active || st.Until == nil || st.Until.Before(before.Add(30*time.Minute)) {
+		t.Error("after start:", code, st)
+	}
+	if _, st := serve("GET", "/maintenance"); !st.Active {
+		t.Error("window not kept:", st)
+	}
+	for _, bad := range []string{"", "soon", "-5m"} {
+		if code, _ := serve("POST", "/maintenance?duration="+bad); code != 400 {
+			t.Errorf("duration %q: status %d", bad, code)
+		}
+	}
+	if code, _ := serve("DELETE", "/maintenance"); code != 405 {
+		t.Error("DELETE:", code)
+	}
+	if code, st := serve("POST", "/maintenance?duration=off"); code != 200 || st.Active {
+		t.Error("after off:", code, st)
+	}
+	// each change is recorded in the next report, and failed requests are not
+	var changes []string
+	for _, c := range pool.Report(true).ConfigChanges {
+		changes = append(changes, c.Source+" "+c.Setting+"="+strings.Fields(c.Value)[0])
+	}
+	if want := []string{"http maintenance=until", "http maintenance=off"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("recorded %q, want %q", changes, want)
+	}
+}
@@ -1,6 +1,10 @@
 package decode
 
 import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
 	"github.com/box/memsniff/capture"
 	"github.com/box/memsniff/log"
 	"github.com/google/gopacket"
@@ -11,15 +15,25 @@ const (
 	batchSize = 1000
 )
 
+// DefaultMTU is the largest IP packet expected on the wire unless set
+// otherwise, that of standard Ethernet.
+const DefaultMTU = 1500
+
+// arphrdLoopback is the hardware type of the loopback interface in the Linux
+// cooked headers of a capture on the any pseudo-interface.
+const arphrdLoopback = 772
+
 // DecodedPacket holds the broken down structure of a decoded TCP packet.
 type DecodedPacket struct {
 	Info gopacket.CaptureInfo
 
 	ethParser *gopacket.DecodingLayerParser
 	loParser  *gopacket.DecodingLayerParser
+	sllParser *gopacket.DecodingLayerParser
 	decoded   []gopacket.LayerType
 	ether     layers.Ethernet
 	lo        layers.Loopback
+	sll       layers.LinuxSLL
 	dot1q     layers.Dot1Q
 	ipv4      layers.IPv4
 	ipv6      layers.IPv6
@@ -48,6 +62,14 @@ func newDecodedPacket() *DecodedPacket {
 	dp.loParser.AddDecodingLayer(&dp.TCP)
 	dp.loParser.AddDecodingLayer(&dp.Payload)
 
+	dp.sllParser = gopacket.NewDecodingLayerParser(dp.sll.LayerType())
+	dp.sllParser.AddDecodingLayer(&dp.sll)
+	dp.sllParser.AddDecodingLayer(&dp.dot1q)
+	dp.sllParser.AddDecodingLayer(&dp.ipv4)
+	dp.sllParser.AddDecodingLayer(&dp.ipv6)
+	dp.sllParser.AddDecodingLayer(&dp.TCP)
+	dp.sllParser.AddDecodingLayer(&dp.Payload)
+
 	return dp
 }
 
@@ -61,24 +83,91 @@ func (dp *DecodedPacket) IsTCP() bool {
 	return false
 }
 
+// IsFragment returns true if dp is an IP fragment, whose transport header is
+// either absent or incomplete without the rest of the datagram.
+func (dp *DecodedPacket) IsFragment() bool {
+	if len(dp.decoded) == 0 {
+		return false
+	}
+	switch dp.decoded[len(dp.decoded)-1] {
+	case layers.LayerTypeIPv4:
+		return dp.ipv4.NextLayerType() == gopacket.LayerTypeFragment
+	case layers.LayerTypeIPv6:
+		return dp.ipv6.NextLayerType() == layers.LayerTypeIPv6Fragment
+	}
+	return false
+}
+
+// isLoopbackCopy returns true if dp is the outgoing copy of a loopback packet
+// captured on the Linux any pseudo-interface, which sees every loopback packet
+// twice: once as sent and once as received.
+func (dp *DecodedPacket) isLoopbackCopy() bool {
+	if len(dp.decoded) == 0 || dp.decoded[0] != layers.LayerTypeLinuxSLL {
+		return false
+	}
+	return dp.sll.PacketType == layers.LinuxSLLPacketTypeOutgoing &&
+		binary.BigEndian.Uint16(dp.sll.Contents[2:4]) == arphrdLoopback
+}
+
+// isLinuxSLL returns true if data is long enough to be decoded as a Linux
+// cooked capture, with a valid address length.
+func isLinuxSLL(data []byte) bool {
+	return len(data) >= 16 && binary.BigEndian.Uint16(data[4:6]) <= 8
+}
+
+// ipLength returns the total length of the IP packet in dp, by its header, or
+// 0 if dp has no IP layer.
+func (dp *DecodedPacket) ipLength() int {
+	for _, lt := range dp.decoded {
+		switch lt {
+		case layers.LayerTypeIPv4:
+			return int(dp.ipv4.Length)
+		case layers.LayerTypeIPv6:
+			return int(dp.ipv6.Length) + 40
+		}
+	}
+	return 0
+}
+
 // decode parses a single packet from raw byte data and updates the decoded
-// field of d.
+// field of d, returning false if the packet is a copy of another to be
+// ignored.  The IP total length is trusted over the length of data, which may
+// carry link-layer padding, so a TCP segment coalesced by GRO or LRO into one
+// large frame is decoded whole, its payload passed to reassembly as a single
+// chunk.
 //
 // decode is not threadsafe.
-func (dp *DecodedPacket) decode(d *decoder, ci gopacket.CaptureInfo, data []byte) {
+func (dp *DecodedPacket) decode(d *decoder, ci gopacket.CaptureInfo, data []byte) bool {
 	dp.Info = ci
 	dp.FlowHash = 0
 	dp.Payload = dp.Payload[:0]
 	parser := dp.ethParser
 	err := parser.DecodeLayers(data, &dp.decoded)
-	if !dp.IsTCP() {
+	if !dp.IsTCP() && !dp.IsFragment() {
 		parser = dp.loParser
 		err = parser.DecodeLayers(data, &dp.decoded)
 	}
+	if !dp.IsTCP() && !dp.IsFragment() && isLinuxSLL(data) {
+		parser = dp.sllParser
+		err = parser.DecodeLayers(data, &dp.decoded)
+	}
+	if dp.isLoopbackCopy() {
+		d.loopback.add(d.logger)
+		return false
+	}
+	if dp.IsFragment() {
+		// IP fragments are not reassembled, so they cannot be parsed.  Count
+		// them instead of logging each one as a decoding error.
+		d.fragments.add(d.logger)
+		return true
+	}
 	if err != nil {
 		d.logger.Log("Error from DecodeLayers:", err)
 	}
 
+	if dp.IsTCP() && dp.ipLength() > d.coalesced.mtu() {
+		d.coalesced.add()
+	}
 	if parser.Truncated && ci.Length > d.largestPacket {
 		d.logger.Log("Found truncated packet of length", ci.Length)
 		d.largestPacket = ci.Length
@@ -94,6 +183,7 @@ func (dp *DecodedPacket) decode(d *decoder, ci gopacket.CaptureInfo, data []byte
 		default:
 		}
 	}
+	return true
 }
 
 // Handler is a user-provided function for processing a single packet.
@@ -104,13 +194,83 @@ type decoder struct {
 	handler       Handler
 	largestPacket int
 	decoded       []*DecodedPacket
+	fragments     *fragmentCounter
+	coalesced     *coalescedCounter
+	loopback      *loopbackCounter
+}
+
+// fragmentCounter counts IP fragments seen by all decoders in a Pool.
+type fragmentCounter struct {
+	count int64
+	hint  sync.Once
+}
+
+// add counts a fragment, logging an explanation the first time.
+func (fc *fragmentCounter) add(logger log.Logger) {
+	atomic.AddInt64(&fc.count, 1)
+	fc.hint.Do(func() {
+		logger.Log("Ignoring IP fragments, which cannot be parsed; check the MTU along the path to the server")
+	})
+}
+
+func (fc *fragmentCounter) get() int {
+	return int(atomic.LoadInt64(&fc.count))
+}
+
+// loopbackCounter counts the outgoing copies of loopback packets seen by all
+// decoders in a Pool capturing on the Linux any pseudo-interface.
+type loopbackCounter struct {
+	count int64
+	hint  sync.Once
+}
+
+// add counts a copy, logging an explanation the first time.
+func (lc *loopbackCounter) add(logger log.Logger) {
+	atomic.AddInt64(&lc.count, 1)
+	lc.hint.Do(func() {
+		logger.Log("Capturing loopback traffic on the any interface, which sees each packet twice; ignoring the outgoing copies")
+	})
+}
+
+func (lc *loopbackCounter) get() int {
+	return int(atomic.LoadInt64(&lc.count))
 }
 
-func newDecoder(logger log.Logger, handler Handler) *decoder {
+// coalescedCounter counts TCP packets larger than the MTU seen by all decoders
+// in a Pool, which were captured after being coalesced by GRO or LRO.
+type coalescedCounter struct {
+	// limit is the MTU, or 0 for DefaultMTU.
+	limit int64
+	count int64
+}
+
+func (cc *coalescedCounter) mtu() int {
+	if limit := atomic.LoadInt64(&cc.limit); limit > 0 {
+		return int(limit)
+	}
+	return DefaultMTU
+}
+
+func (cc *coalescedCounter) setMTU(mtu int) {
+	atomic.StoreInt64(&cc.limit, int64(mtu))
+}
+
+func (cc *coalescedCounter) add() {
+	atomic.AddInt64(&cc.count, 1)
+}
+
+func (cc *coalescedCounter) get() int {
+	return int(atomic.LoadInt64(&cc.count))
+}
+
+func newDecoder(logger log.Logger, handler Handler, fragments *fragmentCounter, coalesced *coalescedCounter, loopback *loopbackCounter) *decoder {
 	d := &decoder{
-		logger:  logger,
-		handler: handler,
-		decoded: make([]*DecodedPacket, batchSize),
+		logger:    logger,
+		handler:   handler,
+		decoded:   make([]*DecodedPacket, batchSize),
+		fragments: fragments,
+		coalesced: coalesced,
+		loopback:  loopback,
 	}
 	for i := 0; i < len(d.decoded); i++ {
 		d.decoded[i] = newDecodedPacket()
@@ -119,7 +279,7 @@ func newDecoder(logger log.Logger, handler Handler) *decoder {
 }
 
 // decode parses a batch of packets from raw byte data and invokes d's handler
-// for each packet.
+// for each packet, other than copies to be ignored.
 //
 // decodeBatch is not threadsafe.
 func (d *decoder) decodeBatch(pb *capture.PacketBuffer) {
@@ -127,11 +287,15 @@ func (d *decoder) decodeBatch(pb *capture.PacketBuffer) {
 	if numPackets > len(d.decoded) {
 		panic("not enough space for decoded packets")
 	}
+	kept := 0
 	for i := 0; i < numPackets; i++ {
 		pd := pb.Packet(i)
-		d.decoded[i].decode(d, pd.Info, pd.Data)
+		// a copy is decoded over by the next packet
+		if d.decoded[kept].decode(d, pd.Info, pd.Data) {
+			kept++
+		}
 	}
-	d.handler(d.decoded[:numPackets])
+	d.handler(d.decoded[:kept])
 }
 
 // based on boost::hash_combine
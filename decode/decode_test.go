@@ -0,0 +1,204 @@
+package decode
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/box/memsniff/capture"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	testMAC = net.HardwareAddr{0, 1, 2, 3, 4, 5}
+	testIP4 = net.IP{10, 0, 0, 1}
+	testIP6 = net.ParseIP("fe80::1")
+)
+
+func serialize(t *testing.T, ls ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func ipv4Packet(t *testing.T, flags layers.IPv4Flag, offset uint16, payload []byte) []byte {
+	eth := &layers.Ethernet{SrcMAC: testMAC, DstMAC: testMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{
+		Version:    4,
+		IHL:        5,
+		TTL:        64,
+		Protocol:   layers.IPProtocolTCP,
+		SrcIP:      testIP4,
+		DstIP:      testIP4,
+		Flags:      flags,
+		FragOffset: offset,
+	}
+	return serialize(t, eth, ip, gopacket.Payload(payload))
+}
+
+func decodeOne(t *testing.T, data []byte) (*DecodedPacket, *decoder) {
+	d := newDecoder(testLogger{t}, nil, &fragmentCounter{}, &coalescedCounter{}, &loopbackCounter{})
+	dp := d.decoded[0]
+	dp.decode(d, gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)}, data)
+	return dp, d
+}
+
+func TestDecodeTCP(t *testing.T) {
+	eth := &layers.Ethernet{SrcMAC: testMAC, DstMAC: testMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: testIP4, DstIP: testIP4}
+	tcp := &layers.TCP{SrcPort: 11211, DstPort: 40000, DataOffset: 5}
+	dp, d := decodeOne(t, serialize(t, eth, ip, tcp, gopacket.Payload("END\r\n")))
+	if !dp.IsTCP() || dp.IsFragment() {
+		t.Error("expected unfragmented TCP packet")
+	}
+	if n := d.fragments.get(); n != 0 {
+		t.Error("fragments:", n)
+	}
+}
+
+func TestDecodeIPv4Fragments(t *testing.T) {
+	// a datagram split in two: the first fragment carries the transport
+	// header, the second only continues the payload
+	first := ipv4Packet(t, layers.IPv4MoreFragments, 0, make([]byte, 64))
+	second := ipv4Packet(t, 0, 8, make([]byte, 32))
+
+	fc := &fragmentCounter{}
+	d := newDecoder(testLogger{t}, nil, fc, &coalescedCounter{}, &loopbackCounter{})
+	for _, data := range [][]byte{first, second} {
+		dp := d.decoded[0]
+		dp.decode(d, gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)}, data)
+		if !dp.IsFragment() {
+			t.Error("expected fragment")
+		}
+		if dp.IsTCP() || dp.FlowHash != 0 {
+			t.Error("fragment decoded as TCP")
+		}
+	}
+	if n := fc.get(); n != 2 {
+		t.Error("fragments:", n)
+	}
+}
+
+func TestDecodeIPv6Fragment(t *testing.T) {
+	eth := &layers.Ethernet{SrcMAC: testMAC, DstMAC: testMAC, EthernetType: layers.EthernetTypeIPv6}
+	ip := &layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolIPv6Fragment,
+		HopLimit:   64,
+		SrcIP:      testIP6,
+		DstIP:      testIP6,
+	}
+	// fragment header: next header TCP, offset 0, more fragments, id 1
+	frag := []byte{byte(layers.IPProtocolTCP), 0, 0, 1, 0, 0, 0, 1}
+	dp, d := decodeOne(t, serialize(t, eth, ip, gopacket.Payload(append(frag, make([]byte, 32)...))))
+	if !dp.IsFragment() {
+		t.Error("expected fragment")
+	}
+	if n := d.fragments.get(); n != 1 {
+		t.Error("fragments:", n)
+	}
+}
+
+// coalescedPacket returns a TCP packet carrying n bytes of payload in a single
+// frame, as captured after GRO or LRO merges segments.
+func coalescedPacket(t *testing.T, n int) []byte {
+	eth := &layers.Ethernet{SrcMAC: testMAC, DstMAC: testMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: testIP4, DstIP: testIP4}
+	tcp := &layers.TCP{SrcPort: 11211, DstPort: 40000, DataOffset: 5}
+	return serialize(t, eth, ip, tcp, gopacket.Payload(make([]byte, n)))
+}
+
+func TestDecodeCoalesced(t *testing.T) {
+	const payload = 60000
+	data := coalescedPacket(t, payload)
+	tso := append([]byte(nil), data...)
+	// with TSO the IP total length may be left as 0
+	tso[16], tso[17] = 0, 0
+
+	cc := &coalescedCounter{}
+	d := newDecoder(testLogger{t}, nil, &fragmentCounter{}, cc, &loopbackCounter{})
+	for _, data := range [][]byte{data, tso} {
+		dp := d.decoded[0]
+		dp.decode(d, gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)}, data)
+		if !dp.IsTCP() || len(dp.TCP.Payload) != payload {
+			t.Error("payload:", len(dp.TCP.Payload))
+		}
+	}
+
+	// captured short of its length, what was captured is still decoded
+	dp := d.decoded[0]
+	dp.decode(d, gopacket.CaptureInfo{Length: len(data), CaptureLength: 2000}, data[:2000])
+	if !dp.IsTCP() || len(dp.TCP.Payload) != 2000-54 {
+		t.Error("truncated payload:", len(dp.TCP.Payload))
+	}
+	if n := cc.get(); n != 3 {
+		t.Error("coalesced:", n)
+	}
+
+	// an ordinary segment, or one within a larger MTU, is not coalesced
+	_, d = decodeOne(t, coalescedPacket(t, 1400))
+	if n := d.coalesced.get(); n != 0 {
+		t.Error("coalesced:", n)
+	}
+	d.coalesced.setMTU(9000)
+	data = coalescedPacket(t, 8000)
+	d.decoded[0].decode(d, gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)}, data)
+	if n := d.coalesced.get(); n != 0 {
+		t.Error("jumbo frame coalesced:", n)
+	}
+}
+
+// sllPacket returns a TCP packet in a Linux cooked header, as captured on the
+// any pseudo-interface, of the given packet and hardware types.
+func sllPacket(t *testing.T, pktType layers.LinuxSLLPacketType, hwType uint16, seq uint32) []byte {
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: testIP4, DstIP: testIP4}
+	tcp := &layers.TCP{SrcPort: 11211, DstPort: 40000, Seq: seq, DataOffset: 5}
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint16(header[0:], uint16(pktType))
+	binary.BigEndian.PutUint16(header[2:], hwType)
+	binary.BigEndian.PutUint16(header[4:], 6)
+	binary.BigEndian.PutUint16(header[14:], uint16(layers.EthernetTypeIPv4))
+	return append(header, serialize(t, ip, tcp, gopacket.Payload("END\r\n"))...)
+}
+
+// TestDecodeLoopbackCopies checks that of the two copies of a loopback packet
+// captured on the any pseudo-interface only the one received is passed on,
+// while packets on other interfaces are passed on whichever their direction.
+func TestDecodeLoopbackCopies(t *testing.T) {
+	packets := [][]byte{
+		sllPacket(t, layers.LinuxSLLPacketTypeOutgoing, arphrdLoopback, 1),
+		sllPacket(t, layers.LinuxSLLPacketTypeHost, arphrdLoopback, 1),
+		sllPacket(t, layers.LinuxSLLPacketTypeOutgoing, 1, 2),
+		sllPacket(t, layers.LinuxSLLPacketTypeHost, 1, 3),
+		sllPacket(t, layers.LinuxSLLPacketTypeOutgoing, arphrdLoopback, 4),
+	}
+	pb := capture.NewPacketBuffer(len(packets), 1<<16)
+	for _, data := range packets {
+		ci := gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)}
+		if err := pb.Append(capture.PacketData{Info: ci, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var seqs []uint32
+	lc := &loopbackCounter{}
+	d := newDecoder(testLogger{t}, func(dps []*DecodedPacket) {
+		for _, dp := range dps {
+			if !dp.IsTCP() || dp.FlowHash == 0 {
+				t.Error("not decoded as TCP:", dp.decoded)
+			}
+			seqs = append(seqs, dp.TCP.Seq)
+		}
+	}, &fragmentCounter{}, &coalescedCounter{}, lc)
+	d.decodeBatch(pb)
+	if !reflect.DeepEqual(seqs, []uint32{1, 2, 3}) {
+		t.Error("passed on", seqs)
+	}
+	if n := lc.get(); n != 2 {
+		t.Error("loopback copies:", n)
+	}
+}
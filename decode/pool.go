@@ -2,7 +2,9 @@
 package decode
 
 import (
+	"errors"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/box/memsniff/capture"
@@ -12,10 +14,22 @@ import (
 
 type workerQueue chan *worker
 
+// errStopped is returned by sendToWorker when Stop is called while waiting
+// for packets.
+var errStopped = errors.New("decode pool stopped")
+
 // Stats contains runtime performance statistics for a Pool.
 type Stats struct {
 	PacketsCaptured int
 	PacketsDropped  int
+	// PacketsFragmented counts IP fragments, which are not parsed.
+	PacketsFragmented int
+	// PacketsCoalesced counts TCP packets larger than the MTU, which
+	// were coalesced from several segments by GRO or LRO before capture.
+	PacketsCoalesced int
+	// PacketsLoopbackCopies counts the outgoing copies of loopback packets
+	// captured on the Linux any pseudo-interface, which are ignored.
+	PacketsLoopbackCopies int
 }
 
 // Pool is a set of workers for decoding network packets.  It is bound to a
@@ -27,6 +41,16 @@ type Pool struct {
 	src        capture.PacketSource
 	readyQ     workerQueue
 	stats      Stats
+	fragments  fragmentCounter
+	coalesced  coalescedCounter
+	loopback   loopbackCounter
+
+	// workers tracks running worker goroutines.
+	workers sync.WaitGroup
+	// stop is closed to request that Run return.
+	stop chan struct{}
+	// done is closed once Run and all workers have exited.
+	done chan struct{}
 }
 
 // NewPool creates a new Pool of workers.  As packets are captured and decoded,
@@ -38,10 +62,12 @@ func NewPool(logger log.Logger, numWorkers int, src capture.PacketSource, handle
 		numWorkers: numWorkers,
 		src:        src,
 		readyQ:     make(workerQueue, numWorkers),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
 	}
 
 	for i := 0; i < numWorkers; i++ {
-		decoder := newDecoder(logger, handler)
+		decoder := newDecoder(logger, handler, &p.fragments, &p.coalesced, &p.loopback)
 		p.startWorker(p.readyQ, decoder.decodeBatch, 1000, 8*1024*1024, i)
 	}
 
@@ -53,20 +79,27 @@ func NewPool(logger log.Logger, numWorkers int, src capture.PacketSource, handle
 //
 // Packets are dropped if they arrive more rapidly than the Pool can handle
 // them.
+//
+// Run returns once the PacketSource reaches EOF or Stop is called, after all
+// workers have finished their current batch and exited.
 func (p *Pool) Run() {
+	defer close(p.done)
 	for {
 		select {
 		case nextWorker := <-p.readyQ:
 			err := p.sendToWorker(nextWorker)
-			if err == io.EOF {
-				p.logger.Log("Reached EOF, waiting for workers to finish")
-				nextWorker.close()
-				for i := 1; i < p.numWorkers; i++ {
-					(<-p.readyQ).close()
+			if err == io.EOF || err == errStopped {
+				if err == io.EOF {
+					p.logger.Log("Reached EOF, waiting for workers to finish")
 				}
+				p.closeWorkers(nextWorker)
 				p.logger.Log("Decoder exiting")
 				return
 			}
+		case <-p.stop:
+			p.closeWorkers(nil)
+			p.logger.Log("Decoder exiting")
+			return
 		default:
 			err := p.src.DiscardPacket()
 			if err == pcap.NextErrorTimeoutExpired {
@@ -84,9 +117,41 @@ func (p *Pool) Run() {
 	}
 }
 
+// Stop asks Run to return and waits until it and all workers have exited.
+// Stop must be called at most once, and only after Run has been started.
+func (p *Pool) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+// closeWorkers shuts down every worker, waiting for each to finish its current
+// batch.  idle is a worker already taken from the ready queue, or nil.
+func (p *Pool) closeWorkers(idle *worker) {
+	remaining := p.numWorkers
+	if idle != nil {
+		idle.close()
+		remaining--
+	}
+	for i := 0; i < remaining; i++ {
+		(<-p.readyQ).close()
+	}
+	p.workers.Wait()
+}
+
 // Stats returns runtime statistics for a Pool.
 func (p *Pool) Stats() Stats {
-	return p.stats
+	s := p.stats
+	s.PacketsFragmented = p.fragments.get()
+	s.PacketsCoalesced = p.coalesced.get()
+	s.PacketsLoopbackCopies = p.loopback.get()
+	return s
+}
+
+// SetMTU sets the largest IP packet expected on the wire of the capture, above
+// which TCP packets are counted as coalesced.  An mtu of 0 restores
+// DefaultMTU.  SetMTU is threadsafe.
+func (p *Pool) SetMTU(mtu int) {
+	p.coalesced.setMTU(mtu)
 }
 
 func (p *Pool) sendToWorker(w *worker) error {
@@ -99,6 +164,11 @@ func (p *Pool) sendToWorker(w *worker) error {
 			p.stats.PacketsCaptured += w.buf().PacketLen()
 			break
 		}
+		select {
+		case <-p.stop:
+			return errStopped
+		default:
+		}
 	}
 	if err == io.EOF {
 		return err
@@ -82,3 +82,29 @@ func TestGoroutineCount(t *testing.T) {
 		t.Error("Pool left behind", afterRun-before, "goroutines")
 	}
 }
+
+// idleSource is a capture.PacketSource on which no packets ever arrive.
+type idleSource struct{ emptySource }
+
+func (is idleSource) CollectPackets(pb *capture.PacketBuffer) error {
+	time.Sleep(time.Millisecond)
+	return pcap.NextErrorTimeoutExpired
+}
+
+func (is idleSource) DiscardPacket() error {
+	return pcap.NextErrorTimeoutExpired
+}
+
+// TestStopIdle checks that Stop shuts down a Pool waiting for packets that
+// never arrive, and that no goroutines remain once it returns.
+func TestStopIdle(t *testing.T) {
+	before := runtime.NumGoroutine()
+	p := NewPool(testLogger{t}, 4, idleSource{}, nil)
+	go p.Run()
+	time.Sleep(10 * time.Millisecond)
+	p.Stop()
+
+	if after := runtime.NumGoroutine(); after != before {
+		t.Error("Pool left behind", after-before, "goroutines")
+	}
+}
@@ -27,7 +27,11 @@ func (p *Pool) startWorker(q workerQueue, handler packetHandler, batchSize int,
 		workReady:   make(chan struct{}, 1),
 		handler:     handler,
 	}
-	go w.loop()
+	p.workers.Add(1)
+	go func() {
+		defer p.workers.Done()
+		w.loop()
+	}()
 }
 
 // buf returns the worker's capture buffer, where packet data should be
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/loadgen"
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/numfmt"
+	"github.com/box/memsniff/presentation"
+)
+
+const (
+	demoWatermark = " DEMO — synthetic data "
+	// demoBatchInterval and demoBatchSize set the rate of synthetic
+	// requests, 5000 per second.
+	demoBatchInterval = 100 * time.Millisecond
+	demoBatchSize     = 500
+	// demoGrowthAlert is the growth alert set on loadgen.GrowingKey when
+	// none is given, so that alerts can be seen within a minute.
+	demoGrowthAlert = 4096
+)
+
+var errDemoNoGui = errors.New("--demo requires the interactive interface")
+
+// runDemo runs the interactive interface on synthetic traffic instead of a
+// capture, so that every feature can be seen without a live cache.  The
+// traffic is the same on every run, although how it falls into intervals
+// depends on timing.
+func runDemo(choice uiChoice, analysisPool *analysis.Pool, updateInterval time.Duration, thresholds presentation.DropThresholds, numbers numfmt.Formatter, buffered *log.BufferLogger) error {
+	if choice.mode != uiTermbox {
+		return errDemoNoGui
+	}
+	analysisPool.SetWatchedKeys(append(*watch, loadgen.GrowingKey))
+	if *growthAlert == 0 {
+		analysisPool.SetGrowthAlert(demoGrowthAlert)
+	}
+
+	var batches int64
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		g := loadgen.New(loadgen.DefaultConfig)
+		tick := time.NewTicker(demoBatchInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				analysisPool.HandleEvents(g.Batch(demoBatchSize))
+				atomic.AddInt64(&batches, 1)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	statProvider := func() presentation.Stats {
+		n := int(atomic.LoadInt64(&batches))
+		analysisStats := analysisPool.Stats()
+		s := presentation.Stats{
+			// a request and a response per get, and a little loss
+			PacketsPassedFilter:    2 * n * demoBatchSize,
+			PacketsDroppedKernel:   n * demoBatchSize / 100,
+			PacketsDroppedAnalysis: int(analysisStats.EventsDropped),
+			ResponsesParsed:        int(analysisStats.EventsHandled),
+			KeysNormalized:         int(analysisStats.KeysNormalized),
+			DuplicateKeys:          int(analysisStats.DuplicateKeys),
+			ClassifierCost:         analysisStats.ClassifierCost(),
+		}
+		s.PacketsCaptured = s.PacketsPassedFilter - s.PacketsDroppedKernel
+		s.PacketsEnteredFilter = s.PacketsPassedFilter
+		s.PacketsDroppedTotal = s.PacketsDroppedKernel + s.PacketsDroppedAnalysis
+		return s
+	}
+
+	cui := presentation.New(analysisPool, updateInterval, *cumulative, presentation.NewStatTracker(statProvider), thresholds, demoWatermark, *keyTree, numbers, nil)
+	logger.SetLogger(cui)
+	go buffered.WriteTo(cui)
+	logger.Log("Demo mode: showing synthetic traffic, not a capture")
+	return cui.Run()
+}
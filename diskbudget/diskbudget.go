@@ -0,0 +1,255 @@
+// Package diskbudget limits the disk space taken by the files memsniff
+// writes.  Each writer of files registers as a Sink of a Budget, reporting the
+// files it creates and asking before each write whether the bytes fit.  When
+// a write would exceed the cap of its sink or the cap of the whole Budget, the
+// oldest files are deleted to make room, and if that is not enough the sink is
+// asked to start a new file or to skip the write.
+//
+// Usage is counted from the sizes of files when they are reported and the
+// bytes written since, so that checking a write never touches the disk.
+package diskbudget
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/numfmt"
+)
+
+// Action is what a Sink must do with a write, as decided by Reserve.
+type Action int
+
+const (
+	// Write means the bytes fit, and have been counted.
+	Write Action = iota
+	// Rotate means the bytes fit only once the current file of the sink
+	// can be deleted, so the sink should start a new file, report it with
+	// Create, and ask again.
+	Rotate
+	// Pause means the bytes do not fit, and the sink should skip the
+	// write.
+	Pause
+)
+
+// file is a file written by a sink.
+type file struct {
+	path    string
+	size    int64
+	created time.Time
+}
+
+// Budget holds the disk space of a set of sinks to a global cap.  Budget is
+// threadsafe.
+type Budget struct {
+	mu     sync.Mutex
+	limit  int64
+	logger log.Logger
+	sinks  []*Sink
+	remove func(path string) error
+	now    func() time.Time
+}
+
+// New returns a Budget holding the files of its sinks to limit bytes in
+// total, or to no cap if limit is 0.  Files deleted and sinks paused or
+// resumed are logged to logger.
+func New(limit int64, logger log.Logger) *Budget {
+	return &Budget{limit: limit, logger: logger, remove: os.Remove, now: time.Now}
+}
+
+// Sink is the account of one writer of files with a Budget.  The methods of a
+// Sink are threadsafe.
+type Sink struct {
+	b     *Budget
+	name  string
+	limit int64
+	// files are those the sink has finished writing, oldest first, which
+	// may be deleted, and current the one being written, if any.
+	files   []file
+	current *file
+	bytes   int64
+	trimmed int
+	paused  bool
+}
+
+// Register adds a sink called name, such as "report archive", whose files are
+// held to limit bytes, or only to the cap of the Budget if limit is 0.
+func (b *Budget) Register(name string, limit int64) *Sink {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := &Sink{b: b, name: name, limit: limit}
+	b.sinks = append(b.sinks, s)
+	return s
+}
+
+// Existing reports a file left by an earlier run, so that it counts towards
+// the budget and may be deleted to make room.
+func (s *Sink) Existing(path string, size int64, modTime time.Time) {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.files = append(s.files, file{path, size, modTime})
+	sort.SliceStable(s.files, func(i, j int) bool {
+		return s.files[i].created.Before(s.files[j].created)
+	})
+	s.bytes += size
+}
+
+// Create reports that the sink has started writing a new, empty file at path,
+// and finished the previous one.  A file to which nothing is written need not
+// exist.
+func (s *Sink) Create(path string) {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.finish()
+	s.current = &file{path: path, created: s.b.now()}
+}
+
+// Close reports that the sink has finished writing its current file.
+func (s *Sink) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.finish()
+}
+
+func (s *Sink) finish() {
+	if s.current != nil && s.current.size > 0 {
+		s.files = append(s.files, *s.current)
+	}
+	s.current = nil
+}
+
+// Reserve asks whether n more bytes may be written to the current file of the
+// sink, deleting the oldest files of the sink, or of any sink if only the
+// global cap is exceeded, until they fit.  A sink is paused from the first
+// write skipped until the next that fits, which are both logged.
+func (s *Sink) Reserve(n int64) Action {
+	b := s.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		overSink := s.limit > 0 && s.bytes+n > s.limit
+		overGlobal := b.limit > 0 && b.total()+n > b.limit
+		if !overSink && !overGlobal {
+			break
+		}
+		victim := s
+		if !overSink {
+			victim = b.oldest()
+		}
+		if victim == nil || len(victim.files) == 0 {
+			if s.current != nil && s.current.size > 0 {
+				return Rotate
+			}
+			s.pause(n, overSink)
+			return Pause
+		}
+		victim.trim()
+	}
+	if s.current != nil {
+		s.current.size += n
+	}
+	s.bytes += n
+	if s.paused {
+		s.paused = false
+		b.log(s.name + " resumed")
+	}
+	return Write
+}
+
+func (s *Sink) pause(n int64, overSink bool) {
+	if s.paused {
+		return
+	}
+	s.paused = true
+	limit := "the budget of " + human.ByteSize(s.b.limit)
+	if overSink {
+		limit = "its cap of " + human.ByteSize(s.limit)
+	}
+	s.b.log(fmt.Sprintf("%s paused, since writing %s would exceed %s", s.name, human.ByteSize(n), limit))
+}
+
+// trim deletes the oldest finished file of s.  A file that cannot be deleted
+// is logged and no longer counted, so that it is not tried again.
+func (s *Sink) trim() {
+	f := s.files[0]
+	s.files = s.files[1:]
+	s.bytes -= f.size
+	s.trimmed++
+	if err := s.b.remove(f.path); err != nil && !os.IsNotExist(err) {
+		s.b.log(err)
+		return
+	}
+	s.b.log("deleted", f.path, "of", human.ByteSize(f.size))
+}
+
+// oldest returns the sink with the oldest finished file, or nil if no sink
+// has one.
+func (b *Budget) oldest() *Sink {
+	var oldest *Sink
+	for _, s := range b.sinks {
+		if len(s.files) == 0 {
+			continue
+		}
+		if oldest == nil || s.files[0].created.Before(oldest.files[0].created) {
+			oldest = s
+		}
+	}
+	return oldest
+}
+
+func (b *Budget) total() int64 {
+	var total int64
+	for _, s := range b.sinks {
+		total += s.bytes
+	}
+	return total
+}
+
+func (b *Budget) log(items ...interface{}) {
+	if b.logger != nil {
+		b.logger.Log(append([]interface{}{"Disk budget:"}, items...)...)
+	}
+}
+
+// human writes the sizes in log messages.
+var human = numfmt.Formatter{Style: numfmt.Human}
+
+// Usage is the disk space taken by the files of one sink.
+type Usage struct {
+	Sink string `json:"sink"`
+	// Bytes is the size of the files of the sink, and Limit its cap, or 0
+	// if it has none.
+	Bytes int64 `json:"bytes"`
+	Limit int64 `json:"limit,omitempty"`
+	// Files is the number of files of the sink, and Trimmed the number
+	// deleted to make room.
+	Files   int  `json:"files"`
+	Trimmed int  `json:"trimmed"`
+	Paused  bool `json:"paused"`
+}
+
+// Totals is the disk space taken by the files of all sinks of a Budget.
+type Totals struct {
+	Bytes int64   `json:"bytes"`
+	Limit int64   `json:"limit,omitempty"`
+	Sinks []Usage `json:"sinks"`
+}
+
+// Usage returns the disk space taken by the files of each sink, in the order
+// registered, and in total.
+func (b *Budget) Usage() Totals {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := Totals{Bytes: b.total(), Limit: b.limit, Sinks: make([]Usage, len(b.sinks))}
+	for i, s := range b.sinks {
+		files := len(s.files)
+		if s.current != nil && s.current.size > 0 {
+			files++
+		}
+		t.Sinks[i] = Usage{s.name, s.bytes, s.limit, files, s.trimmed, s.paused}
+	}
+	return t
+}
@@ -0,0 +1,133 @@
+package diskbudget
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/log"
+)
+
+type testLogger struct {
+	messages []string
+}
+
+func (l *testLogger) Log(items ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintln(items...))
+}
+
+// testBudget returns a Budget whose clock advances a second on each file
+// created, recording the files deleted.
+func testBudget(limit int64, logger log.Logger) (*Budget, *[]string) {
+	b := New(limit, logger)
+	var removed []string
+	b.remove = func(path string) error {
+		removed = append(removed, path)
+		return nil
+	}
+	now := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	b.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return b, &removed
+}
+
+func TestSinkCap(t *testing.T) {
+	b, removed := testBudget(0, nil)
+	s := b.Register("archive", 100)
+	s.Existing("old-2", 30, time.Date(2017, 5, 2, 0, 0, 0, 0, time.UTC))
+	s.Existing("old-1", 30, time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC))
+	s.Create("a")
+	if a := s.Reserve(30); a != Write {
+		t.Fatal(a)
+	}
+	if a := s.Reserve(20); a != Write {
+		t.Fatal(a)
+	}
+	if !reflect.DeepEqual(*removed, []string{"old-1"}) {
+		t.Error("removed", *removed)
+	}
+	// only the current file is left to delete
+	s.Reserve(40)
+	if a := s.Reserve(50); a != Rotate {
+		t.Fatal(a)
+	}
+	s.Create("b")
+	if a := s.Reserve(50); a != Write {
+		t.Fatal(a)
+	}
+	if !reflect.DeepEqual(*removed, []string{"old-1", "old-2", "a"}) {
+		t.Error("removed", *removed)
+	}
+	u := b.Usage()
+	want := Totals{Bytes: 50, Sinks: []Usage{{Sink: "archive", Bytes: 50, Limit: 100, Files: 1, Trimmed: 3}}}
+	if !reflect.DeepEqual(u, want) {
+		t.Error(u)
+	}
+}
+
+func TestGlobalCap(t *testing.T) {
+	logger := &testLogger{}
+	b, removed := testBudget(100, logger)
+	archive := b.Register("archive", 0)
+	dump := b.Register("dump", 0)
+	archive.Create("archive-1")
+	archive.Reserve(40)
+	dump.Create("dump-1")
+	dump.Reserve(40)
+	archive.Create("archive-2")
+	dump.Create("dump-2")
+
+	// the oldest file of any sink goes first
+	if a := dump.Reserve(30); a != Write {
+		t.Fatal(a)
+	}
+	if !reflect.DeepEqual(*removed, []string{"archive-1"}) {
+		t.Error("removed", *removed)
+	}
+	if a := dump.Reserve(60); a != Write {
+		t.Fatal(a)
+	}
+	if !reflect.DeepEqual(*removed, []string{"archive-1", "dump-1"}) {
+		t.Error("removed", *removed)
+	}
+
+	// nothing is left to delete but the current file of another sink
+	if a := archive.Reserve(30); a != Pause {
+		t.Fatal(a)
+	}
+	archive.Reserve(30)
+	if u := b.Usage(); u.Bytes != 90 || !u.Sinks[0].Paused {
+		t.Error(u)
+	}
+	dump.Close()
+	if a := archive.Reserve(30); a != Write {
+		t.Fatal(a)
+	}
+	want := []string{
+		"Disk budget: deleted archive-1 of 40 B\n",
+		"Disk budget: deleted dump-1 of 40 B\n",
+		"Disk budget: archive paused, since writing 30 B would exceed the budget of 100 B\n",
+		"Disk budget: deleted dump-2 of 90 B\n",
+		"Disk budget: archive resumed\n",
+	}
+	if !reflect.DeepEqual(logger.messages, want) {
+		t.Error(logger.messages)
+	}
+}
+
+func TestUnwrittenFile(t *testing.T) {
+	b, removed := testBudget(10, nil)
+	s := b.Register("archive", 0)
+	s.Create("empty")
+	if a := s.Reserve(20); a != Pause {
+		t.Fatal(a)
+	}
+	s.Create("next")
+	s.Close()
+	if u := b.Usage(); u.Bytes != 0 || u.Sinks[0].Files != 0 || len(*removed) != 0 {
+		t.Error(u, *removed)
+	}
+}
@@ -0,0 +1,394 @@
+//go:build integration
+// +build integration
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/capture"
+	"github.com/box/memsniff/protocol/model"
+)
+
+// The integration tests capture the traffic of a small embedded client to a
+// real memcached on loopback, through the full pipeline, and check the
+// reports built from it.  They need permission to capture, as root or with
+// CAP_NET_RAW, and either docker to start memcached in a container or
+// MEMCACHED_ADDR naming one listening on loopback, such as 127.0.0.1:11211.
+// MEMSNIFF_INTERFACE overrides the loopback interface captured on.  Run them
+// with
+//
+//	make integration
+//
+// To cover a new feature, add a scenario to integrationScenarios.
+
+const (
+	// memcachedImage is the container started when MEMCACHED_ADDR is not
+	// set.
+	memcachedImage = "memcached:1.6-alpine"
+	// integrationInterval is the length of each report, of which
+	// integrationIntervals are taken after the traffic of a scenario.
+	integrationInterval  = 500 * time.Millisecond
+	integrationIntervals = 3
+)
+
+// scenario is traffic driven through memcached and the report expected of it.
+type scenario struct {
+	name   string
+	format string
+	// rank is the operations by which keys are ranked, and reported
+	// under all but RankAll.
+	rank analysis.RankBasis
+	// drive sends the traffic of the scenario through c, using keys
+	// returned by key.
+	drive func(c *mcClient, key func(string) string) error
+	// want is the expected values of each key, by short name as given to
+	// key, and then by column.  Keys and columns not listed are not
+	// checked.
+	want map[string]map[string]int64
+	// ops is the expected values stored and deletions of each key.
+	ops map[string]analysis.OpCounts
+	// tolerance is the fraction by which values may differ from want, for
+	// scenarios whose values are estimates.
+	tolerance float64
+}
+
+var integrationScenarios = []scenario{
+	{
+		name:   "gets",
+		format: "key,count(size),sum(size),sum(hit),sum(miss)",
+		drive: func(c *mcClient, key func(string) string) error {
+			return firstError(
+				c.set(key("small"), 100),
+				c.set(key("large"), 20000),
+				c.getN(3, key("small")),
+				c.getN(1, key("large")),
+				c.getN(2, key("missing")),
+			)
+		},
+		want: map[string]map[string]int64{
+			"small":   {"count(size)": 3, "sum(size)": 300, "sum(hit)": 3, "sum(miss)": 0},
+			"large":   {"count(size)": 1, "sum(size)": 20000, "sum(hit)": 1, "sum(miss)": 0},
+			"missing": {"count(size)": 2, "sum(size)": 0, "sum(hit)": 0, "sum(miss)": 2},
+		},
+		ops: map[string]analysis.OpCounts{
+			"small": {Gets: 3, Sets: 1, SetBytes: 100},
+			"large": {Gets: 1, Sets: 1, SetBytes: 20000},
+		},
+	},
+	{
+		name:   "multigets",
+		format: "key,count(size),sum(size),sum(multi)",
+		drive: func(c *mcClient, key func(string) string) error {
+			return firstError(
+				c.set(key("a"), 10),
+				c.set(key("b"), 20),
+				c.getN(2, key("a"), key("b"), key("absent")),
+				c.getN(1, key("a")),
+			)
+		},
+		want: map[string]map[string]int64{
+			"a":      {"count(size)": 3, "sum(size)": 30, "sum(multi)": 2},
+			"b":      {"count(size)": 2, "sum(size)": 40, "sum(multi)": 2},
+			"absent": {"count(size)": 2, "sum(size)": 0, "sum(multi)": 2},
+		},
+	},
+	{
+		name:   "deletes",
+		format: "key,count(size),sum(miss)",
+		rank:   analysis.RankDeletes,
+		drive: func(c *mcClient, key func(string) string) error {
+			return firstError(
+				c.set(key("doomed"), 50),
+				c.delete(key("doomed")),
+				c.delete(key("never")),
+				c.getN(1, key("doomed")),
+			)
+		},
+		want: map[string]map[string]int64{
+			"doomed": {"count(size)": 1, "sum(miss)": 1},
+		},
+		ops: map[string]analysis.OpCounts{
+			"doomed": {Gets: 1, Sets: 1, Deletes: 1, SetBytes: 50},
+			"never":  {Deletes: 1},
+		},
+	},
+	{
+		name:   "distinct clients",
+		format: "key,count(size),distinct(conn),top%",
+		drive: func(c *mcClient, key func(string) string) error {
+			other, err := dialMemcached(c.addr)
+			if err != nil {
+				return err
+			}
+			defer other.close()
+			return firstError(
+				c.set(key("shared"), 10),
+				c.getN(9, key("shared")),
+				other.getN(1, key("shared")),
+			)
+		},
+		want: map[string]map[string]int64{
+			"shared": {"count(size)": 10, "distinct(conn)": 2, "top clnt%": 100},
+		},
+	},
+}
+
+func TestIntegration(t *testing.T) {
+	addr := memcachedAddr(t)
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sc := range integrationScenarios {
+		sc := sc
+		t.Run(sc.name, func(t *testing.T) {
+			runScenario(t, addr, port, sc)
+		})
+	}
+}
+
+// runScenario captures the traffic of sc to memcached at addr, listening on
+// port, for a few intervals, and checks the merged reports against it.
+func runScenario(t *testing.T, addr string, port int, sc scenario) {
+	pool, err := analysis.New(4, sc.format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.SetRankBasis(sc.rank)
+	iface := loopbackInterface()
+	src, err := capture.New(testLogger{t}, iface, "", 8, false, []int{port}, 0)
+	if err != nil {
+		t.Skip("cannot capture on", iface+":", err)
+	}
+	pl := newPipeline(testLogger{t}, src, pool, model.ProtocolMemcacheText, []int{port}, 2, 2)
+	pl.start()
+	defer pl.stop(stopTimeout)
+
+	prefix := fmt.Sprintf("memsniff-it:%s:%d:", strings.Replace(sc.name, " ", "-", -1), time.Now().UnixNano())
+	key := func(name string) string { return prefix + name }
+	c, err := dialMemcached(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.drive(c, key); err != nil {
+		t.Fatal(err)
+	}
+	// close the connection first, so that its traffic is all delivered
+	c.close()
+
+	reports := []analysis.Report{pool.Report(true)}
+	for i := 0; i < integrationIntervals; i++ {
+		time.Sleep(integrationInterval)
+		reports = append(reports, pool.Report(true))
+	}
+	if err := pl.drain(stopTimeout); err != nil {
+		t.Fatal(err)
+	}
+	reports = append(reports, pool.Report(true))
+	rep, err := analysis.MergeReports(reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScenario(t, rep, sc, prefix)
+}
+
+// checkScenario compares the rows of rep for keys starting with prefix
+// against the values and operation counts expected by sc.
+func checkScenario(t *testing.T, rep analysis.Report, sc scenario, prefix string) {
+	rows := make(map[string]analysis.ReportRow)
+	for _, row := range rep.Rows {
+		if strings.HasPrefix(row.Key[0], prefix) {
+			rows[strings.TrimPrefix(row.Key[0], prefix)] = row
+		}
+	}
+	for name, cols := range sc.want {
+		row, ok := rows[name]
+		if !ok {
+			t.Errorf("key %s not reported; got %v", name, rows)
+			continue
+		}
+		for col, want := range cols {
+			i := indexOfColumn(rep.ValColNames, col)
+			if i < 0 {
+				t.Fatalf("no column %s in %v", col, rep.ValColNames)
+			}
+			if got := row.Values[i]; !withinTolerance(got, want, sc.tolerance) {
+				t.Errorf("key %s: %s is %d, want %d", name, col, got, want)
+			}
+		}
+	}
+	for name, want := range sc.ops {
+		if got := rows[name].Ops; got != want {
+			t.Errorf("key %s: operations %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func indexOfColumn(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// withinTolerance returns true if got differs from want by at most the
+// fraction tolerance of want.
+func withinTolerance(got, want int64, tolerance float64) bool {
+	diff := got - want
+	if diff < 0 {
+		diff = -diff
+	}
+	return float64(diff) <= tolerance*float64(want)
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loopbackInterface returns the name of the interface to capture on.
+func loopbackInterface() string {
+	if iface := os.Getenv("MEMSNIFF_INTERFACE"); iface != "" {
+		return iface
+	}
+	if runtime.GOOS == "linux" {
+		return "lo"
+	}
+	return "lo0"
+}
+
+// memcachedAddr returns the address of the memcached to test against, from
+// MEMCACHED_ADDR or by starting a container that is removed when the test
+// ends.  The test is skipped if neither is available.
+func memcachedAddr(t *testing.T) string {
+	if addr := os.Getenv("MEMCACHED_ADDR"); addr != "" {
+		return addr
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("set MEMCACHED_ADDR or install docker to run integration tests")
+	}
+	out, err := exec.Command("docker", "run", "--detach", "--rm", "--publish", "127.0.0.1::11211", memcachedImage).Output()
+	if err != nil {
+		t.Skip("cannot start memcached:", err)
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		exec.Command("docker", "stop", id).Run()
+	})
+	out, err = exec.Command("docker", "port", id, "11211/tcp").Output()
+	if err != nil {
+		t.Fatal("docker port:", err)
+	}
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		c, err := dialMemcached(addr)
+		if err == nil {
+			c.close()
+			return addr
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("memcached did not start:", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// mcClient speaks just enough of the memcached text protocol to drive
+// scenarios.
+type mcClient struct {
+	addr string
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialMemcached(addr string) (*mcClient, error) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &mcClient{addr: addr, conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func (c *mcClient) close() {
+	c.conn.Close()
+}
+
+// command sends line, followed by data if not nil, and returns the first
+// line of the response.
+func (c *mcClient) command(line string, data []byte) (string, error) {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	msg := line + "\r\n"
+	if data != nil {
+		msg += string(data) + "\r\n"
+	}
+	if _, err := c.conn.Write([]byte(msg)); err != nil {
+		return "", err
+	}
+	return c.readLine()
+}
+
+func (c *mcClient) readLine() (string, error) {
+	s, err := c.r.ReadString('\n')
+	return strings.TrimSuffix(s, "\r\n"), err
+}
+
+// set stores a value of size bytes for key.
+func (c *mcClient) set(key string, size int) error {
+	resp, err := c.command(fmt.Sprintf("set %s 0 0 %d", key, size), []byte(strings.Repeat("x", size)))
+	if err == nil && resp != "STORED" {
+		err = fmt.Errorf("set %s: %s", key, resp)
+	}
+	return err
+}
+
+// getN retrieves keys in a single request, n times over.
+func (c *mcClient) getN(n int, keys ...string) error {
+	for i := 0; i < n; i++ {
+		line, err := c.command("get "+strings.Join(keys, " "), nil)
+		for err == nil && line != "END" {
+			var key string
+			var flags, size int
+			if _, err = fmt.Sscanf(line, "VALUE %s %d %d", &key, &flags, &size); err != nil {
+				return fmt.Errorf("get: %q: %v", line, err)
+			}
+			if _, err = c.r.Discard(size + 2); err == nil {
+				line, err = c.readLine()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delete deletes key, whether or not it is stored.
+func (c *mcClient) delete(key string) error {
+	resp, err := c.command("delete "+key, nil)
+	if err == nil && resp != "DELETED" && resp != "NOT_FOUND" {
+		err = fmt.Errorf("delete %s: %s", key, resp)
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+// Package loadgen generates synthetic, reproducible cache traffic, for
+// benchmarks and for exercising the user interface without a live cache.
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+// GrowingKey is a key whose value grows with every batch, as a cached blob
+// appended to indefinitely would, so that watching it raises growth alerts.
+const GrowingKey = "session:blob:42"
+
+// Config describes the traffic to generate.
+type Config struct {
+	// Seed makes the traffic reproducible: generators with the same Config
+	// produce the same events.
+	Seed int64
+	// Keys is the number of distinct keys requested.
+	Keys int
+	// Skew is the exponent of the Zipf distribution of requests among
+	// keys, greater than 1.  Higher values concentrate requests on fewer
+	// keys.
+	Skew float64
+	// Clients is the number of distinct clients making requests.
+	Clients int
+	// MissRate is the fraction of gets that miss.
+	MissRate float64
+	// BurstEvery is the number of batches between bursts of requests for a
+	// single, otherwise unpopular key, or 0 for no bursts.
+	BurstEvery int
+}
+
+// DefaultConfig is moderately skewed traffic over ten thousand keys.
+var DefaultConfig = Config{
+	Seed:       1,
+	Keys:       10000,
+	Skew:       1.2,
+	Clients:    50,
+	MissRate:   0.1,
+	BurstEvery: 20,
+}
+
+// Generator produces batches of events.  A Generator is not threadsafe.
+type Generator struct {
+	c       Config
+	r       *rand.Rand
+	zipf    *rand.Zipf
+	batches int
+	growth  int
+}
+
+// New returns a Generator of traffic described by c.
+func New(c Config) *Generator {
+	r := rand.New(rand.NewSource(c.Seed))
+	return &Generator{
+		c:    c,
+		r:    r,
+		zipf: rand.NewZipf(r, c.Skew, 1, uint64(c.Keys-1)),
+	}
+}
+
+// Key returns the name of key i, made of colon-separated fields so that keys
+// can be grouped by classifiers.
+func Key(i int) string {
+	kinds := [...]string{"user", "photo", "feed", "cfg"}
+	return fmt.Sprintf("%s:%d:%d", kinds[i%len(kinds)], i%16, i)
+}
+
+// valueSize is the size of the value of key i, from a few bytes to tens of
+// kilobytes, the same each time the key is requested.
+func valueSize(i int) int {
+	h := uint32(i)*2654435761 + 1
+	return (16 << (h % 11)) * int(1+h%7) / 4
+}
+
+// Batch returns the events of the next n requests.  A few requests name
+// several keys, some values are stored, and every BurstEvery batches an
+// unpopular key is requested many times.  The batch ends with the traffic of
+// each client connection.  As in a capture, events name the client by its
+// address and the connection by the address and port of the client.
+func (g *Generator) Batch(n int) []model.Event {
+	g.batches++
+	evts := make([]model.Event, 0, n+n/4)
+	for req := 0; req < n; req++ {
+		client := fmt.Sprintf("10.0.%d.%d", g.r.Intn(4), 1+g.r.Intn(g.c.Clients))
+		conn := net.JoinHostPort(client, strconv.Itoa(40000+g.r.Intn(20000)))
+		batchSize := 1
+		if g.r.Intn(10) == 0 {
+			batchSize = 2 + g.r.Intn(4)
+		}
+		for i := 0; i < batchSize; i++ {
+			evts = append(evts, g.get(int(g.zipf.Uint64()), client, conn, batchSize))
+		}
+		if g.r.Intn(20) == 0 {
+			k := int(g.zipf.Uint64())
+			evts = append(evts, model.Event{
+				Type:   model.EventSet,
+				Key:    Key(k),
+				Size:   valueSize(k),
+				Client: client,
+				Conn:   conn,
+				TTL:    30 + g.r.Intn(90),
+			})
+		}
+	}
+
+	g.growth += 64
+	evts = append(evts, model.Event{
+		Type:        model.EventGetHit,
+		Key:         GrowingKey,
+		Size:        1000 + g.growth,
+		RequestSize: len(GrowingKey) + 6,
+		Client:      "10.0.9.9",
+		Conn:        "10.0.9.9:41000",
+		BatchSize:   1,
+	})
+	if g.c.BurstEvery > 0 && g.batches%g.c.BurstEvery == 0 {
+		k := g.c.Keys - 1 - g.r.Intn(g.c.Keys/2)
+		for i := 0; i < n/2; i++ {
+			evts = append(evts, g.get(k, "10.0.8.8", "10.0.8.8:42000", 1))
+		}
+	}
+	return appendTraffic(evts)
+}
+
+// appendTraffic appends an EventTraffic for each connection in evts, in the
+// order the connections first appear, counting the bytes of their requests and
+// of the values returned.
+func appendTraffic(evts []model.Event) []model.Event {
+	index := make(map[string]int)
+	var traffic []model.Event
+	for _, e := range evts {
+		i, ok := index[e.Conn]
+		if !ok {
+			i = len(traffic)
+			index[e.Conn] = i
+			traffic = append(traffic, model.Event{Type: model.EventTraffic, Key: e.Conn, Client: e.Client})
+		}
+		if e.Type == model.EventSet {
+			traffic[i].RequestSize += len(e.Key) + e.Size
+		} else {
+			traffic[i].RequestSize += e.RequestSize
+			traffic[i].Size += e.Size
+		}
+	}
+	return append(evts, traffic...)
+}
+
+func (g *Generator) get(k int, client, conn string, batchSize int) model.Event {
+	key := Key(k)
+	evt := model.Event{
+		Type:        model.EventGetHit,
+		Key:         key,
+		Size:        valueSize(k),
+		RequestSize: len(key) + 1 + 6/batchSize,
+		Client:      client,
+		Conn:        conn,
+		BatchSize:   batchSize,
+	}
+	if g.r.Float64() < g.c.MissRate {
+		evt.Type = model.EventGetMiss
+		evt.Size = 0
+	}
+	return evt
+}
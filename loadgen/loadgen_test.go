@@ -0,0 +1,110 @@
+package loadgen
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/box/memsniff/protocol/model"
+)
+
+func TestReproducible(t *testing.T) {
+	a, b := New(DefaultConfig), New(DefaultConfig)
+	for i := 0; i < 5; i++ {
+		if !reflect.DeepEqual(a.Batch(100), b.Batch(100)) {
+			t.Fatal("batch", i, "differs")
+		}
+	}
+	c := DefaultConfig
+	c.Seed++
+	if reflect.DeepEqual(New(c).Batch(100), New(DefaultConfig).Batch(100)) {
+		t.Error("seed ignored")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	g := New(DefaultConfig)
+	var hits, misses, sets, multi int
+	for _, e := range g.Batch(1000) {
+		switch e.Type {
+		case model.EventGetHit:
+			hits++
+		case model.EventGetMiss:
+			misses++
+		case model.EventSet:
+			sets++
+		}
+		if e.BatchSize > 1 {
+			multi++
+		}
+	}
+	if hits+misses < 1000 || misses == 0 || sets == 0 || multi == 0 {
+		t.Error(hits, misses, sets, multi)
+	}
+}
+
+func TestBurstsAndGrowth(t *testing.T) {
+	c := DefaultConfig
+	c.BurstEvery = 2
+	g := New(c)
+	var lastGrowing int
+	for i := 1; i <= 4; i++ {
+		evts := g.Batch(100)
+		counts := make(map[string]int)
+		for _, e := range evts {
+			counts[e.Key]++
+			if e.Key == GrowingKey {
+				if e.Size <= lastGrowing {
+					t.Error("value did not grow:", e.Size)
+				}
+				lastGrowing = e.Size
+			}
+		}
+		var burst bool
+		for _, n := range counts {
+			burst = burst || n >= 50
+		}
+		if burst != (i%2 == 0) {
+			t.Error("batch", i, "burst:", burst)
+		}
+	}
+}
+
+func TestTraffic(t *testing.T) {
+	evts := New(DefaultConfig).Batch(100)
+	var requested, returned, reqTraffic, respTraffic int
+	for _, e := range evts {
+		switch e.Type {
+		case model.EventTraffic:
+			reqTraffic += e.RequestSize
+			respTraffic += e.Size
+		case model.EventSet:
+			requested += len(e.Key) + e.Size
+		default:
+			requested += e.RequestSize
+			returned += e.Size
+		}
+	}
+	if reqTraffic != requested || respTraffic != returned {
+		t.Error(reqTraffic, requested, respTraffic, returned)
+	}
+}
+
+// TestClients checks that events name clients by address alone and
+// connections by address and port, as a capture does.
+func TestClients(t *testing.T) {
+	for _, e := range New(DefaultConfig).Batch(100) {
+		if net.ParseIP(e.Client) == nil {
+			t.Fatal("client:", e.Client)
+		}
+		conn := e.Conn
+		if e.Type == model.EventTraffic {
+			// the traffic of a connection is keyed by it
+			conn = e.Key
+		}
+		host, _, err := net.SplitHostPort(conn)
+		if err != nil || host != e.Client {
+			t.Fatal("conn:", conn, "of client", e.Client)
+		}
+	}
+}
@@ -3,18 +3,25 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/box/memsniff/protocol/model"
+	"net"
 	"os"
 	"os/signal"
+	"runtime/pprof"
 	"time"
 
 	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/archive"
 	"github.com/box/memsniff/assembly"
 	"github.com/box/memsniff/capture"
 	"github.com/box/memsniff/decode"
+	"github.com/box/memsniff/diskbudget"
 	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/numfmt"
 	"github.com/box/memsniff/presentation"
+	"github.com/box/memsniff/selfusage"
 	flag "github.com/spf13/pflag"
 )
 
@@ -24,19 +31,81 @@ var (
 	bufferSize   = flag.IntP("buffersize", "b", 8, "MiB of kernel buffer for packet data")
 	protocol     = flag.StringP("protocol", "P", "infer", "datastore protocol (one of mctext, redis, or infer to guess based on content)")
 	ports        = flag.IntSliceP("ports", "p", []int{6379, 11211}, "ports to listen on")
+	retries      = flag.Int("reopen-retries", 10, "attempts to reopen a network interface that goes down before giving up")
 
 	assemblyWorkers = flag.Int("assemblyworkers", 8, "number of TCP assembly workers")
 	decodeWorkers   = flag.Int("decodeworkers", 8, "number of decode workers")
 	analysisWorkers = flag.Int("analysisworkers", 32, "number of analysis workers")
+	selfCPULimit    = flag.Float64("self-limit-cpu", 0, "warn when memsniff itself uses more than this percentage of one core over an interval (0 to disable)")
+	connBudget      = flag.String("conn-budget", "0", "bytes each connection may have parsed per interval, such as 1M, skipping the rest of its data until the next interval unless a --watch key was parsed on it first (0 for no limit)")
 	profiles        = flag.StringSlice("profile", []string{}, "profile types to store (one or more of cpu, heap, block)")
+	debugAddr       = flag.String("debug-addr", "", "serve internal counters at /debug/vars, and control of maintenance windows at /maintenance, on this address, such as localhost:6060")
 
-	filter     = flag.String("filter", "", "regex pattern of cache keys to track")
-	format     = flag.StringP("format", "f", "key,max(size),sum(size)", "fields (key, size) and aggregates (avg, max, min, sum, p50 (median), p995 (99.5th percentile), etc.) to display")
+	filter     = flag.StringArray("filter", nil, "regex pattern of cache keys to track, or with a leading ! of keys to exclude; repeat to track keys matching any pattern and excluded by none")
+	normalize  = flag.String("normalize-keys", "", "normalize keys before analysis (comma-separated list of lower, trim)")
+	classify   = flag.String("classify", "", "report keys by group as assigned by a classifier, such as field:N to group by the first N colon-separated fields, or field:N,auto to detect the delimiter of each key among : | and .")
+	format     = flag.StringP("format", "f", "key,max(size),sum(size)", "fields (key, client, conn, server, size, reqsize, hit, miss, multi, expmiss, coldmiss), aggregates (avg, max, min, sum, count, distinct, top (percentage from the most frequent value), p50 (median), p995 (99.5th percentile), etc.), score (cache-efficiency score), cost (estimated server CPU), bw (bytes transferred), req/clnt (requests per client), top% (share of requests from the busiest caller, as chosen by --top-by), split (1 for keys handled by several servers), and multi% (share of retrievals in multi-key requests) to display")
+	chunks     = flag.String("chunk-pattern", "", "fold keys of chunks of large values matching this regex into the key of their value, its first captured group, such as ^(.*)/[0-9]+$, counting chunks retrieved together on a connection as one retrieval")
+	chunkSpan  = flag.Duration("chunk-window", analysis.DefaultChunkWindow, "with --chunk-pattern, count chunks of a value retrieved on a connection within this long of each other as one retrieval")
+	topBy      = flag.String("top-by", "client", "callers among which the top% column finds the busiest of each key: client, conn for connections, or none")
+	keyTree    = flag.String("key-tree", "", "in the interactive interface, show keys as a tree split after each of these characters, such as :, pressing Enter to drill down and Backspace to go up")
 	interval   = flag.IntP("interval", "n", 1, "report top keys every this many seconds")
 	cumulative = flag.Bool("cumulative", false, "accumulate keys over all time instead of an interval")
+	decay      = flag.Duration("cumulative-decay", 0, "with --cumulative, drop keys not seen for this long, such as 30m (0 to keep all keys)")
 
-	noDelay = flag.Bool("nodelay", false, "replay from file at maximum speed instead of rate of original capture")
-	noGui   = flag.Bool("nogui", false, "disable interactive interface")
+	watch        = flag.StringSlice("watch", []string{}, "cache keys for which to record each value size")
+	growthAlert  = flag.Int("watch-growth-alert", 0, "warn when a watched value grows by this many bytes without shrinking (0 to disable)")
+	sampleValues = flag.Bool("sample-values", false, "allow pressing v in the detail view of a watched key to show the start of its next value, which may hold private data")
+	sampleBytes  = flag.Int("sample-bytes", analysis.DefaultValueSampleLen, fmt.Sprintf("bytes of a value shown by --sample-values, at most %d", analysis.MaxValueSampleLen))
+
+	amplificationRatio = flag.Float64("amplification-alert", analysis.DefaultAmplificationRatio, "warn when a connection receives this many times the bytes it sends (0 to disable)")
+	amplificationBytes = flag.Int64("amplification-alert-bytes", analysis.DefaultAmplificationBytes, "minimum response bytes in an interval for --amplification-alert to warn")
+
+	coldConnAge      = flag.Duration("cold-conn-age", analysis.DefaultColdConnAge, "count requests made this soon after their connection opened as cold, marking keys requested mostly that way")
+	coldConnShare    = flag.Float64("cold-conn-alert", analysis.DefaultColdConnShare, "warn when this fraction of the requests for a key are cold (0 to disable)")
+	coldConnRequests = flag.Int64("cold-conn-alert-requests", analysis.DefaultColdConnRequests, "minimum requests for a key in an interval for --cold-conn-alert to warn")
+
+	restartCloses = flag.Int("restart-closes", analysis.DefaultRestartCloses, "report a server restart when the server closes this many connections within --restart-window and its clients reconnect (0 to disable)")
+	restartWindow = flag.Duration("restart-window", analysis.DefaultRestartWindow, "period over which --restart-closes counts connections closed by a server")
+
+	sloLatency    = flag.Duration("slo-latency", 0, "check each interval against this latency SLO for retrievals, such as 2ms, warning on violations (0 to disable)")
+	sloPercentile = flag.Float64("slo-percentile", analysis.DefaultSLOPercentile, "percentile of retrieval latency held to --slo-latency")
+	sloWindow     = flag.Duration("slo-window", analysis.DefaultSLOWindow, "report the share of intervals complying with --slo-latency over this long")
+
+	ring     = flag.String("ring", "", "file listing the servers clients shard keys across, one address:port per line with an optional weight, to count requests sent to the wrong server")
+	ringHash = flag.String("ring-hash", "ketama", "hash algorithm of the --ring clients use (only ketama)")
+
+	referenceKeys = flag.String("reference-keys", "", "file listing the keys a new node is warmed from, one per line, to show the progress of its warmup")
+
+	strictInvariants    = flag.Bool("strict-invariants", false, "panic when a report breaks an invariant, such as listing a key twice, instead of repairing it (for development)")
+	unattributedSamples = flag.Int("debug-unattributed", 0, "log the start of this many responses that cannot be matched to a key")
+
+	scoreSizeWeight = flag.Float64("score-size-weight", analysis.DefaultScoreWeights.Size, "exponent applied to mean value size in the score column")
+	scoreMissWeight = flag.Float64("score-miss-weight", analysis.DefaultScoreWeights.Miss, "exponent applied to miss rate in the score column")
+	scoreRateWeight = flag.Float64("score-rate-weight", analysis.DefaultScoreWeights.Rate, "exponent applied to request count in the score column")
+	costHitWeight   = flag.Float64("cost-hit-weight", analysis.DefaultCostWeights.Hit, "cost of a get hit in the cost column")
+	costMissWeight  = flag.Float64("cost-miss-weight", analysis.DefaultCostWeights.Miss, "cost of a get miss in the cost column")
+	costSetWeight   = flag.Float64("cost-set-weight", analysis.DefaultCostWeights.Set, "cost of storing a value in the cost column")
+	costKBWeight    = flag.Float64("cost-kb-weight", analysis.DefaultCostWeights.KB, "cost of each kilobyte transferred in the cost column")
+
+	expiryTolerance = flag.Duration("expiry-tolerance", analysis.DefaultExpiryTolerance, "how long before a value's expected expiry a miss counts as an expiry miss")
+
+	dropThresholds = flag.String("drop-thresholds", "1,5,10", "percentages of packets dropped by a stage shown in yellow, in red, and in bold")
+
+	noDelay       = flag.Bool("nodelay", false, "replay from file at maximum speed instead of rate of original capture")
+	ui            = flag.String("ui", "auto", "how to show reports: termbox for the interactive interface, text to write them to stdout, or auto to use the interactive interface when stdout is a usable terminal")
+	noGui         = flag.Bool("nogui", false, "disable interactive interface (same as --ui=text)")
+	demo          = flag.Bool("demo", false, "show synthetic traffic instead of capturing, to try out the interactive interface")
+	output        = flag.StringP("output", "o", "text", "report format when the interactive interface is disabled (text, or mctop for mctop-compatible columns)")
+	reportArchive = flag.String("report-archive", "", "also write every report to compact archives in this directory, to be read by memsniff export or memsniff view")
+	archiveBackup = flag.String("report-archive-fallback", "", "write reports to archives in this directory, such as on local disk, while writes to --report-archive fail or stall, returning to --report-archive once it recovers")
+	archiveWait   = flag.Duration("report-archive-timeout", 5*time.Second, "how long a write to --report-archive may take before switching to --report-archive-fallback")
+	archiveMax    = flag.String("report-archive-max", "0", "disk space the archives of --report-archive may take, such as 500M, deleting the oldest to make room (0 for no cap beyond --disk-budget)")
+	compareDir    = flag.String("compare-archive", "", "show the change of each key since the same time the day before in the interactive interface, from the archives in this directory, usually that of --report-archive")
+	diskLimit     = flag.String("disk-budget", "0", "disk space all files written by memsniff may take together, such as 5G, deleting the oldest and pausing writes to stay within it (0 for no cap)")
+	fields        = flag.String("fields", "", "comma-separated columns of --format to include in text output and export, such as key,sum(size) (default all)")
+	numberStyle   = flag.String("number-format", "raw", "how numbers are written in the interactive interface and text output: raw (12345), human (12.3k, 1.2 MiB), or grouped (12,345) with the separators of the locale; exports are always raw")
+	textRows      = flag.Int("text-rows", 0, fmt.Sprintf("keys in each text report, busiest first (0 for all, or %d when text is chosen automatically)", fallbackTextRows))
 
 	displayVersion = flag.Bool("version", false, "display version information")
 )
@@ -49,6 +118,14 @@ func main() {
 		log.ConsoleLogger{}.Log(fmt.Sprintf("memsniff version %v (revision %v)", Version, GitRevision))
 		return
 	}
+	switch flag.Arg(0) {
+	case "compare":
+		os.Exit(runCompare(flag.Args()[1:], os.Stdout))
+	case "export":
+		os.Exit(runExport(flag.Args()[1:], os.Stdout))
+	case "view":
+		os.Exit(runView(flag.Args()[1:]))
+	}
 
 	// Actually execute startProfiling(), capture the returned function (which writes
 	// profiling results), and defer it to be executed when main() exits.
@@ -57,12 +134,26 @@ func main() {
 	buffered := &log.BufferLogger{}
 	logger.SetLogger(buffered)
 
-	analysisPool, err := analysis.New(*analysisWorkers, *format)
+	choice, err := chooseUI(*ui, *noGui, os.Getenv("TERM"), isTerminal(os.Stdout))
 	if err != nil {
 		log.ConsoleLogger{}.Log(err)
 		os.Exit(1)
 	}
-	if err = analysisPool.SetFilterPattern(*filter); err != nil {
+
+	if choice.mode == uiText && *output == "mctop" {
+		if flag.CommandLine.Changed("format") {
+			log.ConsoleLogger{}.Log("cannot combine --format with mctop output")
+			os.Exit(1)
+		}
+		if flag.CommandLine.Changed("fields") {
+			log.ConsoleLogger{}.Log("cannot combine --fields with mctop output")
+			os.Exit(1)
+		}
+		*format = presentation.MctopFormat
+	}
+
+	analysisPool, err := newAnalysisPool(*format)
+	if err != nil {
 		log.ConsoleLogger{}.Log(err)
 		os.Exit(1)
 	}
@@ -73,49 +164,308 @@ func main() {
 		os.Exit(1)
 	}
 
-	packetSource, err := capture.New(*netInterface, *infile, *bufferSize, *noDelay, *ports)
+	thresholds, err := presentation.ParseDropThresholds(*dropThresholds)
+	if err != nil {
+		log.ConsoleLogger{}.Log(err)
+		os.Exit(1)
+	}
+	numbers, err := numberFormat()
+	if err != nil {
+		log.ConsoleLogger{}.Log(err)
+		os.Exit(1)
+	}
+
+	updateInterval := time.Duration(*interval) * time.Second
+	if *demo {
+		if err := runDemo(choice, analysisPool, updateInterval, thresholds, numbers, buffered); err != nil {
+			logger.SetLogger(log.ConsoleLogger{})
+			buffered.WriteTo(logger)
+			logger.Log(err)
+		}
+		return
+	}
+
+	packetSource, err := capture.New(logger, *netInterface, *infile, *bufferSize, *noDelay, *ports, *retries)
 	if err != nil {
 		log.ConsoleLogger{}.Log(err)
 		os.Exit(2)
 	}
 
-	decodePool := decode.NewPool(logger, *decodeWorkers, packetSource, packetHandler(protocolType, analysisPool))
-	eofChan := make(chan struct{}, 1)
-	go func() {
-		decodePool.Run()
-		eofChan <- struct{}{}
-	}()
+	budget, archiveLimit, err := diskBudget()
+	if err != nil {
+		log.ConsoleLogger{}.Log(err)
+		os.Exit(1)
+	}
+	if *reportArchive != "" {
+		sink, err := archiveSink(budget, archiveLimit)
+		if err != nil {
+			log.ConsoleLogger{}.Log(err)
+			os.Exit(1)
+		}
+		defer sink.Close()
+		analysisPool.SetReportHook(archiveHook(sink))
+	} else if *archiveBackup != "" {
+		log.ConsoleLogger{}.Log("--report-archive-fallback requires --report-archive")
+		os.Exit(1)
+	}
+
+	if tr, ok := packetSource.(capture.TimestampReporter); ok {
+		logger.Log("Packet timestamps from", tr.TimestampSource())
+	}
+
+	parseBudget, err := numfmt.ParseSize(*connBudget)
+	if err != nil {
+		log.ConsoleLogger{}.Log("--conn-budget:", err)
+		os.Exit(1)
+	}
+
+	pl := newPipeline(logger, packetSource, analysisPool, protocolType, *ports, *decodeWorkers, *assemblyWorkers)
+	pl.assembly.SetWorkBudget(parseBudget)
+	if ifc, err := net.InterfaceByName(*netInterface); err == nil {
+		// frames beyond the interface MTU were coalesced before capture
+		pl.decode.SetMTU(ifc.MTU)
+	}
+	analysisPool.SetUpstreamDrops(func() (dropped, total int64) {
+		s := pl.decode.Stats()
+		return int64(s.PacketsDropped), int64(s.PacketsDropped + s.PacketsCaptured)
+	})
+	pl.start()
+	defer stopPipeline(pl)
+	meter := selfusage.New(logger, *selfCPULimit)
+	stats := presentation.NewStatTracker(statGenerator(packetSource, pl.decode, pl.assembly, analysisPool, budget, meter))
+	stats.OnEndInterval(pl.assembly.EndInterval)
+	stats.OnEndInterval(func() { meter.Sample() })
+	if *debugAddr != "" {
+		publishVars(pl, stats, budget)
+		serveDebug(*debugAddr)
+	}
 
-	if *noGui {
+	if choice.mode == uiTermbox {
+		var baseline presentation.Baseline
+		if *compareDir != "" {
+			baseline = archive.NewIndex(logger, *compareDir)
+		}
+		cui := presentation.New(analysisPool, updateInterval, *cumulative, stats, thresholds, "", *keyTree, numbers, baseline)
+
+		logger.SetLogger(cui)
+		go buffered.WriteTo(cui)
+
+		err := cui.Run()
+		if err == nil {
+			return
+		}
 		logger.SetLogger(log.ConsoleLogger{})
 		buffered.WriteTo(logger)
+		var ok bool
+		if _, isTerminalErr := err.(presentation.TerminalError); isTerminalErr {
+			choice, ok = choice.fallback(err)
+		}
+		if !ok {
+			if choice.forced {
+				err = fmt.Errorf("--ui=termbox: %v; use --ui=text for plain text reports", err)
+			}
+			logger.Log(err)
+			return
+		}
+	}
+
+	runText(choice, analysisPool, updateInterval, pl, stats, numbers, buffered)
+}
 
+// diskBudget returns the Budget of the files written by memsniff, as set by
+// --disk-budget, and the cap of the report archive within it.
+func diskBudget() (*diskbudget.Budget, int64, error) {
+	limit, err := numfmt.ParseSize(*diskLimit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("--disk-budget: %v", err)
+	}
+	archiveLimit, err := numfmt.ParseSize(*archiveMax)
+	if err != nil {
+		return nil, 0, fmt.Errorf("--report-archive-max: %v", err)
+	}
+	return diskbudget.New(limit, logger), archiveLimit, nil
+}
+
+// numberFormat returns the Formatter of numbers chosen by --number-format.
+func numberFormat() (numfmt.Formatter, error) {
+	style, err := numfmt.ParseStyle(*numberStyle)
+	if err != nil {
+		return numfmt.Formatter{}, fmt.Errorf("--number-format: %v", err)
+	}
+	return numfmt.New(style), nil
+}
+
+// runText writes text reports to stdout until interrupted or the end of the
+// capture.
+func runText(choice uiChoice, analysisPool *analysis.Pool, updateInterval time.Duration, pl *pipeline, stats *presentation.StatTracker, numbers numfmt.Formatter, buffered *log.BufferLogger) {
+	logger.SetLogger(log.ConsoleLogger{})
+	buffered.WriteTo(logger)
+	if notice := choice.notice(); notice != "" {
+		logger.Log(notice)
+	}
+
+	outputFormat := *output
+	if outputFormat == "mctop" && *format != presentation.MctopFormat {
+		// falling back from the interactive interface, for which the
+		// analysis Pool was set up
+		outputFormat = "text"
+	}
+	reporter, err := presentation.NewTextReporter(analysisPool, updateInterval, *cumulative, outputFormat, os.Stdout)
+	if err != nil {
+		logger.Log(err)
+		os.Exit(1)
+	}
+	rows := *textRows
+	if choice.reason != "" && !flag.CommandLine.Changed("text-rows") {
+		rows = fallbackTextRows
+	}
+	reporter.SetLimit(rows)
+	if err := reporter.SetFields(analysis.ParseFields(*fields)); err != nil {
+		logger.Log("--fields:", err)
+		os.Exit(1)
+	}
+	reporter.SetNumberFormat(numbers)
+	reporter.SetStatTracker(stats)
+
+	done := make(chan struct{})
+	go func() {
 		exitChan := make(chan os.Signal, 1)
 		signal.Notify(exitChan, os.Interrupt)
 		select {
 		case <-exitChan:
-		case <-eofChan:
+		case <-pl.eof:
 		}
-	} else {
-		updateInterval := time.Duration(*interval) * time.Second
-		statProvider := statGenerator(packetSource, decodePool, analysisPool)
-		cui := presentation.New(analysisPool, updateInterval, *cumulative, statProvider)
+		close(done)
+	}()
+	if err := reporter.Run(done); err != nil {
+		logger.Log(err)
+	}
+}
 
-		logger.SetLogger(cui)
-		go buffered.WriteTo(cui)
+var (
+	errSLOPercentile = errors.New("--slo-percentile must be greater than 0 and at most 100")
+	errSampleBytes   = fmt.Errorf("--sample-bytes must be between 1 and %d", analysis.MaxValueSampleLen)
+)
 
-		err := cui.Run()
+// newAnalysisPool returns an analysis.Pool reporting format, configured from
+// the command line.
+func newAnalysisPool(format string) (*analysis.Pool, error) {
+	analysisPool, err := analysis.New(*analysisWorkers, format)
+	if err != nil {
+		return nil, err
+	}
+	analysisPool.Logger = logger
+	analysisPool.SetWatchedKeys(*watch)
+	analysisPool.SetGrowthAlert(*growthAlert)
+	if *sampleValues {
+		if *sampleBytes < 1 || *sampleBytes > analysis.MaxValueSampleLen {
+			return nil, errSampleBytes
+		}
+		analysisPool.SetValueSampling(*sampleBytes)
+	}
+	analysisPool.SetUnattributedSamples(*unattributedSamples)
+	analysisPool.SetAmplificationAlert(*amplificationRatio, *amplificationBytes)
+	analysisPool.SetStrictInvariants(*strictInvariants)
+	analysisPool.SetColdConnAge(*coldConnAge)
+	analysisPool.SetColdConnAlert(*coldConnShare, *coldConnRequests)
+	analysisPool.SetRestartDetection(*restartCloses, *restartWindow)
+	if *sloPercentile <= 0 || *sloPercentile > 100 {
+		return nil, errSLOPercentile
+	}
+	analysisPool.SetLatencySLO(*sloLatency, *sloPercentile, *sloWindow)
+	analysisPool.SetScoreWeights(analysis.ScoreWeights{
+		Size: *scoreSizeWeight,
+		Miss: *scoreMissWeight,
+		Rate: *scoreRateWeight,
+	})
+	analysisPool.SetExpiryTolerance(*expiryTolerance)
+	contributor, err := analysis.ParseContributor(*topBy)
+	if err != nil {
+		return nil, err
+	}
+	analysisPool.SetTopContributor(contributor)
+	if *cumulative {
+		analysisPool.SetCumulativeDecay(*decay)
+	}
+	analysisPool.SetCostWeights(analysis.CostWeights{
+		Hit:  *costHitWeight,
+		Miss: *costMissWeight,
+		Set:  *costSetWeight,
+		KB:   *costKBWeight,
+	})
+	keyNormalization, err := analysis.ParseKeyNormalization(*normalize)
+	if err != nil {
+		return nil, err
+	}
+	analysisPool.SetKeyNormalization(keyNormalization)
+	if *classify != "" {
+		classifier, err := analysis.NewClassifier(*classify)
 		if err != nil {
-			logger.SetLogger(log.ConsoleLogger{})
-			buffered.WriteTo(logger)
-			logger.Log(err)
+			return nil, err
+		}
+		analysisPool.SetClassifier(classifier)
+	}
+	if *chunks != "" {
+		if err = analysisPool.SetChunkPattern(*chunks, *chunkSpan); err != nil {
+			return nil, fmt.Errorf("--chunk-pattern: %v", err)
+		}
+	}
+	if *ring != "" {
+		r, err := readRing(*ring, *ringHash)
+		if err != nil {
+			return nil, err
 		}
+		analysisPool.SetRing(r)
+	}
+	if *referenceKeys != "" {
+		ref, err := readReferenceKeys(*referenceKeys)
+		if err != nil {
+			return nil, err
+		}
+		analysisPool.SetReferenceKeys(ref)
+	}
+	if err = analysisPool.SetFilterPattern(*filter...); err != nil {
+		return nil, fmt.Errorf("--filter: %v", err)
+	}
+	return analysisPool, nil
+}
+
+// readRing builds the consistent-hash ring of the servers listed in the file
+// at path.
+func readRing(path, hash string) (*analysis.Ring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
+	servers, err := analysis.ReadRingServers(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return analysis.NewRing(hash, servers)
 }
 
-var stats presentation.Stats
+// readReferenceKeys reads the list of keys in the file at path.
+func readReferenceKeys(path string) (*analysis.ReferenceKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ref, err := analysis.ReadReferenceKeys(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ref, nil
+}
 
-func statGenerator(captureProvider capture.StatProvider, decodePool *decode.Pool, analysisPool *analysis.Pool) presentation.StatProvider {
+// statGenerator returns a StatProvider reading the counters of each stage of
+// the pipeline, and the resources used by memsniff as last sampled by meter.
+// The StatProvider keeps the last capture counters read, in
+// case the capture cannot supply them, and so must not be called
+// concurrently; a presentation.StatTracker ensures this.
+func statGenerator(captureProvider capture.StatProvider, decodePool *decode.Pool, assemblyPool *assembly.Pool, analysisPool *analysis.Pool, budget *diskbudget.Budget, meter *selfusage.Meter) presentation.StatProvider {
+	var stats presentation.Stats
 	return func() presentation.Stats {
 		captureStats, err := captureProvider.Stats()
 		if err == nil {
@@ -126,10 +476,42 @@ func statGenerator(captureProvider capture.StatProvider, decodePool *decode.Pool
 		decodeStats := decodePool.Stats()
 		stats.PacketsCaptured = decodeStats.PacketsCaptured
 		stats.PacketsDroppedParser = decodeStats.PacketsDropped
+		stats.PacketsFragmented = decodeStats.PacketsFragmented
+		stats.PacketsCoalesced = decodeStats.PacketsCoalesced
+		stats.PacketsLoopbackCopies = decodeStats.PacketsLoopbackCopies
+
+		assemblyStats := assemblyPool.Stats()
+		stats.ConnectionsReused = int(assemblyStats.ConnectionsReused)
+		stats.ProtocolReclassified = int(assemblyStats.ProtocolReclassified)
+		stats.ConnectionsThrottled = int(assemblyStats.ConnectionsThrottled)
+		stats.BytesThrottled = int(assemblyStats.BytesThrottled)
 
 		analysisStats := analysisPool.Stats()
 		stats.ResponsesParsed = int(analysisStats.EventsHandled)
 		stats.PacketsDroppedAnalysis = int(analysisStats.EventsDropped)
+		stats.KeysNormalized = int(analysisStats.KeysNormalized)
+		stats.DuplicateKeys = int(analysisStats.DuplicateKeys)
+		stats.ClassifierCost = analysisStats.ClassifierCost()
+
+		disk := budget.Usage()
+		stats.DiskUsed, stats.DiskLimit, stats.DiskPaused = disk.Bytes, disk.Limit, 0
+		for _, u := range disk.Sinks {
+			if u.Paused {
+				stats.DiskPaused++
+			}
+		}
+
+		self := meter.Last()
+		stats.SelfRSS, stats.SelfCPU, stats.SelfCPUOver = self.RSS, self.CPU, self.OverLimit
+		stats.SelfGCPause, stats.SelfGoroutines = self.GCPause, self.Goroutines
+
+		if hr, ok := captureProvider.(capture.HealthReporter); ok {
+			h := hr.Health()
+			stats.CaptureHealth = ""
+			if h.State != capture.Capturing {
+				stats.CaptureHealth = h.String()
+			}
+		}
 
 		stats.PacketsPassedFilter = stats.PacketsDroppedKernel + stats.PacketsCaptured
 		stats.PacketsDroppedTotal = stats.PacketsDroppedKernel + stats.PacketsDroppedParser + stats.PacketsDroppedAnalysis
@@ -138,12 +520,11 @@ func statGenerator(captureProvider capture.StatProvider, decodePool *decode.Pool
 	}
 }
 
-func packetHandler(protocol model.ProtocolType, analysisPool *analysis.Pool) func(dps []*decode.DecodedPacket) {
-	pool := assembly.New(logger, analysisPool, protocol, *ports, *assemblyWorkers)
-	return func(dps []*decode.DecodedPacket) {
-		err := pool.HandlePackets(dps)
-		if err != nil {
-			logger.Log(err)
-		}
+// stopPipeline shuts down pl, dumping the stacks of all goroutines if a stage
+// is stuck.
+func stopPipeline(pl *pipeline) {
+	if err := pl.stop(stopTimeout); err != nil {
+		log.ConsoleLogger{}.Log(err)
+		pprof.Lookup("goroutine").WriteTo(os.Stderr, 1)
 	}
 }
@@ -0,0 +1,267 @@
+// Package numfmt writes counts, byte sizes, rates, durations and percentages
+// for people to read, in one of several styles, and reads the byte sizes
+// people give.  Exports meant for other programs write numbers raw instead.
+package numfmt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Style is how a Formatter writes numbers.
+type Style int
+
+const (
+	// Raw writes numbers in full without separators, as in 12345.
+	Raw Style = iota
+	// Human abbreviates numbers of 1000 or more, as in 12.3k, and byte
+	// sizes of 1024 or more, as in 1.2 MiB.
+	Human
+	// Grouped writes numbers in full with thousands separators, as in
+	// 12,345.
+	Grouped
+)
+
+var styleNames = []string{"raw", "human", "grouped"}
+
+func (s Style) String() string {
+	if s < 0 || int(s) >= len(styleNames) {
+		return fmt.Sprintf("Style(%d)", int(s))
+	}
+	return styleNames[s]
+}
+
+// ParseStyle returns the Style named by name, one of raw, human or grouped.
+func ParseStyle(name string) (Style, error) {
+	for i, n := range styleNames {
+		if n == name {
+			return Style(i), nil
+		}
+	}
+	return Raw, fmt.Errorf("unknown number format %q; valid formats are %s", name, strings.Join(styleNames, ", "))
+}
+
+var errSize = errors.New("size must be a number of bytes, optionally followed by K, M, G or T, such as 500M")
+
+// ParseSize returns the number of bytes in s, a whole number followed by an
+// optional K, M, G or T for KiB, MiB, GiB or TiB, such as 5G.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	shift := uint(0)
+	if i := len(s) - 1; i >= 0 {
+		if u := strings.IndexByte("KMGT", s[i]); u >= 0 {
+			shift = 10 * uint(u+1)
+			s = s[:i]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)>>shift {
+		return 0, errSize
+	}
+	return n << shift, nil
+}
+
+// Separators are the characters a locale writes between groups of thousands
+// and before the fraction of a number.
+type Separators struct {
+	Thousands string
+	Decimal   string
+}
+
+// DefaultSeparators are those of English, used for unknown locales.
+var DefaultSeparators = Separators{",", "."}
+
+// nbsp separates thousands where a language uses spaces, so that numbers are
+// not split across lines.
+const nbsp = "\u00a0"
+
+// localeSeparators lists the separators of languages that differ from
+// DefaultSeparators.
+var localeSeparators = map[string]Separators{
+	"da": {".", ","}, "de": {".", ","}, "el": {".", ","}, "es": {".", ","},
+	"id": {".", ","}, "it": {".", ","}, "nl": {".", ","}, "pt": {".", ","},
+	"ro": {".", ","}, "tr": {".", ","},
+	"cs": {nbsp, ","}, "fi": {nbsp, ","}, "fr": {nbsp, ","},
+	"hu": {nbsp, ","}, "nb": {nbsp, ","}, "pl": {nbsp, ","},
+	"ru": {nbsp, ","}, "sk": {nbsp, ","}, "sv": {nbsp, ","},
+	"uk": {nbsp, ","},
+}
+
+// LocaleSeparators returns the separators of a POSIX locale name such as
+// de_DE.UTF-8, which are DefaultSeparators for C, POSIX and unknown locales.
+func LocaleSeparators(locale string) Separators {
+	lang := locale
+	if i := strings.IndexAny(lang, "_.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if seps, ok := localeSeparators[strings.ToLower(lang)]; ok {
+		return seps
+	}
+	return DefaultSeparators
+}
+
+// EnvLocale returns the locale of numbers named by the environment, from the
+// first of LC_ALL, LC_NUMERIC and LANG that is set.
+func EnvLocale() string {
+	for _, v := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+		if l := os.Getenv(v); l != "" {
+			return l
+		}
+	}
+	return ""
+}
+
+// Formatter writes numbers in a Style.  Raw numbers are always written with
+// DefaultSeparators, so that they can be pasted into other programs; other
+// styles use Separators, or DefaultSeparators if it is zero.  The zero
+// Formatter writes numbers raw.
+type Formatter struct {
+	Style Style
+	Separators
+}
+
+// New returns a Formatter writing numbers in style, with the separators of
+// the locale named by the environment.
+func New(style Style) Formatter {
+	return Formatter{style, LocaleSeparators(EnvLocale())}
+}
+
+func (f Formatter) separators() Separators {
+	if f.Style == Raw || f.Separators == (Separators{}) {
+		return DefaultSeparators
+	}
+	return f.Separators
+}
+
+// countUnits and byteUnits are the suffixes of successive powers of 1000 and
+// 1024, up to beyond the largest int64.
+var (
+	countUnits = []string{"", "k", "M", "G", "T", "P", "E"}
+	byteUnits  = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+)
+
+// Count writes a number of things, as in 12345, 12.3k or 12,345.
+func (f Formatter) Count(n int64) string {
+	switch f.Style {
+	case Human:
+		if n > -1000 && n < 1000 {
+			return strconv.FormatInt(n, 10)
+		}
+		return f.scaled(float64(n), 1000, countUnits, "")
+	case Grouped:
+		return f.group(strconv.FormatInt(n, 10))
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
+
+// Bytes writes a number of bytes, as in 1234567, 1.2 MiB or 1,234,567.
+func (f Formatter) Bytes(n int64) string {
+	if f.Style == Human {
+		if n > -1024 && n < 1024 {
+			return strconv.FormatInt(n, 10) + " B"
+		}
+		return f.scaled(float64(n), 1024, byteUnits, " ")
+	}
+	return f.Count(n)
+}
+
+// ByteSize writes a number of bytes with its unit, for use in prose, as in
+// 1234567 bytes, 1.2 MiB or 1,234,567 bytes.
+func (f Formatter) ByteSize(n int64) string {
+	if f.Style == Human {
+		return f.Bytes(n)
+	}
+	return f.Count(n) + " bytes"
+}
+
+// Rate writes a number of things per second, as in 1234.5/s, 1.2k/s or
+// 1,234.5/s.
+func (f Formatter) Rate(perSec float64) string {
+	return f.Float(perSec, 1) + "/s"
+}
+
+// Float writes v with prec digits after the decimal separator, abbreviating
+// it as Count does.
+func (f Formatter) Float(v float64, prec int) string {
+	switch f.Style {
+	case Human:
+		s := strconv.FormatFloat(v, 'f', prec, 64)
+		if r, _ := strconv.ParseFloat(s, 64); math.Abs(r) >= 1000 {
+			return f.scaled(v, 1000, countUnits, "")
+		}
+		return f.decimal(s)
+	case Grouped:
+		return f.group(strconv.FormatFloat(v, 'f', prec, 64))
+	default:
+		return strconv.FormatFloat(v, 'f', prec, 64)
+	}
+}
+
+// Percent writes pct, out of 100, with prec digits after the decimal
+// separator.  Percentages are never abbreviated.
+func (f Formatter) Percent(pct float64, prec int) string {
+	return f.decimal(strconv.FormatFloat(pct, 'f', prec, 64)) + "%"
+}
+
+// Duration writes d without trailing zero units: 30m rather than 30m0s.
+// Durations are written alike in every style.
+func Duration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// scaled writes v, which is at least base in magnitude, with one decimal in
+// the largest of units it reaches, separated from the unit by sep.  A value
+// that would round up to base in one unit is written in the next, so that
+// 999,950 is 1.0M rather than 1000.0k.
+func (f Formatter) scaled(v, base float64, units []string, sep string) string {
+	i := 0
+	for i == 0 || (i < len(units)-1 && math.Abs(v) >= base-0.05) {
+		v /= base
+		i++
+	}
+	return f.decimal(strconv.FormatFloat(v, 'f', 1, 64)) + sep + units[i]
+}
+
+// decimal replaces the decimal point of s with the decimal separator.
+func (f Formatter) decimal(s string) string {
+	if d := f.separators().Decimal; d != "." {
+		s = strings.Replace(s, ".", d, 1)
+	}
+	return s
+}
+
+// group inserts thousands separators into the integer part of s, a number
+// written by strconv, and replaces its decimal point.
+func (f Formatter) group(s string) string {
+	seps := f.separators()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	frac := ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, frac = s[:i], seps.Decimal+s[i+1:]
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteString(seps.Thousands)
+		}
+		b.WriteRune(c)
+	}
+	return b.String() + frac
+}
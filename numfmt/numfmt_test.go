@@ -0,0 +1,193 @@
+package numfmt
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var (
+	raw     = Formatter{}
+	human   = Formatter{Style: Human}
+	grouped = Formatter{Style: Grouped}
+	german  = Formatter{Human, LocaleSeparators("de_DE.UTF-8")}
+)
+
+func TestCount(t *testing.T) {
+	cases := []struct {
+		n                   int64
+		raw, human, grouped string
+	}{
+		{0, "0", "0", "0"},
+		{999, "999", "999", "999"},
+		{1000, "1000", "1.0k", "1,000"},
+		{-999, "-999", "-999", "-999"},
+		{-1000, "-1000", "-1.0k", "-1,000"},
+		{12345, "12345", "12.3k", "12,345"},
+		{999949, "999949", "999.9k", "999,949"},
+		{999950, "999950", "1.0M", "999,950"},
+		{1000000, "1000000", "1.0M", "1,000,000"},
+		{999950000, "999950000", "1.0G", "999,950,000"},
+		{math.MaxInt64, "9223372036854775807", "9.2E", "9,223,372,036,854,775,807"},
+		{math.MinInt64, "-9223372036854775808", "-9.2E", "-9,223,372,036,854,775,808"},
+	}
+	for _, c := range cases {
+		if s := raw.Count(c.n); s != c.raw {
+			t.Errorf("raw %d: %q", c.n, s)
+		}
+		if s := human.Count(c.n); s != c.human {
+			t.Errorf("human %d: %q", c.n, s)
+		}
+		if s := grouped.Count(c.n); s != c.grouped {
+			t.Errorf("grouped %d: %q", c.n, s)
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	cases := []struct {
+		n                   int64
+		raw, human, grouped string
+	}{
+		{0, "0", "0 B", "0"},
+		{1023, "1023", "1023 B", "1,023"},
+		{1024, "1024", "1.0 KiB", "1,024"},
+		{1258291, "1258291", "1.2 MiB", "1,258,291"},
+		{1048524, "1048524", "1023.9 KiB", "1,048,524"},
+		{1048525, "1048525", "1.0 MiB", "1,048,525"},
+		{math.MaxInt64, "9223372036854775807", "8.0 EiB", "9,223,372,036,854,775,807"},
+	}
+	for _, c := range cases {
+		if s := raw.Bytes(c.n); s != c.raw {
+			t.Errorf("raw %d: %q", c.n, s)
+		}
+		if s := human.Bytes(c.n); s != c.human {
+			t.Errorf("human %d: %q", c.n, s)
+		}
+		if s := grouped.Bytes(c.n); s != c.grouped {
+			t.Errorf("grouped %d: %q", c.n, s)
+		}
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	if s := raw.ByteSize(2097152); s != "2097152 bytes" {
+		t.Error(s)
+	}
+	if s := human.ByteSize(2097152); s != "2.0 MiB" {
+		t.Error(s)
+	}
+	if s := grouped.ByteSize(2097152); s != "2,097,152 bytes" {
+		t.Error(s)
+	}
+}
+
+func TestRate(t *testing.T) {
+	cases := []struct {
+		v                   float64
+		raw, human, grouped string
+	}{
+		{0, "0.0/s", "0.0/s", "0.0/s"},
+		{999.94, "999.9/s", "999.9/s", "999.9/s"},
+		{999.96, "1000.0/s", "1.0k/s", "1,000.0/s"},
+		{1234.5, "1234.5/s", "1.2k/s", "1,234.5/s"},
+	}
+	for _, c := range cases {
+		if s := raw.Rate(c.v); s != c.raw {
+			t.Errorf("raw %v: %q", c.v, s)
+		}
+		if s := human.Rate(c.v); s != c.human {
+			t.Errorf("human %v: %q", c.v, s)
+		}
+		if s := grouped.Rate(c.v); s != c.grouped {
+			t.Errorf("grouped %v: %q", c.v, s)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	if s := raw.Percent(42.25, 1); s != "42.2%" {
+		t.Error(s)
+	}
+	if s := human.Percent(1234, 0); s != "1234%" {
+		t.Error("percentages should not be abbreviated:", s)
+	}
+	if s := german.Percent(42.25, 1); s != "42,2%" {
+		t.Error(s)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	cases := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{0, "0s"},
+		{30 * time.Minute, "30m"},
+		{2 * time.Hour, "2h"},
+		{90 * time.Minute, "1h30m"},
+		{1500 * time.Millisecond, "1.5s"},
+	}
+	for _, c := range cases {
+		if s := Duration(c.d); s != c.expected {
+			t.Errorf("%v: %q", c.d, s)
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	if s := german.Count(12345); s != "12,3k" {
+		t.Error(s)
+	}
+	de := Formatter{Grouped, LocaleSeparators("de_DE.UTF-8")}
+	if s := de.Rate(1234.5); s != "1.234,5/s" {
+		t.Error(s)
+	}
+	fr := Formatter{Grouped, LocaleSeparators("fr_FR@euro")}
+	if s := fr.Count(1234567); s != "1\u00a0234\u00a0567" {
+		t.Errorf("%q", s)
+	}
+	if seps := LocaleSeparators("C"); seps != DefaultSeparators {
+		t.Error(seps)
+	}
+	// raw numbers ignore the locale
+	if s := (Formatter{Raw, de.Separators}).Rate(1234.5); s != "1234.5/s" {
+		t.Error(s)
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	for _, s := range []Style{Raw, Human, Grouped} {
+		if parsed, err := ParseStyle(s.String()); err != nil || parsed != s {
+			t.Error(s, parsed, err)
+		}
+	}
+	if _, err := ParseStyle("fancy"); err == nil || err.Error() != `unknown number format "fancy"; valid formats are raw, human, grouped` {
+		t.Error(err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		s    string
+		want int64
+	}{
+		{"0", 0},
+		{"4096", 4096},
+		{"500M", 500 << 20},
+		{"5g", 5 << 30},
+		{"2GiB", 2 << 30},
+		{"1KB", 1024},
+		{"8T", 8 << 40},
+	}
+	for _, c := range cases {
+		if got, err := ParseSize(c.s); err != nil || got != c.want {
+			t.Errorf("%q: %d, %v", c.s, got, err)
+		}
+	}
+	for _, bad := range []string{"", "G", "-1", "1.5G", "5X", "9000000T"} {
+		if _, err := ParseSize(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/assembly"
+	"github.com/box/memsniff/capture"
+	"github.com/box/memsniff/decode"
+	"github.com/box/memsniff/log"
+	"github.com/box/memsniff/protocol/model"
+)
+
+// stopTimeout bounds the time each stage of a pipeline may take to stop.
+const stopTimeout = 5 * time.Second
+
+// pipeline carries packets from a PacketSource through decoding, TCP
+// reassembly, and protocol parsing to an analysis.Pool.
+type pipeline struct {
+	src      capture.PacketSource
+	decode   *decode.Pool
+	assembly *assembly.Pool
+	analysis *analysis.Pool
+	// eof is closed once decoding stops, at the end of input or after stop.
+	eof chan struct{}
+}
+
+func newPipeline(logger log.Logger, src capture.PacketSource, analysisPool *analysis.Pool, protocol model.ProtocolType, ports []int, decodeWorkers, assemblyWorkers int) *pipeline {
+	pl := &pipeline{
+		src:      src,
+		assembly: assembly.New(logger, analysisPool, protocol, ports, assemblyWorkers),
+		analysis: analysisPool,
+		eof:      make(chan struct{}),
+	}
+	pl.decode = decode.NewPool(logger, decodeWorkers, src, func(dps []*decode.DecodedPacket) {
+		if err := pl.assembly.HandlePackets(dps); err != nil {
+			logger.Log(err)
+		}
+	})
+	return pl
+}
+
+// start begins capturing packets in the background.
+func (pl *pipeline) start() {
+	go func() {
+		pl.decode.Run()
+		close(pl.eof)
+	}()
+}
+
+// stage is a step of shutting down a pipeline.
+type stage struct {
+	name string
+	stop func()
+}
+
+// stop shuts down each stage in turn, so that every stage has delivered all
+// of its output before the next one is closed.  The analysis.Pool is closed
+// last, after which it must not be used to build reports.
+//
+// If a stage does not stop within timeout, stop returns an error naming it
+// and leaves later stages running.
+func (pl *pipeline) stop(timeout time.Duration) error {
+	return stopStages(timeout, append(pl.inputStages(), stage{"analysis", pl.analysis.Close}))
+}
+
+// drain is like stop, but leaves the analysis.Pool running so that it can
+// report on everything captured.
+func (pl *pipeline) drain(timeout time.Duration) error {
+	return stopStages(timeout, pl.inputStages())
+}
+
+// inputStages lists the stages feeding the analysis.Pool in shutdown order.
+func (pl *pipeline) inputStages() []stage {
+	return []stage{
+		{"decode", pl.decode.Stop},
+		{"capture", pl.closeSource},
+		{"assembly", pl.assembly.Close},
+	}
+}
+
+func stopStages(timeout time.Duration, stages []stage) error {
+	for _, s := range stages {
+		done := make(chan struct{})
+		go func(stop func()) {
+			stop()
+			close(done)
+		}(s.stop)
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			return fmt.Errorf("%s stage did not stop within %v", s.name, timeout)
+		}
+	}
+	return nil
+}
+
+// closeSource releases the capture handle, if the source has one.
+func (pl *pipeline) closeSource() {
+	if c, ok := pl.src.(interface {
+		Close()
+	}); ok {
+		c.Close()
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/capture"
+	"github.com/box/memsniff/decode"
+	"github.com/box/memsniff/protocol/model"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (tl testLogger) Log(items ...interface{}) {
+	tl.t.Log(items...)
+}
+
+// loopbackSource replays a single memcached get over 127.0.0.1, then waits
+// for packets that never arrive, like an idle live capture.
+type loopbackSource struct {
+	packets [][]byte
+	// delivered is closed once the packets have been collected.
+	delivered chan struct{}
+	// timestamps, if set, are the capture times of packets, as read from a
+	// capture file.  Otherwise packets are stamped as they are collected,
+	// as in a live capture.
+	timestamps []time.Time
+}
+
+func newLoopbackSource(t *testing.T) *loopbackSource {
+	return &loopbackSource{packets: getConversation(t, 100, 200, "foo", "bar"), delivered: make(chan struct{})}
+}
+
+// getConversation returns the packets of a connection from port 40000 to
+// memcached on which key is retrieved, with value, starting from the given
+// initial sequence numbers.  The connection is left open.
+func getConversation(t *testing.T, clientSeq, serverSeq uint32, key, value string) [][]byte {
+	const client, server = 40000, 11211
+	return [][]byte{
+		tcpPacket(t, client, server, clientSeq, layers.TCP{SYN: true}, ""),
+		tcpPacket(t, server, client, serverSeq, layers.TCP{SYN: true, ACK: true}, ""),
+		tcpPacket(t, client, server, clientSeq+1, layers.TCP{ACK: true}, "get "+key+"\r\n"),
+		tcpPacket(t, server, client, serverSeq+1, layers.TCP{ACK: true}, fmt.Sprintf("VALUE %s 0 %d\r\n%s\r\nEND\r\n", key, len(value), value)),
+	}
+}
+
+func tcpPacket(t *testing.T, src, dst layers.TCPPort, seq uint32, tcp layers.TCP, payload string) []byte {
+	lo := net.IP{127, 0, 0, 1}
+	eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, 0}, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 0}, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: lo, DstIP: lo}
+	tcp.SrcPort, tcp.DstPort, tcp.Seq, tcp.DataOffset, tcp.Window = src, dst, seq, 5, 65535
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, eth, ip, &tcp, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func (ls *loopbackSource) CollectPackets(pb *capture.PacketBuffer) error {
+	pb.Clear()
+	if len(ls.packets) == 0 {
+		time.Sleep(time.Millisecond)
+		return pcap.NextErrorTimeoutExpired
+	}
+	for i, p := range ls.packets {
+		ts := time.Now()
+		if ls.timestamps != nil {
+			ts = ls.timestamps[i]
+		}
+		ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(p), Length: len(p)}
+		if err := pb.Append(capture.PacketData{Info: ci, Data: p}); err != nil {
+			return err
+		}
+	}
+	ls.packets = nil
+	close(ls.delivered)
+	return nil
+}
+
+func (ls *loopbackSource) DiscardPacket() error {
+	time.Sleep(time.Millisecond)
+	return pcap.NextErrorTimeoutExpired
+}
+
+func (ls *loopbackSource) Stats() (*pcap.Stats, error) {
+	return &pcap.Stats{}, nil
+}
+
+// TestPipelineStop starts and stops the full pipeline repeatedly, checking
+// that events in flight are delivered and that no goroutines are left behind.
+func TestPipelineStop(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		analysisPool, err := analysis.New(4, "key,sum(size)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := newLoopbackSource(t)
+		pl := newPipeline(testLogger{t}, src, analysisPool, model.ProtocolMemcacheText, []int{11211}, 2, 2)
+		pl.start()
+		select {
+		case <-src.delivered:
+		case <-time.After(time.Second):
+			t.Fatal("packets not collected")
+		}
+		if err := pl.stop(time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if n := analysisPool.Stats().EventsHandled; n != 1 {
+			t.Error("events handled:", n, pl.decode.Stats())
+		}
+	}
+
+	// goroutines used to wait on each stage may still be returning
+	deadline := time.Now().Add(time.Second)
+	after := runtime.NumGoroutine()
+	for after != before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		after = runtime.NumGoroutine()
+	}
+	if after != before {
+		buf := make([]byte, 1<<16)
+		t.Errorf("pipeline left behind %d goroutines:\n%s", after-before, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+// TestPipelineDrain checks that a drained pipeline's analysis.Pool still
+// reports everything captured.
+func TestPipelineDrain(t *testing.T) {
+	analysisPool, err := analysis.New(4, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newLoopbackSource(t)
+	pl := newPipeline(testLogger{t}, src, analysisPool, model.ProtocolMemcacheText, []int{11211}, 2, 2)
+	pl.start()
+	select {
+	case <-src.delivered:
+	case <-time.After(time.Second):
+		t.Fatal("packets not collected")
+	}
+	if err := pl.drain(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	rep := analysisPool.Report(false)
+	analysisPool.Close()
+	if len(rep.Rows) != 1 || rep.Rows[0].Key[0] != "foo" || rep.Rows[0].Values[0] != 3 {
+		t.Error(rep.Rows)
+	}
+}
+
+// TestPipelineConnectionReuse checks that a connection reusing the addresses
+// and ports of one whose end was not seen is parsed separately, rather than as
+// a continuation of the first.
+func TestPipelineConnectionReuse(t *testing.T) {
+	analysisPool, err := analysis.New(4, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets := append(getConversation(t, 100, 200, "foo", "bar"), getConversation(t, 7000, 9000, "baz", "quux")...)
+	src := &loopbackSource{packets: packets, delivered: make(chan struct{})}
+	pl := newPipeline(testLogger{t}, src, analysisPool, model.ProtocolMemcacheText, []int{11211}, 2, 2)
+	pl.start()
+	select {
+	case <-src.delivered:
+	case <-time.After(time.Second):
+		t.Fatal("packets not collected")
+	}
+	if err := pl.drain(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	rep := analysisPool.Report(false)
+	analysisPool.Close()
+	rep.SortBy(0)
+	if len(rep.Rows) != 2 || rep.Rows[0].Key[0] != "baz" || rep.Rows[0].Values[0] != 4 ||
+		rep.Rows[1].Key[0] != "foo" || rep.Rows[1].Values[0] != 3 {
+		t.Error(rep.Rows)
+	}
+	if n := pl.assembly.Stats().ConnectionsReused; n != 1 {
+		t.Error("connections reused:", n)
+	}
+}
+
+// runToReport passes the packets of src through the full pipeline, returning
+// the report built once they have been analyzed.
+func runToReport(t *testing.T, src *loopbackSource) analysis.Report {
+	rep, _ := runToStats(t, src)
+	return rep
+}
+
+// runToStats is runToReport, also returning the statistics of decoding.
+func runToStats(t *testing.T, src *loopbackSource) (analysis.Report, decode.Stats) {
+	rep, pl := runPipeline(t, src, func(*pipeline) {})
+	return rep, pl.decode.Stats()
+}
+
+// runPipeline is runToReport, calling setup on the pipeline before it starts,
+// and returning the pipeline once drained.
+func runPipeline(t *testing.T, src *loopbackSource, setup func(*pipeline)) (analysis.Report, *pipeline) {
+	analysisPool, err := analysis.New(4, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer analysisPool.Close()
+	pl := newPipeline(testLogger{t}, src, analysisPool, model.ProtocolMemcacheText, []int{11211}, 2, 2)
+	setup(pl)
+	pl.start()
+	select {
+	case <-src.delivered:
+	case <-time.After(time.Second):
+		t.Fatal("packets not collected")
+	}
+	if err := pl.drain(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return analysisPool.Report(true), pl
+}
+
+// TestPipelineOfflineTimestamps checks that a report of packets read from a
+// capture file is stamped with the capture time of the last response, not the
+// time it was analyzed.
+func TestPipelineOfflineTimestamps(t *testing.T) {
+	src := newLoopbackSource(t)
+	start := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	for i := range src.packets {
+		src.timestamps = append(src.timestamps, start.Add(time.Duration(i)*time.Millisecond))
+	}
+	rep := runToReport(t, src)
+	if want := start.Add(3 * time.Millisecond); !rep.Timestamp.Equal(want) {
+		t.Errorf("report at %v, want %v", rep.Timestamp, want)
+	}
+}
+
+// TestPipelineLiveTimestamps checks that a report of a live capture is stamped
+// with the time packets were captured.
+func TestPipelineLiveTimestamps(t *testing.T) {
+	before := time.Now()
+	rep := runToReport(t, newLoopbackSource(t))
+	if rep.Timestamp.Before(before) || rep.Timestamp.After(time.Now()) {
+		t.Errorf("report at %v, captured after %v", rep.Timestamp, before)
+	}
+}
+
+// anyInterface rewrites Ethernet frames captured on lo as the Linux any
+// pseudo-interface delivers them: each twice, in a cooked header, first as
+// sent and then as received.
+func anyInterface(frames [][]byte) [][]byte {
+	const ethHeader, arphrdLoopback = 14, 772
+	var packets [][]byte
+	for _, f := range frames {
+		for _, pktType := range []layers.LinuxSLLPacketType{layers.LinuxSLLPacketTypeOutgoing, layers.LinuxSLLPacketTypeHost} {
+			sll := make([]byte, 16, 16+len(f)-ethHeader)
+			binary.BigEndian.PutUint16(sll[0:], uint16(pktType))
+			binary.BigEndian.PutUint16(sll[2:], arphrdLoopback)
+			binary.BigEndian.PutUint16(sll[4:], 6)
+			copy(sll[14:], f[12:ethHeader])
+			packets = append(packets, append(sll, f[ethHeader:]...))
+		}
+	}
+	return packets
+}
+
+// TestPipelineAnyInterface checks that traffic to a local memcached captured
+// on the any pseudo-interface, which sees each packet twice, is counted as
+// when captured on lo alone.
+func TestPipelineAnyInterface(t *testing.T) {
+	frames := append(getConversation(t, 100, 200, "foo", "bar"), getConversation(t, 7000, 9000, "baz", "quux")...)
+	lo := runToReport(t, &loopbackSource{packets: frames, delivered: make(chan struct{})})
+	any, stats := runToStats(t, &loopbackSource{packets: anyInterface(frames), delivered: make(chan struct{})})
+	lo.SortBy(0)
+	any.SortBy(0)
+	if len(lo.Rows) != 2 || !reflect.DeepEqual(any.Rows, lo.Rows) {
+		t.Errorf("on any: %v\non lo: %v", any.Rows, lo.Rows)
+	}
+	// reassembly would discard most copies as retransmissions, but not
+	// before they were decoded and handled
+	if stats.PacketsLoopbackCopies != len(frames) {
+		t.Errorf("%d copies ignored of %d packets", stats.PacketsLoopbackCopies, len(frames))
+	}
+}
+
+// floodConversation returns the packets of a connection from clientPort to
+// memcached on which a client stuck retrying retrieves key n times, with a
+// one-byte value.
+func floodConversation(t *testing.T, clientPort layers.TCPPort, key string, n int) [][]byte {
+	const server = 11211
+	request := "get " + key + "\r\n"
+	response := "VALUE " + key + " 0 1\r\nx\r\nEND\r\n"
+	clientSeq, serverSeq := uint32(100), uint32(200)
+	packets := [][]byte{
+		tcpPacket(t, clientPort, server, clientSeq, layers.TCP{SYN: true}, ""),
+		tcpPacket(t, server, clientPort, serverSeq, layers.TCP{SYN: true, ACK: true}, ""),
+	}
+	clientSeq, serverSeq = clientSeq+1, serverSeq+1
+	for i := 0; i < n; i++ {
+		packets = append(packets,
+			tcpPacket(t, clientPort, server, clientSeq, layers.TCP{ACK: true}, request),
+			tcpPacket(t, server, clientPort, serverSeq, layers.TCP{ACK: true}, response))
+		clientSeq += uint32(len(request))
+		serverSeq += uint32(len(response))
+	}
+	return packets
+}
+
+// TestPipelineWorkBudget checks that the parse budget of each connection
+// bounds the load a single flooding connection puts on analysis, however much
+// it sends, while other connections are parsed in full.
+func TestPipelineWorkBudget(t *testing.T) {
+	frames := append(floodConversation(t, 40001, "spam", 400), getConversation(t, 100, 200, "foo", "bar")...)
+	for _, budget := range []int64{0, 1024} {
+		src := &loopbackSource{packets: frames, delivered: make(chan struct{})}
+		rep, pl := runPipeline(t, src, func(pl *pipeline) {
+			pl.assembly.SetWorkBudget(budget)
+		})
+		values := make(map[string]int64)
+		for _, row := range rep.Rows {
+			values[row.Key[0]] = row.Values[0]
+		}
+		if values["foo"] != 3 {
+			t.Errorf("budget %d: other connection not parsed: %v", budget, values)
+		}
+		stats, throttled := pl.analysis.Stats(), pl.assembly.Stats()
+		if stats.EventsDropped != 0 {
+			t.Errorf("budget %d: analysis dropped %d events", budget, stats.EventsDropped)
+		}
+		if budget == 0 {
+			if values["spam"] != 400 || throttled.ConnectionsThrottled != 0 {
+				t.Errorf("throttled without budget: %v %+v", values, throttled)
+			}
+			continue
+		}
+		// whole packets are parsed until the budget is spent
+		if values["spam"] > 1024/34+1 || stats.EventsHandled > 40 {
+			t.Errorf("flood parsed: %v, %d events handled", values, stats.EventsHandled)
+		}
+		if throttled.ConnectionsThrottled != 1 || throttled.BytesThrottled == 0 {
+			t.Errorf("throttled: %+v", throttled)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package presentation
+
+import (
+	"github.com/box/memsniff/analysis"
+	"sort"
+	"strings"
+)
+
+// keyOf returns the value of the "key" column of row, and whether rep has
+// such a column.
+func keyOf(rep analysis.Report, row analysis.ReportRow) (string, bool) {
+	for i, name := range rep.KeyColNames {
+		if name == "key" {
+			return row.Key[i], true
+		}
+	}
+	return "", false
+}
+
+// isAcked returns true if row is for an acknowledged key.
+func (u *uiContext) isAcked(rep analysis.Report, row analysis.ReportRow) bool {
+	key, ok := keyOf(rep, row)
+	return ok && u.acked[key]
+}
+
+// displayed returns the most recent report as shown, without acknowledged
+// keys if they are hidden, and rolled up to the current node of the key tree
+// if there is one.
+func (u *uiContext) displayed() analysis.Report {
+	rep := u.prevReport
+	if u.hideAcked && len(u.acked) > 0 {
+		rows := make([]analysis.ReportRow, 0, len(rep.Rows))
+		for _, r := range rep.Rows {
+			if !u.isAcked(rep, r) {
+				rows = append(rows, r)
+			}
+		}
+		rep.Rows = rows
+	}
+	if u.keyTree != "" {
+		rep = u.rollUp(rep)
+	}
+	return rep
+}
+
+// handleAck acknowledges the highlighted key, or stops acknowledging it if it
+// already was.
+func (u *uiContext) handleAck() error {
+	rep := u.displayed()
+	if u.connView || u.misrouteView || u.detailKey != nil || u.selected >= len(rep.Rows) {
+		return nil
+	}
+	key, ok := keyOf(rep, rep.Rows[u.selected])
+	if !ok {
+		u.Log("Keys can only be acknowledged when the format includes key")
+		return nil
+	}
+	if !u.isTreeKey(rep, rep.Rows[u.selected]) {
+		u.Log("Only keys can be acknowledged, not", key)
+		return nil
+	}
+	if u.acked[key] {
+		u.unack(sourceKeyboard, key)
+	} else {
+		u.ack(sourceKeyboard, key)
+	}
+	return u.render()
+}
+
+// handleHideAcked switches between dimming and hiding acknowledged keys.
+func (u *uiContext) handleHideAcked() error {
+	u.hideAcked = !u.hideAcked
+	if u.hideAcked {
+		u.analysis.RecordConfigChange(sourceKeyboard, "hideacked", "on")
+		u.Log("Hiding acknowledged keys")
+	} else {
+		u.analysis.RecordConfigChange(sourceKeyboard, "hideacked", "off")
+		u.Log("Showing acknowledged keys")
+	}
+	return u.render()
+}
+
+func (u *uiContext) ack(source, key string) {
+	u.acked[key] = true
+	u.analysis.SetAcknowledgedKeys(u.ackedKeys())
+	u.analysis.RecordConfigChange(source, "ack", key)
+	u.Log("Acknowledged", key)
+}
+
+func (u *uiContext) unack(source, key string) {
+	if !u.acked[key] {
+		u.Log("Not acknowledged:", key)
+		return
+	}
+	delete(u.acked, key)
+	u.analysis.SetAcknowledgedKeys(u.ackedKeys())
+	u.analysis.RecordConfigChange(source, "unack", key)
+	u.Log("No longer acknowledged:", key)
+}
+
+// ackedKeys returns the acknowledged keys in sorted order.
+func (u *uiContext) ackedKeys() []string {
+	keys := make([]string, 0, len(u.acked))
+	for k := range u.acked {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ackCommand handles the commands "ack list", "ack KEY", and "unack KEY".
+func (u *uiContext) ackCommand(name string, args []string) {
+	switch {
+	case name == "ack" && len(args) == 1 && args[0] == "list":
+		if len(u.acked) == 0 {
+			u.Log("No keys acknowledged")
+			return
+		}
+		u.Log("Acknowledged:", strings.Join(u.ackedKeys(), " "))
+	case name == "ack" && len(args) == 1:
+		u.ack(sourcePrompt, args[0])
+	case name == "unack" && len(args) == 1:
+		u.unack(sourcePrompt, args[0])
+	default:
+		u.Log("Usage: :ack list, :ack KEY, :unack KEY")
+	}
+}
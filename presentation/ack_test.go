@@ -0,0 +1,59 @@
+package presentation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+func ackContext(t *testing.T) *uiContext {
+	pool, err := analysis.New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := New(pool, 0, false, nil, DefaultDropThresholds, "", "", numfmt.Formatter{}, nil).(*uiContext)
+	u.prevReport = mctopReport()
+	return u
+}
+
+func displayedKeys(u *uiContext) []string {
+	var keys []string
+	for _, r := range u.displayed().Rows {
+		keys = append(keys, r.Key[0])
+	}
+	return keys
+}
+
+func TestAckCommands(t *testing.T) {
+	u := ackContext(t)
+	u.runCommand("ack small")
+	u.runCommand("  ack   empty ")
+	u.runCommand("unack small")
+	if !reflect.DeepEqual(u.ackedKeys(), []string{"empty"}) {
+		t.Error(u.ackedKeys())
+	}
+	u.runCommand("ack list")
+	u.runCommand("bogus")
+	if len(u.msgChan) != 5 {
+		t.Error("expected a message per command, got", len(u.msgChan))
+	}
+}
+
+func TestHideAcked(t *testing.T) {
+	u := ackContext(t)
+	u.runCommand("ack small")
+	u.runCommand("ack missing")
+	if len(u.displayed().Rows) != 5 {
+		t.Error("acknowledged keys hidden by default")
+	}
+	u.hideAcked = true
+	want := []string{"user:1234", "a-rather-long-key-name:with:many:parts", "empty"}
+	if got := displayedKeys(u); !reflect.DeepEqual(got, want) {
+		t.Error(got)
+	}
+	if len(u.prevReport.Rows) != 5 {
+		t.Error("hiding modified the report")
+	}
+}
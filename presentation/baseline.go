@@ -0,0 +1,109 @@
+package presentation
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// baselineAge is how long before each live report the Baseline is consulted,
+// so that traffic is compared with the same time of day.
+const baselineAge = 24 * time.Hour
+
+// baselineTitle heads the column of changes from the Baseline.
+const baselineTitle = "Δ24h"
+
+// Baseline supplies the report covering an earlier time, and the length of the
+// period it covers, such as from an archive.Index.  It returns false if no
+// report covers the time.
+type Baseline interface {
+	At(t time.Time) (analysis.Report, time.Duration, bool)
+}
+
+// comparison is the report a day before a live report, with the values of the
+// column by which keys are ranked scaled to the length of the live interval.
+type comparison struct {
+	// column is the name of the column compared, and values its value for
+	// each key of the earlier report.
+	column string
+	values map[string]float64
+	// requests is the number of requests in the earlier report.
+	requests float64
+}
+
+// compare returns the comparison of rep with the report from baseline a day
+// earlier, ranked by the value column sortCol as given to Report.SortBy, or
+// nil if none is available.  Live reports must each cover interval, so that
+// rates are compared, and comparisons are not made with cumulative reports,
+// whose period is unknown.
+func compare(baseline Baseline, rep analysis.Report, sortCol int, interval time.Duration, cumulative bool) *comparison {
+	col := -sortCol - len(rep.KeyColNames)
+	if baseline == nil || cumulative || interval <= 0 || col < 0 || col >= len(rep.ValColNames) {
+		return nil
+	}
+	then, span, ok := baseline.At(rep.Timestamp.Add(-baselineAge))
+	if !ok || span <= 0 {
+		return nil
+	}
+	c := &comparison{column: rep.ValColNames[col]}
+	thenCol := -1
+	for i, name := range then.ValColNames {
+		if name == c.column {
+			thenCol = i
+		}
+	}
+	if thenCol < 0 || strings.Join(then.KeyColNames, ",") != strings.Join(rep.KeyColNames, ",") {
+		return nil
+	}
+	scale := interval.Seconds() / span.Seconds()
+	c.values = make(map[string]float64, len(then.Rows))
+	for _, row := range then.Rows {
+		c.values[strings.Join(row.Key, "\x00")] = float64(row.Values[thenCol]) * scale
+	}
+	c.requests = float64(then.Skew.Requests) * scale
+	return c
+}
+
+// rowLabel describes the change in the compared column of row, which is in a
+// report with column names valCols.
+func (c *comparison) rowLabel(nf numfmt.Formatter, valCols []string, row analysis.ReportRow) string {
+	for i, name := range valCols {
+		if name == c.column {
+			return changeLabel(nf, float64(row.Values[i]), c.values[strings.Join(row.Key, "\x00")])
+		}
+	}
+	return ""
+}
+
+// totalLabel describes the change in requests from the comparison to rep, or
+// notes that no comparison is available if c is nil.
+func (c *comparison) totalLabel(nf numfmt.Formatter, rep analysis.Report) string {
+	if c == nil {
+		return baselineTitle + ": no data"
+	}
+	return baselineTitle + ": " + changeLabel(nf, float64(rep.Skew.Requests), c.requests) + " requests"
+}
+
+// changeLabel describes the change from then to now as a percentage, or as new
+// if then is 0.
+func changeLabel(nf numfmt.Formatter, now, then float64) string {
+	if then == 0 {
+		if now == 0 {
+			return nf.Percent(0, 0)
+		}
+		return "new"
+	}
+	rounded := math.Round((now - then) * 100 / then)
+	if rounded == 0 {
+		// never -0%
+		rounded = 0
+	}
+	pct := nf.Percent(rounded, 0)
+	if !strings.HasPrefix(pct, "-") {
+		pct = "+" + pct
+	}
+	return pct
+}
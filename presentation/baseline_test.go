@@ -0,0 +1,123 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// fixedBaseline returns rep, covering span, for any time a day before
+// testTimestamp.
+type fixedBaseline struct {
+	rep  analysis.Report
+	span time.Duration
+}
+
+func (b fixedBaseline) At(t time.Time) (analysis.Report, time.Duration, bool) {
+	if !t.Equal(testTimestamp.Add(-baselineAge)) {
+		return analysis.Report{}, 0, false
+	}
+	return b.rep, b.span, true
+}
+
+// yesterday returns a report covering 20 seconds a day before mctopReport,
+// with twice the traffic of some keys over twice its interval.
+func yesterday() fixedBaseline {
+	rep := mctopReport()
+	rep.Timestamp = rep.Timestamp.Add(-baselineAge)
+	rep.Rows = []analysis.ReportRow{
+		{Key: []string{"small"}, Values: []int64{20, 2000}},
+		{Key: []string{"user:1234"}, Values: []int64{256, 1048576}},
+		{Key: []string{"empty"}, Values: []int64{6, 0}},
+	}
+	rep.Skew.Requests = 800
+	return fixedBaseline{rep, 20 * time.Second}
+}
+
+func TestChangeLabel(t *testing.T) {
+	nf := numfmt.Formatter{}
+	cases := []struct {
+		now, then float64
+		want      string
+	}{
+		{150, 100, "+50%"},
+		{50, 100, "-50%"},
+		{99.8, 100, "+0%"},
+		{100.2, 100, "+0%"},
+		{7, 0, "new"},
+		{0, 0, "0%"},
+	}
+	for _, c := range cases {
+		if got := changeLabel(nf, c.now, c.then); got != c.want {
+			t.Errorf("%v from %v: %q, want %q", c.now, c.then, got, c.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	nf := numfmt.Formatter{}
+	rep := mctopReport()
+	rep.Skew.Requests = 600
+	c := compare(yesterday(), rep, sortColumn(rep, -1), 10*time.Second, false)
+	if c == nil || c.column != "sum(size)" {
+		t.Fatal(c)
+	}
+	var labels []string
+	for _, row := range rep.Rows {
+		labels = append(labels, c.rowLabel(nf, rep.ValColNames, row))
+	}
+	want := "+0%,+300%,new,0%,0%"
+	if got := strings.Join(labels, ","); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := c.totalLabel(nf, rep); got != "Δ24h: +50% requests" {
+		t.Error(got)
+	}
+
+	for _, bad := range []struct {
+		baseline   Baseline
+		interval   time.Duration
+		cumulative bool
+	}{
+		{nil, 10 * time.Second, false},
+		{yesterday(), 10 * time.Second, true},
+		{yesterday(), 0, false},
+		{fixedBaseline{analysis.Report{ValColNames: []string{"sum(hit)"}}, time.Second}, 10 * time.Second, false},
+	} {
+		if c := compare(bad.baseline, rep, sortColumn(rep, -1), bad.interval, bad.cumulative); c != nil {
+			t.Error(c)
+		}
+	}
+	rep.Timestamp = rep.Timestamp.Add(time.Minute)
+	c = compare(yesterday(), rep, sortColumn(rep, -1), 10*time.Second, false)
+	if c != nil {
+		t.Error(c)
+	}
+	if got := c.totalLabel(nf, rep); got != "Δ24h: no data" {
+		t.Error(got)
+	}
+}
+
+func TestRenderBaseline(t *testing.T) {
+	u, g := screenContext(t, 120, 12)
+	u.interval = 10 * time.Second
+	u.baseline = yesterday()
+	// ranked by the first value column, sum(hit), as the Pool has just one
+	u.compared = compare(u.baseline, u.prevReport, u.sortColumn(), u.interval, u.cumulative)
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(g.String(), "\n")
+	if !strings.HasSuffix(lines[0], " Δ24h") {
+		t.Errorf("header %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[3], "+300%") {
+		t.Errorf("row %q", lines[3])
+	}
+	if !strings.Contains(lines[len(lines)-2], "Δ24h: ") {
+		t.Errorf("footer %q", lines[len(lines)-2])
+	}
+}
@@ -0,0 +1,20 @@
+package presentation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// chunksLabel describes the chunks in which the value of a key folded by
+// --chunk-pattern has been retrieved, with the chunk keys most recently seen.
+func chunksLabel(nf numfmt.Formatter, cf analysis.ChunkFanout) string {
+	perFetch := "-"
+	if cf.Fetches > 0 {
+		perFetch = nf.Float(float64(cf.Chunks)/float64(cf.Fetches), 1)
+	}
+	return fmt.Sprintf("chunks: %s per fetch over %s fetches: %s",
+		perFetch, nf.Count(cf.Fetches), strings.Join(cf.Keys, " "))
+}
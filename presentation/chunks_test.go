@@ -0,0 +1,18 @@
+package presentation
+
+import (
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+func TestChunksLabel(t *testing.T) {
+	cf := analysis.ChunkFanout{Keys: []string{"big/0", "big/1", "big/2"}, Fetches: 4, Chunks: 10}
+	if got, want := chunksLabel(numfmt.Formatter{}, cf), "chunks: 2.5 per fetch over 4 fetches: big/0 big/1 big/2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := chunksLabel(numfmt.Formatter{}, analysis.ChunkFanout{Keys: []string{"big/0"}}), "chunks: - per fetch over 0 fetches: big/0"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package presentation
+
+import (
+	"time"
+)
+
+// clock is the source of time for the update loops, replaced in tests.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// updateTimer schedules periodic updates one interval after the previous
+// update finished, so that a slow update or a suspended host never leaves a
+// backlog of updates to run at once.
+type updateTimer struct {
+	clock    clock
+	interval time.Duration
+	due      time.Time
+	// C receives when the next update is due.
+	C <-chan time.Time
+}
+
+func newUpdateTimer(c clock, interval time.Duration) *updateTimer {
+	t := &updateTimer{clock: c, interval: interval}
+	t.reset()
+	return t
+}
+
+// reset schedules the next update one interval from now.
+func (t *updateTimer) reset() {
+	t.due = t.clock.Now().Add(t.interval)
+	t.C = t.clock.After(t.interval)
+}
+
+// gap returns how late the update firing now is, or 0 if it is close enough
+// to schedule.  A late update means the period since the last one was
+// interrupted, usually by the host suspending.
+//
+// Wall clock times are compared, since the monotonic clock may not advance
+// while suspended, leaving the timer unaware of the time lost.
+func (t *updateTimer) gap() time.Duration {
+	late := wall(t.clock.Now()).Sub(wall(t.due))
+	tolerance := t.interval
+	if tolerance < time.Second {
+		tolerance = time.Second
+	}
+	if late > tolerance {
+		return late
+	}
+	return 0
+}
+
+// wall strips the monotonic clock reading from tm.
+func wall(tm time.Time) time.Time {
+	return tm.Round(0)
+}
@@ -0,0 +1,171 @@
+package presentation
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// fakeClock is a clock advanced only by the test.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+	// timers receives each timer as it is started.
+	timers chan fakeTimer
+}
+
+type fakeTimer struct {
+	due time.Time
+	c   chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: testTimestamp, timers: make(chan fakeTimer, 1)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	f.timers <- fakeTimer{f.Now().Add(d), c}
+	return c
+}
+
+// fire waits for the next timer to be started, then advances the clock to
+// late after it is due and fires it.
+func (f *fakeClock) fire(late time.Duration) {
+	tm := <-f.timers
+	f.mu.Lock()
+	f.now = tm.due.Add(late)
+	f.mu.Unlock()
+	tm.c <- tm.due.Add(late)
+}
+
+type writtenReport struct {
+	discontinuous bool
+	elapsed       time.Duration
+}
+
+// runFakeReporter starts a TextReporter on a fake clock, recording the
+// reports it writes.
+func runFakeReporter(t *testing.T, cumulative bool) (*fakeClock, <-chan writtenReport, chan<- struct{}, <-chan error) {
+	pool, err := analysis.New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTextReporter(pool, time.Second, cumulative, "text", ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := newFakeClock()
+	tr.clock = fc
+	written := make(chan writtenReport)
+	tr.write = func(w io.Writer, _ numfmt.Formatter, rep analysis.Report, elapsed time.Duration, _ *StatsSnapshot) error {
+		written <- writtenReport{rep.Discontinuous, elapsed}
+		return nil
+	}
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() { errs <- tr.Run(done) }()
+	return fc, written, done, errs
+}
+
+func TestTextReporterSuspend(t *testing.T) {
+	fc, written, done, errs := runFakeReporter(t, false)
+	expected := []writtenReport{
+		{false, time.Second},
+		{true, 10*time.Minute + time.Second},
+		{false, time.Second},
+	}
+	for _, late := range []time.Duration{0, 10 * time.Minute, 0} {
+		fc.fire(late)
+		if w := <-written; w != expected[0] {
+			t.Error(w, expected[0])
+		}
+		expected = expected[1:]
+	}
+	close(done)
+	<-written
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTextReporterSuspendCumulative(t *testing.T) {
+	fc, written, done, errs := runFakeReporter(t, true)
+	for _, late := range []time.Duration{0, 10 * time.Minute, 0} {
+		fc.fire(late)
+		<-written
+	}
+	fc.fire(0)
+	// the time suspended is excluded from the elapsed time
+	if w := <-written; w != (writtenReport{false, 4 * time.Second}) {
+		t.Error(w)
+	}
+	close(done)
+	<-written
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+}
+
+// TestTextReporterSuspendHooked checks that a report interrupted by a suspend
+// is marked Discontinuous before it reaches the report hook.
+func TestTextReporterSuspendHooked(t *testing.T) {
+	pool, err := analysis.New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooked := make(chan bool, 1)
+	pool.SetReportHook(func(rep analysis.Report) {
+		hooked <- rep.Discontinuous
+	})
+	tr, err := NewTextReporter(pool, time.Second, false, "text", ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := newFakeClock()
+	tr.clock = fc
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() { errs <- tr.Run(done) }()
+	for _, want := range []bool{false, true, false} {
+		if want {
+			fc.fire(10 * time.Minute)
+		} else {
+			fc.fire(0)
+		}
+		if got := <-hooked; got != want {
+			t.Error("hook saw Discontinuous", got, "want", want)
+		}
+	}
+	close(done)
+	<-hooked
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateTimerGap(t *testing.T) {
+	fc := newFakeClock()
+	timer := newUpdateTimer(fc, 100*time.Millisecond)
+	<-fc.timers
+	fc.now = fc.now.Add(900 * time.Millisecond)
+	// intervals under a second tolerate being a second late
+	if g := timer.gap(); g != 0 {
+		t.Error(g)
+	}
+	fc.now = fc.now.Add(time.Second)
+	if g := timer.gap(); g != 1800*time.Millisecond {
+		t.Error(g)
+	}
+}
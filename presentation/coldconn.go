@@ -0,0 +1,37 @@
+package presentation
+
+import (
+	"fmt"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// coldConnKey returns the counts of requests for key made on newly opened
+// connections, and whether rep flags key as requested mostly that way.
+func coldConnKey(rep analysis.Report, key string) (analysis.ColdConnKey, bool) {
+	for _, ck := range rep.ColdConnKeys {
+		if ck.Key == key {
+			return ck, true
+		}
+	}
+	return analysis.ColdConnKey{}, false
+}
+
+// coldConnMarker is appended to the key of a row requested mostly on newly
+// opened connections.
+func coldConnMarker(nf numfmt.Formatter, ck analysis.ColdConnKey) string {
+	return " cold-conn " + nf.Percent(ck.ColdPercent(), 0)
+}
+
+// coldConnLabel counts the keys in rep requested mostly on newly opened
+// connections.
+func coldConnLabel(nf numfmt.Formatter, rep analysis.Report) string {
+	return "Cold-conn keys: " + nf.Count(int64(len(rep.ColdConnKeys)))
+}
+
+// coldConnDetail describes the requests for a key made on newly opened
+// connections.
+func coldConnDetail(nf numfmt.Formatter, ck analysis.ColdConnKey) string {
+	return fmt.Sprintf("cold-conn: %s of %s requests (%s) on newly opened connections", nf.Count(ck.Cold), nf.Count(ck.Requests), nf.Percent(ck.ColdPercent(), 0))
+}
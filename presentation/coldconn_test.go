@@ -0,0 +1,30 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+func TestRenderColdConns(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	u.prevReport.ColdConnKeys = []analysis.ColdConnKey{{Key: "user:1234", Requests: 512, Cold: 480}}
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(g.String(), "user:1234 cold-conn 94%") {
+		t.Errorf("cold-conn key not marked:\n%s", g)
+	}
+	if strings.Contains(g.String(), "small cold-conn") {
+		t.Errorf("key marked without cold connections:\n%s", g)
+	}
+	if notes := strings.Join(footerNotes(numfmt.Formatter{}, u.prevReport, Stats{}), "  "); !strings.Contains(notes, "Cold-conn keys: 1") {
+		t.Error("cold-conn keys missing from footer:", notes)
+	}
+
+	if label := coldConnDetail(numfmt.Formatter{}, u.prevReport.ColdConnKeys[0]); label != "cold-conn: 480 of 512 requests (94%) on newly opened connections" {
+		t.Error(label)
+	}
+}
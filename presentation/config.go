@@ -0,0 +1,42 @@
+package presentation
+
+import (
+	"strings"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/mattn/go-runewidth"
+)
+
+// Sources of the settings changed in the interactive interface, as recorded
+// by Pool.RecordConfigChange.
+const (
+	sourceKeyboard = "keyboard"
+	sourcePrompt   = "prompt"
+)
+
+// configMarker is shown on the first line while the report shown covers a
+// change of settings.
+const configMarker = " config changed "
+
+// configLabel lists the settings changed over the period of rep, with the
+// source and time of each change.
+func configLabel(rep analysis.Report) string {
+	parts := make([]string, len(rep.ConfigChanges))
+	for i, c := range rep.ConfigChanges {
+		parts[i] = c.Setting + "=" + c.Value + " (" + c.Source + " at " + c.Time.Format("15:04:05") + ")"
+	}
+	return "Config changed: " + strings.Join(parts, ", ")
+}
+
+// renderConfigChanged marks the first line, ending at column right, if the
+// report shown covers a change of settings, so that the numbers changing are
+// not taken for a change in traffic.  It returns the column at which the
+// marker starts.
+func (u *uiContext) renderConfigChanged(right int) int {
+	if len(u.prevReport.ConfigChanges) == 0 {
+		return right
+	}
+	left := right - runewidth.StringWidth(configMarker)
+	u.renderTextAt(left, 0, configMarker, styleDimmed|styleSelected)
+	return left
+}
@@ -0,0 +1,87 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/nsf/termbox-go"
+)
+
+// TestConfigChangesRecorded checks that every setting changed from the
+// keyboard or the prompt is listed in the next report.
+func TestConfigChangesRecorded(t *testing.T) {
+	cases := []struct {
+		keys    string
+		command string
+		want    string
+	}{
+		{keys: "b", want: "keyboard bw=req"},
+		{keys: "R", want: "keyboard rank=gets"},
+		{keys: "Z", want: "keyboard maintenance=until "},
+		{keys: "ZZ", want: "keyboard maintenance=until ,keyboard maintenance=off"},
+		{keys: "k", want: "keyboard ack=small"},
+		{keys: "kk", want: "keyboard ack=small,keyboard unack=small"},
+		{command: "maint 10m", want: "prompt maintenance=until "},
+		{command: "ack empty", want: "prompt ack=empty"},
+		{command: "unack empty"},
+		{keys: "s", want: "keyboard sort=sum(size)"},
+		{keys: "h", want: "keyboard hideacked=on"},
+		{keys: "hh", want: "keyboard hideacked=on,keyboard hideacked=off"},
+		// pausing only holds the display, so is not recorded
+		{keys: "p"},
+	}
+	for _, c := range cases {
+		u, _ := screenContext(t, 80, 24)
+		for _, ch := range c.keys {
+			if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: ch}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if c.command != "" {
+			u.runCommand(c.command)
+		}
+		rep := u.analysis.(*analysis.Pool).Report(true)
+		var got []string
+		for _, ch := range rep.ConfigChanges {
+			value := ch.Value
+			if strings.HasPrefix(value, "until ") {
+				value = "until "
+			}
+			got = append(got, ch.Source+" "+ch.Setting+"="+value)
+		}
+		if strings.Join(got, ",") != c.want {
+			t.Errorf("%q%q: recorded %q, want %q", c.keys, c.command, got, c.want)
+		}
+	}
+}
+
+func TestRenderConfigChanged(t *testing.T) {
+	u, g := screenContext(t, 100, 24)
+	u.watermark = " DEMO "
+	u.prevReport.ConfigChanges = []analysis.ConfigChange{
+		{Time: time.Date(2017, 6, 1, 9, 0, 1, 0, time.Local), Source: "keyboard", Setting: "bw", Value: "request"},
+	}
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(g.String(), "\n")
+	if !strings.HasSuffix(lines[0], configMarker+" DEMO") {
+		t.Errorf("marker missing from header %q", lines[0])
+	}
+	if g.attr(100-len(" DEMO ")-1, 0) != styleDimmed|styleSelected {
+		t.Error("marker not styled")
+	}
+	if got, want := configLabel(u.prevReport), "Config changed: bw=request (keyboard at 09:00:01)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	u.prevReport.ConfigChanges = nil
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(g.String(), configMarker) {
+		t.Error("marker shown without changes")
+	}
+}
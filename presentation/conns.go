@@ -0,0 +1,109 @@
+package presentation
+
+import (
+	"sort"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// connSort is a column by which the connection view is ranked.
+type connSort int
+
+const (
+	connSortResponse connSort = iota
+	connSortAmplification
+	connSortRequest
+	numConnSorts
+)
+
+// connColumns are the headings of the connection view and the screen columns
+// they start at, in the order of connSort after the connection itself.
+var connColumns = []struct {
+	name   string
+	column int
+}{
+	{"response", 6},
+	{"resp:req", 8},
+	{"request", 10},
+}
+
+// handleConnView switches between the list of keys and the list of
+// connections.
+func (u *uiContext) handleConnView() error {
+	u.connView = !u.connView
+	u.misrouteView = false
+	u.detailKey = nil
+	return u.render()
+}
+
+// handleConnSort ranks connections by the next column, wrapping around to the
+// first after the last.
+func (u *uiContext) handleConnSort() error {
+	u.connSort = (u.connSort + 1) % numConnSorts
+	return u.render()
+}
+
+// sortedConns returns the connections of rep ranked by the current column,
+// most first.  Connections whose amplification is undefined rank last by
+// amplification.
+func (u *uiContext) sortedConns(rep analysis.Report) []analysis.ConnTraffic {
+	conns := append([]analysis.ConnTraffic(nil), rep.Connections...)
+	sort.SliceStable(conns, func(i, j int) bool {
+		switch u.connSort {
+		case connSortAmplification:
+			ri, iok := conns[i].Amplification()
+			rj, jok := conns[j].Amplification()
+			if iok != jok {
+				return iok
+			}
+			return ri > rj
+		case connSortRequest:
+			return conns[i].RequestBytes > conns[j].RequestBytes
+		default:
+			return conns[i].ResponseBytes > conns[j].ResponseBytes
+		}
+	})
+	return conns
+}
+
+// renderConnections shows the bytes carried in each direction by the busiest
+// connections in the most recent report.
+func (u *uiContext) renderConnections() {
+	u.renderText(0, 0, "connection")
+	for i, c := range connColumns {
+		if connSort(i) == u.connSort {
+			u.renderTextAttr(c.column, 0, c.name, styleSortColumn)
+		} else {
+			u.renderText(c.column, 0, c.name)
+		}
+	}
+	u.renderLine(0, 12, 1, '-')
+
+	conns := u.sortedConns(u.prevReport)
+	if len(conns) == 0 {
+		u.renderTextAttr(0, 2, "no connection traffic seen", styleDimmed)
+		return
+	}
+	lastY := u.yFromBottom(statusLines + logLines)
+	for i, c := range conns {
+		y := 2 + i
+		if y > lastY {
+			break
+		}
+		u.renderText(0, y, c.Conn)
+		u.renderText(connColumns[connSortResponse].column, y, u.numbers.Bytes(c.ResponseBytes))
+		u.renderText(connColumns[connSortAmplification].column, y, amplificationLabel(u.numbers, c))
+		u.renderText(connColumns[connSortRequest].column, y, u.numbers.Bytes(c.RequestBytes))
+	}
+}
+
+// amplificationLabel formats the ratio of response to request bytes of c, or
+// a dash where it is undefined.
+func amplificationLabel(nf numfmt.Formatter, c analysis.ConnTraffic) string {
+	ratio, ok := c.Amplification()
+	if !ok {
+		return "—"
+	}
+	return nf.Float(ratio, 1)
+}
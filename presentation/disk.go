@@ -0,0 +1,16 @@
+package presentation
+
+import "github.com/box/memsniff/numfmt"
+
+// diskLabel gives the disk space taken by the files memsniff writes, against
+// their budget if there is one, and warns of sinks paused to stay within it.
+func diskLabel(nf numfmt.Formatter, stats Stats) string {
+	label := "Disk: " + nf.ByteSize(stats.DiskUsed)
+	if stats.DiskLimit > 0 {
+		label += " of " + nf.ByteSize(stats.DiskLimit)
+	}
+	if stats.DiskPaused > 0 {
+		label = "⚠ " + label + ", writes paused"
+	}
+	return label
+}
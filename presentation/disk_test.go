@@ -0,0 +1,28 @@
+package presentation
+
+import (
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+func TestDiskLabel(t *testing.T) {
+	human := numfmt.Formatter{Style: numfmt.Human}
+	cases := []struct {
+		stats Stats
+		want  string
+	}{
+		{Stats{DiskUsed: 3 << 20}, "Disk: 3.0 MiB"},
+		{Stats{DiskUsed: 3 << 20, DiskLimit: 5 << 30}, "Disk: 3.0 MiB of 5.0 GiB"},
+		{Stats{DiskUsed: 5 << 30, DiskLimit: 5 << 30, DiskPaused: 1}, "⚠ Disk: 5.0 GiB of 5.0 GiB, writes paused"},
+	}
+	for _, c := range cases {
+		if label := diskLabel(human, c.stats); label != c.want {
+			t.Error(label)
+		}
+	}
+	if notes := footerNotes(human, analysis.Report{}, Stats{}); len(notes) != 0 {
+		t.Error("disk usage shown with nothing written:", notes)
+	}
+}
@@ -0,0 +1,102 @@
+package presentation
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/box/memsniff/numfmt"
+)
+
+// DropThresholds are the fractions of packets dropped by a stage of the
+// pipeline at which its drops are shown as a warning (Warn) or as severe
+// (Severe), and beyond which all drops are emphasized (Emphasize).
+type DropThresholds struct {
+	Warn      float64
+	Severe    float64
+	Emphasize float64
+}
+
+// DefaultDropThresholds warns of drops above 1% and 5% of packets, and
+// emphasizes drops above 10%, when results are seriously incomplete.
+var DefaultDropThresholds = DropThresholds{Warn: 0.01, Severe: 0.05, Emphasize: 0.10}
+
+// responseDropThresholds applies to the fraction of responses missing from a
+// report, shown below its header.
+var responseDropThresholds = DropThresholds{Warn: 0.05, Severe: 0.20}
+
+var errDropThresholds = errors.New("drop thresholds must be three increasing percentages, such as 1,5,10")
+
+// ParseDropThresholds parses a comma-separated list of three percentages,
+// such as "1,5,10", into DropThresholds.
+func ParseDropThresholds(s string) (DropThresholds, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 {
+		return DropThresholds{}, errDropThresholds
+	}
+	var pcts [3]float64
+	for i, f := range fields {
+		pct, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || pct < 0 || (i > 0 && pct < pcts[i-1]) {
+			return DropThresholds{}, errDropThresholds
+		}
+		pcts[i] = pct
+	}
+	return DropThresholds{Warn: pcts[0] / 100, Severe: pcts[1] / 100, Emphasize: pcts[2] / 100}, nil
+}
+
+// classify returns the severity of dropping fraction rate.
+func (dt DropThresholds) classify(rate float64) severity {
+	switch {
+	case rate > dt.Severe:
+		return severitySevere
+	case rate > dt.Warn:
+		return severityWarn
+	default:
+		return severityOK
+	}
+}
+
+// dropStage is the number of packets dropped by one stage of the pipeline.
+type dropStage struct {
+	name    string
+	dropped int
+}
+
+// dropStages returns the packets dropped by each stage of the pipeline, in
+// order.
+func dropStages(s Stats) []dropStage {
+	return []dropStage{
+		{"kernel", s.PacketsDroppedKernel},
+		{"parse", s.PacketsDroppedParser},
+		{"analysis", s.PacketsDroppedAnalysis},
+	}
+}
+
+// throttleLabel describes the connections whose data exceeded the parse budget
+// set by --conn-budget, and the bytes of theirs skipped.
+func throttleLabel(nf numfmt.Formatter, s Stats) string {
+	return fmt.Sprintf("throttled %s conns (%s)", nf.Count(int64(s.ConnectionsThrottled)), nf.ByteSize(int64(s.BytesThrottled)))
+}
+
+// dropRate returns the fraction of packets received that were dropped.
+func dropRate(s Stats, dropped int) float64 {
+	if s.PacketsPassedFilter == 0 {
+		return 0
+	}
+	return float64(dropped) / float64(s.PacketsPassedFilter)
+}
+
+// warnDrops logs a warning the first time the drops of each stage become
+// severe.
+func (u *uiContext) warnDrops(s Stats) {
+	for _, st := range dropStages(s) {
+		rate := dropRate(s, st.dropped)
+		if u.dropsWarned[st.name] || u.dropThresholds.classify(rate) != severitySevere {
+			continue
+		}
+		u.dropsWarned[st.name] = true
+		u.Log(fmt.Sprintf("Warning: %s dropped %s of packets (over %g%%)", st.name, u.numbers.Percent(rate*100, 1), u.dropThresholds.Severe*100))
+	}
+}
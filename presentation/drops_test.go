@@ -0,0 +1,112 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestParseDropThresholds(t *testing.T) {
+	dt, err := ParseDropThresholds("2, 4.5,50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dt != (DropThresholds{Warn: 0.02, Severe: 0.045, Emphasize: 0.5}) {
+		t.Error(dt)
+	}
+	for _, bad := range []string{"", "1,5", "1,5,10,20", "5,1,10", "a,b,c", "-1,5,10"} {
+		if _, err := ParseDropThresholds(bad); err != errDropThresholds {
+			t.Errorf("%q: %v", bad, err)
+		}
+	}
+}
+
+func TestDropSeverity(t *testing.T) {
+	dt := DefaultDropThresholds
+	cases := map[float64]severity{
+		0:     severityOK,
+		0.01:  severityOK,
+		0.02:  severityWarn,
+		0.05:  severityWarn,
+		0.051: severitySevere,
+	}
+	for rate, expected := range cases {
+		if s := dt.classify(rate); s != expected {
+			t.Error(rate, s)
+		}
+	}
+}
+
+func TestWarnDropsOnce(t *testing.T) {
+	u := ackContext(t)
+	stats := Stats{PacketsPassedFilter: 1000, PacketsDroppedKernel: 20, PacketsDroppedAnalysis: 60}
+	u.warnDrops(stats)
+	stats.PacketsDroppedKernel = 100
+	u.warnDrops(stats)
+	u.warnDrops(stats)
+	if len(u.msgChan) != 2 {
+		t.Fatal("expected a warning per severe stage, got", len(u.msgChan))
+	}
+	if msg := <-u.msgChan; !strings.Contains(msg, "analysis dropped 6.0%") {
+		t.Error(msg)
+	}
+	if msg := <-u.msgChan; !strings.Contains(msg, "kernel dropped 10.0%") {
+		t.Error(msg)
+	}
+}
+
+func TestRenderDrops(t *testing.T) {
+	u, g := screenContext(t, 120, 24)
+	u.stats = NewStatTracker(func() Stats {
+		return Stats{PacketsPassedFilter: 1000, PacketsDroppedKernel: 20, PacketsDroppedAnalysis: 150}
+	})
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	footer := strings.Split(g.String(), "\n")[23]
+	expected := []struct {
+		label string
+		fg    termbox.Attribute
+	}{
+		{"kernel 2.00%", termbox.ColorYellow | styleEmphasis},
+		{"parse 0.00%", termbox.ColorGreen | styleEmphasis},
+		{"analysis 15.00%", termbox.ColorRed | styleEmphasis},
+	}
+	for _, e := range expected {
+		x := strings.Index(footer, e.label)
+		if x < 0 {
+			t.Fatalf("%q not in footer %q", e.label, footer)
+		}
+		if fg := g.attr(x, 23); fg != e.fg {
+			t.Errorf("%s shown as %v, expected %v", e.label, fg, e.fg)
+		}
+	}
+}
+
+func TestRenderThrottled(t *testing.T) {
+	u, g := screenContext(t, 160, 24)
+	u.stats = NewStatTracker(func() Stats {
+		return Stats{PacketsPassedFilter: 1000, ConnectionsThrottled: 2, BytesThrottled: 123456}
+	})
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	footer := strings.Split(g.String(), "\n")[23]
+	label := "analysis 0.00% throttled 2 conns (123456 bytes)"
+	x := strings.Index(footer, label)
+	if x < 0 {
+		t.Fatalf("%q not in footer %q", label, footer)
+	}
+	if fg := g.attr(x+len("analysis 0.00% "), 23); fg != termbox.ColorYellow {
+		t.Errorf("throttled shown as %v", fg)
+	}
+
+	u.stats = NewStatTracker(func() Stats { return Stats{PacketsPassedFilter: 1000} })
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(g.String(), "throttled") {
+		t.Error("throttled shown without throttling")
+	}
+}
@@ -0,0 +1,62 @@
+package presentation
+
+import (
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/mattn/go-runewidth"
+)
+
+// handleMaintenance starts a maintenance window of the default length, or
+// ends the current one.
+func (u *uiContext) handleMaintenance() error {
+	if _, ok := u.analysis.Maintenance(); ok {
+		u.endMaintenance(sourceKeyboard)
+	} else {
+		u.startMaintenance(sourceKeyboard, analysis.DefaultMaintenance)
+	}
+	return u.render()
+}
+
+func (u *uiContext) startMaintenance(source string, d time.Duration) {
+	until := u.clock.Now().Add(d)
+	u.analysis.SetMaintenance(until)
+	u.analysis.RecordConfigChange(source, "maintenance", "until "+until.Format("15:04:05"))
+	u.Log("Maintenance until", until.Format("15:04:05")+"; alerts suppressed")
+}
+
+func (u *uiContext) endMaintenance(source string) {
+	if _, ok := u.analysis.Maintenance(); !ok {
+		u.Log("No maintenance window in progress")
+		return
+	}
+	u.analysis.SetMaintenance(time.Time{})
+	u.analysis.RecordConfigChange(source, "maintenance", "off")
+	u.Log("Maintenance ended; alerts no longer suppressed")
+}
+
+// maintCommand handles the commands "maint DURATION" and "maint off".
+func (u *uiContext) maintCommand(args []string) {
+	if len(args) == 1 && args[0] == "off" {
+		u.endMaintenance(sourcePrompt)
+		return
+	}
+	if len(args) == 1 {
+		if d, err := time.ParseDuration(args[0]); err == nil && d > 0 {
+			u.startMaintenance(sourcePrompt, d)
+			return
+		}
+	}
+	u.Log("Usage: :maint DURATION (such as 30m), :maint off")
+}
+
+// renderMaintenance shows a banner on the first line, ending at column right,
+// while a maintenance window is in progress.
+func (u *uiContext) renderMaintenance(right int) {
+	until, ok := u.analysis.Maintenance()
+	if !ok {
+		return
+	}
+	banner := " MAINTENANCE until " + until.Format("15:04") + " "
+	u.renderTextAt(right-runewidth.StringWidth(banner), 0, banner, styleMaintenance)
+}
@@ -0,0 +1,57 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestMaintenanceCommands(t *testing.T) {
+	u := ackContext(t)
+	u.runCommand("maint 10m")
+	until, ok := u.analysis.Maintenance()
+	if !ok || time.Until(until) > 10*time.Minute || time.Until(until) < 9*time.Minute {
+		t.Error("window not started:", until, ok)
+	}
+	u.runCommand("maint off")
+	if _, ok := u.analysis.Maintenance(); ok {
+		t.Error("window not ended")
+	}
+	u.runCommand("maint off")
+	u.runCommand("maint")
+	u.runCommand("maint -5m")
+	if _, ok := u.analysis.Maintenance(); ok {
+		t.Error("window started by bad command")
+	}
+	if len(u.msgChan) != 5 {
+		t.Error("expected a message per command, got", len(u.msgChan))
+	}
+}
+
+func TestRenderMaintenance(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	u.watermark = " DEMO "
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'Z'}); err != nil {
+		t.Fatal(err)
+	}
+	until, ok := u.analysis.Maintenance()
+	if !ok {
+		t.Fatal("window not started")
+	}
+	want := " MAINTENANCE until " + until.Format("15:04") + "  DEMO"
+	if line := strings.Split(g.String(), "\n")[0]; !strings.HasSuffix(line, want) {
+		t.Errorf("banner missing from header %q", line)
+	}
+	if g.attr(80-len(" DEMO ")-1, 0) != styleMaintenance {
+		t.Error("banner not styled")
+	}
+
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'Z'}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(g.String(), "MAINTENANCE") {
+		t.Error("banner shown after window ended")
+	}
+}
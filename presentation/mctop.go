@@ -0,0 +1,91 @@
+package presentation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// MctopFormat is the analysis format required by the mctop output format.
+const MctopFormat = "key,sum(hit),sum(size)"
+
+const mctopKeyHeader = "memcache key"
+
+var errMctopFormat = errors.New("mctop output requires format " + MctopFormat)
+
+// writeMctop writes rep in the column layout of mctop's display:
+//
+//	memcache key      calls   objsize    req/sec  bw (kbps)
+//	user:1234           512      4096      51.20    1677.72
+//
+// Rows are ordered by calls, busiest first, as in mctop's default sort.
+//
+// The numbers are memsniff's estimates mapped onto mctop's fields, which
+// differ from mctop in a few ways:
+//
+//   - calls counts the values returned for the key in the reporting period
+//     (the interval, or since startup in cumulative mode), while mctop always
+//     counts since startup.  Like mctop, misses are not counted, and keys
+//     that only missed are not shown.
+//   - objsize is the mean value size over the period.  mctop shows the size
+//     of the most recently seen value.
+//   - req/sec and bw (kbps) are computed over the elapsed time of the
+//     reporting period.  bw is measured in kilobits (1000 bits) of value
+//     data per second, excluding protocol overhead, as in mctop.  They are
+//     shown as "-" when the period was interrupted, such as by suspending.
+//   - responses that memsniff dropped under load are not counted, so all
+//     figures are lower bounds when the footer reports drops.
+//
+// Numbers are always written raw, as by mctop.
+func writeMctop(w io.Writer, _ numfmt.Formatter, rep analysis.Report, elapsed time.Duration, _ *StatsSnapshot) error {
+	if columnNames(rep) != MctopFormat {
+		return errMctopFormat
+	}
+	// sum(hit), then key ascending for a stable order among equals
+	rep.SortBy(-1, 0)
+
+	keyWidth := len(mctopKeyHeader)
+	for _, r := range rep.Rows {
+		if len(r.Key[0]) > keyWidth {
+			keyWidth = len(r.Key[0])
+		}
+	}
+
+	secs := elapsed.Seconds()
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "%-*s %10s %9s %10s %10s\n", keyWidth, mctopKeyHeader, "calls", "objsize", "req/sec", "bw (kbps)")
+	for _, r := range rep.Rows {
+		calls, bytes := r.Values[0], r.Values[1]
+		if calls == 0 {
+			continue
+		}
+		objsize := bytes / calls
+		if rep.Discontinuous {
+			fmt.Fprintf(buf, "%-*s %10d %9d %10s %10s\n", keyWidth, r.Key[0], calls, objsize, "-", "-")
+			continue
+		}
+		var reqRate, kbps float64
+		if secs > 0 {
+			reqRate = float64(calls) / secs
+			kbps = float64(bytes) * 8 / 1000 / secs
+		}
+		fmt.Fprintf(buf, "%-*s %10d %9d %10.2f %10.2f\n", keyWidth, r.Key[0], calls, objsize, reqRate, kbps)
+	}
+	fmt.Fprintln(buf)
+	return buf.Flush()
+}
+
+// columnNames returns the key and value column names of rep in the form of
+// an analysis format descriptor.
+func columnNames(rep analysis.Report) string {
+	names := make([]string, 0, len(rep.KeyColNames)+len(rep.ValColNames))
+	names = append(names, rep.KeyColNames...)
+	names = append(names, rep.ValColNames...)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,72 @@
+package presentation
+
+import (
+	"fmt"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// misrouteColumns are the headings of the misroute view after the client, and
+// the screen columns they start at.
+var misrouteColumns = []struct {
+	name   string
+	column int
+}{
+	{"misrouted", 6},
+	{"requests", 8},
+	{"misroute%", 10},
+}
+
+// handleMisrouteView switches between the list of keys and the list of clients
+// sending requests to servers that do not own their keys.
+func (u *uiContext) handleMisrouteView() error {
+	u.misrouteView = !u.misrouteView
+	u.connView = false
+	u.detailKey = nil
+	return u.render()
+}
+
+// renderMisroutes shows the clients with the most misrouted requests in the
+// most recent report.
+func (u *uiContext) renderMisroutes() {
+	u.renderText(0, 0, "client")
+	for _, c := range misrouteColumns {
+		u.renderText(c.column, 0, c.name)
+	}
+	u.renderLine(0, 12, 1, '-')
+
+	rep := u.prevReport
+	if rep.RoutedRequests == 0 {
+		u.renderTextAttr(0, 2, "no requests checked against a ring (see --ring)", styleDimmed)
+		return
+	}
+	if len(rep.Misroutes) == 0 {
+		u.renderTextAttr(0, 2, "no misrouted requests seen", styleDimmed)
+		return
+	}
+	lastY := u.yFromBottom(statusLines + logLines)
+	for i, cr := range rep.Misroutes {
+		y := 2 + i
+		if y > lastY {
+			break
+		}
+		u.renderText(0, y, cr.Client)
+		u.renderText(misrouteColumns[0].column, y, u.numbers.Count(cr.Misrouted))
+		u.renderText(misrouteColumns[1].column, y, u.numbers.Count(cr.Requests))
+		u.renderText(misrouteColumns[2].column, y, u.numbers.Float(cr.MisroutedPercent(), 1))
+	}
+}
+
+// misrouteLabel gives the percentage of requests in rep sent to a server other
+// than the one owning their key.
+func misrouteLabel(nf numfmt.Formatter, rep analysis.Report) string {
+	pct := float64(rep.MisroutedRequests) * 100 / float64(rep.RoutedRequests)
+	return "Misrouted: " + nf.Percent(pct, 1)
+}
+
+// routingLabel describes the server owning a key and the requests for it sent
+// elsewhere.
+func routingLabel(nf numfmt.Formatter, kr analysis.KeyRouting) string {
+	return fmt.Sprintf("ring owner %s; %s of %s requests misrouted", kr.Owner, nf.Count(kr.Misrouted), nf.Count(kr.Requests))
+}
@@ -0,0 +1,34 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+	"github.com/nsf/termbox-go"
+)
+
+func TestRenderMisroutes(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	u.prevReport.RoutedRequests = 1000
+	u.prevReport.MisroutedRequests = 123
+	u.prevReport.Misroutes = []analysis.ClientRouting{
+		{Client: "10.0.0.7", Requests: 100, Misrouted: 98},
+		{Client: "10.0.0.9", Requests: 300, Misrouted: 25},
+	}
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'm'}); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "screen_misroutes.golden", []byte(g.String()))
+	if notes := strings.Join(footerNotes(numfmt.Formatter{}, u.prevReport, Stats{}), "  "); !strings.Contains(notes, "Misrouted: 12.3%") {
+		t.Error("misroute percentage missing from footer:", notes)
+	}
+
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'c'}); err != nil {
+		t.Fatal(err)
+	}
+	if u.misrouteView {
+		t.Error("misroute view kept with connection view")
+	}
+}
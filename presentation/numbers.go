@@ -0,0 +1,32 @@
+package presentation
+
+import (
+	"strings"
+
+	"github.com/box/memsniff/numfmt"
+)
+
+// byteColumn returns true if the value column named name measures bytes, such
+// as sum(size) or bw(resp), rather than counting things.
+func byteColumn(name string) bool {
+	if strings.HasPrefix(name, "bw(") {
+		return true
+	}
+	if strings.HasPrefix(name, "count(") || strings.HasPrefix(name, "distinct(") {
+		return false
+	}
+	return strings.HasSuffix(name, "(size)") || strings.HasSuffix(name, "(reqsize)")
+}
+
+// formatValue writes v, a value of the column named name, with nf.  A
+// negative percentage, such as top% when no callers are counted, is unknown
+// and written as a dash.
+func formatValue(nf numfmt.Formatter, name string, v int64) string {
+	if v < 0 && strings.HasSuffix(name, "%") {
+		return "—"
+	}
+	if byteColumn(name) {
+		return nf.Bytes(v)
+	}
+	return nf.Count(v)
+}
@@ -0,0 +1,68 @@
+package presentation
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+func TestFormatValue(t *testing.T) {
+	human := numfmt.Formatter{Style: numfmt.Human}
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{"sum(size)", "2.0 MiB"},
+		{"p99(reqsize)", "2.0 MiB"},
+		{"bw(resp)", "2.0 MiB"},
+		{"count(size)", "2.1M"},
+		{"distinct(client)", "2.1M"},
+		{"sum(hit)", "2.1M"},
+		{"score", "2.1M"},
+	}
+	for _, c := range cases {
+		if s := formatValue(human, c.name, 2097152); s != c.expected {
+			t.Errorf("%s: %q", c.name, s)
+		}
+	}
+	if s := formatValue(human, "top%", -1); s != "—" {
+		t.Error("unknown top%:", s)
+	}
+	if s := formatValue(human, "top clnt%", 98); s != "98" {
+		t.Error("top clnt%:", s)
+	}
+}
+
+func TestTextHumanNumbers(t *testing.T) {
+	rep := mctopReport()
+	rep.TotalRows = 12345
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{Style: numfmt.Human}, rep, time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "text_human.golden", buf.Bytes())
+
+	buf.Reset()
+	if err := writeMctop(&buf, numfmt.Formatter{Style: numfmt.Human}, mctopReport(), time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	var raw bytes.Buffer
+	if err := writeMctop(&raw, numfmt.Formatter{}, mctopReport(), time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != raw.String() {
+		t.Error("mctop output should ignore the number format")
+	}
+}
+
+func TestFooterGroupedNumbers(t *testing.T) {
+	grouped := numfmt.Formatter{Style: numfmt.Grouped}
+	rep := analysis.Report{Rows: make([]analysis.ReportRow, 10), TotalRows: 1234567}
+	notes := footerNotes(grouped, rep, Stats{PacketsFragmented: 4321})
+	if len(notes) != 2 || notes[0] != "Fragments: 4,321" || notes[1] != "Keys: top 10 of 1,234,567" {
+		t.Error(notes)
+	}
+}
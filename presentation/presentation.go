@@ -5,6 +5,7 @@ package presentation
 import (
 	"fmt"
 	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
 	"time"
 )
 
@@ -17,48 +18,181 @@ type UIHandler interface {
 	Log(items ...interface{})
 }
 
+// Analyzer is the source of the reports shown by the interactive interface,
+// usually an analysis.Pool.
+type Analyzer interface {
+	ReportTop(shouldReset bool, n int, columns ...int) analysis.Report
+	MarkDiscontinuous()
+	ColumnNames() (keyCols, valCols []string)
+	BandwidthBasis() analysis.BandwidthBasis
+	SetBandwidthBasis(b analysis.BandwidthBasis)
+	RankBasis() analysis.RankBasis
+	SetRankBasis(b analysis.RankBasis)
+	SetAcknowledgedKeys(keys []string)
+	GroupKeys(group string) ([]string, bool)
+	Chunks(key string) (analysis.ChunkFanout, bool)
+	Expiry(key string) (analysis.KeyExpiry, bool)
+	Servers(key string) ([]analysis.ServerCount, bool)
+	WatchedSizes(key string) ([]analysis.SizeSample, bool)
+	ValueSampling() int
+	ArmValueSample(key string) error
+	ValueSample(key string) (analysis.ValueSample, bool)
+	Routing(key string) (analysis.KeyRouting, bool)
+	LastRestart(server string) (time.Time, bool)
+	SetMaintenance(until time.Time)
+	Maintenance() (time.Time, bool)
+	RecordConfigChange(source, setting, value string)
+}
+
 type uiContext struct {
-	analysis     *analysis.Pool
-	interval     time.Duration
-	statProvider StatProvider
-	messages     []string
-	msgChan      chan string
-	prevReport   analysis.Report
-	cumulative   bool
-	paused       bool
+	analysis   Analyzer
+	screen     Screen
+	clock      clock
+	interval   time.Duration
+	stats      *StatTracker
+	messages   []string
+	msgChan    chan string
+	prevReport analysis.Report
+	cumulative bool
+	paused     bool
+	// sortBy is the index of the value column by which keys are ranked, or
+	// -1 to use the default column.
+	sortBy int
+	// selected is the index of the highlighted row in prevReport.
+	selected int
+	// detailKey is the key shown in the detail view, or nil when showing
+	// the list of keys.
+	detailKey []string
+	// acked is the set of acknowledged keys, which are dimmed, or hidden if
+	// hideAcked is true.
+	acked     map[string]bool
+	hideAcked bool
+	// prompt is the command being typed after ':', or nil if no command
+	// is being entered.
+	prompt []rune
+	// dropThresholds sets the severity of packets dropped by each stage,
+	// and dropsWarned records the stages whose severe drops were logged.
+	dropThresholds DropThresholds
+	dropsWarned    map[string]bool
+	// connView is true when showing the list of connections instead of
+	// keys, ranked by connSort.
+	connView bool
+	connSort connSort
+	// misrouteView is true when showing the clients sending requests to
+	// servers that do not own their keys instead of keys.
+	misrouteView bool
+	// selfHidden is true when the resources used by memsniff are hidden
+	// from the footer.
+	selfHidden bool
+	// watermark is shown at the top right of every view, if not empty.
+	watermark string
+	// keyTree, if not empty, are the delimiters at which keys are split
+	// into a tree, whose node at treePrefix is shown by its children.
+	keyTree    string
+	treePrefix string
+	// numbers formats the numbers shown.
+	numbers numfmt.Formatter
+	// baseline, if not nil, supplies the reports a day earlier, and
+	// compared is the comparison of prevReport with one of them, or nil if
+	// none is available.
+	baseline Baseline
+	compared *comparison
 }
 
 // Stats collects statistics on runtime performance to be displayed to the user.
+// Every field but ClassifierCost, CaptureHealth, the Disk fields and the Self
+// fields is a counter.
 type Stats struct {
 	// count of packets that entered the kernel BPF
-	PacketsEnteredFilter int
+	PacketsEnteredFilter int `json:"packets_entered_filter"`
 	// count of packets that passed the BPF and queued or dropped by the kernel
-	PacketsPassedFilter int
+	PacketsPassedFilter int `json:"packets_passed_filter"`
 	// count of packets received from pcap
-	PacketsCaptured int
+	PacketsCaptured int `json:"packets_captured"`
 	// count of packets dropped due to kernel buffer overflow
-	PacketsDroppedKernel int
+	PacketsDroppedKernel int `json:"packets_dropped_kernel"`
 	// count of packets dropped due to no decoder available
-	PacketsDroppedParser int
+	PacketsDroppedParser int `json:"packets_dropped_parser"`
 	// count of packets dropped due to analysis queue being full
-	PacketsDroppedAnalysis int
-	PacketsDroppedTotal    int
-	ResponsesParsed        int
+	PacketsDroppedAnalysis int `json:"packets_dropped_analysis"`
+	PacketsDroppedTotal    int `json:"packets_dropped_total"`
+	// count of IP fragments, which are captured but cannot be parsed
+	PacketsFragmented int `json:"packets_fragmented"`
+	// count of TCP packets larger than the MTU, coalesced from several
+	// segments by GRO or LRO before capture
+	PacketsCoalesced int `json:"packets_coalesced"`
+	// count of loopback packets captured twice on the Linux any
+	// pseudo-interface, whose outgoing copies were ignored
+	PacketsLoopbackCopies int `json:"packets_loopback_copies"`
+	// count of new connections that reused the addresses and ports of one
+	// whose end was not seen
+	ConnectionsReused int `json:"connections_reused"`
+	// count of refused attempts to change the protocol of a connection,
+	// which indicates a bug
+	ProtocolReclassified int `json:"protocol_reclassified"`
+	ResponsesParsed      int `json:"responses_parsed"`
+	// count of connections whose data exceeded the parse budget, once per
+	// interval in which they did, and of the bytes they sent that were
+	// skipped
+	ConnectionsThrottled int `json:"connections_throttled"`
+	BytesThrottled       int `json:"bytes_throttled"`
+	// count of events whose key was changed by key normalization
+	KeysNormalized int `json:"keys_normalized"`
+	// count of rows merged into others by reports listing a key twice,
+	// which indicates a bug
+	DuplicateKeys int `json:"duplicate_keys"`
+	// mean duration of a call to the key classifier, or 0 if none is set
+	ClassifierCost time.Duration `json:"classifier_cost_ns"`
+	// CaptureHealth describes a lost network interface, or is empty while
+	// capturing normally.
+	CaptureHealth string `json:"capture_health,omitempty"`
+	// bytes taken by the files memsniff writes, the budget for them, or 0
+	// if there is none, and the number of file sinks paused to stay
+	// within it
+	DiskUsed   int64 `json:"disk_used,omitempty"`
+	DiskLimit  int64 `json:"disk_limit,omitempty"`
+	DiskPaused int   `json:"disk_paused,omitempty"`
+	// resources used by memsniff itself as of the end of the last
+	// interval: resident memory in bytes and the percentage of one core
+	// used over the interval, both 0 where unknown, whether that exceeded
+	// --self-limit-cpu, the total time paused for garbage collection since
+	// the start, and the number of goroutines
+	SelfRSS        int64         `json:"self_rss_bytes,omitempty"`
+	SelfCPU        float64       `json:"self_cpu_percent"`
+	SelfCPUOver    bool          `json:"self_cpu_over_limit,omitempty"`
+	SelfGCPause    time.Duration `json:"self_gc_pause_ns"`
+	SelfGoroutines int           `json:"self_goroutines,omitempty"`
 }
 
-// StatProvider returns a snapshot of current runtime statistics.
+// StatProvider returns a snapshot of current runtime statistics, counting from
+// the start of the capture.
 type StatProvider func() Stats
 
-// New returns a UIHandler that is ready to run
-func New(analysisPool *analysis.Pool, interval time.Duration, cumulative bool, statProvider StatProvider) UIHandler {
+// New returns a UIHandler that is ready to run.  If watermark is not empty, it
+// is shown prominently in the header, for example to mark synthetic data.  If
+// keyTree is not empty, keys are shown as a tree split after each of its
+// characters, starting from the first level.  Numbers are written with
+// numbers.  If baseline is not nil, the change of each key since the same time
+// a day earlier is shown alongside it.
+func New(analysisPool Analyzer, interval time.Duration, cumulative bool, stats *StatTracker, dropThresholds DropThresholds, watermark string, keyTree string, numbers numfmt.Formatter, baseline Baseline) UIHandler {
 	return &uiContext{
-		analysis:     analysisPool,
-		interval:     interval,
-		statProvider: statProvider,
-		msgChan:      make(chan string, 128),
-		prevReport:   analysis.Report{},
-		cumulative:   cumulative,
-		paused:       false,
+		analysis:       analysisPool,
+		screen:         termboxScreen{},
+		clock:          realClock{},
+		interval:       interval,
+		stats:          stats,
+		msgChan:        make(chan string, 128),
+		prevReport:     analysis.Report{},
+		cumulative:     cumulative,
+		paused:         false,
+		sortBy:         -1,
+		acked:          make(map[string]bool),
+		dropThresholds: dropThresholds,
+		dropsWarned:    make(map[string]bool),
+		watermark:      watermark,
+		keyTree:        keyTree,
+		numbers:        numbers,
+		baseline:       baseline,
 	}
 }
 
@@ -0,0 +1,51 @@
+package presentation
+
+import (
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+	"strings"
+)
+
+// handlePromptKey edits or runs the command being entered after ':'.
+func (u *uiContext) handlePromptKey(ev termbox.Event) error {
+	switch ev.Key {
+	case termbox.KeyEsc, termbox.KeyCtrlC:
+		u.prompt = nil
+	case termbox.KeyEnter:
+		line := string(u.prompt)
+		u.prompt = nil
+		u.runCommand(line)
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		if len(u.prompt) > 0 {
+			u.prompt = u.prompt[:len(u.prompt)-1]
+		}
+	case termbox.KeySpace:
+		u.prompt = append(u.prompt, ' ')
+	default:
+		if ev.Ch != 0 {
+			u.prompt = append(u.prompt, ev.Ch)
+		}
+	}
+	return u.render()
+}
+
+// runCommand carries out a command entered after ':'.
+func (u *uiContext) runCommand(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	switch fields[0] {
+	case "ack", "unack":
+		u.ackCommand(fields[0], fields[1:])
+	case "maint":
+		u.maintCommand(fields[1:])
+	default:
+		u.Log("Unknown command:", fields[0])
+	}
+}
+
+func (u *uiContext) renderPrompt() {
+	u.renderText(0, u.yFromBottom(0), ":"+string(u.prompt))
+	u.screen.SetCursor(runewidth.StringWidth(string(u.prompt))+1, u.yFromBottom(0))
+}
@@ -0,0 +1,36 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/nsf/termbox-go"
+)
+
+func TestRankBasisKey(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	for _, want := range []analysis.RankBasis{analysis.RankGets, analysis.RankSets, analysis.RankDeletes, analysis.RankAll} {
+		if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'R'}); err != nil {
+			t.Fatal(err)
+		}
+		if b := u.analysis.RankBasis(); b != want {
+			t.Error("basis", b, "want", want)
+		}
+	}
+
+	u.prevReport.RankBasis = analysis.RankSets
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(g.String(), "ranked by sets") {
+		t.Errorf("ranking missing from header:\n%s", g)
+	}
+	u.prevReport.RankBasis = analysis.RankAll
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(g.String(), "ranked by") {
+		t.Errorf("default ranking shown in header:\n%s", g)
+	}
+}
@@ -0,0 +1,17 @@
+package presentation
+
+import (
+	"strings"
+
+	"github.com/box/memsniff/analysis"
+)
+
+// restartLabel lists the servers in rep that appeared to restart, with the
+// time of each restart.
+func restartLabel(rep analysis.Report) string {
+	parts := make([]string, len(rep.Restarts))
+	for i, r := range rep.Restarts {
+		parts[i] = r.Server + " at " + r.Time.Format("15:04:05")
+	}
+	return "⚠ Restarted: " + strings.Join(parts, ", ")
+}
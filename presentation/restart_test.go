@@ -0,0 +1,36 @@
+package presentation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+func TestRestartLabels(t *testing.T) {
+	at := time.Date(2017, 3, 1, 14, 2, 11, 0, time.Local)
+	rep := mctopReport()
+	rep.Restarts = []analysis.ServerRestart{{Server: "10.3.4.7:11211", Time: at, Closed: 40, Reconnected: 38}}
+
+	if notes := strings.Join(footerNotes(numfmt.Formatter{}, rep, Stats{}), "  "); !strings.Contains(notes, "⚠ Restarted: 10.3.4.7:11211 at 14:02:11") {
+		t.Error("restart missing from footer:", notes)
+	}
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := buf.ReadString('\n'); !strings.Contains(line, "⚠ Restarted: 10.3.4.7:11211 at 14:02:11") {
+		t.Errorf("restart missing from header %q", line)
+	}
+
+	lastRestart := func(server string) (time.Time, bool) {
+		return at, server == "10.3.4.7:11211"
+	}
+	label := serversLabel(numfmt.Formatter{}, []analysis.ServerCount{{Server: "10.3.4.7:11211", Requests: 120}, {Server: "10.3.4.8:11211", Requests: 3}}, lastRestart)
+	if label != "served by 10.3.4.7:11211 (120, restarted 14:02:11), 10.3.4.8:11211 (3)" {
+		t.Error(label)
+	}
+}
@@ -0,0 +1,61 @@
+package presentation
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// valueSamplingBanner warns on the first line that values are being read,
+// since they can hold private data.
+const valueSamplingBanner = " ⚠ VALUE SAMPLING ON "
+
+// handleValueSample samples the next value retrieved for the key in the
+// detail view.
+func (u *uiContext) handleValueSample() error {
+	if u.detailKey == nil {
+		return nil
+	}
+	key := u.detailKeyColumn()
+	if err := u.analysis.ArmValueSample(key); err != nil {
+		u.Log("Cannot sample value:", err)
+		return nil
+	}
+	u.Log("Sampling the next value of", key)
+	return u.render()
+}
+
+// renderValueSample shows the last value sampled for detailKey as a hex and
+// ASCII dump, starting at line y and ending before line bottom.
+func (u *uiContext) renderValueSample(y, bottom int) {
+	if u.analysis.ValueSampling() == 0 {
+		return
+	}
+	vs, ok := u.analysis.ValueSample(u.detailKeyColumn())
+	if !ok {
+		u.renderText(0, y, "no value sampled (press v to sample the next)")
+		return
+	}
+	u.renderText(0, y, fmt.Sprintf("value sample: first %d of %s at %s (v to sample again)",
+		len(vs.Data), u.numbers.ByteSize(int64(vs.Size)), vs.Time.Format("15:04:05")))
+	for _, line := range strings.Split(strings.TrimSuffix(hex.Dump([]byte(vs.Data)), "\n"), "\n") {
+		y++
+		if y >= bottom {
+			return
+		}
+		u.renderText(0, y, line)
+	}
+}
+
+// renderValueSampling shows a warning on the first line, ending at column
+// right, while value sampling is on, returning the column at which it starts.
+func (u *uiContext) renderValueSampling(right int) int {
+	if u.analysis.ValueSampling() == 0 {
+		return right
+	}
+	left := right - runewidth.StringWidth(valueSamplingBanner)
+	u.renderTextAt(left, 0, valueSamplingBanner, styleAlert|styleSelected)
+	return left
+}
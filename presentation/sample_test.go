@@ -0,0 +1,56 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/protocol/model"
+	"github.com/nsf/termbox-go"
+)
+
+func TestValueSample(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	pool := u.analysis.(*analysis.Pool)
+	pool.SetWatchedKeys([]string{"user:1234"})
+	if err := u.handleSelect(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.handleDetail(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(g.String(), "VALUE SAMPLING") || strings.Contains(g.String(), "no value sampled") {
+		t.Error("sampling shown while off:\n", g.String())
+	}
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'v'}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-u.msgChan; !strings.Contains(msg, "value sampling is off") {
+		t.Error(msg)
+	}
+
+	pool.SetValueSampling(analysis.DefaultValueSampleLen)
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'v'}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := strings.TrimSpace(<-u.msgChan); msg != "Sampling the next value of user:1234" {
+		t.Error(msg)
+	}
+	if line := strings.Split(g.String(), "\n")[0]; !strings.HasSuffix(line, strings.TrimRight(valueSamplingBanner, " ")) {
+		t.Errorf("warning missing from header %q", line)
+	}
+	if !strings.Contains(g.String(), "no value sampled (press v to sample the next)") {
+		t.Error("missing sample prompt:\n", g.String())
+	}
+
+	pool.HandleEvents([]model.Event{{Type: model.EventGetHit, Key: "user:1234", Size: 2097152, Sample: "<html><body>hi"}})
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	screen := g.String()
+	if !strings.Contains(screen, "value sample: first 14 of 2097152 bytes") ||
+		!strings.Contains(screen, "00000000  3c 68 74 6d 6c 3e 3c 62  6f 64 79 3e 68 69") ||
+		!strings.Contains(screen, "|<html><body>hi|") {
+		t.Error("sample not shown:\n", screen)
+	}
+}
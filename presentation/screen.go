@@ -0,0 +1,50 @@
+package presentation
+
+import (
+	"github.com/nsf/termbox-go"
+)
+
+// Screen is a grid of character cells on which the interactive display is
+// drawn.  Drawing is buffered until Flush.
+type Screen interface {
+	// SetCell draws ch at column x of line y.  Cells outside the screen are
+	// ignored.
+	SetCell(x, y int, ch rune, fg, bg termbox.Attribute)
+	// Size returns the width and height of the screen in cells.
+	Size() (width, height int)
+	// Clear blanks every cell.
+	Clear() error
+	// Flush shows everything drawn since the last Flush.
+	Flush() error
+	// SetCursor moves the cursor to column x of line y, or hides it if
+	// either is negative.
+	SetCursor(x, y int)
+}
+
+// termboxScreen draws on the terminal through termbox, which must be
+// initialized.
+type termboxScreen struct{}
+
+func (termboxScreen) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	termbox.SetCell(x, y, ch, fg, bg)
+}
+
+func (termboxScreen) Size() (int, int) {
+	return termbox.Size()
+}
+
+func (termboxScreen) Clear() error {
+	return termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+}
+
+func (termboxScreen) Flush() error {
+	return termbox.Flush()
+}
+
+func (termboxScreen) SetCursor(x, y int) {
+	if x < 0 || y < 0 {
+		termbox.HideCursor()
+		return
+	}
+	termbox.SetCursor(x, y)
+}
@@ -0,0 +1,241 @@
+package presentation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// cellGrid is a Screen held in memory.
+type cellGrid struct {
+	width, height int
+	cells         []rune
+	fg            []termbox.Attribute
+	cursorX       int
+	cursorY       int
+	flushes       int
+}
+
+func newCellGrid(width, height int) *cellGrid {
+	g := &cellGrid{
+		width:  width,
+		height: height,
+		cells:  make([]rune, width*height),
+		fg:     make([]termbox.Attribute, width*height),
+	}
+	g.Clear()
+	return g
+}
+
+func (g *cellGrid) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	if x < 0 || x >= g.width || y < 0 || y >= g.height {
+		return
+	}
+	g.cells[y*g.width+x] = ch
+	g.fg[y*g.width+x] = fg
+}
+
+func (g *cellGrid) Size() (int, int) {
+	return g.width, g.height
+}
+
+func (g *cellGrid) Clear() error {
+	for i := range g.cells {
+		g.cells[i] = ' '
+		g.fg[i] = termbox.ColorDefault
+	}
+	g.cursorX, g.cursorY = -1, -1
+	return nil
+}
+
+func (g *cellGrid) Flush() error {
+	g.flushes++
+	return nil
+}
+
+func (g *cellGrid) SetCursor(x, y int) {
+	g.cursorX, g.cursorY = x, y
+}
+
+// attr returns the foreground attributes of the cell at x, y.
+func (g *cellGrid) attr(x, y int) termbox.Attribute {
+	return g.fg[y*g.width+x]
+}
+
+// String returns the contents of each line, without trailing spaces.
+func (g *cellGrid) String() string {
+	var sb strings.Builder
+	for y := 0; y < g.height; y++ {
+		var line []rune
+		for x := 0; x < g.width; x++ {
+			r := g.cells[y*g.width+x]
+			if r < ' ' {
+				// such as the newline ending a log message
+				r = ' '
+			}
+			line = append(line, r)
+			if w := runewidth.RuneWidth(r); w > 1 {
+				// wide characters cover the following cells
+				x += w - 1
+			}
+		}
+		sb.WriteString(strings.TrimRight(string(line), " "))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func screenContext(t *testing.T, width, height int) (*uiContext, *cellGrid) {
+	u := ackContext(t)
+	g := newCellGrid(width, height)
+	u.screen = g
+	u.stats = NewStatTracker(func() Stats {
+		return Stats{PacketsPassedFilter: 1200, ResponsesParsed: 530}
+	})
+	return u, g
+}
+
+// TestResizeRedraws checks that resizing the terminal redraws the screen
+// without ending the interval early.
+func TestResizeRedraws(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	var reports int
+	u.analysis.(*analysis.Pool).SetReportHook(func(analysis.Report) {
+		reports++
+	})
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventResize}); err != nil {
+		t.Fatal(err)
+	}
+	if reports != 0 {
+		t.Error(reports, "reports built on resize")
+	}
+	if g.flushes != 1 {
+		t.Error("expected one flush, got", g.flushes)
+	}
+}
+
+func TestRenderSizes(t *testing.T) {
+	sizes := []struct{ width, height int }{
+		{80, 24},
+		{120, 12},
+		{40, 9},
+	}
+	for _, sz := range sizes {
+		u, g := screenContext(t, sz.width, sz.height)
+		u.Log("capture started")
+		u.handleNewMessage(<-u.msgChan)
+		if err := u.render(); err != nil {
+			t.Fatal(err)
+		}
+		if g.flushes != 1 {
+			t.Error("expected one flush, got", g.flushes)
+		}
+		checkGolden(t, fmt.Sprintf("screen_%dx%d.golden", sz.width, sz.height), []byte(g.String()))
+	}
+}
+
+func TestRenderSelected(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	u.runCommand("ack empty")
+	if err := u.handleSelect(1); err != nil {
+		t.Fatal(err)
+	}
+	if g.attr(0, 3)&termbox.AttrReverse == 0 {
+		t.Error("selected row not highlighted")
+	}
+	if g.attr(0, 2)&termbox.AttrReverse != 0 {
+		t.Error("unselected row highlighted")
+	}
+	if g.attr(0, 5) != termbox.ColorBlack|termbox.AttrBold {
+		t.Error("acknowledged row not dimmed")
+	}
+}
+
+func TestRenderDetail(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	if err := u.handleSelect(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.handleDetail(); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "screen_detail.golden", []byte(g.String()))
+}
+
+func TestRenderPrompt(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: ':'}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range "ack" {
+		if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: ch}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.HasSuffix(g.String(), ":ack\n") {
+		t.Errorf("prompt not shown on last line:\n%s", g)
+	}
+	if g.cursorX != 4 || g.cursorY != 23 {
+		t.Error("cursor at", g.cursorX, g.cursorY)
+	}
+}
+
+func TestRenderWatermark(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	u.watermark = " DEMO "
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	if line := strings.Split(g.String(), "\n")[0]; !strings.HasSuffix(line, " DEMO") {
+		t.Errorf("watermark missing from header %q", line)
+	}
+	if g.attr(79, 0) != styleWatermark {
+		t.Error("watermark not styled")
+	}
+}
+
+func TestRenderConnections(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	u.prevReport.Connections = []analysis.ConnTraffic{
+		{Conn: "10.0.0.1:40000", RequestBytes: 20, ResponseBytes: 90000},
+		{Conn: "10.0.0.2:40000", RequestBytes: 0, ResponseBytes: 50000},
+		{Conn: "10.0.0.3:40000", RequestBytes: 3000, ResponseBytes: 60000},
+	}
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'c'}); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "screen_conns.golden", []byte(g.String()))
+
+	// ranked by amplification, with the undefined ratio last
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 's'}); err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, c := range u.sortedConns(u.prevReport) {
+		order = append(order, c.Conn)
+	}
+	if strings.Join(order, " ") != "10.0.0.1:40000 10.0.0.3:40000 10.0.0.2:40000" {
+		t.Error(order)
+	}
+	if u.sortBy != -1 {
+		t.Error("key ranking changed in connection view")
+	}
+}
+
+func TestRenderNoTraffic(t *testing.T) {
+	u, g := screenContext(t, 80, 24)
+	u.prevReport.Rows, u.prevReport.TotalRows = nil, 0
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	if line := strings.Split(g.String(), "\n")[2]; line != noTrafficLabel {
+		t.Errorf("body shows %q", line)
+	}
+	if g.attr(0, 2) != styleDimmed {
+		t.Error("no traffic label not dimmed")
+	}
+}
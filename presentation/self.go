@@ -0,0 +1,41 @@
+package presentation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/box/memsniff/numfmt"
+	"github.com/mattn/go-runewidth"
+)
+
+// selfLabel summarizes the resources used by memsniff itself in s, leaving out
+// memory and CPU where unknown.
+func selfLabel(nf numfmt.Formatter, s Stats) string {
+	label := "memsniff:"
+	if s.SelfRSS > 0 {
+		label += fmt.Sprintf(" %s, %s CPU,", nf.ByteSize(s.SelfRSS), nf.Percent(s.SelfCPU, 1))
+	}
+	return label + fmt.Sprintf(" GC %v, %s goroutines", s.SelfGCPause.Round(time.Millisecond), nf.Count(int64(s.SelfGoroutines)))
+}
+
+// renderSelf shows the resources used by memsniff at the right end of line y,
+// once they have been sampled, unless hidden.  They are shown as an alert
+// while exceeding --self-limit-cpu.
+func (u *uiContext) renderSelf(y int, s Stats) {
+	if u.selfHidden || s.SelfGoroutines == 0 {
+		return
+	}
+	w, _ := u.screen.Size()
+	label := " " + selfLabel(u.numbers, s)
+	style := styleDimmed
+	if s.SelfCPUOver {
+		style = styleAlert
+	}
+	u.renderTextAt(w-runewidth.StringWidth(label), y, label, style)
+}
+
+// handleSelfToggle shows or hides the resources used by memsniff.
+func (u *uiContext) handleSelfToggle() error {
+	u.selfHidden = !u.selfHidden
+	return u.render()
+}
@@ -0,0 +1,61 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/numfmt"
+	"github.com/nsf/termbox-go"
+)
+
+func TestSelfLabel(t *testing.T) {
+	s := Stats{SelfRSS: 52428800, SelfCPU: 3.14, SelfGCPause: 12345678 * time.Nanosecond, SelfGoroutines: 38}
+	if got, want := selfLabel(numfmt.Formatter{Style: numfmt.Human}, s), "memsniff: 50.0 MiB, 3.1% CPU, GC 12ms, 38 goroutines"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// memory and CPU are unknown without /proc
+	s.SelfRSS, s.SelfCPU = 0, 0
+	if got, want := selfLabel(numfmt.Formatter{}, s), "memsniff: GC 12ms, 38 goroutines"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestRenderSelf checks that the resources used by memsniff are shown at the
+// right of the footer, as an alert while over the CPU limit, until hidden.
+func TestRenderSelf(t *testing.T) {
+	u, g := screenContext(t, 120, 24)
+	stats := Stats{SelfGCPause: time.Millisecond, SelfGoroutines: 12}
+	u.stats = NewStatTracker(func() Stats { return stats })
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	footer := strings.Split(g.String(), "\n")[23]
+	if !strings.HasSuffix(footer, " memsniff: GC 1ms, 12 goroutines") {
+		t.Fatalf("usage not at right of footer %q", footer)
+	}
+	if fg := g.attr(119, 23); fg != styleDimmed {
+		t.Errorf("usage shown as %v", fg)
+	}
+
+	stats.SelfCPUOver = true
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	if fg := g.attr(119, 23); fg != styleAlert {
+		t.Errorf("usage over limit shown as %v", fg)
+	}
+
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'u'}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(g.String(), "goroutines") {
+		t.Error("usage shown once hidden")
+	}
+	if err := u.handleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'u'}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(g.String(), "goroutines") {
+		t.Error("usage not shown again")
+	}
+}
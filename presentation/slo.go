@@ -0,0 +1,23 @@
+package presentation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// sloLabel summarizes compliance with the latency SLO over its window, and
+// whether the latest interval violated it.
+func sloLabel(nf numfmt.Formatter, s analysis.SLOStatus) string {
+	window := "last " + numfmt.Duration(s.Window)
+	if s.Window == time.Hour {
+		window = "last hour"
+	}
+	label := fmt.Sprintf("SLO: %s of intervals compliant (%s)", nf.Percent(s.CompliantPercent(), 1), window)
+	if s.Violated {
+		label += fmt.Sprintf(" ⚠ p%v %v > %v", s.Percentile, s.Observed, s.Target)
+	}
+	return label
+}
@@ -0,0 +1,34 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+func TestSLOLabel(t *testing.T) {
+	s := analysis.SLOStatus{
+		Target:     2 * time.Millisecond,
+		Percentile: 99,
+		Window:     time.Hour,
+		Intervals:  500,
+		Compliant:  496,
+	}
+	if label := sloLabel(numfmt.Formatter{}, s); label != "SLO: 99.2% of intervals compliant (last hour)" {
+		t.Error(label)
+	}
+
+	s.Window = 30 * time.Minute
+	s.Violated, s.Observed = true, 3100*time.Microsecond
+	if label := sloLabel(numfmt.Formatter{}, s); label != "SLO: 99.2% of intervals compliant (last 30m) ⚠ p99 3.1ms > 2ms" {
+		t.Error(label)
+	}
+
+	rep := analysis.Report{SLO: &s}
+	if notes := strings.Join(footerNotes(numfmt.Formatter{}, rep, Stats{}), "  "); !strings.Contains(notes, "SLO: 99.2%") {
+		t.Error("SLO missing from footer:", notes)
+	}
+}
@@ -0,0 +1,34 @@
+package presentation
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the last width values as a bar chart one line high, with
+// bars scaled between the smallest and largest of those values.
+func sparkline(vals []int, width int) string {
+	if len(vals) > width {
+		vals = vals[len(vals)-width:]
+	}
+	if len(vals) == 0 {
+		return ""
+	}
+
+	min, max := vals[0], vals[0]
+	for _, v := range vals {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	res := make([]rune, len(vals))
+	for i, v := range vals {
+		level := 0
+		if max > min {
+			level = (v - min) * (len(sparkRunes) - 1) / (max - min)
+		}
+		res[i] = sparkRunes[level]
+	}
+	return string(res)
+}
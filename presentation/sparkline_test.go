@@ -0,0 +1,27 @@
+package presentation
+
+import "testing"
+
+func TestSparkline(t *testing.T) {
+	if s := sparkline([]int{0, 7, 14, 21, 28, 35, 42, 49}, 80); s != "▁▂▃▄▅▆▇█" {
+		t.Error(s)
+	}
+}
+
+func TestSparklineFlat(t *testing.T) {
+	if s := sparkline([]int{5, 5, 5}, 80); s != "▁▁▁" {
+		t.Error(s)
+	}
+}
+
+func TestSparklineTruncatesOldest(t *testing.T) {
+	if s := sparkline([]int{100, 0, 1}, 2); s != "▁█" {
+		t.Error(s)
+	}
+}
+
+func TestSparklineEmpty(t *testing.T) {
+	if s := sparkline(nil, 80); s != "" {
+		t.Error(s)
+	}
+}
@@ -0,0 +1,148 @@
+package presentation
+
+import (
+	"sync"
+	"time"
+)
+
+// StatsVersion is the version of the JSON form of StatsSnapshot.  It changes
+// whenever the meaning of an existing field changes, so that consumers of
+// exported statistics can tell the difference.
+const StatsVersion = 1
+
+// wrap32 is the range of the 32-bit packet counters kept by libpcap.
+const wrap32 = int64(1) << 32
+
+// StatsSnapshot is the runtime statistics at one moment, both over the life
+// of the capture and over the most recent reporting interval.
+type StatsSnapshot struct {
+	Version int `json:"version"`
+	// Lifetime counts from the start of the capture.
+	Lifetime Stats `json:"lifetime"`
+	// Interval counts over the most recent interval ended by
+	// StatTracker.EndInterval, or from the start of the capture if none
+	// has ended.  ClassifierCost, CaptureHealth, the Disk fields and the
+	// Self fields are as of the end of the interval.
+	Interval Stats `json:"interval"`
+	// IntervalStart and IntervalEnd are the bounds of Interval.
+	IntervalStart time.Time `json:"interval_start"`
+	IntervalEnd   time.Time `json:"interval_end"`
+}
+
+// StatTracker computes the statistics of each reporting interval from the
+// lifetime counters of a StatProvider, by subtracting those at the start of
+// the interval from those at its end.  Whatever produces reports ends each
+// interval, and every other consumer sees the same intervals.  StatTracker is
+// threadsafe, and calls its StatProvider with a lock held.
+type StatTracker struct {
+	provider StatProvider
+	now      func() time.Time
+	mu       sync.Mutex
+	start    time.Time
+	// mark is the lifetime statistics at the end of the last interval.
+	mark  Stats
+	ended bool
+	last  StatsSnapshot
+	// onEnd are called at the end of each interval, in order.
+	onEnd []func()
+}
+
+// NewStatTracker returns a StatTracker whose first interval starts now.
+func NewStatTracker(sp StatProvider) *StatTracker {
+	st := &StatTracker{provider: sp, now: time.Now}
+	st.start = st.now()
+	return st
+}
+
+// Snapshot returns the current lifetime statistics, and those of the most
+// recent complete interval.
+func (st *StatTracker) Snapshot() StatsSnapshot {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	lifetime := st.provider()
+	if !st.ended {
+		return StatsSnapshot{
+			Version:       StatsVersion,
+			Lifetime:      lifetime,
+			Interval:      lifetime,
+			IntervalStart: st.start,
+			IntervalEnd:   st.now(),
+		}
+	}
+	snap := st.last
+	snap.Lifetime = lifetime
+	return snap
+}
+
+// OnEndInterval causes f to be called at the end of each interval, before its
+// statistics are read, after any functions given earlier, for stages of the
+// pipeline that keep their own state per interval or sample statistics too
+// costly to read on every Snapshot.  OnEndInterval is not threadsafe and
+// should be called before the StatTracker is in use.
+func (st *StatTracker) OnEndInterval(f func()) {
+	st.onEnd = append(st.onEnd, f)
+}
+
+// EndInterval ends the current interval, returning a snapshot including its
+// statistics, and starts the next.
+func (st *StatTracker) EndInterval() StatsSnapshot {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, f := range st.onEnd {
+		f()
+	}
+	lifetime := st.provider()
+	start := st.start
+	if st.ended {
+		start = st.last.IntervalEnd
+	}
+	st.last = StatsSnapshot{
+		Version:       StatsVersion,
+		Lifetime:      lifetime,
+		Interval:      lifetime.since(st.mark),
+		IntervalStart: start,
+		IntervalEnd:   st.now(),
+	}
+	st.mark, st.ended = lifetime, true
+	return st.last
+}
+
+// since returns the change in the counters of s from prev.  ClassifierCost,
+// CaptureHealth, the Disk fields and the Self fields, which are not counters,
+// are those of s.
+func (s Stats) since(prev Stats) Stats {
+	d := s
+	d.PacketsEnteredFilter = counterDelta(s.PacketsEnteredFilter, prev.PacketsEnteredFilter)
+	d.PacketsPassedFilter = counterDelta(s.PacketsPassedFilter, prev.PacketsPassedFilter)
+	d.PacketsCaptured = counterDelta(s.PacketsCaptured, prev.PacketsCaptured)
+	d.PacketsDroppedKernel = counterDelta(s.PacketsDroppedKernel, prev.PacketsDroppedKernel)
+	d.PacketsDroppedParser = counterDelta(s.PacketsDroppedParser, prev.PacketsDroppedParser)
+	d.PacketsDroppedAnalysis = counterDelta(s.PacketsDroppedAnalysis, prev.PacketsDroppedAnalysis)
+	d.PacketsDroppedTotal = counterDelta(s.PacketsDroppedTotal, prev.PacketsDroppedTotal)
+	d.PacketsFragmented = counterDelta(s.PacketsFragmented, prev.PacketsFragmented)
+	d.PacketsCoalesced = counterDelta(s.PacketsCoalesced, prev.PacketsCoalesced)
+	d.PacketsLoopbackCopies = counterDelta(s.PacketsLoopbackCopies, prev.PacketsLoopbackCopies)
+	d.ConnectionsReused = counterDelta(s.ConnectionsReused, prev.ConnectionsReused)
+	d.ProtocolReclassified = counterDelta(s.ProtocolReclassified, prev.ProtocolReclassified)
+	d.ConnectionsThrottled = counterDelta(s.ConnectionsThrottled, prev.ConnectionsThrottled)
+	d.BytesThrottled = counterDelta(s.BytesThrottled, prev.BytesThrottled)
+	d.ResponsesParsed = counterDelta(s.ResponsesParsed, prev.ResponsesParsed)
+	d.KeysNormalized = counterDelta(s.KeysNormalized, prev.KeysNormalized)
+	d.DuplicateKeys = counterDelta(s.DuplicateKeys, prev.DuplicateKeys)
+	return d
+}
+
+// counterDelta returns the increase of a counter from prev to cur.  A counter
+// that went backwards either wrapped around, as the 32-bit counters kept by
+// libpcap do, or was reset, as when a capture is reopened.  Wrapping is
+// assumed if prev was in the upper half of the 32-bit range, and otherwise
+// the counter is taken to have restarted from 0.
+func counterDelta(cur, prev int) int {
+	if cur >= prev {
+		return cur - prev
+	}
+	if p := int64(prev); p >= wrap32/2 && p < wrap32 {
+		return int(int64(cur) + wrap32 - p)
+	}
+	return cur
+}
@@ -0,0 +1,82 @@
+package presentation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		cur, prev, want int
+	}{
+		{150, 100, 50},
+		{100, 100, 0},
+		// reset, as when the capture is reopened
+		{30, 100, 30},
+		// a 32-bit pcap counter wrapping around
+		{5, 1<<32 - 10, 15},
+		{5, 1 << 31, 1<<31 + 5},
+	}
+	for _, tt := range tests {
+		if got := counterDelta(tt.cur, tt.prev); got != tt.want {
+			t.Errorf("counterDelta(%d, %d) = %d, want %d", tt.cur, tt.prev, got, tt.want)
+		}
+	}
+}
+
+func TestStatTracker(t *testing.T) {
+	lifetime := Stats{PacketsCaptured: 100, ResponsesParsed: 40, ClassifierCost: time.Microsecond}
+	start := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	st := NewStatTracker(func() Stats { return lifetime })
+	st.start, st.now = start, func() time.Time { return now }
+
+	// before any interval has ended, the interval is the whole capture
+	if snap := st.Snapshot(); snap.Interval != lifetime || snap.Lifetime != lifetime || snap.Version != StatsVersion {
+		t.Error(snap)
+	}
+
+	now = now.Add(time.Second)
+	if snap := st.EndInterval(); snap.Interval.PacketsCaptured != 100 || !snap.IntervalStart.Equal(start) {
+		t.Error(snap)
+	}
+	lifetime.PacketsCaptured, lifetime.ResponsesParsed = 130, 45
+	lifetime.ClassifierCost = 2 * time.Microsecond
+	// the last complete interval, with current lifetime counters
+	if snap := st.Snapshot(); snap.Interval.PacketsCaptured != 100 || snap.Lifetime.PacketsCaptured != 130 {
+		t.Error(snap)
+	}
+
+	now = now.Add(time.Second)
+	snap := st.EndInterval()
+	want := Stats{PacketsCaptured: 30, ResponsesParsed: 5, ClassifierCost: 2 * time.Microsecond}
+	if snap.Interval != want {
+		t.Errorf("interval %+v, want %+v", snap.Interval, want)
+	}
+	if !snap.IntervalStart.Equal(start.Add(time.Second)) || !snap.IntervalEnd.Equal(now) {
+		t.Error(snap.IntervalStart, snap.IntervalEnd)
+	}
+
+	// counters reset part way through
+	lifetime.PacketsCaptured = 10
+	if snap := st.EndInterval(); snap.Interval.PacketsCaptured != 10 {
+		t.Error(snap.Interval)
+	}
+}
+
+// TestOnEndInterval checks that the hooks set by OnEndInterval run in order
+// once per interval ended, before its statistics are read.
+func TestOnEndInterval(t *testing.T) {
+	var ended, sampled int
+	st := NewStatTracker(func() Stats { return Stats{ConnectionsThrottled: ended, SelfGoroutines: sampled} })
+	st.OnEndInterval(func() { ended++ })
+	st.OnEndInterval(func() { sampled = ended * 10 })
+	st.Snapshot()
+	if ended != 0 {
+		t.Error("hook run by Snapshot")
+	}
+	st.EndInterval()
+	if snap := st.EndInterval(); ended != 2 || snap.Interval.ConnectionsThrottled != 1 || snap.Interval.SelfGoroutines != 20 {
+		t.Error(ended, snap.Interval)
+	}
+}
@@ -0,0 +1,50 @@
+package presentation
+
+import (
+	"github.com/nsf/termbox-go"
+)
+
+// Styles of text in the interactive display.
+const (
+	styleDefault = termbox.ColorDefault
+	// styleSortColumn marks the heading of the column keys are ranked by.
+	styleSortColumn = termbox.AttrBold
+	// styleSelected is added to the style of the highlighted row.
+	styleSelected = termbox.AttrReverse
+	// styleDimmed is for rows of lesser interest, such as acknowledged keys
+	// and responses not matched to a key.
+	styleDimmed = termbox.ColorBlack | termbox.AttrBold
+	// styleAlert is for conditions that need attention, such as a lost
+	// network interface.
+	styleAlert = termbox.ColorRed | termbox.AttrBold
+	// styleWatermark is for the watermark, which must not be missed in a
+	// screenshot.
+	styleWatermark = termbox.ColorYellow | termbox.AttrBold | termbox.AttrReverse
+	// styleMaintenance is for the banner shown during a maintenance
+	// window, while alerts are suppressed.
+	styleMaintenance = termbox.ColorMagenta | termbox.AttrBold | termbox.AttrReverse
+	// styleEmphasis is added to the style of a severity to make it stand
+	// out further.
+	styleEmphasis = termbox.AttrBold
+)
+
+// severity classifies how concerning a measurement is.
+type severity int
+
+const (
+	severityOK severity = iota
+	severityWarn
+	severitySevere
+)
+
+// style returns the color in which a measurement of severity s is shown.
+func (s severity) style() termbox.Attribute {
+	switch s {
+	case severityWarn:
+		return termbox.ColorYellow
+	case severitySevere:
+		return termbox.ColorRed
+	default:
+		return termbox.ColorGreen
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
 	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
-	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,16 +15,32 @@ const (
 	numColumns  = 12
 	statusLines = 1
 	logLines    = 4
+	// reportMargin is the number of rows kept beyond those that fit on
+	// screen, so that a resized terminal still has rows to show.
+	reportMargin = 20
+	// cellEllipsis ends the text of a report cell cut short to fit.
+	cellEllipsis = "…"
 )
 
 var (
 	errQuitRequested = errors.New("user requested to quit")
 )
 
+// TerminalError is returned by UIHandler.Run when the terminal cannot be used
+// for the interactive interface, such as when TERM names a terminal without
+// the capabilities required.
+type TerminalError struct {
+	Err error
+}
+
+func (e TerminalError) Error() string {
+	return "cannot start the interactive interface: " + e.Err.Error()
+}
+
 func (u *uiContext) runTermbox() error {
 	err := termbox.Init()
 	if err != nil {
-		return err
+		return TerminalError{err}
 	}
 	defer func() {
 		// ensure that the termboxEvents goroutine shuts down
@@ -35,19 +52,19 @@ func (u *uiContext) runTermbox() error {
 }
 
 func (u *uiContext) eventLoop() error {
-	updateTick := time.NewTicker(u.interval)
-	defer updateTick.Stop()
+	timer := newUpdateTimer(u.clock, u.interval)
 	events := termboxEvents()
-	if err := u.update(); err != nil {
+	if err := u.update(false); err != nil {
 		return err
 	}
 
 	for {
 		select {
-		case <-updateTick.C:
-			if err := u.update(); err != nil {
+		case <-timer.C:
+			if err := u.update(timer.gap() > 0); err != nil {
 				return err
 			}
+			timer.reset()
 
 		case msg := <-u.msgChan:
 			u.handleNewMessage(msg)
@@ -80,25 +97,77 @@ func termboxEvents() <-chan termbox.Event {
 func (u *uiContext) handleEvent(ev termbox.Event) error {
 	switch ev.Type {
 	case termbox.EventKey:
+		if u.prompt != nil {
+			return u.handlePromptKey(ev)
+		}
+		if ev.Ch == ':' {
+			u.prompt = []rune{}
+			return u.render()
+		}
+		if ev.Ch == 'k' {
+			return u.handleAck()
+		}
+		if ev.Ch == 'h' {
+			return u.handleHideAcked()
+		}
 		if ev.Ch == 'p' {
 			u.handlePause()
 		}
+		if ev.Ch == 'c' {
+			return u.handleConnView()
+		}
+		if ev.Ch == 's' && u.connView {
+			return u.handleConnSort()
+		}
+		if ev.Ch == 's' {
+			if err := u.handleSort(); err != nil {
+				return err
+			}
+		}
+		if ev.Ch == 'b' {
+			u.handleBandwidthBasis()
+		}
+		if ev.Ch == 'R' {
+			u.handleRankBasis()
+		}
+		if ev.Ch == 'm' {
+			return u.handleMisrouteView()
+		}
+		if ev.Ch == 'Z' {
+			return u.handleMaintenance()
+		}
+		if ev.Ch == 'v' {
+			return u.handleValueSample()
+		}
+		if ev.Ch == 'u' {
+			return u.handleSelfToggle()
+		}
 		if ev.Ch == 'q' || ev.Key == termbox.KeyCtrlC {
 			return errQuitRequested
 		}
+		switch ev.Key {
+		case termbox.KeyArrowUp:
+			return u.handleSelect(u.selected - 1)
+		case termbox.KeyArrowDown:
+			return u.handleSelect(u.selected + 1)
+		case termbox.KeyEnter:
+			return u.handleDetail()
+		case termbox.KeyEsc:
+			u.detailKey = nil
+			return u.render()
+		case termbox.KeyBackspace, termbox.KeyBackspace2:
+			return u.handleDrillUp()
+		}
 		if ev.Key == termbox.KeyCtrlL {
-			if err := u.update(); err != nil {
-				return err
-			}
+			// redraw without ending the interval early
 			if err := termbox.Sync(); err != nil {
 				return err
 			}
+			return u.render()
 		}
 
 	case termbox.EventResize:
-		if err := u.update(); err != nil {
-			return err
-		}
+		return u.render()
 	}
 	return nil
 }
@@ -112,6 +181,76 @@ func (u *uiContext) handlePause() {
 	}
 }
 
+// handleSort ranks keys by the next value column, wrapping around to the
+// first after the last.
+func (u *uiContext) handleSort() error {
+	names := u.prevReport.ValColNames
+	if len(names) == 0 {
+		return nil
+	}
+	next := 0
+	if col := u.sortColumn(); col < 0 {
+		next = (-col - len(u.prevReport.KeyColNames) + 1) % len(names)
+	}
+	u.sortBy = next
+	u.analysis.RecordConfigChange(sourceKeyboard, "sort", names[next])
+	// Only the rows busiest by the previous column are available until the
+	// next update.
+	u.prevReport.SortBy(u.sortColumn())
+	u.compared = compare(u.baseline, u.prevReport, u.sortColumn(), u.interval, u.cumulative)
+	return u.render()
+}
+
+// sortColumn returns the argument to Report.SortBy for the current ranking.
+func (u *uiContext) sortColumn() int {
+	keyCols, valCols := u.analysis.ColumnNames()
+	return sortColumn(analysis.Report{KeyColNames: keyCols, ValColNames: valCols}, u.sortBy)
+}
+
+// handleBandwidthBasis switches the bw column to measure the next kind of
+// traffic, starting with the next report.
+func (u *uiContext) handleBandwidthBasis() {
+	b := u.analysis.BandwidthBasis().Next()
+	u.analysis.SetBandwidthBasis(b)
+	u.analysis.RecordConfigChange(sourceKeyboard, "bw", b.String())
+	u.Log("Bandwidth measured as", b, "bytes from next update")
+}
+
+// handleRankBasis ranks keys by the next class of operations, starting with
+// the next report.
+func (u *uiContext) handleRankBasis() {
+	b := u.analysis.RankBasis().Next()
+	u.analysis.SetRankBasis(b)
+	u.analysis.RecordConfigChange(sourceKeyboard, "rank", b.String())
+	u.Log("Keys ranked by", b, "from next update")
+}
+
+// handleSelect highlights row n of the report, if it exists.
+func (u *uiContext) handleSelect(n int) error {
+	if u.connView || u.misrouteView || u.detailKey != nil || n < 0 || n >= len(u.displayed().Rows) {
+		return nil
+	}
+	u.selected = n
+	return u.render()
+}
+
+// handleDetail switches between the list of keys and the detail view of the
+// highlighted key, or shows the children of the highlighted node of the key
+// tree.
+func (u *uiContext) handleDetail() error {
+	if u.connView || u.misrouteView {
+		return nil
+	}
+	if u.detailKey != nil {
+		u.detailKey = nil
+	} else if u.handleDrillDown() {
+		// showing the children of a node instead
+	} else if rep := u.displayed(); u.selected < len(rep.Rows) && u.isTreeKey(rep, rep.Rows[u.selected]) {
+		u.detailKey = rep.Rows[u.selected].Key
+	}
+	return u.render()
+}
+
 func (u *uiContext) handleNewMessage(msg string) {
 	if len(u.messages) < logLines {
 		u.messages = append(u.messages, msg)
@@ -120,115 +259,487 @@ func (u *uiContext) handleNewMessage(msg string) {
 	}
 }
 
-func renderHeader(rep analysis.Report) {
+func (u *uiContext) renderHeader(rep analysis.Report, sortCol int) {
 	var col int
 	for _, h := range rep.KeyColNames {
-		renderText(col, 0, h)
+		if h == "key" && u.keyTree != "" {
+			h = u.breadcrumbs()
+		}
+		u.renderCell(col, 4, 0, h, styleDefault)
 		col += 4
 	}
-	for _, h := range rep.ValColNames {
-		renderText(col, 0, h)
+	for i, h := range rep.ValColNames {
+		fg := styleDefault
+		if -sortCol == len(rep.KeyColNames)+i {
+			fg = styleSortColumn
+		}
+		u.renderCell(col, u.valueSpan(col, i, len(rep.ValColNames)), 0, h, fg)
 		col++
 	}
-	renderLine(0, 12, 1, '-')
+	if u.compared != nil {
+		u.renderText(col, 0, baselineTitle)
+	}
+	// a warning replaces the line below the header when responses are
+	// missing
+	if sev := responseDropThresholds.classify(rep.DropRate); sev != severityOK {
+		u.renderTextAttr(0, 1, dropWarning(u.numbers, rep.DropRate), sev.style()|styleEmphasis)
+	} else {
+		u.renderLine(0, 12, 1, '-')
+	}
+	var labels []string
+	if rep.RankBasis != analysis.RankAll {
+		labels = append(labels, rankLabel(rep.RankBasis))
+	}
+	if u.cumulative {
+		labels = append(labels, cumulativeLabel(rep.Decay))
+	}
+	if len(labels) > 0 {
+		label := " " + strings.Join(labels, ", ") + " "
+		w, _ := u.screen.Size()
+		u.renderTextAt(w-runewidth.StringWidth(label), 1, label, styleDefault)
+	}
+}
+
+// rankLabel describes the ranking of keys by b.
+func rankLabel(b analysis.RankBasis) string {
+	return "ranked by " + b.String()
+}
+
+// reportRows returns the number of report rows that fit on screen.
+func (u *uiContext) reportRows() int {
+	return u.yFromBottom(statusLines+logLines) - 1
 }
 
-func renderReport(rep analysis.Report) {
-	lastY := yFromBottom(statusLines + logLines)
+func (u *uiContext) renderReport(rep analysis.Report) {
+	lastY := u.yFromBottom(statusLines + logLines)
+	pseudoKey, pseudoVals, pseudo := unattributedRow(u.numbers, rep)
+	if pseudo {
+		// keep the last line for the unattributed row
+		lastY--
+	}
+	y := 2
+	if noTraffic(rep) && !rep.Timestamp.IsZero() {
+		u.renderTextAttr(0, y, noTrafficLabel, styleDimmed)
+		return
+	}
 	for i, r := range rep.Rows {
 		col := 0
-		y := i + 2
-		for _, h := range r.Key {
-			renderText(col, y, h)
+		fg := styleDefault
+		if u.isAcked(rep, r) {
+			fg = styleDimmed
+		}
+		if i == u.selected {
+			fg |= styleSelected
+		}
+		branch := u.isBranch(rep, r)
+		for j, h := range r.Key {
+			if branch && rep.KeyColNames[j] == "key" {
+				h += treeSeparator
+			}
+			if ck, ok := coldConnKey(rep, h); ok && rep.KeyColNames[j] == "key" {
+				h += coldConnMarker(u.numbers, ck)
+			}
+			u.renderCell(col, 4, y, h, fg)
 			col += 4
 		}
-		for _, v := range r.Values {
-			renderText(col, y, strconv.Itoa(int(v)))
+		for j, v := range r.Values {
+			u.renderCell(col, u.valueSpan(col, j, len(r.Values)), y, formatValue(u.numbers, rep.ValColNames[j], v), fg)
 			col++
 		}
+		if u.compared != nil && !branch {
+			u.renderTextAttr(col, y, u.compared.rowLabel(u.numbers, rep.ValColNames, r), fg)
+		}
 		y++
 		if y > lastY {
 			break
 		}
 	}
+	if pseudo {
+		col := 0
+		for _, h := range pseudoKey {
+			u.renderCell(col, 4, y, h, styleDimmed)
+			col += 4
+		}
+		for j, v := range pseudoVals {
+			u.renderCell(col, u.valueSpan(col, j, len(pseudoVals)), y, v, styleDimmed)
+			col++
+		}
+	}
+}
+
+// renderDetail shows everything known about detailKey: its values in the most
+// recent report, and its recent value sizes and any sample of its value if it
+// is being watched.
+func (u *uiContext) renderDetail() {
+	rep := u.prevReport
+	y := 0
+	for i, name := range rep.KeyColNames {
+		u.renderText(0, y, name)
+		u.renderText(2, y, u.detailKey[i])
+		y++
+	}
+	u.renderLine(0, 12, y, '-')
+	y++
+
+	var row *analysis.ReportRow
+	for i := range rep.Rows {
+		if keysEqual(rep.Rows[i].Key, u.detailKey) {
+			row = &rep.Rows[i]
+			break
+		}
+	}
+	for i, name := range rep.ValColNames {
+		u.renderText(0, y, name)
+		if row != nil {
+			u.renderText(2, y, formatValue(u.numbers, name, row.Values[i]))
+		} else {
+			u.renderText(2, y, "-")
+		}
+		y++
+	}
+	y++
+
+	if keys, ok := u.analysis.GroupKeys(u.detailKeyColumn()); ok {
+		u.renderText(0, y, "group of "+strings.Join(keys, " "))
+		y += 2
+	}
+	if cf, ok := u.analysis.Chunks(u.detailKeyColumn()); ok {
+		u.renderText(0, y, chunksLabel(u.numbers, cf))
+		y += 2
+	}
+	if ke, ok := u.analysis.Expiry(u.detailKeyColumn()); ok {
+		u.renderText(0, y, expiryLabel(u.numbers, ke))
+		y += 2
+	}
+	if servers, ok := u.analysis.Servers(u.detailKeyColumn()); ok {
+		u.renderText(0, y, serversLabel(u.numbers, servers, u.analysis.LastRestart))
+		y += 2
+	}
+	if kr, ok := u.analysis.Routing(u.detailKeyColumn()); ok {
+		u.renderText(0, y, routingLabel(u.numbers, kr))
+		y += 2
+	}
+	if ck, ok := coldConnKey(rep, u.detailKeyColumn()); ok {
+		u.renderText(0, y, coldConnDetail(u.numbers, ck))
+		y += 2
+	}
+	u.renderWatched(y)
+	u.renderValueSample(y+4, u.yFromBottom(statusLines+logLines))
+}
+
+// expiryLabel describes the expiry of the last value stored for a key, and
+// the misses on the key since, by cause.
+func expiryLabel(nf numfmt.Formatter, ke analysis.KeyExpiry) string {
+	expires := "never expires"
+	if !ke.Expires().IsZero() {
+		expires = fmt.Sprintf("expires %s (TTL %v)", ke.Expires().Format("15:04:05"), ke.TTL)
+	}
+	return fmt.Sprintf("stored %s, %s; misses since: %s expiry, %s cold",
+		ke.Stored.Format("15:04:05"), expires, nf.Count(ke.ExpiryMisses), nf.Count(ke.ColdMisses))
+}
+
+// serversLabel lists the servers that handled requests for a key, with the
+// number of requests each handled and when each last restarted, as given by
+// lastRestart.
+func serversLabel(nf numfmt.Formatter, servers []analysis.ServerCount, lastRestart func(string) (time.Time, bool)) string {
+	parts := make([]string, len(servers))
+	for i, s := range servers {
+		if t, ok := lastRestart(s.Server); ok {
+			parts[i] = fmt.Sprintf("%s (%s, restarted %s)", s.Server, nf.Count(s.Requests), t.Format("15:04:05"))
+			continue
+		}
+		parts[i] = fmt.Sprintf("%s (%s)", s.Server, nf.Count(s.Requests))
+	}
+	return "served by " + strings.Join(parts, ", ")
+}
+
+// detailKeyColumn returns the value of the "key" column of detailKey.
+func (u *uiContext) detailKeyColumn() string {
+	for i, name := range u.prevReport.KeyColNames {
+		if name == "key" {
+			return u.detailKey[i]
+		}
+	}
+	return ""
+}
+
+// renderWatched shows the recent value sizes of detailKey, starting at line y,
+// if the key is being watched.
+func (u *uiContext) renderWatched(y int) {
+	samples, ok := u.analysis.WatchedSizes(u.detailKeyColumn())
+	if !ok {
+		u.renderText(0, y, "not watched (use --watch to track value sizes)")
+		return
+	}
+	if len(samples) == 0 {
+		u.renderText(0, y, "watched, no values seen yet")
+		return
+	}
+
+	sizes := make([]int, len(samples))
+	for i, s := range samples {
+		sizes[i] = s.Size
+	}
+	w, _ := u.screen.Size()
+	u.renderText(0, y, fmt.Sprintf("value size: %s, %s samples since %s",
+		u.numbers.ByteSize(int64(sizes[len(sizes)-1])), u.numbers.Count(int64(len(samples))), samples[0].Time.Format("15:04:05")))
+	u.renderText(0, y+1, sparkline(sizes, w))
+	growth := u.numbers.Float(analysis.GrowthRate(samples), 1)
+	if !strings.HasPrefix(growth, "-") {
+		growth = "+" + growth
+	}
+	u.renderText(0, y+2, "growth: "+growth+" bytes/minute")
+}
+
+func keysEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func (u *uiContext) renderMessages() {
 	for i, msg := range u.messages {
-		renderText(0, yFromBottom(i+statusLines), msg)
+		u.renderText(0, u.yFromBottom(i+statusLines), msg)
 	}
 }
 
+// renderFooter shows the packets handled and dropped over the most recent
+// interval, notes on conditions seen since the start of the capture, and the
+// resources used by memsniff itself.
 func (u *uiContext) renderFooter(rep analysis.Report) {
-	y := yFromBottom(0)
-	stats := u.statProvider()
-	renderText(0, y, rep.Timestamp.Format("15:04:05.000"))
+	y := u.yFromBottom(0)
+	snap := u.stats.Snapshot()
+	x := u.renderTextAt(0, y, rep.Timestamp.Format("15:04:05.000")+"  ", styleDefault)
+	x = u.renderDrops(x, y, snap.Interval)
+	x = u.renderTextAt(x, y, fmt.Sprintf("  Packets: %s  GET responses: %s  ",
+		u.numbers.Count(int64(snap.Interval.PacketsPassedFilter)), u.numbers.Count(int64(snap.Interval.ResponsesParsed))), styleDefault)
+	if snap.Lifetime.CaptureHealth != "" {
+		x = u.renderTextAt(x, y, snap.Lifetime.CaptureHealth+"  ", styleAlert)
+	}
+	notes := footerNotes(u.numbers, rep, snap.Lifetime)
+	if u.baseline != nil && !u.cumulative {
+		notes = append(notes, u.compared.totalLabel(u.numbers, rep))
+	}
+	u.renderTextAt(x, y, strings.Join(notes, "  "), styleDefault)
+	u.renderSelf(y, snap.Lifetime)
+}
 
-	renderText(2, y, dropLabel(stats))
-	renderText(4, y, fmt.Sprintf("Packets: %10d", stats.PacketsPassedFilter))
-	renderText(6, y, fmt.Sprintf("GET responses: %10d", stats.ResponsesParsed))
+// renderDrops shows the percentage of packets dropped by each stage of the
+// pipeline, colored by severity, and any connections throttled by the parse
+// budget, starting at screen position x and returning the position following
+// it.  All are emphasized if any stage drops enough.
+func (u *uiContext) renderDrops(x, y int, stats Stats) int {
+	var emphasis termbox.Attribute
+	for _, st := range dropStages(stats) {
+		if dropRate(stats, st.dropped) > u.dropThresholds.Emphasize {
+			emphasis = styleEmphasis
+		}
+	}
+	x = u.renderTextAt(x, y, "Dropped:", styleDefault)
+	for _, st := range dropStages(stats) {
+		rate := dropRate(stats, st.dropped)
+		fg := u.dropThresholds.classify(rate).style() | emphasis
+		x = u.renderTextAt(x, y, fmt.Sprintf(" %s %s", st.name, u.numbers.Percent(rate*100, 2)), fg)
+	}
+	if stats.ConnectionsThrottled > 0 {
+		// skipped deliberately, so not counted among the drops
+		x = u.renderTextAt(x, y, " "+throttleLabel(u.numbers, stats), severityWarn.style()|emphasis)
+	}
+	return x
 }
 
-func dropLabel(s Stats) string {
-	var dropRate float64
-	if s.PacketsPassedFilter == 0 {
-		dropRate = 0
-	} else {
-		dropRate = float64(s.PacketsDroppedTotal) / float64(s.PacketsPassedFilter)
+// footerNotes describes conditions worth noticing that are usually absent.
+func footerNotes(nf numfmt.Formatter, rep analysis.Report, stats Stats) []string {
+	var notes []string
+	if stats.PacketsFragmented > 0 {
+		notes = append(notes, "Fragments: "+nf.Count(int64(stats.PacketsFragmented)))
+	}
+	if stats.PacketsLoopbackCopies > 0 {
+		notes = append(notes, "Loopback copies: "+nf.Count(int64(stats.PacketsLoopbackCopies)))
+	}
+	if stats.ConnectionsReused > 0 {
+		notes = append(notes, "Conn reuse: "+nf.Count(int64(stats.ConnectionsReused)))
+	}
+	if stats.ProtocolReclassified > 0 {
+		notes = append(notes, fmt.Sprintf("⚠ Reclassified: %s (bug)", nf.Count(int64(stats.ProtocolReclassified))))
+	}
+	if stats.DuplicateKeys > 0 {
+		notes = append(notes, fmt.Sprintf("⚠ Duplicate keys: %s (bug)", nf.Count(int64(stats.DuplicateKeys))))
+	}
+	if stats.KeysNormalized > 0 {
+		notes = append(notes, "Normalized: "+nf.Count(int64(stats.KeysNormalized)))
 	}
+	if stats.ClassifierCost > 0 {
+		notes = append(notes, fmt.Sprintf("Classify: %v/key", stats.ClassifierCost))
+	}
+	if stats.DiskUsed > 0 || stats.DiskPaused > 0 {
+		notes = append(notes, diskLabel(nf, stats))
+	}
+	if rep.Discontinuous {
+		notes = append(notes, "Interrupted")
+	}
+	if rep.KeysSingleGet+rep.KeysMultiGet > 0 {
+		notes = append(notes, multiGetLabel(nf, rep))
+	}
+	if rep.Skew.Keys > 1 {
+		notes = append(notes, skewLabel(nf, rep.Skew))
+	}
+	if rep.KeysSplit > 0 {
+		notes = append(notes, splitLabel(nf, rep))
+	}
+	if rep.RoutedRequests > 0 {
+		notes = append(notes, misrouteLabel(nf, rep))
+	}
+	if len(rep.ColdConnKeys) > 0 {
+		notes = append(notes, coldConnLabel(nf, rep))
+	}
+	if len(rep.Restarts) > 0 {
+		notes = append(notes, restartLabel(rep))
+	}
+	if len(rep.ConfigChanges) > 0 {
+		notes = append(notes, configLabel(rep))
+	}
+	if rep.SLO != nil {
+		notes = append(notes, sloLabel(nf, *rep.SLO))
+	}
+	if rep.Warmup != nil {
+		notes = append(notes, warmupLabel(nf, *rep.Warmup))
+	}
+	if shown := len(rep.Rows); rep.TotalRows > shown {
+		notes = append(notes, topKeysLabel(nf, rep))
+	}
+	return notes
+}
+
+func (u *uiContext) renderText(column int, y int, txt string) {
+	u.renderTextAttr(column, y, txt, styleDefault)
+}
+
+func (u *uiContext) renderTextAttr(column int, y int, txt string, fg termbox.Attribute) {
+	u.renderTextAt(u.columnX(column), y, txt, fg)
+}
 
-	return fmt.Sprintf("Dropped: %d+%d+%d=%d (%5.2f%%)",
-		s.PacketsDroppedKernel, s.PacketsDroppedParser,
-		s.PacketsDroppedAnalysis, s.PacketsDroppedTotal, dropRate*100)
+// renderCell draws txt in the span columns starting at column, cut short with
+// an ellipsis where it would leave no space before the next column.
+func (u *uiContext) renderCell(column, span, y int, txt string, fg termbox.Attribute) {
+	x := u.columnX(column)
+	width := u.columnX(column+span) - x
+	if column+span < numColumns {
+		width--
+	}
+	if width <= 0 {
+		return
+	}
+	if runewidth.StringWidth(txt) > width {
+		txt = runewidth.Truncate(txt, width, cellEllipsis)
+	}
+	u.renderTextAt(x, y, txt, fg)
 }
 
-func renderText(column int, y int, txt string) {
-	x := columnX(column)
-	runes := []rune(txt)
+// valueSpan returns the columns available to value j of n starting at column:
+// the last value takes the rest of the line unless the comparison with a
+// baseline follows it.
+func (u *uiContext) valueSpan(column, j, n int) int {
+	if j == n-1 && u.compared == nil && column < numColumns {
+		return numColumns - column
+	}
+	return 1
+}
 
-	for _, r := range runes {
-		termbox.SetCell(x, y, r, termbox.ColorDefault, termbox.ColorDefault)
+// renderTextAt draws txt starting at screen position x, returning the position
+// following it.
+func (u *uiContext) renderTextAt(x int, y int, txt string, fg termbox.Attribute) int {
+	for _, r := range txt {
+		u.screen.SetCell(x, y, r, fg, termbox.ColorDefault)
 		x += runewidth.RuneWidth(r)
 	}
+	return x
 }
 
-func renderLine(column int, span int, y int, ch rune) {
+func (u *uiContext) renderLine(column int, span int, y int, ch rune) {
 	w := runewidth.RuneWidth(ch)
-	for x := columnX(column); x < columnX(column+span); x += w {
-		termbox.SetCell(x, y, ch, termbox.ColorDefault, termbox.ColorDefault)
+	for x := u.columnX(column); x < u.columnX(column+span); x += w {
+		u.screen.SetCell(x, y, ch, termbox.ColorDefault, termbox.ColorDefault)
 	}
 }
 
-func columnX(col int) int {
-	w, _ := termbox.Size()
+func (u *uiContext) columnX(col int) int {
+	w, _ := u.screen.Size()
 	if col >= numColumns {
 		return w
 	}
 	return w * col / numColumns
 }
 
-func yFromBottom(n int) int {
-	_, h := termbox.Size()
+func (u *uiContext) yFromBottom(n int) int {
+	_, h := u.screen.Size()
 	return h - 1 - n
 }
 
-func (u *uiContext) update() error {
-	err := termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
-	if err != nil {
-		return err
-	}
-
+// update fetches a new report and redraws the screen.  interrupted is true if
+// the period covered by the report was interrupted, such as by the host being
+// suspended.
+func (u *uiContext) update(interrupted bool) error {
 	// Continue to clear the accumulated data every interval even when paused
 	// so we don't get a big burst of data on unpause.
-	rep := u.analysis.Report(!u.cumulative)
+	n := u.reportRows() + reportMargin
+	if u.keyTree != "" {
+		// every key is needed to roll up the nodes of the tree
+		n = -1
+	}
+	if interrupted {
+		u.analysis.MarkDiscontinuous()
+	}
+	rep := u.analysis.ReportTop(!u.cumulative, n, u.sortColumn())
+	u.warnDrops(u.stats.EndInterval().Interval)
 	if !u.paused {
 		u.prevReport = rep
-		u.prevReport.SortBy(-2)
+		u.compared = compare(u.baseline, rep, u.sortColumn(), u.interval, u.cumulative)
+	}
+	return u.render()
+}
+
+// render redraws the screen from the most recent report.
+func (u *uiContext) render() error {
+	if err := u.screen.Clear(); err != nil {
+		return err
+	}
+
+	if u.connView {
+		u.renderConnections()
+	} else if u.misrouteView {
+		u.renderMisroutes()
+	} else if u.detailKey != nil {
+		u.renderDetail()
+	} else {
+		rep := u.displayed()
+		if u.selected >= len(rep.Rows) {
+			u.selected = 0
+		}
+		u.renderHeader(rep, u.sortColumn())
+		u.renderReport(rep)
+	}
+	w, _ := u.screen.Size()
+	if u.watermark != "" {
+		w -= runewidth.StringWidth(u.watermark)
+		u.renderTextAt(w, 0, u.watermark, styleWatermark)
+	}
+	w = u.renderValueSampling(w)
+	w = u.renderConfigChanged(w)
+	u.renderMaintenance(w)
+	if u.prompt != nil {
+		u.renderPrompt()
+	} else {
+		u.screen.SetCursor(-1, -1)
+		u.renderFooter(u.prevReport)
 	}
-	renderHeader(u.prevReport)
-	renderReport(u.prevReport)
-	u.renderFooter(u.prevReport)
 	u.renderMessages()
 
-	return termbox.Flush()
+	return u.screen.Flush()
 }
@@ -0,0 +1,326 @@
+package presentation
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// TextReporter periodically writes a summary of cache activity to an
+// io.Writer.  It is used in place of the interactive interface when
+// running non-interactively.
+type TextReporter struct {
+	analysis   *analysis.Pool
+	interval   time.Duration
+	cumulative bool
+	// limit is the number of keys in each report, or 0 for all.
+	limit int
+	// fields are the columns included in each report, or nil for all.
+	fields []string
+	// numbers formats the numbers in each report.
+	numbers numfmt.Formatter
+	out     io.Writer
+	write   reportWriter
+	// stats, if not nil, tracks the capture statistics of each interval,
+	// which are included in reports of no traffic.
+	stats *StatTracker
+	clock clock
+	// skipped is the time lost to interruptions since the TextReporter
+	// started, which is excluded from the elapsed time of cumulative
+	// reports.
+	skipped time.Duration
+}
+
+// reportWriter formats a single report to w, writing numbers with nf where
+// the format allows.  elapsed is the span of time
+// over which the data in rep was collected, which is unreliable if rep is
+// Discontinuous.  stats, if not nil, are the capture statistics at the time of
+// the report.
+type reportWriter func(w io.Writer, nf numfmt.Formatter, rep analysis.Report, elapsed time.Duration, stats *StatsSnapshot) error
+
+// NewTextReporter returns a TextReporter that writes reports to out in the
+// named output format, either "text" or "mctop".
+func NewTextReporter(analysisPool *analysis.Pool, interval time.Duration, cumulative bool, output string, out io.Writer) (*TextReporter, error) {
+	var write reportWriter
+	switch output {
+	case "text":
+		write = writeText
+	case "mctop":
+		write = writeMctop
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", output)
+	}
+	return &TextReporter{
+		analysis:   analysisPool,
+		interval:   interval,
+		cumulative: cumulative,
+		out:        out,
+		write:      write,
+		clock:      realClock{},
+	}, nil
+}
+
+// SetLimit keeps only the n busiest keys in each report, or all keys if n is
+// 0.
+func (t *TextReporter) SetLimit(n int) {
+	t.limit = n
+}
+
+// SetFields includes only the named columns in each report, merging keys
+// that no longer differ, or all columns if fields is empty.  The fields are
+// checked against the columns of the analysis Pool.
+func (t *TextReporter) SetFields(fields []string) error {
+	keyCols, valCols := t.analysis.ColumnNames()
+	if err := analysis.CheckFields(fields, keyCols, valCols); err != nil {
+		return err
+	}
+	t.fields = fields
+	return nil
+}
+
+// SetNumberFormat writes the numbers in text reports with nf.  Reports in the
+// mctop format are unaffected.
+func (t *TextReporter) SetNumberFormat(nf numfmt.Formatter) {
+	t.numbers = nf
+}
+
+// SetStatTracker ends an interval of st with each report, and includes its
+// capture statistics in reports of an interval in which no traffic was
+// observed, so that an idle cache can be told apart from a capture that has
+// stopped working.
+func (t *TextReporter) SetStatTracker(st *StatTracker) {
+	t.stats = st
+}
+
+// Run writes a report every interval until done is closed, at which point
+// a final report is written and Run returns.
+func (t *TextReporter) Run(done <-chan struct{}) error {
+	timer := newUpdateTimer(t.clock, t.interval)
+	start := t.clock.Now()
+	last := start
+	for {
+		select {
+		case <-timer.C:
+			if err := t.report(start, last, timer.gap()); err != nil {
+				return err
+			}
+			last = t.clock.Now()
+			timer.reset()
+
+		case <-done:
+			return t.report(start, last, timer.gap())
+		}
+	}
+}
+
+// report writes a report covering the time since last, or since start in
+// cumulative mode.  gap is the time by which the report is overdue, and so
+// was lost to an interruption.
+func (t *TextReporter) report(start, last time.Time, gap time.Duration) error {
+	if gap > 0 {
+		t.analysis.MarkDiscontinuous()
+		t.skipped += gap
+	}
+	rep := t.analysis.Report(!t.cumulative)
+	if err := rep.SelectFields(t.fields); err != nil {
+		return err
+	}
+	if t.limit > 0 {
+		rep.Limit(t.limit, sortColumn(rep, -1))
+	}
+	now := wall(t.clock.Now())
+	elapsed := now.Sub(wall(last))
+	if t.cumulative {
+		elapsed = now.Sub(wall(start)) - t.skipped
+	}
+	var stats *StatsSnapshot
+	if t.stats != nil {
+		snap := t.stats.EndInterval()
+		if noTraffic(rep) {
+			stats = &snap
+		}
+	}
+	return t.write(t.out, t.numbers, rep, elapsed, stats)
+}
+
+// writeText writes rep as an aligned table, preceded by its timestamp and
+// followed by a blank line.  A report with no traffic has a line saying so in
+// place of the table body, with stats if not nil.
+func writeText(w io.Writer, nf numfmt.Formatter, rep analysis.Report, elapsed time.Duration, stats *StatsSnapshot) error {
+	rep.SortBy(sortColumn(rep, -1))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := []string{rep.Timestamp.Format("15:04:05.000")}
+	if rep.KeysSingleGet+rep.KeysMultiGet > 0 {
+		header = append(header, multiGetLabel(nf, rep))
+	}
+	if rep.Skew.Keys > 1 {
+		header = append(header, skewLabel(nf, rep.Skew))
+	}
+	if rep.KeysSplit > 0 {
+		header = append(header, splitLabel(nf, rep))
+	}
+	if rep.RoutedRequests > 0 {
+		header = append(header, misrouteLabel(nf, rep))
+	}
+	if len(rep.ColdConnKeys) > 0 {
+		header = append(header, coldConnLabel(nf, rep))
+	}
+	if len(rep.Restarts) > 0 {
+		header = append(header, restartLabel(rep))
+	}
+	if len(rep.ConfigChanges) > 0 {
+		header = append(header, configLabel(rep))
+	}
+	if rep.SLO != nil {
+		header = append(header, sloLabel(nf, *rep.SLO))
+	}
+	if rep.Warmup != nil {
+		header = append(header, warmupLabel(nf, *rep.Warmup))
+	}
+	if shown := len(rep.Rows); rep.TotalRows > shown {
+		header = append(header, topKeysLabel(nf, rep))
+	}
+	if rep.DropRate > 0 {
+		header = append(header, dropWarning(nf, rep.DropRate))
+	}
+	if rep.Decay > 0 {
+		header = append(header, "("+cumulativeLabel(rep.Decay)+")")
+	}
+	if rep.Discontinuous {
+		header = append(header, discontinuousLabel)
+	}
+	fmt.Fprintln(tw, strings.Join(header, " "))
+	writeTabbed(tw, rep.KeyColNames, rep.ValColNames)
+	for _, r := range rep.Rows {
+		vals := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			vals[i] = formatValue(nf, rep.ValColNames[i], v)
+		}
+		writeTabbed(tw, r.Key, vals)
+	}
+	if key, vals, ok := unattributedRow(nf, rep); ok {
+		writeTabbed(tw, key, vals)
+	}
+	if noTraffic(rep) {
+		line := noTrafficLabel
+		if stats != nil {
+			line += " " + captureLabel(nf, *stats)
+		}
+		fmt.Fprintln(tw, line)
+	}
+	fmt.Fprintln(tw)
+	return tw.Flush()
+}
+
+// noTrafficLabel replaces the body of a report with no traffic, so that an
+// idle interval is not mistaken for a missing one.
+const noTrafficLabel = "no traffic observed this interval"
+
+// noTraffic returns true if no keys or unattributed responses were seen in the
+// period of rep.
+func noTraffic(rep analysis.Report) bool {
+	return len(rep.Rows) == 0 && rep.TotalRows == 0 && rep.UnattributedResponses == 0
+}
+
+// captureLabel summarizes the capture statistics in snap.
+func captureLabel(nf numfmt.Formatter, snap StatsSnapshot) string {
+	return fmt.Sprintf("(this interval: %s packets captured, %s dropped; since start: %s packets captured, %s responses parsed)",
+		nf.Count(int64(snap.Interval.PacketsCaptured)), nf.Count(int64(snap.Interval.PacketsDroppedTotal)),
+		nf.Count(int64(snap.Lifetime.PacketsCaptured)), nf.Count(int64(snap.Lifetime.ResponsesParsed)))
+}
+
+// dropWarning describes the effect of dropping a fraction rate of responses.
+func dropWarning(nf numfmt.Formatter, rate float64) string {
+	return fmt.Sprintf("⚠ %s of responses dropped — counts are underestimates", nf.Percent(rate*100, 0))
+}
+
+// discontinuousLabel marks a report whose period was interrupted.
+const discontinuousLabel = "⚠ interrupted (suspended?) — rates unavailable"
+
+// skewLabel describes how unevenly requests were spread across keys.
+func skewLabel(nf numfmt.Formatter, ks analysis.KeySkew) string {
+	return fmt.Sprintf("Skew: Gini %s, top 1%% %s", nf.Float(ks.Gini, 2), nf.Percent(ks.Top1Share*100, 0))
+}
+
+// splitLabel counts the keys in rep handled by more than one server.
+func splitLabel(nf numfmt.Formatter, rep analysis.Report) string {
+	return "Split keys: " + nf.Count(int64(rep.KeysSplit))
+}
+
+// topKeysLabel notes that rep lists only some of the keys active.
+func topKeysLabel(nf numfmt.Formatter, rep analysis.Report) string {
+	return fmt.Sprintf("Keys: top %s of %s", nf.Count(int64(len(rep.Rows))), nf.Count(int64(rep.TotalRows)))
+}
+
+// cumulativeLabel describes a cumulative report from which keys not seen for
+// decay were removed, or from which no keys were removed if decay is 0.
+func cumulativeLabel(decay time.Duration) string {
+	if decay == 0 {
+		return "cumulative"
+	}
+	return fmt.Sprintf("cumulative, %s decay", numfmt.Duration(decay))
+}
+
+// multiGetLabel describes the share of keys in rep retrieved by multi-key
+// requests.
+func multiGetLabel(nf numfmt.Formatter, rep analysis.Report) string {
+	return fmt.Sprintf("Multiget: %s of %s keys", nf.Percent(rep.MultiGetFraction()*100, 1), nf.Count(rep.KeysSingleGet+rep.KeysMultiGet))
+}
+
+// unattributedRow returns a pseudo-row for the responses in rep that could not
+// be matched to a key, so that totals reconcile with the traffic seen, and
+// whether there were any.  Only columns that follow from the number and size
+// of the responses are filled in; the rest are "-".
+func unattributedRow(nf numfmt.Formatter, rep analysis.Report) (key, vals []string, ok bool) {
+	if rep.UnattributedResponses == 0 {
+		return nil, nil, false
+	}
+	key = make([]string, len(rep.KeyColNames))
+	if len(key) > 0 {
+		key[0] = "(unattributed)"
+	}
+	vals = make([]string, len(rep.ValColNames))
+	for i, name := range rep.ValColNames {
+		switch {
+		case name == "sum(size)" || name == "bw(resp)":
+			vals[i] = nf.Bytes(rep.UnattributedBytes)
+		case strings.HasPrefix(name, "count("):
+			vals[i] = nf.Count(rep.UnattributedResponses)
+		default:
+			vals[i] = "-"
+		}
+	}
+	return key, vals, true
+}
+
+func writeTabbed(w io.Writer, fields ...[]string) {
+	var sep string
+	for _, f := range fields {
+		for _, s := range f {
+			fmt.Fprint(w, sep, s)
+			sep = "\t"
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// sortColumn returns the argument to rep.SortBy to rank keys by value column
+// i, descending.  If i is not a value column, keys are ranked by the third
+// column, which is sum(size) under the default format, or the last column if
+// there are fewer.
+func sortColumn(rep analysis.Report, i int) int {
+	if i >= 0 && i < len(rep.ValColNames) {
+		return -(len(rep.KeyColNames) + i)
+	}
+	numCols := len(rep.KeyColNames) + len(rep.ValColNames)
+	if numCols > 2 {
+		return -2
+	}
+	return -(numCols - 1)
+}
@@ -0,0 +1,296 @@
+package presentation
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+	"github.com/box/memsniff/protocol/model"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+var testTimestamp = time.Date(2017, 6, 1, 12, 34, 56, 789000000, time.UTC)
+
+func mctopReport() analysis.Report {
+	return analysis.Report{
+		Timestamp:   testTimestamp,
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"sum(hit)", "sum(size)"},
+		Rows: []analysis.ReportRow{
+			{Key: []string{"small"}, Values: []int64{10, 1000}},
+			{Key: []string{"user:1234"}, Values: []int64{512, 2097152}},
+			{Key: []string{"a-rather-long-key-name:with:many:parts"}, Values: []int64{10, 2500}},
+			{Key: []string{"empty"}, Values: []int64{3, 0}},
+			{Key: []string{"missing"}, Values: []int64{0, 0}},
+		},
+	}
+}
+
+func TestMctopGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMctop(&buf, numfmt.Formatter{}, mctopReport(), 10*time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "mctop.golden", buf.Bytes())
+}
+
+func TestMctopZeroElapsed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMctop(&buf, numfmt.Formatter{}, mctopReport(), 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "mctop_zero_elapsed.golden", buf.Bytes())
+}
+
+func TestMctopWrongFormat(t *testing.T) {
+	rep := mctopReport()
+	rep.ValColNames = []string{"max(size)", "sum(size)"}
+	var buf bytes.Buffer
+	if err := writeMctop(&buf, numfmt.Formatter{}, rep, time.Second, nil); err != errMctopFormat {
+		t.Error("expected format error, got", err)
+	}
+}
+
+func TestTextGolden(t *testing.T) {
+	rep := analysis.Report{
+		Timestamp:   testTimestamp,
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"max(size)", "sum(size)"},
+		Rows: []analysis.ReportRow{
+			{Key: []string{"key1"}, Values: []int64{10, 20}},
+			{Key: []string{"key22"}, Values: []int64{300, 300}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "text.golden", buf.Bytes())
+}
+
+func TestTextDropWarning(t *testing.T) {
+	rep := analysis.Report{
+		Timestamp:   testTimestamp,
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"sum(size)"},
+		Rows: []analysis.ReportRow{
+			{Key: []string{"key1"}, Values: []int64{20}},
+		},
+		DropRate: 0.15,
+	}
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "text_drops.golden", buf.Bytes())
+}
+
+func TestTextMultiGet(t *testing.T) {
+	rep := analysis.Report{
+		Timestamp:     testTimestamp,
+		KeyColNames:   []string{"key"},
+		ValColNames:   []string{"sum(size)", "multi%"},
+		Rows:          []analysis.ReportRow{{Key: []string{"key1"}, Values: []int64{20, 75}}},
+		KeysSingleGet: 1,
+		KeysMultiGet:  3,
+	}
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "text_multiget.golden", buf.Bytes())
+}
+
+func TestTextUnattributed(t *testing.T) {
+	rep := analysis.Report{
+		Timestamp:             testTimestamp,
+		KeyColNames:           []string{"key", "client"},
+		ValColNames:           []string{"sum(size)", "count(size)", "max(size)"},
+		Rows:                  []analysis.ReportRow{{Key: []string{"key1", "10.0.0.1"}, Values: []int64{20, 2, 10}}},
+		UnattributedResponses: 3,
+		UnattributedBytes:     4500,
+	}
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "text_unattributed.golden", buf.Bytes())
+}
+
+func checkGolden(t *testing.T, name string, actual []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output does not match %s\nexpected:\n%s\nactual:\n%s", path, expected, actual)
+	}
+}
+
+func TestTextDiscontinuous(t *testing.T) {
+	rep := mctopReport()
+	rep.Discontinuous = true
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "text_discontinuous.golden", buf.Bytes())
+	buf.Reset()
+	if err := writeMctop(&buf, numfmt.Formatter{}, rep, time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "mctop_discontinuous.golden", buf.Bytes())
+}
+
+func TestCumulativeLabel(t *testing.T) {
+	cases := []struct {
+		decay    time.Duration
+		expected string
+	}{
+		{0, "cumulative"},
+		{30 * time.Minute, "cumulative, 30m decay"},
+		{2 * time.Hour, "cumulative, 2h decay"},
+		{90 * time.Minute, "cumulative, 1h30m decay"},
+		{30 * time.Second, "cumulative, 30s decay"},
+	}
+	for _, c := range cases {
+		if label := cumulativeLabel(c.decay); label != c.expected {
+			t.Errorf("%v: %q", c.decay, label)
+		}
+	}
+
+	rep := mctopReport()
+	rep.Decay = 30 * time.Minute
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := buf.ReadString('\n'); !strings.Contains(line, "(cumulative, 30m decay)") {
+		t.Errorf("decay missing from header %q", line)
+	}
+}
+
+func TestTextSkew(t *testing.T) {
+	rep := mctopReport()
+	rep.Skew = analysis.KeySkew{Keys: 200, Requests: 400, Gini: 0.495, Top1Share: 0.505}
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := buf.ReadString('\n'); !strings.Contains(line, "Skew: Gini 0.49, top 1% 50%") {
+		t.Errorf("skew missing from header %q", line)
+	}
+}
+
+func TestTextReporterLimit(t *testing.T) {
+	pool, err := analysis.New(1, "key,sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	pool.HandleEvents([]model.Event{
+		{Type: model.EventGetHit, Key: "small", Size: 1},
+		{Type: model.EventGetHit, Key: "large", Size: 100},
+		{Type: model.EventGetHit, Key: "medium", Size: 10},
+	})
+	var buf bytes.Buffer
+	tr, err := NewTextReporter(pool, time.Second, false, "text", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.SetLimit(2)
+	now := time.Now()
+	if err := tr.report(now, now, 0); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Keys: top 2 of 3") || !strings.Contains(out, "medium") || strings.Contains(out, "small") {
+		t.Errorf("unexpected report:\n%s", out)
+	}
+}
+
+func TestTextReporterFields(t *testing.T) {
+	pool, err := analysis.New(1, "key,max(size),sum(size)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	pool.HandleEvents([]model.Event{{Type: model.EventGetHit, Key: "a", Size: 7}})
+	var buf bytes.Buffer
+	tr, err := NewTextReporter(pool, time.Second, false, "text", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.SetFields([]string{"key", "hit_rate"}); err == nil || !strings.Contains(err.Error(), "key, max(size), sum(size)") {
+		t.Error(err)
+	}
+	if err := tr.SetFields([]string{"key", "sum(size)"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := tr.report(now, now, 0); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "sum(size)") || strings.Contains(out, "max(size)") {
+		t.Errorf("unexpected report:\n%s", out)
+	}
+}
+
+func TestTextSplit(t *testing.T) {
+	rep := mctopReport()
+	rep.KeysSplit = 3
+	var buf bytes.Buffer
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := buf.ReadString('\n'); !strings.Contains(line, "Split keys: 3") {
+		t.Errorf("split keys missing from header %q", line)
+	}
+
+	noRestarts := func(string) (time.Time, bool) { return time.Time{}, false }
+	label := serversLabel(numfmt.Formatter{}, []analysis.ServerCount{{Server: "10.0.0.1:11211", Requests: 120}, {Server: "10.0.0.2:11211", Requests: 3}}, noRestarts)
+	if label != "served by 10.0.0.1:11211 (120), 10.0.0.2:11211 (3)" {
+		t.Error(label)
+	}
+}
+
+func TestTextNoTraffic(t *testing.T) {
+	rep := mctopReport()
+	rep.Rows, rep.TotalRows = nil, 0
+	var buf bytes.Buffer
+	stats := StatsSnapshot{
+		Lifetime: Stats{PacketsCaptured: 40, ResponsesParsed: 12},
+		Interval: Stats{PacketsCaptured: 4, PacketsDroppedTotal: 2},
+	}
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Second, &stats); err != nil {
+		t.Fatal(err)
+	}
+	want := "no traffic observed this interval (this interval: 4 packets captured, 2 dropped; since start: 40 packets captured, 12 responses parsed)"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("no traffic not reported:\n%s", buf.String())
+	}
+
+	// unattributed responses are traffic
+	rep.UnattributedResponses = 1
+	buf.Reset()
+	if err := writeText(&buf, numfmt.Formatter{}, rep, time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), noTrafficLabel) {
+		t.Errorf("traffic reported as none:\n%s", buf.String())
+	}
+}
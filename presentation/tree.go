@@ -0,0 +1,71 @@
+package presentation
+
+import (
+	"strings"
+
+	"github.com/box/memsniff/analysis"
+)
+
+// treeSeparator divides the levels of the breadcrumbs shown in the header.
+const treeSeparator = " › "
+
+// rollUp returns rep with its keys combined by the children of the current
+// node of the key tree, limited to the rows that fit on screen.
+func (u *uiContext) rollUp(rep analysis.Report) analysis.Report {
+	return analysis.RollUp(rep, u.keyTree, u.treePrefix, u.reportRows(), u.sortColumn())
+}
+
+// isBranch returns true if row of the displayed report is a node of the key
+// tree with children of its own, rather than a key, and so can be drilled
+// into.
+func (u *uiContext) isBranch(rep analysis.Report, row analysis.ReportRow) bool {
+	if u.keyTree == "" {
+		return false
+	}
+	key, ok := keyOf(rep, row)
+	return ok && analysis.IsTreeBranch(key, u.treePrefix, u.keyTree)
+}
+
+// isTreeKey returns true if row of the displayed report is a key, rather than
+// a node of the key tree or the row combining the children not listed.
+func (u *uiContext) isTreeKey(rep analysis.Report, row analysis.ReportRow) bool {
+	if u.keyTree == "" {
+		return true
+	}
+	key, _ := keyOf(rep, row)
+	return !u.isBranch(rep, row) && key != analysis.OtherChildren
+}
+
+// handleDrillDown shows the children of the highlighted node of the key tree.
+// It returns false if the highlighted row is not a node.
+func (u *uiContext) handleDrillDown() bool {
+	rep := u.displayed()
+	if u.selected >= len(rep.Rows) || !u.isBranch(rep, rep.Rows[u.selected]) {
+		return false
+	}
+	u.treePrefix, _ = keyOf(rep, rep.Rows[u.selected])
+	u.selected = 0
+	return true
+}
+
+// handleDrillUp returns to the parent of the current node of the key tree.
+func (u *uiContext) handleDrillUp() error {
+	if u.keyTree == "" || u.treePrefix == "" || u.connView || u.misrouteView || u.detailKey != nil {
+		return nil
+	}
+	u.treePrefix = analysis.TreeParent(u.treePrefix, u.keyTree)
+	u.selected = 0
+	return u.render()
+}
+
+// breadcrumbs names the current node of the key tree and those above it,
+// starting from the root.
+func (u *uiContext) breadcrumbs() string {
+	crumbs := []string{"key"}
+	for rest := u.treePrefix; rest != ""; {
+		i := strings.IndexAny(rest, u.keyTree)
+		crumbs = append(crumbs, rest[:i+1])
+		rest = rest[i+1:]
+	}
+	return strings.Join(crumbs, treeSeparator)
+}
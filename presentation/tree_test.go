@@ -0,0 +1,85 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/nsf/termbox-go"
+)
+
+func treeContext(t *testing.T) (*uiContext, *cellGrid) {
+	u, g := screenContext(t, 80, 24)
+	u.keyTree = ":"
+	u.prevReport = analysis.Report{
+		KeyColNames: []string{"key"},
+		ValColNames: []string{"sum(size)"},
+		Rows: []analysis.ReportRow{
+			{Key: []string{"user:1:profile"}, Values: []int64{500}},
+			{Key: []string{"user:2:profile"}, Values: []int64{300}},
+			{Key: []string{"user:1:session"}, Values: []int64{100}},
+			{Key: []string{"config"}, Values: []int64{50}},
+		},
+		TotalRows: 4,
+	}
+	return u, g
+}
+
+func pressKey(t *testing.T, u *uiContext, ev termbox.Event) {
+	ev.Type = termbox.EventKey
+	if err := u.handleEvent(ev); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func screenLines(g *cellGrid) []string {
+	return strings.Split(g.String(), "\n")
+}
+
+func TestKeyTreeNavigation(t *testing.T) {
+	u, g := treeContext(t)
+	if err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+	lines := screenLines(g)
+	if !strings.HasPrefix(lines[0], "key ") || !strings.HasPrefix(lines[2], "user: ›") || !strings.Contains(lines[2], "900") ||
+		!strings.HasPrefix(lines[3], "config ") {
+		t.Errorf("root:\n%s", g)
+	}
+
+	pressKey(t, u, termbox.Event{Key: termbox.KeyEnter})
+	pressKey(t, u, termbox.Event{Key: termbox.KeyArrowDown})
+	pressKey(t, u, termbox.Event{Key: termbox.KeyEnter})
+	lines = screenLines(g)
+	if u.treePrefix != "user:2:" || !strings.HasPrefix(lines[0], "key › user: › 2:") ||
+		!strings.HasPrefix(lines[2], "user:2:profile ") {
+		t.Errorf("user:2:\n%s", g)
+	}
+
+	// a key opens its detail view, which Backspace leaves alone
+	pressKey(t, u, termbox.Event{Key: termbox.KeyEnter})
+	pressKey(t, u, termbox.Event{Key: termbox.KeyBackspace2})
+	if u.detailKey == nil || u.treePrefix != "user:2:" {
+		t.Error("detail view of", u.detailKey, "under", u.treePrefix)
+	}
+	pressKey(t, u, termbox.Event{Key: termbox.KeyEsc})
+	pressKey(t, u, termbox.Event{Key: termbox.KeyBackspace2})
+	pressKey(t, u, termbox.Event{Key: termbox.KeyBackspace2})
+	pressKey(t, u, termbox.Event{Key: termbox.KeyBackspace2})
+	if u.treePrefix != "" || !strings.HasPrefix(screenLines(g)[2], "user: ›") {
+		t.Errorf("back at root:\n%s", g)
+	}
+}
+
+func TestKeyTreeAck(t *testing.T) {
+	u, _ := treeContext(t)
+	pressKey(t, u, termbox.Event{Ch: 'k'})
+	if len(u.acked) != 0 {
+		t.Error("node acknowledged:", u.acked)
+	}
+	pressKey(t, u, termbox.Event{Key: termbox.KeyArrowDown})
+	pressKey(t, u, termbox.Event{Ch: 'k'})
+	if !u.acked["config"] {
+		t.Error("key not acknowledged:", u.acked)
+	}
+}
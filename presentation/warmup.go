@@ -0,0 +1,27 @@
+package presentation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+// warmupLabel describes how much of the reference key list has been seen, and
+// when the rest is expected.
+func warmupLabel(nf numfmt.Formatter, wp analysis.WarmupProgress) string {
+	label := fmt.Sprintf("Warmup: %s of %s keys", nf.Percent(wp.Fraction()*100, 1), nf.Count(wp.Reference))
+	switch {
+	case wp.Observed >= wp.Reference:
+		label += ", done"
+	case wp.ETA > 0:
+		label += ", ETA " + numfmt.Duration(wp.ETA.Round(time.Second))
+	default:
+		label += ", ETA unknown"
+	}
+	if wp.Unlisted > 0 {
+		label += fmt.Sprintf(" (%s unlisted)", nf.Count(wp.Unlisted))
+	}
+	return label
+}
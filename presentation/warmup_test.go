@@ -0,0 +1,32 @@
+package presentation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/box/memsniff/analysis"
+	"github.com/box/memsniff/numfmt"
+)
+
+func TestWarmupLabel(t *testing.T) {
+	wp := analysis.WarmupProgress{Reference: 1000000, Observed: 420000, Unlisted: 350, ETA: 12*time.Minute + 400*time.Millisecond}
+	if label := warmupLabel(numfmt.Formatter{}, wp); label != "Warmup: 42.0% of 1000000 keys, ETA 12m (350 unlisted)" {
+		t.Error(label)
+	}
+
+	wp.Unlisted, wp.ETA = 0, 0
+	if label := warmupLabel(numfmt.Formatter{}, wp); label != "Warmup: 42.0% of 1000000 keys, ETA unknown" {
+		t.Error(label)
+	}
+
+	wp.Observed = wp.Reference
+	if label := warmupLabel(numfmt.Formatter{}, wp); label != "Warmup: 100.0% of 1000000 keys, done" {
+		t.Error(label)
+	}
+
+	rep := analysis.Report{Warmup: &wp}
+	if notes := strings.Join(footerNotes(numfmt.Formatter{}, rep, Stats{}), "  "); !strings.Contains(notes, "Warmup: 100.0%") {
+		t.Error("warmup missing from footer:", notes)
+	}
+}
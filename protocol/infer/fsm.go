@@ -29,8 +29,13 @@ func (f *fsm) Run() {
 	var fsm model.Fsm
 	switch out[0] {
 	case '*':
+		if !f.consumer.Classify(model.ProtocolRedis) {
+			f.consumer.Close()
+			return
+		}
 		fsm = redis.NewFsm(f.logger)
 	default:
+		// mctext classifies the conversation, as either text or binary
 		fsm = mctext.NewFsm(f.logger)
 	}
 	fsm.SetConsumer(f.consumer)
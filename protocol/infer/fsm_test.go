@@ -25,6 +25,9 @@ func TestInferRedis(t *testing.T) {
 			Type: model.EventGetHit,
 			Key:  "foo",
 			Size: 3,
+			// *2 $3 GET $3 foo, each followed by CRLF
+			RequestSize: 22,
+			BatchSize:   1,
 		},
 	}
 	test(t, input, output, expected)
@@ -44,6 +47,9 @@ func TestInferMemcached(t *testing.T) {
 			Type: model.EventGetHit,
 			Key:  "hello",
 			Size: 5,
+			// get hello CRLF
+			RequestSize: 11,
+			BatchSize:   1,
 		},
 	}
 	test(t, input, output, expected)
@@ -78,3 +84,27 @@ func test(t *testing.T, input []string, output []string, expected []model.Event)
 		t.Error("Expected", expected, "events but never received")
 	}
 }
+
+// TestInferBinary checks that a connection starting with a binary protocol
+// request stays classified as binary when later packets look like text or
+// Redis commands.
+func TestInferBinary(t *testing.T) {
+	var got []model.Event
+	c := model.New(func(evts []model.Event) {
+		got = append(got, evts...)
+	}, NewFsm(&log.ConsoleLogger{}))
+	header := make([]byte, 24)
+	header[0] = 0x80
+	c.ClientStream().Reassembled(reassemblyString(string(header) + "get x\r\n"))
+	for _, s := range []string{"get x\r\n", "*2\r\n$3\r\nGET\r\n$1\r\nx\r\n"} {
+		c.ClientStream().Reassembled(reassemblyString(s))
+		c.ServerStream().Reassembled(reassemblyString("END\r\n"))
+	}
+	c.FlushEvents()
+	if len(got) != 0 {
+		t.Error("binary connection parsed:", got)
+	}
+	if c.Protocol != model.ProtocolMemcacheBinary {
+		t.Error("classified as", c.Protocol)
+	}
+}
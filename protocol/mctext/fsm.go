@@ -6,6 +6,7 @@ import (
 	"io"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/box/memsniff/assembly/reader"
 	"github.com/box/memsniff/log"
@@ -15,6 +16,8 @@ import (
 const (
 	crlf       = "\r\n"
 	debuglevel = 0
+	// binaryMagic is the first byte of a binary protocol request.
+	binaryMagic = 0x80
 )
 
 var (
@@ -29,6 +32,15 @@ type fsm struct {
 	state    state
 	cmd      string
 	args     []string
+	// nextArg is the index in args of the first requested key that has not
+	// yet been matched to a response.
+	nextArg int
+	// requestLen is the length of the request line read so far, including
+	// delimiters.
+	requestLen int
+	// requestOverhead is the length of the request line excluding arguments
+	// and the spaces preceding them: the command name and line ending.
+	requestOverhead int
 }
 
 type state func() error
@@ -65,7 +77,7 @@ func (f *fsm) Run() {
 }
 
 func (f *fsm) peekBinaryProtocolMagicByte() error {
-	f.consumer.ServerReader.Truncate()
+	f.consumer.DiscardUnattributed()
 	firstByte, err := f.consumer.ClientReader.PeekN(1)
 	if err != nil {
 		if _, ok := err.(reader.ErrLostData); ok {
@@ -75,9 +87,16 @@ func (f *fsm) peekBinaryProtocolMagicByte() error {
 		}
 		return err
 	}
-	if firstByte[0] == 0x80 {
+	if firstByte[0] == binaryMagic {
 		//binary memcached protocol, don't try to handle this connection
 		f.log(2, "looks like binary protocol, ignoring connection")
+		f.consumer.Classify(model.ProtocolMemcacheBinary)
+		f.consumer.Close()
+		return io.EOF
+	}
+	if !f.consumer.Classify(model.ProtocolMemcacheText) {
+		// never parse data classified as another protocol as text
+		f.log(1, "connection already classified as another protocol, ignoring connection")
 		f.consumer.Close()
 		return io.EOF
 	}
@@ -87,7 +106,8 @@ func (f *fsm) peekBinaryProtocolMagicByte() error {
 
 func (f *fsm) readCommand() error {
 	f.args = f.args[:0]
-	f.consumer.ServerReader.Truncate()
+	f.nextArg = 0
+	f.consumer.DiscardUnattributed()
 	f.log(3, "reading command")
 	pos, err := f.consumer.ClientReader.IndexAny(" \n")
 	if err != nil {
@@ -98,6 +118,8 @@ func (f *fsm) readCommand() error {
 	if err != nil {
 		return err
 	}
+	f.consumer.MarkRequest()
+	f.requestLen = len(cmd)
 	f.cmd = string(bytes.TrimRight(cmd, " \r\n"))
 	f.log(3, "read command:", f.cmd)
 
@@ -121,6 +143,8 @@ func (f *fsm) commandState() state {
 		return f.handleGet
 	case "set", "add", "replace", "append", "prepend", "cas":
 		return f.handleSet
+	case "delete":
+		return f.handleDelete
 	case "quit":
 		return f.handleQuit
 	default:
@@ -129,7 +153,7 @@ func (f *fsm) commandState() state {
 }
 
 func (f *fsm) readArgs() error {
-	f.consumer.ServerReader.Truncate()
+	f.consumer.DiscardUnattributed()
 	pos, err := f.consumer.ClientReader.IndexAny(" \n")
 	if err != nil {
 		return err
@@ -138,11 +162,16 @@ func (f *fsm) readArgs() error {
 	if err != nil {
 		return err
 	}
+	f.requestLen += len(word)
 	f.args = append(f.args, string(bytes.TrimRight(word[:len(word)-1], "\r")))
 	delim := word[len(word)-1]
 	if delim == ' ' {
 		return nil
 	}
+	f.requestOverhead = f.requestLen
+	for _, arg := range f.args {
+		f.requestOverhead -= len(arg) + 1
+	}
 	f.log(3, "read arguments:", f.args)
 	f.state = f.commandState()
 	return nil
@@ -167,9 +196,13 @@ func (f *fsm) handleGet() error {
 				return err
 			}
 			evt := model.Event{
-				Type: model.EventGetHit,
-				Key:  string(key),
-				Size: size,
+				Type:   model.EventGetHit,
+				Key:    string(key),
+				Size:   size,
+				Sample: f.consumer.SampleValue(string(key), size),
+			}
+			if i := f.addMissesBefore(evt.Key); i >= 0 {
+				evt.RequestSize = f.requestShare(i)
 			}
 			// f.log("sending event:", evt)
 			f.addEvent(evt)
@@ -180,12 +213,59 @@ func (f *fsm) handleGet() error {
 			}
 			// f.log("discarded value")
 		} else {
+			if bytes.Equal(line, []byte("END")) {
+				f.addMissesBefore("")
+			}
 			f.state = f.readCommand
 			return nil
 		}
 	}
 }
 
+// addMissesBefore records a miss for each requested key preceding key that
+// has not yet been matched to a response, relying on memcached returning
+// values in the order they were requested, and returns the index of key in
+// the request.  If key is the empty string, all remaining requested keys are
+// recorded as misses.  If key was not requested no misses are recorded, since
+// we cannot tell which keys it answered, and -1 is returned.
+func (f *fsm) addMissesBefore(key string) int {
+	end := len(f.args)
+	if key != "" {
+		end = f.nextArg
+		for end < len(f.args) && f.args[end] != key {
+			end++
+		}
+		if end == len(f.args) {
+			return -1
+		}
+	}
+	for ; f.nextArg < end; f.nextArg++ {
+		f.addEvent(model.Event{
+			Type:        model.EventGetMiss,
+			Key:         f.args[f.nextArg],
+			RequestSize: f.requestShare(f.nextArg),
+		})
+	}
+	if key == "" {
+		return -1
+	}
+	// skip past the key we just matched
+	f.nextArg++
+	return end
+}
+
+// requestShare returns the number of request bytes attributed to the key at
+// index i of args: the key and the space preceding it, plus an even share of
+// the command name and line ending.  Any remainder of the overhead goes to
+// the first keys, so that the shares sum to the length of the request.
+func (f *fsm) requestShare(i int) int {
+	share := f.requestOverhead / len(f.args)
+	if i < f.requestOverhead%len(f.args) {
+		share++
+	}
+	return len(f.args[i]) + 1 + share
+}
+
 func (f *fsm) handleSet() error {
 	if len(f.args) < 4 {
 		return f.discardResponse()
@@ -199,7 +279,76 @@ func (f *fsm) handleSet() error {
 	if err != nil {
 		return err
 	}
-	f.log(3, "discarding response from server")
+	if f.args[len(f.args)-1] == "noreply" {
+		f.addSet(size)
+		f.state = f.readCommand
+		return nil
+	}
+	f.state = func() error { return f.readSetResponse(size) }
+	return nil
+}
+
+// readSetResponse records the value stored by a storage command, of size
+// bytes, if the server confirms that it was stored.
+func (f *fsm) readSetResponse(size int) error {
+	line, err := f.consumer.ServerReader.ReadLine()
+	if err != nil {
+		return err
+	}
+	f.log(3, "server reply:", string(line))
+	if bytes.Equal(line, []byte("STORED")) {
+		f.addSet(size)
+	}
+	f.state = f.readCommand
+	return nil
+}
+
+// maxRelativeExptime is the largest expiration time memcached treats as a
+// number of seconds from now rather than as a Unix time.
+const maxRelativeExptime = 30 * 24 * 60 * 60
+
+// addSet records a value of size bytes stored by the current command.
+// append and prepend keep the existing expiration time, so are not recorded.
+func (f *fsm) addSet(size int) {
+	if f.cmd == "append" || f.cmd == "prepend" {
+		return
+	}
+	ttl, err := strconv.Atoi(f.args[2])
+	if err != nil {
+		return
+	}
+	if ttl > maxRelativeExptime {
+		// relative to when the command was captured, which may be long
+		// past when reading from a file
+		now := f.consumer.Seen()
+		if now.IsZero() {
+			now = time.Now()
+		}
+		ttl -= int(now.Unix())
+		if ttl == 0 {
+			ttl = -1
+		}
+	}
+	f.consumer.AddEvent(model.Event{
+		Type: model.EventSet,
+		Key:  f.args[0],
+		Size: size,
+		TTL:  ttl,
+	})
+}
+
+func (f *fsm) handleDelete() error {
+	if len(f.args) < 1 {
+		return f.discardResponse()
+	}
+	f.consumer.AddEvent(model.Event{
+		Type: model.EventDelete,
+		Key:  f.args[0],
+	})
+	if f.args[len(f.args)-1] == "noreply" {
+		f.state = f.readCommand
+		return nil
+	}
 	return f.discardResponse()
 }
 
@@ -228,7 +377,10 @@ func (f *fsm) discardResponse() error {
 	return nil
 }
 
+// addEvent sends evt on for analysis, tagged with the number of keys named by
+// the current request.
 func (f *fsm) addEvent(evt model.Event) {
+	evt.BatchSize = len(f.args)
 	f.consumer.AddEvent(evt)
 }
 
@@ -1,7 +1,9 @@
 package mctext
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/box/memsniff/log"
 	"github.com/box/memsniff/protocol/model"
@@ -16,8 +18,8 @@ func TestTextMulti(t *testing.T) {
 		"world",
 	}
 	testReadText(t, lines, []model.Event{
-		{model.EventGetHit, "key1", 5},
-		{model.EventGetHit, "key2", 5},
+		{Type: model.EventGetHit, Key: "key1", Size: 5, RequestSize: 7, BatchSize: 3},
+		{Type: model.EventGetHit, Key: "key2", Size: 5, RequestSize: 7, BatchSize: 3},
 	})
 }
 
@@ -27,7 +29,7 @@ func TestTextEmptyValue(t *testing.T) {
 		"",
 	}
 	testReadText(t, lines, []model.Event{
-		{model.EventGetHit, "key3|foo", 0},
+		{Type: model.EventGetHit, Key: "key3|foo", BatchSize: 3},
 	})
 }
 
@@ -38,7 +40,7 @@ func TestTextIncompleteHeader(t *testing.T) {
 		"VALUE ",
 	}
 	testReadText(t, lines, []model.Event{
-		{model.EventGetHit, "key1", 5},
+		{Type: model.EventGetHit, Key: "key1", Size: 5, RequestSize: 7, BatchSize: 3},
 	})
 }
 
@@ -48,10 +50,66 @@ func TestTextIncompleteBody(t *testing.T) {
 		"wor",
 	}
 	testReadText(t, lines, []model.Event{
-		{model.EventGetHit, "key1", 5},
+		{Type: model.EventGetHit, Key: "key1", Size: 5, RequestSize: 7, BatchSize: 3},
 	})
 }
 
+func TestTextMisses(t *testing.T) {
+	lines := []string{
+		"VALUE key2 0 5",
+		"hello",
+		"END",
+	}
+	testReadText(t, lines, []model.Event{
+		{Type: model.EventGetMiss, Key: "key1", RequestSize: 7, BatchSize: 3},
+		{Type: model.EventGetHit, Key: "key2", Size: 5, RequestSize: 7, BatchSize: 3},
+		{Type: model.EventGetMiss, Key: "key3", RequestSize: 6, BatchSize: 3},
+	})
+}
+
+func TestTextAllMiss(t *testing.T) {
+	testReadText(t, []string{"END"}, []model.Event{
+		{Type: model.EventGetMiss, Key: "key1", RequestSize: 7, BatchSize: 3},
+		{Type: model.EventGetMiss, Key: "key2", RequestSize: 7, BatchSize: 3},
+		{Type: model.EventGetMiss, Key: "key3", RequestSize: 6, BatchSize: 3},
+	})
+}
+
+func TestTextUnrequestedKey(t *testing.T) {
+	lines := []string{
+		"VALUE key1 0 5",
+		"hello",
+		"VALUE other 0 5",
+		"world",
+		"END",
+	}
+	testReadText(t, lines, []model.Event{
+		{Type: model.EventGetHit, Key: "key1", Size: 5, RequestSize: 7, BatchSize: 3},
+		{Type: model.EventGetHit, Key: "other", Size: 5, BatchSize: 3},
+		{Type: model.EventGetMiss, Key: "key2", RequestSize: 7, BatchSize: 3},
+		{Type: model.EventGetMiss, Key: "key3", RequestSize: 6, BatchSize: 3},
+	})
+}
+
+func TestRequestSharesSumToRequest(t *testing.T) {
+	var total int
+	handler := func(evts []model.Event) {
+		for _, e := range evts {
+			total += e.RequestSize
+		}
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	request := "get a bb ccc dddd eeeee\r\n"
+	r.ClientStream().Reassembled(reassemblyString(request))
+	r.ServerStream().Reassembled(reassemblyString("END\r\n"))
+	r.ClientStream().ReassemblyComplete()
+	r.ServerStream().ReassemblyComplete()
+
+	if total != len(request) {
+		t.Error("attributed", total, "bytes of", len(request), "byte request")
+	}
+}
+
 func TestClientOverrun(t *testing.T) {
 	r := newConsumer(&log.ConsoleLogger{}, nil)
 	var data [1024]byte
@@ -60,11 +118,49 @@ func TestClientOverrun(t *testing.T) {
 	}
 }
 func TestServerOverrun(t *testing.T) {
-	r := newConsumer(&log.ConsoleLogger{}, nil)
+	var unattributed int
+	handler := func(evts []model.Event) {
+		for _, e := range evts {
+			if e.Type == model.EventUnattributed {
+				unattributed += e.Size
+			}
+		}
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
 	var data [1024]byte
 	for i := 0; i < 1024; i++ {
 		r.ServerStream().Reassembled(reassemblyString(string(data[:])))
 	}
+	r.FlushEvents()
+	if unattributed != 1024*len(data) {
+		t.Error("unattributed", unattributed, "bytes")
+	}
+}
+
+func TestUnattributedBeforeRequest(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	r.ClientStream().Reassembled(reassemblyString("get "))
+	r.ServerStream().Reassembled(reassemblyString("VALUE key0 0 5\r\nhello\r\nEND\r\n"))
+	r.ClientStream().Reassembled(reassemblyString("key1\r\n"))
+	r.ServerStream().Reassembled(reassemblyString("END\r\n"))
+	r.FlushEvents()
+
+	expected := []model.Event{
+		{Type: model.EventUnattributed, Key: "VALUE key0 0 5\r\nhello\r\nEND\r\n", Size: 28},
+		{Type: model.EventGetMiss, Key: "key1", RequestSize: 10, BatchSize: 1},
+	}
+	if len(got) != len(expected) {
+		t.Fatal(got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Error("Expected", expected[i], "got", got[i])
+		}
+	}
 }
 
 func newConsumer(logger log.Logger, handler model.EventHandler) *model.Consumer {
@@ -97,3 +193,286 @@ func testReadText(t *testing.T, lines []string, expected []model.Event) {
 func reassemblyString(s string) []tcpassembly.Reassembly {
 	return []tcpassembly.Reassembly{{Bytes: []byte(s)}}
 }
+
+// TestTextTimestamps checks that each event carries the capture time of the
+// response data from which it was parsed.
+func TestTextTimestamps(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	start := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	at := func(s string, offset time.Duration) []tcpassembly.Reassembly {
+		return []tcpassembly.Reassembly{{Bytes: []byte(s), Seen: start.Add(offset)}}
+	}
+	r.ClientStream().Reassembled(at("get key1 key2\r\n", 0))
+	r.ServerStream().Reassembled(at("VALUE key1 0 5\r\nhel", time.Millisecond))
+	r.ServerStream().Reassembled(at("lo\r\n", 2*time.Millisecond))
+	r.ServerStream().Reassembled(at("END\r\n", 3*time.Millisecond))
+	r.FlushEvents()
+
+	if len(got) != 2 {
+		t.Fatal(got)
+	}
+	for i, want := range []time.Duration{time.Millisecond, 3 * time.Millisecond} {
+		if !got[i].Timestamp.Equal(start.Add(want)) {
+			t.Errorf("event %d (%s) at %v, want %v", i, got[i].Key, got[i].Timestamp, start.Add(want))
+		}
+	}
+}
+
+// TestTextConnOpened checks that events carry the capture time of the SYN
+// opening their connection, if it was seen.
+func TestTextConnOpened(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	opened := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	r.ClientStream().Reassembled([]tcpassembly.Reassembly{{Start: true, Seen: opened}})
+	r.ClientStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("get key1\r\n"), Seen: opened.Add(time.Millisecond)}})
+	r.ServerStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("END\r\n"), Start: true, Seen: opened.Add(2 * time.Millisecond)}})
+	r.FlushEvents()
+
+	if len(got) != 1 || !got[0].ConnOpened.Equal(opened) {
+		t.Fatal(got)
+	}
+
+	// picked up part way through
+	got = nil
+	r = newConsumer(&log.ConsoleLogger{}, handler)
+	r.ClientStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("get key1\r\n"), Seen: opened}})
+	r.ServerStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("END\r\n"), Seen: opened}})
+	r.FlushEvents()
+	if len(got) != 1 || !got[0].ConnOpened.IsZero() {
+		t.Fatal(got)
+	}
+}
+
+func TestTextLatency(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	at := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	r.ClientStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("get key1\r\n"), Seen: at}})
+	r.ServerStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("END\r\n"), Seen: at.Add(3 * time.Millisecond)}})
+	r.ClientStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("get key2\r\n"), Seen: at.Add(time.Second)}})
+	r.ServerStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("END\r\n"), Seen: at.Add(time.Second + time.Millisecond)}})
+	r.FlushEvents()
+
+	if len(got) != 2 || got[0].Latency != 3*time.Millisecond || got[1].Latency != time.Millisecond {
+		t.Fatal(got)
+	}
+}
+
+// sampleKeys is a model.ValueSampler asking for a sample of the values of
+// its keys.
+type sampleKeys map[string]int
+
+func (sk sampleKeys) SampleLen(key string) int {
+	return sk[key]
+}
+
+func TestTextSampleValue(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	r.Sampler = sampleKeys{"key1": 4, "key2": 100}
+	r.ClientStream().Reassembled(reassemblyString("get key1 key2 key3\r\n"))
+	r.ServerStream().Reassembled(reassemblyString("VALUE key1 0 5\r\nhello\r\nVALUE key2 0 5\r\nworld\r\nVALUE key3 0 2\r\nhi\r\nEND\r\n"))
+	r.FlushEvents()
+
+	if len(got) != 3 || got[0].Sample != "hell" || got[1].Sample != "world" || got[2].Sample != "" {
+		t.Fatal(got)
+	}
+}
+
+// binaryGet returns a binary protocol get request for key, padded with body
+// so that text commands can be hidden inside it.
+func binaryGet(key, body string) string {
+	hdr := make([]byte, 24)
+	hdr[0] = binaryMagic
+	hdr[3] = byte(len(key))
+	total := len(key) + len(body)
+	hdr[8], hdr[9], hdr[10], hdr[11] = byte(total>>24), byte(total>>16), byte(total>>8), byte(total)
+	return string(hdr) + key + body
+}
+
+// TestTextIgnoresBinary checks that nothing on a binary protocol connection is
+// parsed as text, even where its payload holds text commands, including at
+// the start of later packets.
+func TestTextIgnoresBinary(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	before := model.Reclassifications()
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	r.ClientStream().Reassembled(reassemblyString(binaryGet("k", "get x\r\n")))
+	for _, s := range []string{"get x\r\n", "VALUE x 0 5\r\nhello\r\nEND\r\n"} {
+		r.ClientStream().Reassembled(reassemblyString(s))
+		r.ServerStream().Reassembled(reassemblyString(s))
+	}
+	r.FlushEvents()
+	if len(got) != 0 {
+		t.Error("binary payload parsed as text:", got)
+	}
+	if r.Protocol != model.ProtocolMemcacheBinary {
+		t.Error("classified as", r.Protocol)
+	}
+
+	// data arriving after the binary connection was closed must not reach
+	// other closed connections
+	other := newConsumer(&log.ConsoleLogger{}, handler)
+	other.ClientStream().Reassembled(reassemblyString("get y\r\n"))
+	other.ClientStream().ReassemblyComplete()
+	other.ServerStream().Reassembled(reassemblyString("END\r\n"))
+	other.ServerStream().Reassembled(reassemblyString("END\r\n"))
+	other.FlushEvents()
+	if len(got) == 0 || got[0].Key != "y" {
+		t.Error(got)
+	}
+	for _, e := range got {
+		if e.Type != model.EventUnattributed && e.Key != "y" {
+			t.Error("parsed data sent after close:", e)
+		}
+	}
+	if n := model.Reclassifications() - before; n != 0 {
+		t.Error(n, "reclassifications")
+	}
+}
+
+// TestTextRefusesReclassification checks that a connection classified as
+// another protocol is never parsed as text, and that the attempt is counted.
+func TestTextRefusesReclassification(t *testing.T) {
+	var got []model.Event
+	r := newConsumer(&log.ConsoleLogger{}, func(evts []model.Event) {
+		got = append(got, evts...)
+	})
+	r.Classify(model.ProtocolMemcacheBinary)
+	before := model.Reclassifications()
+	r.ClientStream().Reassembled(reassemblyString("get x\r\n"))
+	r.ServerStream().Reassembled(reassemblyString("END\r\n"))
+	r.FlushEvents()
+	if len(got) != 0 {
+		t.Error(got)
+	}
+	if n := model.Reclassifications() - before; n != 1 {
+		t.Error(n, "reclassifications")
+	}
+}
+
+func TestTextSet(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	exchanges := []struct{ request, response string }{
+		{"set key1 0 300 5\r\nhello\r\n", "STORED\r\n"},
+		{"add key2 0 60 5\r\nhello\r\n", "NOT_STORED\r\n"},
+		{"append key1 0 0 1\r\n!\r\n", "STORED\r\n"},
+		{"cas key3 0 0 2 17\r\nhi\r\n", "STORED\r\n"},
+		{"set key4 0 10 2 noreply\r\nhi\r\n", ""},
+		{"get key1\r\n", "END\r\n"},
+	}
+	for _, ex := range exchanges {
+		r.ClientStream().Reassembled(reassemblyString(ex.request))
+		if ex.response != "" {
+			r.ServerStream().Reassembled(reassemblyString(ex.response))
+		}
+	}
+	r.FlushEvents()
+
+	expected := []model.Event{
+		{Type: model.EventSet, Key: "key1", Size: 5, TTL: 300},
+		{Type: model.EventSet, Key: "key3", Size: 2},
+		{Type: model.EventSet, Key: "key4", Size: 2, TTL: 10},
+		{Type: model.EventGetMiss, Key: "key1", RequestSize: 10, BatchSize: 1},
+	}
+	if len(got) != len(expected) {
+		t.Fatal(got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Error("Expected", expected[i], "got", got[i])
+		}
+	}
+}
+
+func TestTextSetAbsoluteExptime(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	exptime := time.Now().Unix() + 3600
+	r.ClientStream().Reassembled(reassemblyString(fmt.Sprintf("set key1 0 %d 5\r\nhello\r\n", exptime)))
+	r.ServerStream().Reassembled(reassemblyString("STORED\r\n"))
+	r.FlushEvents()
+
+	if len(got) != 1 || got[0].TTL < 3590 || got[0].TTL > 3600 {
+		t.Error(got)
+	}
+}
+
+// TestTextSetAbsoluteExptimeCaptured checks that an absolute expiration time
+// is taken relative to the capture time of the command, not the current time.
+func TestTextSetAbsoluteExptimeCaptured(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	captured := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	exptime := captured.Unix() + 3600
+	r.ClientStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte(fmt.Sprintf("set key1 0 %d 5\r\nhello\r\n", exptime)), Seen: captured}})
+	r.ServerStream().Reassembled([]tcpassembly.Reassembly{{Bytes: []byte("STORED\r\n"), Seen: captured.Add(time.Millisecond)}})
+	r.FlushEvents()
+
+	if len(got) != 1 || got[0].TTL != 3600 {
+		t.Error(got)
+	}
+}
+
+func TestTextDelete(t *testing.T) {
+	var got []model.Event
+	handler := func(evts []model.Event) {
+		got = append(got, evts...)
+	}
+	r := newConsumer(&log.ConsoleLogger{}, handler)
+	exchanges := []struct{ request, response string }{
+		{"delete key1\r\n", "DELETED\r\n"},
+		{"delete key2 noreply\r\n", ""},
+		{"delete key3\r\n", "NOT_FOUND\r\n"},
+		{"get key1\r\n", "END\r\n"},
+	}
+	for _, ex := range exchanges {
+		r.ClientStream().Reassembled(reassemblyString(ex.request))
+		if ex.response != "" {
+			r.ServerStream().Reassembled(reassemblyString(ex.response))
+		}
+	}
+	r.FlushEvents()
+
+	expected := []model.Event{
+		{Type: model.EventDelete, Key: "key1"},
+		{Type: model.EventDelete, Key: "key2"},
+		{Type: model.EventDelete, Key: "key3"},
+		{Type: model.EventGetMiss, Key: "key1", RequestSize: 10, BatchSize: 1},
+	}
+	if len(got) != len(expected) {
+		t.Fatal(got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Error("Expected", expected[i], "got", got[i])
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package model
+
+import "sync/atomic"
+
+// WorkBudget limits the bytes parsed on each connection per interval, so that
+// one pathological connection, such as a scanner sending garbage or a client
+// stuck retrying, cannot take a disproportionate share of parser time.  Data a
+// connection sends beyond its budget is skipped, as if lost from the capture,
+// until the next interval.  A connection on which a watched key is parsed is
+// exempt from then on, but a watched key sent only once the budget is spent
+// is skipped with the rest, since it is never parsed to be recognized.  A
+// WorkBudget is shared by many Consumers, and is threadsafe.
+type WorkBudget struct {
+	// limit is the bytes each connection may parse per interval, or 0 for
+	// no limit.
+	limit int64
+	// intervals is the number of intervals ended.
+	intervals int64
+	// throttled counts the connections throttled in each interval, and
+	// skipped the bytes they sent that were not parsed.
+	throttled, skipped int64
+}
+
+// SetLimit sets the bytes each connection may parse per interval, or 0 for no
+// limit.
+func (b *WorkBudget) SetLimit(bytes int64) {
+	atomic.StoreInt64(&b.limit, bytes)
+}
+
+// EndInterval restores the budget of every connection.
+func (b *WorkBudget) EndInterval() {
+	atomic.AddInt64(&b.intervals, 1)
+}
+
+// Throttled returns the number of connections that exceeded their budget,
+// counting each once per interval in which it did, and the bytes skipped
+// since.
+func (b *WorkBudget) Throttled() (conns, bytes int64) {
+	return atomic.LoadInt64(&b.throttled), atomic.LoadInt64(&b.skipped)
+}
+
+// KeyWatcher identifies the keys being watched.  It is called from many
+// Consumers concurrently, and so must be threadsafe.
+type KeyWatcher interface {
+	Watched(key string) bool
+}
+
+// connBudget is the state of a Consumer against its WorkBudget.
+type connBudget struct {
+	// interval is the WorkBudget interval in which parsed bytes were
+	// parsed.
+	interval int64
+	parsed   int64
+	// throttled is true once the connection exceeds its budget in the
+	// current interval.
+	throttled bool
+	// exempt is true once a watched key is parsed on the connection, which
+	// is then never throttled.
+	exempt bool
+	// clientSkip and serverSkip are the bytes skipped in each direction
+	// since data was last passed on.
+	clientSkip, serverSkip int
+}
+
+// admit returns whether n more bytes received on the conversation of c may be
+// parsed, counting those that may not as skipped.
+func (c *Consumer) admit(n int) bool {
+	b := c.Budget
+	if b == nil || c.budget.exempt {
+		return true
+	}
+	limit := atomic.LoadInt64(&b.limit)
+	if limit <= 0 {
+		return true
+	}
+	if iv := atomic.LoadInt64(&b.intervals); iv != c.budget.interval {
+		c.budget.interval, c.budget.parsed, c.budget.throttled = iv, 0, false
+	}
+	if c.budget.parsed < limit {
+		c.budget.parsed += int64(n)
+		return true
+	}
+	if !c.budget.throttled {
+		c.budget.throttled = true
+		atomic.AddInt64(&b.throttled, 1)
+	}
+	atomic.AddInt64(&b.skipped, int64(n))
+	return false
+}
+
+// checkWatched exempts the conversation of c from its WorkBudget if key is
+// watched.
+func (c *Consumer) checkWatched(key string) {
+	if c.Budget != nil && c.Watcher != nil && !c.budget.exempt && c.Watcher.Watched(key) {
+		c.budget.exempt = true
+	}
+}
@@ -3,6 +3,8 @@ package model
 import (
 	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/box/memsniff/assembly/reader"
 	"github.com/google/gopacket/tcpassembly"
@@ -11,11 +13,18 @@ import (
 var (
 	bufferPool = sync.Pool{New: func() interface{} { return reader.New() }}
 	eofSource  *reader.Reader
+	// reclassifications counts refused attempts to change the protocol of
+	// a conversation, and is updated atomically.
+	reclassifications int64
 )
 
 func init() {
 	eofSource = reader.New()
 	eofSource.ReassemblyComplete()
+	// Shared by every closed Consumer, so data arriving after a Consumer is
+	// closed must be dropped rather than buffered where another
+	// conversation could read it.
+	eofSource.Close()
 }
 
 // Reader represents a subset of the bufio.Reader interface.
@@ -66,6 +75,14 @@ type ConsumerSource interface {
 	tcpassembly.Stream
 }
 
+// ValueSampler chooses the retrieved values of which a sample is kept.  It is
+// called from many Consumers concurrently, and so must be threadsafe.
+type ValueSampler interface {
+	// SampleLen returns the number of leading bytes of the value of key to
+	// keep in the event reporting its retrieval, or 0 to keep none.
+	SampleLen(key string) int
+}
+
 // Consumer is a generic reader of a datastore conversation.
 type Consumer struct {
 	// Handler receives events derived from the conversation.
@@ -77,6 +94,39 @@ type Consumer struct {
 
 	Fsm      Fsm
 	eventBuf []Event
+	// Client is the network address of the client in this conversation,
+	// recorded in each event added.
+	Client string
+	// Server is the network address and port of the server in this
+	// conversation, recorded in each event added.
+	Server string
+	// Conn identifies the connection by the address and port of the client.
+	// If set, the bytes sent in each direction are reported in an
+	// EventTraffic whenever events are flushed.
+	Conn string
+	// requestBytes and responseBytes count the data received from the
+	// client and server since the last EventTraffic.
+	requestBytes, responseBytes int
+	// seen is the capture time of the data most recently received in
+	// either direction, recorded in each event added.
+	seen time.Time
+	// opened is the capture time of the SYN seen opening the connection,
+	// recorded in each event added, or the zero Time if none was seen.
+	opened time.Time
+	// clientSeen is the capture time of the data most recently received
+	// from the client, and requested its value when the Fsm last called
+	// MarkRequest, or the zero Time if it never has.
+	clientSeen, requested time.Time
+	// Protocol is the protocol the conversation was classified as carrying,
+	// or ProtocolUnknown until Classify is first called.
+	Protocol ProtocolType
+	// Sampler, if not nil, chooses the values sampled by SampleValue.
+	Sampler ValueSampler
+	// Budget, if not nil, limits the bytes of the conversation parsed per
+	// interval, except once a key for which Watcher returns true is parsed.
+	Budget  *WorkBudget
+	Watcher KeyWatcher
+	budget  connBudget
 }
 
 func New(handler EventHandler, fsm Fsm) *Consumer {
@@ -92,17 +142,128 @@ func New(handler EventHandler, fsm Fsm) *Consumer {
 	return c
 }
 
+// Classify records that the conversation carries protocol, returning false if
+// it was already classified as another protocol.  Classification never
+// changes once made, so that payload bytes that happen to look like another
+// protocol, such as a text command inside a binary value, cannot reclassify a
+// conversation part way through.  A refused attempt indicates a bug in a
+// parser and is counted by Reclassifications.
+func (c *Consumer) Classify(protocol ProtocolType) bool {
+	if c.Protocol == ProtocolUnknown || c.Protocol == protocol {
+		c.Protocol = protocol
+		return true
+	}
+	atomic.AddInt64(&reclassifications, 1)
+	return false
+}
+
+// Reclassifications returns the number of refused attempts to change the
+// protocol of a conversation once classified, which should always be 0.
+func Reclassifications() int64 {
+	return atomic.LoadInt64(&reclassifications)
+}
+
+// MarkRequest records that the Fsm has just read a request from the client,
+// so that events added until the next call carry the time taken to answer it
+// in their Latency.  Fsms for protocols without a clear request per response
+// need not call MarkRequest, leaving Latency unknown.
+func (c *Consumer) MarkRequest() {
+	c.requested = c.clientSeen
+}
+
+// Seen returns the capture time of the data most recently received in either
+// direction, or the zero Time if none has been.
+func (c *Consumer) Seen() time.Time {
+	return c.seen
+}
+
+// eventBatchSize is the most events passed to the Handler at once, including
+// the EventTraffic ending each batch.
+const eventBatchSize = 8
+
 func (c *Consumer) AddEvent(evt Event) {
+	c.checkWatched(evt.Key)
+	if evt.Client == "" {
+		evt.Client = c.Client
+	}
+	if evt.Conn == "" {
+		evt.Conn = c.Conn
+	}
+	if evt.Server == "" {
+		evt.Server = c.Server
+	}
+	if evt.Timestamp.IsZero() {
+		evt.Timestamp = c.seen
+	}
+	if evt.ConnOpened.IsZero() {
+		evt.ConnOpened = c.opened
+	}
+	if evt.Latency == 0 && !c.requested.IsZero() && evt.Timestamp.After(c.requested) {
+		evt.Latency = evt.Timestamp.Sub(c.requested)
+	}
 	if c.eventBuf == nil {
-		c.eventBuf = make([]Event, 0, 8)
+		c.eventBuf = make([]Event, 0, eventBatchSize)
 	}
 	c.eventBuf = append(c.eventBuf, evt)
-	if len(c.eventBuf) == cap(c.eventBuf) {
+	// leave room for the EventTraffic added by FlushEvents
+	if len(c.eventBuf) >= eventBatchSize-1 {
 		c.FlushEvents()
 	}
 }
 
+// SampleValue returns the first bytes of a value of size bytes retrieved for
+// key, which the ServerReader must be positioned at, if the Sampler asks for
+// them, or the empty string.  Only bytes already received are sampled, so the
+// sample may be shorter than asked for, or empty if none have arrived.
+func (c *Consumer) SampleValue(key string, size int) string {
+	if c.Sampler == nil {
+		return ""
+	}
+	n := c.Sampler.SampleLen(key)
+	if n <= 0 {
+		return ""
+	}
+	data, _ := c.ServerReader.PeekN(min(min(n, size), c.ServerReader.Len()))
+	return string(data)
+}
+
+// unattributedSampleLen is the number of bytes of unattributed response data
+// kept in an event for diagnosis.
+const unattributedSampleLen = 64
+
+// DiscardUnattributed discards any data sent by the server that the Fsm has
+// not matched to a request, recording it as an EventUnattributed.
+func (c *Consumer) DiscardUnattributed() {
+	if n := c.ServerReader.Len(); n > 0 {
+		sample, _ := c.ServerReader.PeekN(min(n, unattributedSampleLen))
+		c.AddEvent(Event{
+			Type: EventUnattributed,
+			Key:  string(sample),
+			Size: n,
+		})
+	}
+	c.ServerReader.Truncate()
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func (c *Consumer) FlushEvents() {
+	if c.Conn != "" && c.requestBytes+c.responseBytes > 0 {
+		c.eventBuf = append(c.eventBuf, Event{
+			Type:        EventTraffic,
+			Key:         c.Conn,
+			Size:        c.responseBytes,
+			RequestSize: c.requestBytes,
+			Client:      c.Client,
+			Timestamp:   c.seen,
+		})
+		c.requestBytes, c.responseBytes = 0, 0
+	}
 	c.Handler(c.eventBuf)
 	c.eventBuf = c.eventBuf[:0]
 }
@@ -129,11 +290,40 @@ func (c *Consumer) ServerStream() tcpassembly.Stream {
 	return (*ServerStream)(c)
 }
 
+// skipped returns the bytes of the stream covered by r, including any gap
+// before it.
+func skipped(r tcpassembly.Reassembly) int {
+	if r.Skip > 0 {
+		return r.Skip + len(r.Bytes)
+	}
+	return len(r.Bytes)
+}
+
+// withSkipped returns the gap before data following a gap of skip bytes, as
+// reported by tcpassembly, after n more bytes were skipped for exceeding the
+// WorkBudget, so that the Fsm treats them as lost.
+func withSkipped(skip, n int) int {
+	if n == 0 || skip < 0 {
+		return skip
+	}
+	return skip + n
+}
+
 // ClientStream is a view on a Consumer that consumes tcpassembly data from the client
 type ClientStream Consumer
 
 func (cs *ClientStream) Reassembled(rs []tcpassembly.Reassembly) {
 	for _, r := range rs {
+		cs.requestBytes += len(r.Bytes)
+		cs.seen, cs.clientSeen = r.Seen, r.Seen
+		if r.Start && cs.opened.IsZero() {
+			cs.opened = r.Seen
+		}
+		if !(*Consumer)(cs).admit(len(r.Bytes)) {
+			cs.budget.clientSkip += skipped(r)
+			continue
+		}
+		r.Skip, cs.budget.clientSkip = withSkipped(r.Skip, cs.budget.clientSkip), 0
 		cs.ClientReader.Reassembled([]tcpassembly.Reassembly{r})
 		(*Consumer)(cs).Fsm.Run()
 	}
@@ -154,6 +344,16 @@ type ServerStream Consumer
 
 func (ss *ServerStream) Reassembled(rs []tcpassembly.Reassembly) {
 	for _, r := range rs {
+		ss.responseBytes += len(r.Bytes)
+		ss.seen = r.Seen
+		if r.Start && ss.opened.IsZero() {
+			ss.opened = r.Seen
+		}
+		if !(*Consumer)(ss).admit(len(r.Bytes)) {
+			ss.budget.serverSkip += skipped(r)
+			continue
+		}
+		r.Skip, ss.budget.serverSkip = withSkipped(r.Skip, ss.budget.serverSkip), 0
 		ss.ServerReader.Reassembled([]tcpassembly.Reassembly{r})
 		(*Consumer)(ss).Fsm.Run()
 	}
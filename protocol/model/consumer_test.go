@@ -0,0 +1,31 @@
+package model
+
+import "testing"
+
+// TestEventBatchSize checks that every batch of events passed to the Handler,
+// including the traffic of the connection, stays within eventBatchSize.
+func TestEventBatchSize(t *testing.T) {
+	var batches []int
+	c := &Consumer{
+		Handler: func(evts []Event) { batches = append(batches, len(evts)) },
+		Conn:    "10.0.0.1:40000",
+	}
+	for i := 0; i < 1000; i++ {
+		c.requestBytes, c.responseBytes = 10, 20
+		c.AddEvent(Event{Type: EventGetHit, Key: "k"})
+	}
+	c.FlushEvents()
+	var total int
+	for i, n := range batches {
+		if n > eventBatchSize {
+			t.Fatalf("batch %d of %d events", i, n)
+		}
+		total += n
+	}
+	if len(batches) < 1000/eventBatchSize || total < 1000 {
+		t.Errorf("%d events in %d batches", total, len(batches))
+	}
+	if cap(c.eventBuf) != eventBatchSize {
+		t.Errorf("buffer grew to %d", cap(c.eventBuf))
+	}
+}
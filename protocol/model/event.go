@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // EventType described what sort of event has occurred.
 type EventType int
 
@@ -10,6 +12,30 @@ const (
 	EventGetHit
 	// EventGetMiss is a data retrieval that did not result in data.
 	EventGetMiss
+	// EventUnattributed is response data that could not be matched to a
+	// request, such as responses on a connection picked up mid-stream.
+	// Size is the length of the data, and Key holds its first few bytes
+	// for diagnosis rather than a datastore key.
+	EventUnattributed
+	// EventSet is a value stored for Key, of Size bytes, that expires
+	// after TTL.
+	EventSet
+	// EventTraffic is the data carried by a connection since its last
+	// EventTraffic: RequestSize bytes from the client and Size bytes from
+	// the server.  Key identifies the connection by the address and port
+	// of the client rather than a datastore key.
+	EventTraffic
+	// EventDelete is a request to remove the value stored for Key, whether
+	// or not one was found.
+	EventDelete
+	// EventConnClosed is a connection closed by its server, which sent a
+	// FIN or RST before the client did.  Server and Client are the
+	// addresses and ports of its ends.
+	EventConnClosed
+	// EventConnAccepted is a connection accepted by its server, which
+	// answered the client's SYN.  Server and Client are the addresses and
+	// ports of its ends.
+	EventConnAccepted
 )
 
 // Event is a single event in a datastore conversation
@@ -20,6 +46,43 @@ type Event struct {
 	Key string
 	// Size of the datastore value affected by this event.
 	Size int
+	// RequestSize is the number of bytes of the client request attributed
+	// to this event.  When a single request names several keys, each key
+	// is attributed its own bytes plus a share of the rest of the request.
+	RequestSize int
+	// Client is the network address of the client that made the request.
+	Client string
+	// Conn is the network address and port of the client end of the
+	// connection that carried the request, or empty if unknown.
+	Conn string
+	// BatchSize is the number of keys named by the request, 1 for a
+	// single-key get, or 0 if unknown.
+	BatchSize int
+	// TTL is the number of seconds after which a stored value expires, 0
+	// if it never expires, or negative if it expired immediately.
+	TTL int
+	// Expired is set during analysis for a miss on a key whose last value
+	// stored is believed to have expired, rather than never been stored
+	// or been evicted.
+	Expired bool
+	// Server is the network address and port of the server that handled
+	// the request.
+	Server string
+	// Timestamp is when the data from which the event was parsed was
+	// captured: as recorded in the file when reading a capture file, or as
+	// stamped by the kernel or network adapter in a live capture.  It is
+	// the zero Time if unknown.
+	Timestamp time.Time
+	// ConnOpened is the capture time of the SYN that opened the connection
+	// carrying the event, or the zero Time if the connection was already
+	// open when first seen.
+	ConnOpened time.Time
+	// Latency is the time from the capture of the request to the capture of
+	// the response data from which the event was parsed, or 0 if unknown.
+	Latency time.Duration
+	// Sample holds the first bytes of the value retrieved, for a key whose
+	// value the Consumer's Sampler asked for, or is empty.
+	Sample string
 }
 
 // EventHandler consumes a batch of events.
@@ -34,6 +97,27 @@ const (
 	FieldNone EventFieldMask = 0
 	FieldKey  EventFieldMask = 1 << iota
 	FieldSize
+	// FieldHit is 1 for a successful retrieval, or 0 otherwise.
+	FieldHit
+	// FieldMiss is 1 for an unsuccessful retrieval, or 0 otherwise.
+	FieldMiss
+	FieldRequestSize
+	// FieldClient is the address of the client that made the request.
+	FieldClient
+	// FieldMultiGet is 1 for a retrieval of a key named alongside others in
+	// a single request, or 0 otherwise.
+	FieldMultiGet
+	// FieldExpiryMiss is 1 for a miss on a key whose value expired, or 0
+	// otherwise.
+	FieldExpiryMiss
+	// FieldColdMiss is 1 for any other miss, or 0 otherwise.
+	FieldColdMiss
+	// FieldServer is the address and port of the server that handled the
+	// request.
+	FieldServer
+	// FieldConn is the address and port of the client end of the
+	// connection that carried the request.
+	FieldConn
 
 	// FieldEndOfFields is a dummy value to use as the endpoint of an iteration.
 	FieldEndOfFields
@@ -42,5 +126,5 @@ const (
 const (
 	// IntFields is a mask identifying the set of fields that can be viewed as integers,
 	// and are viable targets for aggregation.
-	IntFields = FieldSize
+	IntFields = FieldSize | FieldHit | FieldMiss | FieldRequestSize | FieldMultiGet | FieldExpiryMiss | FieldColdMiss
 )
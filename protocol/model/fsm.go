@@ -7,6 +7,9 @@ const (
 	ProtocolInfer
 	ProtocolMemcacheText
 	ProtocolRedis
+	// ProtocolMemcacheBinary is recognized so that its conversations can be
+	// ignored, but is not parsed.
+	ProtocolMemcacheBinary
 )
 
 func GetProtocolType(protocol string) ProtocolType {
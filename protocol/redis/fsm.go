@@ -2,6 +2,7 @@ package redis
 
 import (
 	"io"
+	"strconv"
 	"strings"
 
 	"github.com/box/memsniff/assembly/reader"
@@ -64,7 +65,7 @@ func (f *fsm) transitionTo(fromServer bool, state state) {
 }
 
 func (f *fsm) readCommand() error {
-	f.consumer.ServerReader.Truncate()
+	f.consumer.DiscardUnattributed()
 	err := f.parser.Run()
 	if err != nil {
 		return err
@@ -76,7 +77,7 @@ func (f *fsm) readCommand() error {
 		if len(fields) < 2 {
 			return ProtocolErr
 		}
-		f.transitionTo(true, f.handleGet(fields[1]))
+		f.transitionTo(true, f.handleGet(fields[1], commandSize(fields), len(fields)-1))
 		return nil
 	default:
 		f.transitionTo(true, f.discardResponse)
@@ -84,7 +85,18 @@ func (f *fsm) readCommand() error {
 	return nil
 }
 
-func (f *fsm) handleGet(key []byte) func() error {
+// commandSize returns the length of the RESP encoding of a command, an array
+// of bulk strings.  Arguments longer than maxCommandSize are truncated by the
+// parser, so the size of commands carrying large values is underestimated.
+func commandSize(fields [][]byte) int {
+	n := 1 + len(strconv.Itoa(len(fields))) + 2
+	for _, field := range fields {
+		n += 1 + len(strconv.Itoa(len(field))) + 2 + len(field) + 2
+	}
+	return n
+}
+
+func (f *fsm) handleGet(key []byte, requestSize int, batchSize int) func() error {
 	return func() error {
 		err := f.parser.Run()
 		if err != nil {
@@ -93,14 +105,18 @@ func (f *fsm) handleGet(key []byte) func() error {
 		res := f.parser.Result()
 		if res == nil {
 			f.consumer.AddEvent(model.Event{
-				Type: model.EventGetMiss,
-				Key:  string(key),
+				Type:        model.EventGetMiss,
+				Key:         string(key),
+				RequestSize: requestSize,
+				BatchSize:   batchSize,
 			})
 		} else {
 			f.consumer.AddEvent(model.Event{
-				Type: model.EventGetHit,
-				Key:  string(key),
-				Size: res.(int),
+				Type:        model.EventGetHit,
+				Key:         string(key),
+				Size:        res.(int),
+				RequestSize: requestSize,
+				BatchSize:   batchSize,
 			})
 		}
 		f.transitionTo(false, f.readCommand)
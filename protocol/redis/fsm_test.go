@@ -27,6 +27,9 @@ func TestBasicGet(t *testing.T) {
 			Type: model.EventGetHit,
 			Key:  "key1",
 			Size: 5,
+			// *2 $3 get $4 key1, each followed by CRLF
+			RequestSize: 23,
+			BatchSize:   1,
 		},
 	}
 	test(t, input, output, expected)
@@ -58,6 +61,9 @@ func TestIgnoreUnknown(t *testing.T) {
 			Type: model.EventGetHit,
 			Key:  "hello",
 			Size: 5,
+			// *2 $3 GET $5 hello, each followed by CRLF
+			RequestSize: 24,
+			BatchSize:   1,
 		},
 	}
 
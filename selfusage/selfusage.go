@@ -0,0 +1,144 @@
+// Package selfusage measures the resources memsniff itself uses, so that the
+// cost of leaving it running on a busy host can be judged.  Memory and CPU are
+// read from /proc/self/stat, and are unknown where it is unavailable, as on
+// hosts other than Linux.  Garbage collection and goroutines are read from
+// the Go runtime, which stops the world briefly, so a Meter is sampled only
+// once per interval.
+package selfusage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/box/memsniff/log"
+)
+
+// userHZ is the rate of the clock ticks in which /proc/self/stat measures CPU
+// time, which is 100 on every Linux platform Go supports.
+const userHZ = 100
+
+var errStat = errors.New("malformed /proc/self/stat")
+
+// Usage is the resources used by the process.
+type Usage struct {
+	// RSS is the resident set size in bytes, and CPU the percentage of one
+	// core used over the last interval.  Both are 0 where
+	// /proc/self/stat is unavailable.
+	RSS int64
+	CPU float64
+	// GCPause is the total time the process has been paused for garbage
+	// collection since it started.
+	GCPause time.Duration
+	// Goroutines is the number of goroutines running.
+	Goroutines int
+	// OverLimit is true if CPU exceeded the limit of the Meter.
+	OverLimit bool
+}
+
+// Meter samples the Usage of the process.  Meter is threadsafe.
+type Meter struct {
+	logger log.Logger
+	// limit is the CPU percentage above which a warning is logged, or 0
+	// for none.
+	limit float64
+	now   func() time.Time
+	// readStat returns the contents of /proc/self/stat.
+	readStat func() ([]byte, error)
+
+	mu    sync.Mutex
+	usage Usage
+	// cpu is the CPU time used as of at, when last sampled.
+	cpu time.Duration
+	at  time.Time
+}
+
+// New returns a Meter measuring CPU from now, which logs a warning to logger
+// when an interval uses more than cpuLimit percent of one core, unless
+// cpuLimit is 0.
+func New(logger log.Logger, cpuLimit float64) *Meter {
+	m := &Meter{
+		logger:   logger,
+		limit:    cpuLimit,
+		now:      time.Now,
+		readStat: func() ([]byte, error) { return ioutil.ReadFile("/proc/self/stat") },
+	}
+	m.at = m.now()
+	if data, err := m.readStat(); err == nil {
+		m.cpu, _, _ = parseStat(data)
+	}
+	return m
+}
+
+// Sample measures the Usage of the process, with CPU over the period since the
+// previous call, and returns it.
+func (m *Meter) Sample() Usage {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	u := Usage{
+		GCPause:    time.Duration(ms.PauseTotalNs),
+		Goroutines: runtime.NumGoroutine(),
+	}
+	if data, err := m.readStat(); err == nil {
+		if cpu, rss, err := parseStat(data); err == nil {
+			if elapsed := now.Sub(m.at); elapsed > 0 {
+				u.CPU = float64(cpu-m.cpu) / float64(elapsed) * 100
+			}
+			u.RSS = rss
+			m.cpu = cpu
+		}
+	}
+	m.at = now
+	u.OverLimit = m.limit > 0 && u.CPU > m.limit
+	if u.OverLimit && !m.usage.OverLimit && m.logger != nil {
+		m.logger.Log(fmt.Sprintf("Warning: memsniff used %.0f%% CPU over the last interval (over %g%%)", u.CPU, m.limit))
+	}
+	m.usage = u
+	return u
+}
+
+// Last returns the Usage measured by the most recent call to Sample, or the
+// zero Usage if there has been none.
+func (m *Meter) Last() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// parseStat returns the CPU time, user and system, and the resident set size
+// in bytes recorded in the contents of /proc/self/stat.
+func parseStat(data []byte) (cpu time.Duration, rss int64, err error) {
+	// the command name in parentheses may itself contain spaces and
+	// parentheses
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return 0, 0, errStat
+	}
+	// fields from the third, the state, onward
+	fields := bytes.Fields(data[end+1:])
+	if len(fields) < 22 {
+		return 0, 0, errStat
+	}
+	var ticks [2]int64
+	for i, f := range fields[11:13] {
+		if ticks[i], err = strconv.ParseInt(string(f), 10, 64); err != nil {
+			return 0, 0, errStat
+		}
+	}
+	pages, err := strconv.ParseInt(string(fields[21]), 10, 64)
+	if err != nil {
+		return 0, 0, errStat
+	}
+	cpu = time.Duration(ticks[0]+ticks[1]) * time.Second / userHZ
+	return cpu, pages * int64(os.Getpagesize()), nil
+}
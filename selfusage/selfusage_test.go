@@ -0,0 +1,64 @@
+package selfusage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stat is /proc/self/stat of a process with a command name containing spaces
+// and parentheses, having used 250 ticks of user and 50 of system CPU time,
+// with 1000 pages resident.
+const stat = "1234 (mem sniff (x)) S 1 1234 1234 0 -1 4194560 500 0 0 0 250 50 0 0 20 0 12 0 100 123456789 1000 18446744073709551615"
+
+func TestParseStat(t *testing.T) {
+	cpu, rss, err := parseStat([]byte(stat))
+	if err != nil || cpu != 3*time.Second || rss != 1000*int64(os.Getpagesize()) {
+		t.Error(cpu, rss, err)
+	}
+	for _, bad := range []string{"", "1234 (memsniff) S 1", strings.Replace(stat, " 250 ", " x ", 1)} {
+		if _, _, err := parseStat([]byte(bad)); err != errStat {
+			t.Errorf("%q: %v", bad, err)
+		}
+	}
+}
+
+type testLogger []string
+
+func (tl *testLogger) Log(items ...interface{}) {
+	*tl = append(*tl, fmt.Sprint(items...))
+}
+
+// TestMeter checks that CPU is measured over each interval, warning once per
+// run of intervals over the limit.
+func TestMeter(t *testing.T) {
+	var logged testLogger
+	now := time.Date(2017, 6, 1, 9, 0, 0, 0, time.UTC)
+	ticks := 0
+	m := &Meter{logger: &logged, limit: 50, now: func() time.Time { return now }, at: now}
+	m.readStat = func() ([]byte, error) {
+		return []byte(strings.Replace(stat, " 250 50 ", fmt.Sprintf(" %d 0 ", ticks), 1)), nil
+	}
+	for i, busy := range []int{10, 80, 90, 20, 60} {
+		now, ticks = now.Add(time.Second), ticks+busy
+		u := m.Sample()
+		if u.CPU != float64(busy) || u.OverLimit != (busy > 50) || u.Goroutines == 0 {
+			t.Errorf("interval %d: %+v", i, u)
+		}
+		if m.Last() != u {
+			t.Errorf("interval %d: last %+v", i, m.Last())
+		}
+	}
+	if len(logged) != 2 || logged[0] != "Warning: memsniff used 80% CPU over the last interval (over 50%)" {
+		t.Error(logged)
+	}
+
+	// without /proc, memory and CPU are unknown
+	m.readStat = func() ([]byte, error) { return nil, errors.New("no /proc") }
+	if u := m.Sample(); u.RSS != 0 || u.CPU != 0 || u.OverLimit || u.Goroutines == 0 {
+		t.Error(u)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// uiMode is a way of presenting reports.
+type uiMode int
+
+const (
+	// uiTermbox is the interactive interface.
+	uiTermbox uiMode = iota
+	// uiText writes reports to stdout, in the format set by --output.
+	uiText
+)
+
+// fallbackTextRows limits the keys in each text report when the text mode is
+// chosen automatically, since an unlimited report every interval would bury
+// anything else written to the same log.  --text-rows overrides it.
+const fallbackTextRows = 50
+
+var errUIName = errors.New("--ui must be auto, termbox, or text")
+
+// uiChoice is how reports are to be presented.
+type uiChoice struct {
+	mode uiMode
+	// forced is true if the user chose the mode, so that the interactive
+	// interface being unavailable is an error rather than a reason to fall
+	// back to text.
+	forced bool
+	// reason explains why text was chosen automatically, or is empty.
+	reason string
+}
+
+// chooseUI decides how to present reports from the --ui and --nogui flags,
+// the TERM environment variable, and whether stdout is a terminal.  Apart from
+// falling back to text when the interactive interface fails to start, which
+// fallback does, this is the only place the mode is decided.
+func chooseUI(ui string, noGui bool, term string, stdoutTTY bool) (uiChoice, error) {
+	switch {
+	case ui == "text" || noGui:
+		return uiChoice{mode: uiText, forced: true}, nil
+	case ui == "termbox":
+		return uiChoice{mode: uiTermbox, forced: true}, nil
+	case ui != "auto":
+		return uiChoice{}, errUIName
+	case !stdoutTTY:
+		return uiChoice{mode: uiText, reason: "standard output is not a terminal"}, nil
+	case term == "" || term == "dumb":
+		return uiChoice{mode: uiText, reason: fmt.Sprintf("TERM is %q", term)}, nil
+	}
+	return uiChoice{mode: uiTermbox}, nil
+}
+
+// fallback returns the choice after the interactive interface failed to start
+// with err, and whether to carry on in text mode.
+func (c uiChoice) fallback(err error) (uiChoice, bool) {
+	if c.forced {
+		return c, false
+	}
+	return uiChoice{mode: uiText, reason: err.Error()}, true
+}
+
+// notice is the message explaining an automatic choice of text mode, or the
+// empty string.
+func (c uiChoice) notice() string {
+	if c.mode != uiText || c.reason == "" {
+		return ""
+	}
+	return fmt.Sprintf("Writing text reports instead of the interactive interface: %s (use --ui=termbox to insist, or --ui=text to silence this)", c.reason)
+}
+
+// isTerminal returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
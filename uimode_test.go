@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChooseUI(t *testing.T) {
+	cases := []struct {
+		ui        string
+		noGui     bool
+		term      string
+		stdoutTTY bool
+		expected  uiChoice
+	}{
+		{"auto", false, "xterm", true, uiChoice{mode: uiTermbox}},
+		{"auto", false, "xterm", false, uiChoice{mode: uiText, reason: "standard output is not a terminal"}},
+		{"auto", false, "dumb", true, uiChoice{mode: uiText, reason: `TERM is "dumb"`}},
+		{"auto", false, "", true, uiChoice{mode: uiText, reason: `TERM is ""`}},
+		{"auto", true, "xterm", true, uiChoice{mode: uiText, forced: true}},
+		{"text", false, "xterm", true, uiChoice{mode: uiText, forced: true}},
+		{"termbox", false, "dumb", false, uiChoice{mode: uiTermbox, forced: true}},
+	}
+	for _, c := range cases {
+		choice, err := chooseUI(c.ui, c.noGui, c.term, c.stdoutTTY)
+		if err != nil || choice != c.expected {
+			t.Errorf("%+v: %+v, %v", c, choice, err)
+		}
+	}
+	if _, err := chooseUI("curses", false, "xterm", true); err != errUIName {
+		t.Error(err)
+	}
+}
+
+func TestUIFallback(t *testing.T) {
+	initErr := errors.New("terminal not supported")
+	choice, ok := uiChoice{mode: uiTermbox}.fallback(initErr)
+	if !ok || choice.mode != uiText || !strings.Contains(choice.notice(), "terminal not supported") {
+		t.Error(choice, ok)
+	}
+	if _, ok := (uiChoice{mode: uiTermbox, forced: true}).fallback(initErr); ok {
+		t.Error("forced interactive interface fell back to text")
+	}
+	if notice := (uiChoice{mode: uiText, forced: true}).notice(); notice != "" {
+		t.Error("notice for text chosen by the user:", notice)
+	}
+}